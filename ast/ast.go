@@ -2,6 +2,8 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/riadafridishibly/go-monkey/token"
@@ -28,9 +30,32 @@ type Program struct {
 
 // String implements Node.
 func (p *Program) String() string {
+	return joinStatements(p.Statements)
+}
+
+// parenthesized returns the source of e in parentheses, as the conditions
+// of if expressions and while loops are written. Operator expressions print
+// their own.
+func parenthesized(e Expression) string {
+	switch e.(type) {
+	case *PrefixExpression, *InfixExpression, *AssignExpression:
+		return e.String()
+	}
+	return "(" + e.String() + ")"
+}
+
+// joinStatements returns the source of list, with the statements separated
+// by semicolons where they do not end with one already.
+func joinStatements(list []Statement) string {
 	sb := strings.Builder{}
-	for _, s := range p.Statements {
+	for i, s := range list {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
 		sb.WriteString(s.String())
+		if i < len(list)-1 && !strings.HasSuffix(s.String(), ";") {
+			sb.WriteString(";")
+		}
 	}
 	return sb.String()
 }
@@ -45,9 +70,12 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// LetStatement binds Name to Value. Name is an identifier, or an array or
+// hash pattern binding the parts of Value to the names it holds.
 type LetStatement struct {
 	Token token.Token // token.LET
-	Name  *Identifier
+	Name  Pattern
+	Type  TypeExpr // nil if Name is not annotated
 	Value Expression
 }
 
@@ -57,6 +85,9 @@ func (ls *LetStatement) String() string {
 
 	sb.WriteString(ls.TokenLiteral() + " ")
 	sb.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		sb.WriteString(": " + ls.Type.String())
+	}
 	sb.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -73,6 +104,33 @@ var _ Statement = (*LetStatement)(nil)
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// ConstStatement binds Name to Value like a let statement, but Name can
+// not be assigned to afterwards.
+type ConstStatement struct {
+	Token token.Token // token.CONST
+	Name  *Identifier
+	Type  TypeExpr // nil if Name is not annotated
+	Value Expression
+}
+
+// String implements Statement.
+func (cs *ConstStatement) String() string {
+	name := cs.Name.String()
+	if cs.Type != nil {
+		name += ": " + cs.Type.String()
+	}
+	value := ""
+	if cs.Value != nil {
+		value = cs.Value.String()
+	}
+	return cs.TokenLiteral() + " " + name + " = " + value + ";"
+}
+
+var _ Statement = (*ConstStatement)(nil)
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+
 type Identifier struct {
 	Token token.Token // token.IDENT
 	Value string
@@ -88,6 +146,10 @@ var _ Expression = (*Identifier)(nil)
 func (ident *Identifier) expressionNode()      {}
 func (ident *Identifier) TokenLiteral() string { return ident.Token.Literal }
 
+// patternNode implements Pattern. An identifier pattern matches any value
+// and binds the name to it.
+func (ident *Identifier) patternNode() {}
+
 type ReturnStatement struct {
 	Token       token.Token // token.RETURN
 	ReturnValue Expression
@@ -116,6 +178,128 @@ func (r *ReturnStatement) statementNode() {}
 
 var _ Statement = (*ReturnStatement)(nil)
 
+// ImportStatement binds Name to the module loaded from Path.
+type ImportStatement struct {
+	Token token.Token // token.IMPORT
+	Path  *StringLiteral
+	Name  *Identifier
+}
+
+// String implements Statement.
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + is.Path.String() + " as " + is.Name.String() + ";"
+}
+
+var _ Statement = (*ImportStatement)(nil)
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+
+// ExportStatement makes the name bound by Binding, a *LetStatement or a
+// *ConstStatement, visible to the programs importing the module.
+type ExportStatement struct {
+	Token   token.Token // token.EXPORT
+	Binding Statement
+}
+
+// String implements Statement.
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Binding.String()
+}
+
+var _ Statement = (*ExportStatement)(nil)
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+
+// ThrowStatement raises Value as an exception.
+type ThrowStatement struct {
+	Token token.Token // token.THROW
+	Value Expression
+}
+
+// String implements Statement.
+func (t *ThrowStatement) String() string {
+	return t.TokenLiteral() + " " + t.Value.String() + ";"
+}
+
+// TokenLiteral implements Statement.
+func (t *ThrowStatement) TokenLiteral() string {
+	return t.Token.Literal
+}
+
+// statementNode implements Statement.
+func (t *ThrowStatement) statementNode() {}
+
+var _ Statement = (*ThrowStatement)(nil)
+
+// WhileStatement runs Body as long as Condition is truthy.
+type WhileStatement struct {
+	Token     token.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+// String implements Statement.
+func (w *WhileStatement) String() string {
+	return "while " + parenthesized(w.Condition) + " { " + w.Body.String() + " }"
+}
+
+// TokenLiteral implements Statement.
+func (w *WhileStatement) TokenLiteral() string {
+	return w.Token.Literal
+}
+
+// statementNode implements Statement.
+func (w *WhileStatement) statementNode() {}
+
+var _ Statement = (*WhileStatement)(nil)
+
+// ForStatement runs Body once for every element of an array, key of a
+// hash or character of a string, bound to Variable in the scope of Body.
+type ForStatement struct {
+	Token    token.Token // token.FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+// String implements Statement.
+func (f *ForStatement) String() string {
+	return "for (" + f.Variable.String() + " in " + f.Iterable.String() + ") { " + f.Body.String() + " }"
+}
+
+// TokenLiteral implements Statement.
+func (f *ForStatement) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+// statementNode implements Statement.
+func (f *ForStatement) statementNode() {}
+
+var _ Statement = (*ForStatement)(nil)
+
+// BranchStatement is a break or continue statement, which jumps out of the
+// innermost loop or to its next iteration.
+type BranchStatement struct {
+	Token token.Token // token.BREAK or token.CONTINUE
+}
+
+// String implements Statement.
+func (b *BranchStatement) String() string {
+	return b.TokenLiteral() + ";"
+}
+
+// TokenLiteral implements Statement.
+func (b *BranchStatement) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// statementNode implements Statement.
+func (b *BranchStatement) statementNode() {}
+
+var _ Statement = (*BranchStatement)(nil)
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -157,8 +341,61 @@ func (i *InetegerLiteral) TokenLiteral() string {
 // expressionNode implements Expression.
 func (i *InetegerLiteral) expressionNode() {}
 
+// patternNode implements Pattern.
+func (i *InetegerLiteral) patternNode() {}
+
 var _ Expression = (*InetegerLiteral)(nil)
 
+// BigIntegerLiteral is an integer literal too large for an int64.
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+// String implements Expression.
+func (b *BigIntegerLiteral) String() string {
+	return b.Token.Literal
+}
+
+// TokenLiteral implements Expression.
+func (b *BigIntegerLiteral) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (b *BigIntegerLiteral) expressionNode() {}
+
+// patternNode implements Pattern.
+func (b *BigIntegerLiteral) patternNode() {}
+
+var _ Expression = (*BigIntegerLiteral)(nil)
+
+// DecimalLiteral is a decimal number like 12.50, whose value is
+// Unscaled × 10^-Scale.
+type DecimalLiteral struct {
+	Token    token.Token
+	Unscaled *big.Int
+	Scale    int
+}
+
+// String implements Expression.
+func (d *DecimalLiteral) String() string {
+	return d.Token.Literal
+}
+
+// TokenLiteral implements Expression.
+func (d *DecimalLiteral) TokenLiteral() string {
+	return d.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (d *DecimalLiteral) expressionNode() {}
+
+// patternNode implements Pattern.
+func (d *DecimalLiteral) patternNode() {}
+
+var _ Expression = (*DecimalLiteral)(nil)
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -212,3 +449,690 @@ func (i *InfixExpression) TokenLiteral() string {
 func (i *InfixExpression) expressionNode() {}
 
 var _ Expression = (*InfixExpression)(nil)
+
+// AssignExpression stores Value in Target, an *Identifier or an
+// *IndexExpression. Compound operators like "+=" combine the current value
+// of Target with Value first. The value of the expression is the value
+// stored.
+type AssignExpression struct {
+	Token    token.Token // the operator token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+// String implements Expression.
+func (a *AssignExpression) String() string {
+	return "(" + a.Target.String() + " " + a.Operator + " " + a.Value.String() + ")"
+}
+
+// TokenLiteral implements Expression.
+func (a *AssignExpression) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (a *AssignExpression) expressionNode() {}
+
+var _ Expression = (*AssignExpression)(nil)
+
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+// String implements Expression.
+func (b *Boolean) String() string {
+	return b.Token.Literal
+}
+
+// TokenLiteral implements Expression.
+func (b *Boolean) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (b *Boolean) expressionNode() {}
+
+// patternNode implements Pattern.
+func (b *Boolean) patternNode() {}
+
+var _ Expression = (*Boolean)(nil)
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+// String implements Expression.
+func (s *StringLiteral) String() string {
+	return strconv.Quote(s.Value)
+}
+
+// TokenLiteral implements Expression.
+func (s *StringLiteral) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (s *StringLiteral) expressionNode() {}
+
+// patternNode implements Pattern.
+func (s *StringLiteral) patternNode() {}
+
+var _ Expression = (*StringLiteral)(nil)
+
+// TemplateLiteral is a backtick string embedding expressions, as in
+// `${n} items`. Parts alternates between the text, as *StringLiteral, and the
+// embedded expressions, starting and ending with text, which may be empty.
+type TemplateLiteral struct {
+	Token token.Token // token.BACKTICK
+	Parts []Expression
+}
+
+// String implements Expression.
+func (t *TemplateLiteral) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("`")
+	for i, part := range t.Parts {
+		if i%2 == 1 {
+			sb.WriteString("${" + part.String() + "}")
+			continue
+		}
+		if text, ok := part.(*StringLiteral); ok {
+			sb.WriteString(templateEscaper.Replace(text.Value))
+		}
+	}
+	sb.WriteString("`")
+	return sb.String()
+}
+
+var templateEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+
+// TokenLiteral implements Expression.
+func (t *TemplateLiteral) TokenLiteral() string {
+	return t.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (t *TemplateLiteral) expressionNode() {}
+
+var _ Expression = (*TemplateLiteral)(nil)
+
+type BlockStatement struct {
+	Token      token.Token // token.LBRACE
+	Statements []Statement
+}
+
+// String implements Statement.
+func (b *BlockStatement) String() string {
+	return joinStatements(b.Statements)
+}
+
+// TokenLiteral implements Statement.
+func (b *BlockStatement) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// statementNode implements Statement.
+func (b *BlockStatement) statementNode() {}
+
+var _ Statement = (*BlockStatement)(nil)
+
+type IfExpression struct {
+	Token       token.Token // token.IF
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+// String implements Expression.
+func (i *IfExpression) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("if ")
+	sb.WriteString(parenthesized(i.Condition))
+	sb.WriteString(" { ")
+	sb.WriteString(i.Consequence.String())
+	sb.WriteString(" }")
+	if i.Alternative != nil {
+		sb.WriteString(" else { ")
+		sb.WriteString(i.Alternative.String())
+		sb.WriteString(" }")
+	}
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (i *IfExpression) TokenLiteral() string {
+	return i.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (i *IfExpression) expressionNode() {}
+
+var _ Expression = (*IfExpression)(nil)
+
+// TryExpression evaluates Block. An exception raised there is bound to
+// CatchParam, if there is one, and handled by Catch; Finally runs in any
+// case. The value is the value of Block, or of Catch when an exception was
+// caught. At least one of Catch and Finally is set.
+type TryExpression struct {
+	Token      token.Token // token.TRY
+	Block      *BlockStatement
+	CatchParam *Identifier
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+// String implements Expression.
+func (t *TryExpression) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("try { ")
+	sb.WriteString(t.Block.String())
+	sb.WriteString(" }")
+	if t.Catch != nil {
+		sb.WriteString(" catch ")
+		if t.CatchParam != nil {
+			sb.WriteString("(" + t.CatchParam.String() + ") ")
+		}
+		sb.WriteString("{ ")
+		sb.WriteString(t.Catch.String())
+		sb.WriteString(" }")
+	}
+	if t.Finally != nil {
+		sb.WriteString(" finally { ")
+		sb.WriteString(t.Finally.String())
+		sb.WriteString(" }")
+	}
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (t *TryExpression) TokenLiteral() string {
+	return t.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (t *TryExpression) expressionNode() {}
+
+var _ Expression = (*TryExpression)(nil)
+
+type FunctionLiteral struct {
+	Token token.Token // token.FUNCTION
+	// Parameters are identifiers, or array and hash patterns destructuring
+	// the arguments like the names of let statements.
+	Parameters []Pattern
+	// ParameterTypes holds the annotations of the parameters, with nil for
+	// the parameters without one. It is nil if no parameter is annotated.
+	ParameterTypes []TypeExpr
+	// Defaults holds the default values of the parameters, with nil for the
+	// parameters without one. It is nil if no parameter has a default.
+	Defaults   []Expression
+	Rest       *Identifier // the rest parameter `...name`, nil if there is none
+	ReturnType TypeExpr    // nil if the result is not annotated
+	Body       *BlockStatement
+	Name       string // name of the let binding, if any
+}
+
+// String implements Expression.
+func (f *FunctionLiteral) String() string {
+	params := make([]string, 0, len(f.Parameters)+1)
+	for i, p := range f.Parameters {
+		param := p.String()
+		if f.ParameterTypes != nil && f.ParameterTypes[i] != nil {
+			param += ": " + f.ParameterTypes[i].String()
+		}
+		if f.Defaults != nil && f.Defaults[i] != nil {
+			param += " = " + f.Defaults[i].String()
+		}
+		params = append(params, param)
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(f.TokenLiteral())
+	sb.WriteString("(")
+	sb.WriteString(strings.Join(params, ", "))
+	sb.WriteString(")")
+	if f.ReturnType != nil {
+		sb.WriteString(": " + f.ReturnType.String())
+	}
+	sb.WriteString(" { ")
+	sb.WriteString(f.Body.String())
+	sb.WriteString(" }")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (f *FunctionLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (f *FunctionLiteral) expressionNode() {}
+
+var _ Expression = (*FunctionLiteral)(nil)
+
+// MacroLiteral is a macro, which is called with the unevaluated AST of its
+// arguments, as quotes, and returns the quote its call is replaced with.
+type MacroLiteral struct {
+	Token      token.Token // token.MACRO
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+// String implements Expression.
+func (m *MacroLiteral) String() string {
+	params := make([]string, 0, len(m.Parameters))
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	return m.TokenLiteral() + "(" + strings.Join(params, ", ") + ") { " + m.Body.String() + " }"
+}
+
+// TokenLiteral implements Expression.
+func (m *MacroLiteral) TokenLiteral() string {
+	return m.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (m *MacroLiteral) expressionNode() {}
+
+var _ Expression = (*MacroLiteral)(nil)
+
+type CallExpression struct {
+	Token          token.Token // token.LPAREN
+	Function       Expression  // Identifier or FunctionLiteral
+	Arguments      []Expression
+	NamedArguments []NamedArgument // `name: value` arguments, after the others
+}
+
+// NamedArgument is an argument passed to the parameter of the given name.
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
+}
+
+// String implements Expression.
+func (c *CallExpression) String() string {
+	args := make([]string, 0, len(c.Arguments)+len(c.NamedArguments))
+	for _, a := range c.Arguments {
+		args = append(args, a.String())
+	}
+	for _, a := range c.NamedArguments {
+		args = append(args, a.Name.String()+": "+a.Value.String())
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(c.Function.String())
+	sb.WriteString("(")
+	sb.WriteString(strings.Join(args, ", "))
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (c *CallExpression) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (c *CallExpression) expressionNode() {}
+
+var _ Expression = (*CallExpression)(nil)
+
+type ArrayLiteral struct {
+	Token    token.Token // token.LBRACKET
+	Elements []Expression
+}
+
+// String implements Expression.
+func (a *ArrayLiteral) String() string {
+	elements := make([]string, 0, len(a.Elements))
+	for _, e := range a.Elements {
+		elements = append(elements, e.String())
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("[")
+	sb.WriteString(strings.Join(elements, ", "))
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (a *ArrayLiteral) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (a *ArrayLiteral) expressionNode() {}
+
+var _ Expression = (*ArrayLiteral)(nil)
+
+type IndexExpression struct {
+	Token token.Token // token.LBRACKET
+	Left  Expression
+	Index Expression
+}
+
+// String implements Expression.
+func (i *IndexExpression) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("(")
+	sb.WriteString(i.Left.String())
+	sb.WriteString("[")
+	sb.WriteString(i.Index.String())
+	sb.WriteString("])")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (i *IndexExpression) TokenLiteral() string {
+	return i.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (i *IndexExpression) expressionNode() {}
+
+var _ Expression = (*IndexExpression)(nil)
+
+// HashPair is a single `key: value` entry of a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+type HashLiteral struct {
+	Token token.Token // token.LBRACE
+	Pairs []HashPair  // in source order
+}
+
+// String implements Expression.
+func (h *HashLiteral) String() string {
+	pairs := make([]string, 0, len(h.Pairs))
+	for _, p := range h.Pairs {
+		pairs = append(pairs, p.Key.String()+": "+p.Value.String())
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("{")
+	sb.WriteString(strings.Join(pairs, ", "))
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (h *HashLiteral) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (h *HashLiteral) expressionNode() {}
+
+var _ Expression = (*HashLiteral)(nil)
+
+// MatchExpression compares Subject with the patterns of its arms in order.
+// The first arm whose pattern matches and whose guard, if any, is true
+// gives the value of the expression.
+type MatchExpression struct {
+	Token   token.Token // token.MATCH
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm is a single `pattern if guard => body` arm of a MatchExpression.
+// The names bound by the pattern are visible in the guard and the body.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression // nil if the arm has no guard
+	Body    *BlockStatement
+}
+
+// String implements Expression.
+func (m *MatchExpression) String() string {
+	arms := make([]string, 0, len(m.Arms))
+	for _, arm := range m.Arms {
+		s := arm.Pattern.String()
+		if arm.Guard != nil {
+			s += " if " + arm.Guard.String()
+		}
+		arms = append(arms, s+" => { "+arm.Body.String()+" }")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("match (")
+	sb.WriteString(m.Subject.String())
+	sb.WriteString(") { ")
+	sb.WriteString(strings.Join(arms, ", "))
+	sb.WriteString(" }")
+	return sb.String()
+}
+
+// TokenLiteral implements Expression.
+func (m *MatchExpression) TokenLiteral() string {
+	return m.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (m *MatchExpression) expressionNode() {}
+
+var _ Expression = (*MatchExpression)(nil)
+
+// Pattern is the shape of a value: a literal, which matches values equal
+// to it, an identifier, which matches anything and binds its name to it,
+// the wildcard `_`, or an array or hash pattern.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+var (
+	_ Pattern = (*Identifier)(nil)
+	_ Pattern = (*InetegerLiteral)(nil)
+	_ Pattern = (*BigIntegerLiteral)(nil)
+	_ Pattern = (*DecimalLiteral)(nil)
+	_ Pattern = (*Boolean)(nil)
+	_ Pattern = (*StringLiteral)(nil)
+)
+
+// WildcardPattern is the pattern `_`, which matches anything.
+type WildcardPattern struct {
+	Token token.Token // token.IDENT
+}
+
+// String implements Pattern.
+func (w *WildcardPattern) String() string {
+	return "_"
+}
+
+// TokenLiteral implements Pattern.
+func (w *WildcardPattern) TokenLiteral() string {
+	return w.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (w *WildcardPattern) patternNode() {}
+
+var _ Pattern = (*WildcardPattern)(nil)
+
+// ArrayPattern matches arrays of as many elements as it has, each matching
+// the pattern in its place. With a Rest pattern, written `...rest` after
+// the elements, it matches longer arrays too, and Rest matches the array of
+// the remaining elements.
+type ArrayPattern struct {
+	Token    token.Token // token.LBRACKET
+	Elements []Pattern
+	Rest     Pattern // nil, an *Identifier or a *WildcardPattern
+}
+
+// String implements Pattern.
+func (a *ArrayPattern) String() string {
+	elements := make([]string, 0, len(a.Elements)+1)
+	for _, e := range a.Elements {
+		elements = append(elements, e.String())
+	}
+	if a.Rest != nil {
+		elements = append(elements, "..."+a.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// TokenLiteral implements Pattern.
+func (a *ArrayPattern) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (a *ArrayPattern) patternNode() {}
+
+var _ Pattern = (*ArrayPattern)(nil)
+
+// HashPatternPair is a single `key: pattern` entry of a HashPattern. Key is
+// an integer, boolean or string literal. The shorthand `name` stands for
+// `"name": name`.
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+// HashPattern matches hashes that have all of its keys, with values that
+// match their patterns. The hashes may have other keys too.
+type HashPattern struct {
+	Token token.Token // token.LBRACE
+	Pairs []HashPatternPair
+}
+
+// String implements Pattern.
+func (h *HashPattern) String() string {
+	pairs := make([]string, 0, len(h.Pairs))
+	for _, p := range h.Pairs {
+		key, ok := p.Key.(*StringLiteral)
+		if name, isName := p.Value.(*Identifier); ok && isName && key.Value == name.Value {
+			pairs = append(pairs, name.String())
+			continue
+		}
+		pairs = append(pairs, p.Key.String()+": "+p.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// TokenLiteral implements Pattern.
+func (h *HashPattern) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (h *HashPattern) patternNode() {}
+
+var _ Pattern = (*HashPattern)(nil)
+
+// PatternNames returns the identifiers a pattern binds, in source order.
+func PatternNames(p Pattern) []*Identifier {
+	var names []*Identifier
+	Inspect(p, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			names = append(names, ident)
+		}
+		return true
+	})
+	return names
+}
+
+// TypeExpr is a type annotation.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// NamedType is a type named by an identifier, like int or string.
+type NamedType struct {
+	Token token.Token // token.IDENT
+	Name  string
+}
+
+// String implements TypeExpr.
+func (n *NamedType) String() string {
+	return n.Name
+}
+
+// TokenLiteral implements TypeExpr.
+func (n *NamedType) TokenLiteral() string {
+	return n.Token.Literal
+}
+
+// typeNode implements TypeExpr.
+func (n *NamedType) typeNode() {}
+
+var _ TypeExpr = (*NamedType)(nil)
+
+// ArrayType is the type [Element] of arrays.
+type ArrayType struct {
+	Token   token.Token // token.LBRACKET
+	Element TypeExpr
+}
+
+// String implements TypeExpr.
+func (a *ArrayType) String() string {
+	return "[" + a.Element.String() + "]"
+}
+
+// TokenLiteral implements TypeExpr.
+func (a *ArrayType) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// typeNode implements TypeExpr.
+func (a *ArrayType) typeNode() {}
+
+var _ TypeExpr = (*ArrayType)(nil)
+
+// HashType is the type {Key: Value} of hashes.
+type HashType struct {
+	Token token.Token // token.LBRACE
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+// String implements TypeExpr.
+func (h *HashType) String() string {
+	return "{" + h.Key.String() + ": " + h.Value.String() + "}"
+}
+
+// TokenLiteral implements TypeExpr.
+func (h *HashType) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+// typeNode implements TypeExpr.
+func (h *HashType) typeNode() {}
+
+var _ TypeExpr = (*HashType)(nil)
+
+// FunctionType is the type fn(Parameters): Result of functions.
+type FunctionType struct {
+	Token      token.Token // token.FUNCTION
+	Parameters []TypeExpr
+	Result     TypeExpr
+}
+
+// String implements TypeExpr.
+func (f *FunctionType) String() string {
+	params := make([]string, 0, len(f.Parameters))
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + "): " + f.Result.String()
+}
+
+// TokenLiteral implements TypeExpr.
+func (f *FunctionType) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+// typeNode implements TypeExpr.
+func (f *FunctionType) typeNode() {}
+
+var _ TypeExpr = (*FunctionType)(nil)
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/riadafridishibly/go-monkey/token"
@@ -38,3 +39,145 @@ func TestString(t *testing.T) {
 		t.Errorf("prog.String() wrong. got=%q", prog.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	prog := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &CallExpression{
+					Function: ident("add"),
+					Arguments: []Expression{
+						ident("a"),
+						&PrefixExpression{Operator: "-", Right: ident("b")},
+					},
+				},
+			},
+		},
+	}
+
+	var names []string
+	Inspect(prog, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		// skip the operand of prefix expressions
+		_, prefix := n.(*PrefixExpression)
+		return !prefix
+	})
+
+	if strings.Join(names, ",") != "add,a" {
+		t.Errorf("wrong identifiers visited. got=%v", names)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &InetegerLiteral{Token: token.Token{Literal: "1"}, Value: 1} }
+	two := func() Expression { return &InetegerLiteral{Token: token.Token{Literal: "2"}, Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*InetegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return two()
+	}
+
+	tests := []struct {
+		input    Node
+		expected string
+	}{
+		{one(), "2"},
+		{&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}}, "2"},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, "(2 + 2)"},
+		{&PrefixExpression{Operator: "-", Right: one()}, "(-2)"},
+		{&IndexExpression{Left: one(), Index: one()}, "(2[2])"},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{&ReturnStatement{Token: token.Token{Literal: "return"}, ReturnValue: one()}},
+				},
+			},
+			"if (2) { 2 } else { return 2; }",
+		},
+		{
+			&LetStatement{Token: token.Token{Literal: "let"}, Name: &Identifier{Value: "x"}, Value: one()},
+			"let x = 2;",
+		},
+		{
+			&FunctionLiteral{
+				Token: token.Token{Literal: "fn"},
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			"fn() { 2 }",
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, "[2, 2]"},
+		{&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}}, "{2: 2}"},
+		{&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}}, "f(2)"},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if modified.String() != tt.expected {
+			t.Errorf("not modified. expected=%q, got=%q", tt.expected, modified.String())
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	one := &InetegerLiteral{Token: token.Token{Literal: "1"}, Value: 1}
+	param := &Identifier{Value: "x"}
+	fn := &FunctionLiteral{
+		Token:      token.Token{Literal: "fn"},
+		Parameters: []Pattern{param, &Identifier{Value: "y"}},
+		Defaults:   []Expression{nil, one},
+		Rest:       &Identifier{Value: "r"},
+		Body: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &InfixExpression{Left: param, Operator: "+", Right: one}},
+		}},
+	}
+	prog := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Literal: "let"}, Name: &Identifier{Value: "f"}, Value: fn},
+		&ExpressionStatement{Expression: &HashLiteral{Pairs: []HashPair{{Key: one, Value: &ArrayLiteral{Elements: []Expression{one}}}}}},
+		&ExpressionStatement{Expression: &CallExpression{
+			Function:       &Identifier{Value: "f"},
+			NamedArguments: []NamedArgument{{Name: &Identifier{Value: "y"}, Value: one}},
+		}},
+	}}
+
+	copied := Copy(prog)
+	if copied.String() != prog.String() {
+		t.Fatalf("copy differs. want=%q, got=%q", prog.String(), copied.String())
+	}
+
+	shared := map[Node]bool{}
+	Inspect(prog, func(n Node) bool {
+		shared[n] = true
+		return true
+	})
+	Inspect(copied, func(n Node) bool {
+		if n != nil && shared[n] {
+			t.Errorf("node %T %q is shared with the original", n, n)
+		}
+		return true
+	})
+
+	Modify(copied, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok {
+			ident.Value = "y"
+		}
+		return node
+	})
+	if prog.String() != "let f = fn(x, y = 1, ...r) { (x + 1) }; {1: [1]}; f(y: 1)" {
+		t.Errorf("original modified: %q", prog.String())
+	}
+}
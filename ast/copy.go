@@ -0,0 +1,294 @@
+package ast
+
+import "fmt"
+
+// Copy returns a deep copy of node, which shares no node with the original
+// and can be modified without changing it. Tokens are copied as they are,
+// so the copy keeps the positions of the original.
+func Copy(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(n.Statements)}
+	case *BlockStatement:
+		c := *n
+		c.Statements = copyStatements(n.Statements)
+		return &c
+	case *LetStatement:
+		c := *n
+		c.Name = copyPattern(n.Name)
+		c.Type = copyType(n.Type)
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *ConstStatement:
+		c := *n
+		c.Name = copyIdentifier(n.Name)
+		c.Type = copyType(n.Type)
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = copyExpression(n.ReturnValue)
+		return &c
+	case *ImportStatement:
+		c := *n
+		path := *n.Path
+		c.Path = &path
+		c.Name = copyIdentifier(n.Name)
+		return &c
+	case *ExportStatement:
+		c := *n
+		c.Binding = Copy(n.Binding).(Statement)
+		return &c
+	case *ThrowStatement:
+		c := *n
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *WhileStatement:
+		c := *n
+		c.Condition = copyExpression(n.Condition)
+		c.Body = copyBlock(n.Body)
+		return &c
+	case *ForStatement:
+		c := *n
+		c.Variable = copyIdentifier(n.Variable)
+		c.Iterable = copyExpression(n.Iterable)
+		c.Body = copyBlock(n.Body)
+		return &c
+	case *BranchStatement:
+		c := *n
+		return &c
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = copyExpression(n.Expression)
+		return &c
+	case *Identifier:
+		return copyIdentifier(n)
+	case *InetegerLiteral:
+		c := *n
+		return &c
+	case *BigIntegerLiteral:
+		c := *n
+		return &c
+	case *DecimalLiteral:
+		c := *n
+		return &c
+	case *Boolean:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *TemplateLiteral:
+		c := *n
+		c.Parts = copyExpressions(n.Parts)
+		return &c
+	case *PrefixExpression:
+		c := *n
+		c.Right = copyExpression(n.Right)
+		return &c
+	case *InfixExpression:
+		c := *n
+		c.Left = copyExpression(n.Left)
+		c.Right = copyExpression(n.Right)
+		return &c
+	case *AssignExpression:
+		c := *n
+		c.Target = copyExpression(n.Target)
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *IfExpression:
+		c := *n
+		c.Condition = copyExpression(n.Condition)
+		c.Consequence = copyBlock(n.Consequence)
+		c.Alternative = copyBlock(n.Alternative)
+		return &c
+	case *TryExpression:
+		c := *n
+		c.Block = copyBlock(n.Block)
+		c.CatchParam = copyIdentifier(n.CatchParam)
+		c.Catch = copyBlock(n.Catch)
+		c.Finally = copyBlock(n.Finally)
+		return &c
+	case *FunctionLiteral:
+		c := *n
+		c.Parameters = copyPatterns(n.Parameters)
+		c.ParameterTypes = copyTypes(n.ParameterTypes)
+		c.Defaults = copyExpressions(n.Defaults)
+		c.Rest = copyIdentifier(n.Rest)
+		c.ReturnType = copyType(n.ReturnType)
+		c.Body = copyBlock(n.Body)
+		return &c
+	case *MacroLiteral:
+		c := *n
+		c.Parameters = copyIdentifiers(n.Parameters)
+		c.Body = copyBlock(n.Body)
+		return &c
+	case *CallExpression:
+		c := *n
+		c.Function = copyExpression(n.Function)
+		c.Arguments = copyExpressions(n.Arguments)
+		if n.NamedArguments != nil {
+			c.NamedArguments = make([]NamedArgument, len(n.NamedArguments))
+			for i, a := range n.NamedArguments {
+				c.NamedArguments[i] = NamedArgument{Name: copyIdentifier(a.Name), Value: copyExpression(a.Value)}
+			}
+		}
+		return &c
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = copyExpressions(n.Elements)
+		return &c
+	case *IndexExpression:
+		c := *n
+		c.Left = copyExpression(n.Left)
+		c.Index = copyExpression(n.Index)
+		return &c
+	case *HashLiteral:
+		c := *n
+		c.Pairs = make([]HashPair, len(n.Pairs))
+		for i, p := range n.Pairs {
+			c.Pairs[i] = HashPair{Key: copyExpression(p.Key), Value: copyExpression(p.Value)}
+		}
+		return &c
+	case *MatchExpression:
+		c := *n
+		c.Subject = copyExpression(n.Subject)
+		c.Arms = make([]*MatchArm, len(n.Arms))
+		for i, arm := range n.Arms {
+			c.Arms[i] = &MatchArm{
+				Pattern: copyPattern(arm.Pattern),
+				Guard:   copyExpression(arm.Guard),
+				Body:    copyBlock(arm.Body),
+			}
+		}
+		return &c
+	case *WildcardPattern:
+		c := *n
+		return &c
+	case *ArrayPattern:
+		c := *n
+		c.Elements = make([]Pattern, len(n.Elements))
+		for i, e := range n.Elements {
+			c.Elements[i] = copyPattern(e)
+		}
+		c.Rest = copyPattern(n.Rest)
+		return &c
+	case *HashPattern:
+		c := *n
+		c.Pairs = make([]HashPatternPair, len(n.Pairs))
+		for i, p := range n.Pairs {
+			c.Pairs[i] = HashPatternPair{Key: copyExpression(p.Key), Value: copyPattern(p.Value)}
+		}
+		return &c
+	case *NamedType:
+		c := *n
+		return &c
+	case *ArrayType:
+		c := *n
+		c.Element = copyType(n.Element)
+		return &c
+	case *HashType:
+		c := *n
+		c.Key = copyType(n.Key)
+		c.Value = copyType(n.Value)
+		return &c
+	case *FunctionType:
+		c := *n
+		c.Parameters = copyTypes(n.Parameters)
+		c.Result = copyType(n.Result)
+		return &c
+	default:
+		panic(fmt.Sprintf("ast.Copy: unexpected node type %T", n))
+	}
+}
+
+func copyStatements(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+	c := make([]Statement, len(list))
+	for i, s := range list {
+		c[i] = Copy(s).(Statement)
+	}
+	return c
+}
+
+func copyExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	c := make([]Expression, len(list))
+	for i, e := range list {
+		c[i] = copyExpression(e)
+	}
+	return c
+}
+
+func copyIdentifiers(list []*Identifier) []*Identifier {
+	if list == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(list))
+	for i, ident := range list {
+		c[i] = copyIdentifier(ident)
+	}
+	return c
+}
+
+func copyTypes(list []TypeExpr) []TypeExpr {
+	if list == nil {
+		return nil
+	}
+	c := make([]TypeExpr, len(list))
+	for i, t := range list {
+		c[i] = copyType(t)
+	}
+	return c
+}
+
+func copyType(typ TypeExpr) TypeExpr {
+	if typ == nil {
+		return nil
+	}
+	return Copy(typ).(TypeExpr)
+}
+
+func copyPatterns(list []Pattern) []Pattern {
+	if list == nil {
+		return nil
+	}
+	c := make([]Pattern, len(list))
+	for i, p := range list {
+		c[i] = copyPattern(p)
+	}
+	return c
+}
+
+func copyPattern(p Pattern) Pattern {
+	if p == nil {
+		return nil
+	}
+	return Copy(p).(Pattern)
+}
+
+func copyExpression(expr Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	return Copy(expr).(Expression)
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Copy(block).(*BlockStatement)
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
@@ -0,0 +1,132 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the replacement for node, or node itself to keep it.
+type ModifierFunc func(node Node) Node
+
+// Modify rewrites an AST bottom-up: the children of node are modified first,
+// then node itself is passed to modifier and the result is returned. Children
+// are replaced in place, so the original tree is changed too.
+//
+// Declared names, that is let, const and import names, function and macro
+// parameters, catch parameters and loop variables, are not passed to
+// modifier, and neither are match patterns, the names of named arguments,
+// the text of template literals, import paths and type annotations.
+// Replacements must fit the field they are stored in; a statement can not
+// take the place of an expression.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = modifyStatements(n.Statements, modifier)
+	case *BlockStatement:
+		n.Statements = modifyStatements(n.Statements, modifier)
+	case *LetStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ConstStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *ImportStatement:
+		// nothing to do
+	case *ExportStatement:
+		n.Binding = Modify(n.Binding, modifier).(Statement)
+	case *ThrowStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *WhileStatement:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *ForStatement:
+		n.Iterable = modifyExpression(n.Iterable, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *BranchStatement:
+		// nothing to do
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *Identifier, *InetegerLiteral, *BigIntegerLiteral, *DecimalLiteral, *Boolean, *StringLiteral:
+		// nothing to do
+	case *TemplateLiteral:
+		for i := 1; i < len(n.Parts); i += 2 {
+			n.Parts[i] = modifyExpression(n.Parts[i], modifier)
+		}
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *AssignExpression:
+		n.Target = modifyExpression(n.Target, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *TryExpression:
+		n.Block = modifyBlock(n.Block, modifier)
+		n.Catch = modifyBlock(n.Catch, modifier)
+		n.Finally = modifyBlock(n.Finally, modifier)
+	case *FunctionLiteral:
+		for i, d := range n.Defaults {
+			n.Defaults[i] = modifyExpression(d, modifier)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+	case *MacroLiteral:
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		n.Arguments = modifyExpressions(n.Arguments, modifier)
+		for i, a := range n.NamedArguments {
+			n.NamedArguments[i].Value = modifyExpression(a.Value, modifier)
+		}
+	case *ArrayLiteral:
+		n.Elements = modifyExpressions(n.Elements, modifier)
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *HashLiteral:
+		for i, p := range n.Pairs {
+			n.Pairs[i] = HashPair{
+				Key:   modifyExpression(p.Key, modifier),
+				Value: modifyExpression(p.Value, modifier),
+			}
+		}
+	case *MatchExpression:
+		n.Subject = modifyExpression(n.Subject, modifier)
+		for _, arm := range n.Arms {
+			arm.Guard = modifyExpression(arm.Guard, modifier)
+			arm.Body = modifyBlock(arm.Body, modifier)
+		}
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) []Statement {
+	for i, s := range list {
+		list[i] = Modify(s, modifier).(Statement)
+	}
+	return list
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) []Expression {
+	for i, e := range list {
+		list[i] = modifyExpression(e, modifier)
+	}
+	return list
+}
+
+func modifyExpression(expr Expression, modifier ModifierFunc) Expression {
+	if expr == nil {
+		return nil
+	}
+	return Modify(expr, modifier).(Expression)
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Modify(block, modifier).(*BlockStatement)
+}
@@ -0,0 +1,94 @@
+package ast
+
+import "github.com/riadafridishibly/go-monkey/token"
+
+// Pos returns the position of the first token of node. Infix and postfix
+// forms start with their left operand rather than their own token.
+func Pos(node Node) token.Position {
+	switch n := node.(type) {
+	case *Program:
+		if len(n.Statements) > 0 {
+			return Pos(n.Statements[0])
+		}
+		return token.Position{}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			return Pos(n.Expression)
+		}
+		return n.Token.Pos
+	case *LetStatement:
+		return n.Token.Pos
+	case *ConstStatement:
+		return n.Token.Pos
+	case *ReturnStatement:
+		return n.Token.Pos
+	case *ImportStatement:
+		return n.Token.Pos
+	case *ExportStatement:
+		return n.Token.Pos
+	case *ThrowStatement:
+		return n.Token.Pos
+	case *WhileStatement:
+		return n.Token.Pos
+	case *ForStatement:
+		return n.Token.Pos
+	case *BranchStatement:
+		return n.Token.Pos
+	case *BlockStatement:
+		return n.Token.Pos
+	case *Identifier:
+		return n.Token.Pos
+	case *InetegerLiteral:
+		return n.Token.Pos
+	case *BigIntegerLiteral:
+		return n.Token.Pos
+	case *DecimalLiteral:
+		return n.Token.Pos
+	case *Boolean:
+		return n.Token.Pos
+	case *StringLiteral:
+		return n.Token.Pos
+	case *TemplateLiteral:
+		return n.Token.Pos
+	case *PrefixExpression:
+		return n.Token.Pos
+	case *InfixExpression:
+		return Pos(n.Left)
+	case *AssignExpression:
+		return Pos(n.Target)
+	case *IfExpression:
+		return n.Token.Pos
+	case *TryExpression:
+		return n.Token.Pos
+	case *FunctionLiteral:
+		return n.Token.Pos
+	case *MacroLiteral:
+		return n.Token.Pos
+	case *MatchExpression:
+		return n.Token.Pos
+	case *WildcardPattern:
+		return n.Token.Pos
+	case *ArrayPattern:
+		return n.Token.Pos
+	case *HashPattern:
+		return n.Token.Pos
+	case *NamedType:
+		return n.Token.Pos
+	case *ArrayType:
+		return n.Token.Pos
+	case *HashType:
+		return n.Token.Pos
+	case *FunctionType:
+		return n.Token.Pos
+	case *CallExpression:
+		return Pos(n.Function)
+	case *ArrayLiteral:
+		return n.Token.Pos
+	case *IndexExpression:
+		return Pos(n.Left)
+	case *HashLiteral:
+		return n.Token.Pos
+	}
+
+	return token.Position{}
+}
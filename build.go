@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/bytecode"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/report"
+)
+
+func buildCommand(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "write the program to `file` (default: the source name with a .mkc extension)")
+	strip := flags.Bool("s", false, "omit the line table")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey build [-o file] [-s] file")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	filename := flags.Arg(0)
+
+	src, err := readSource(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %v\n", err)
+		return 1
+	}
+
+	bc, err := compileSource(src)
+	if err != nil {
+		report.Print(os.Stderr, filename, src, err)
+		return 1
+	}
+	if *strip {
+		bytecode.StripLines(bc)
+	}
+
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mkc"
+	}
+
+	var buf bytes.Buffer
+	if err := bytecode.Encode(&buf, &bytecode.File{Source: filename, Bytecode: bc}); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// compileSource parses, expands and compiles a program.
+func compileSource(src string) (*compiler.Bytecode, error) {
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		return nil, errs
+	}
+	prog, err := evaluator.Expand(prog)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(prog); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
+
+// loadProgram reads a compiled program, or compiles the source in the named
+// file. It also returns the source text when it is available, even when the
+// source does not compile.
+func loadProgram(filename string) (*bytecode.File, string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !bytecode.IsBytecode(data) {
+		bc, err := compileSource(string(data))
+		if err != nil {
+			return nil, string(data), err
+		}
+		return &bytecode.File{Source: filename, Bytecode: bc}, string(data), nil
+	}
+
+	f, err := bytecode.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", filename, err)
+	}
+
+	var src string
+	if f.Source != "" {
+		if data, err := os.ReadFile(f.Source); err == nil {
+			src = string(data)
+		}
+	}
+	return f, src, nil
+}
@@ -0,0 +1,719 @@
+// Package bytecode reads and writes compiled Monkey programs.
+//
+// A file starts with the magic bytes "MKC\x00", a big endian uint16 version
+// and a uint16 of flags. It is followed by the name of the source file, the
+// function prototypes, the constant pool and the instructions of the main
+// program. Counts and lengths are unsigned varints, integers signed varints
+// and strings a length followed by their bytes.
+//
+// A prototype holds the name, the number of locals and parameters, the
+// signature and the instructions of a compiled function. The signature is
+// the number of parameters, the name or pattern and the default value of
+// each, with "" for required parameters, and the name of the rest parameter,
+// "" if there is none. Constants are a tag byte followed by
+// the value; integers too large for an int64 and decimals are written as
+// strings of their digits, function constants refer to their prototype by
+// index.
+//
+// When FlagLines is set every set of instructions is followed by its line
+// table: the number of entries, then for each entry the offset relative to
+// the previous entry and the byte offset, line and column of the start and
+// of the end of the source span. Unknown ends are written as zeros.
+//
+// The file ends with the big endian CRC-32 (IEEE) of everything before it.
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/big"
+
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// Magic starts every compiled program.
+var Magic = []byte("MKC\x00")
+
+// Version is the version of the format written by Encode. Decode rejects
+// files of any other version.
+const Version = 5
+
+// Flags of the file header.
+const (
+	FlagLines = 1 << iota // instructions are followed by line tables
+)
+
+// Constant tags.
+const (
+	tagInteger  = 'i'
+	tagBigInt   = 'b'
+	tagDecimal  = 'd'
+	tagString   = 's'
+	tagFunction = 'f'
+)
+
+// ErrFormat is returned, wrapped, by Decode for malformed input.
+var ErrFormat = errors.New("malformed bytecode")
+
+// File is a compiled program along with the name of its source.
+type File struct {
+	Source   string
+	Bytecode *compiler.Bytecode
+}
+
+// IsBytecode reports whether data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// HasLines reports whether any instructions of bc have source positions.
+func HasLines(bc *compiler.Bytecode) bool {
+	if len(bc.Lines) > 0 {
+		return true
+	}
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok && len(fn.Lines) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// StripLines removes the line tables of bc and of its functions.
+func StripLines(bc *compiler.Bytecode) {
+	bc.Lines = nil
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Lines = nil
+		}
+	}
+}
+
+// Encode writes f to w. Line tables are written when the program has any.
+func Encode(w io.Writer, f *File) error {
+	bc := f.Bytecode
+	e := &encoder{w: bufio.NewWriter(w), sum: crc32.NewIEEE()}
+
+	var flags uint16
+	if HasLines(bc) {
+		flags |= FlagLines
+		e.lines = true
+	}
+
+	e.write(Magic)
+	e.uint16(Version)
+	e.uint16(flags)
+	e.string(f.Source)
+
+	prototypes := map[*object.CompiledFunction]int{}
+	var fns []*object.CompiledFunction
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			prototypes[fn] = len(fns)
+			fns = append(fns, fn)
+		}
+	}
+
+	e.uvarint(uint64(len(fns)))
+	for _, fn := range fns {
+		e.string(fn.Name)
+		e.uvarint(uint64(fn.NumLocals))
+		e.uvarint(uint64(fn.NumParameters))
+		e.signature(fn)
+		e.instructions(fn.Instructions, fn.Lines)
+	}
+
+	e.uvarint(uint64(len(bc.Constants)))
+	for i, c := range bc.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			e.byte(tagInteger)
+			e.varint(c.Value)
+		case *object.BigInt:
+			e.byte(tagBigInt)
+			e.string(c.Inspect())
+		case *object.Decimal:
+			e.byte(tagDecimal)
+			e.string(c.Inspect())
+		case *object.String:
+			e.byte(tagString)
+			e.string(c.Value)
+		case *object.CompiledFunction:
+			e.byte(tagFunction)
+			e.uvarint(uint64(prototypes[c]))
+		default:
+			return fmt.Errorf("constant %d: cannot encode %s", i, c.Type())
+		}
+	}
+
+	e.instructions(bc.Instructions, bc.Lines)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], e.sum.Sum32())
+	e.write(sum[:])
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+type encoder struct {
+	w     *bufio.Writer
+	sum   hash.Hash32 // of the bytes written so far
+	lines bool
+	err   error
+	buf   [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		e.sum.Write(p)
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.write([]byte{b})
+}
+
+func (e *encoder) uint16(v uint16) {
+	binary.BigEndian.PutUint16(e.buf[:], v)
+	e.write(e.buf[:2])
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) varint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *encoder) signature(fn *object.CompiledFunction) {
+	sig := fn.Signature
+	if sig == nil {
+		sig = &object.Signature{Params: make([]string, fn.NumParameters)}
+	}
+	e.uvarint(uint64(len(sig.Params)))
+	for i, p := range sig.Params {
+		e.string(p)
+		if i < len(sig.Defaults) {
+			e.string(sig.Defaults[i])
+		} else {
+			e.string("")
+		}
+	}
+	e.string(sig.Rest)
+}
+
+func (e *encoder) instructions(ins code.Instructions, lines code.LineTable) {
+	e.uvarint(uint64(len(ins)))
+	e.write(ins)
+
+	if !e.lines {
+		return
+	}
+
+	e.uvarint(uint64(len(lines)))
+	offset := 0
+	for _, entry := range lines {
+		e.uvarint(uint64(entry.Offset - offset))
+		e.uvarint(uint64(entry.Pos.Offset))
+		e.uvarint(uint64(entry.Pos.Line))
+		e.uvarint(uint64(entry.Pos.Column))
+		e.uvarint(uint64(entry.End.Offset))
+		e.uvarint(uint64(entry.End.Line))
+		e.uvarint(uint64(entry.End.Column))
+		offset = entry.Offset
+	}
+}
+
+// Decode reads a program written by Encode.
+func Decode(r io.Reader) (*File, error) {
+	d := &decoder{r: &summingReader{r: bufio.NewReader(r), sum: crc32.NewIEEE()}}
+
+	magic := d.read(len(Magic))
+	if d.err == nil && !bytes.Equal(magic, Magic) {
+		return nil, fmt.Errorf("%w: not a compiled monkey program", ErrFormat)
+	}
+
+	version := d.uint16()
+	if d.err == nil && version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d (want %d)", version, Version)
+	}
+	d.lines = d.uint16()&FlagLines != 0
+
+	f := &File{Source: d.string(), Bytecode: &compiler.Bytecode{}}
+
+	fns := make([]*object.CompiledFunction, d.count())
+	for i := range fns {
+		fn := &object.CompiledFunction{Name: d.string()}
+		fn.NumLocals = int(d.uvarint())
+		fn.NumParameters = int(d.uvarint())
+		fn.Signature = d.signature()
+		if d.err == nil && len(fn.Signature.Params) != fn.NumParameters {
+			d.fail("signature of %d parameters for a function of %d", len(fn.Signature.Params), fn.NumParameters)
+		}
+		if d.err == nil && fn.NumLocals < numArgSlots(fn) {
+			d.fail("function of %d parameters with %d locals", numArgSlots(fn), fn.NumLocals)
+		}
+		fn.Instructions, fn.Lines = d.instructions()
+		fns[i] = fn
+	}
+
+	constants := make([]object.Object, d.count())
+	for i := range constants {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			constants[i] = &object.Integer{Value: d.varint()}
+		case tagBigInt:
+			s := d.string()
+			n, ok := new(big.Int).SetString(s, 10)
+			if d.err == nil && !ok {
+				d.fail("invalid integer %q", s)
+			}
+			if d.err == nil {
+				constants[i] = object.NewInteger(n)
+			}
+		case tagDecimal:
+			s := d.string()
+			dec, err := object.ParseDecimal(s)
+			if d.err == nil && err != nil {
+				d.fail("invalid decimal %q", s)
+			}
+			if d.err == nil {
+				constants[i] = dec
+			}
+		case tagString:
+			constants[i] = &object.String{Value: d.string()}
+		case tagFunction:
+			index := d.uvarint()
+			if d.err == nil && index >= uint64(len(fns)) {
+				d.fail("function prototype %d out of range", index)
+			}
+			if d.err == nil {
+				constants[i] = fns[index]
+			}
+		default:
+			d.fail("unknown constant tag %q", tag)
+		}
+		if d.err != nil {
+			break
+		}
+	}
+	f.Bytecode.Constants = constants
+
+	f.Bytecode.Instructions, f.Bytecode.Lines = d.instructions()
+
+	sum := d.r.sum.Sum32()
+	if p := d.read(4); d.err == nil && binary.BigEndian.Uint32(p) != sum {
+		d.fail("checksum mismatch")
+	}
+
+	if d.err == nil {
+		d.checkOperands(f.Bytecode.Instructions, nil, constants)
+		d.checkStack(f.Bytecode.Instructions, nil)
+		for _, fn := range fns {
+			d.checkOperands(fn.Instructions, fn, constants)
+			d.checkStack(fn.Instructions, fn)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return f, nil
+}
+
+// summingReader is a reader computing the checksum of the bytes read.
+type summingReader struct {
+	r   *bufio.Reader
+	sum hash.Hash32
+}
+
+func (r *summingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.sum.Write(p[:n])
+	return n, err
+}
+
+func (r *summingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.sum.Write([]byte{b})
+	}
+	return b, err
+}
+
+type decoder struct {
+	r     *summingReader
+	lines bool
+	err   error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) check(err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		d.fail("unexpected end of file")
+	} else if err != nil && d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(d.r, p)
+	d.check(err)
+	return p
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.check(err)
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	p := d.read(2)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(p)
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.check(err)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.check(err)
+	return v
+}
+
+// count reads a count or a length, rejecting values that cannot fit the rest
+// of a sane file.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > 1<<24 {
+		d.fail("length %d too large", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	return string(d.read(d.count()))
+}
+
+func (d *decoder) signature() *object.Signature {
+	sig := &object.Signature{Params: make([]string, d.count())}
+	defaults := make([]string, len(sig.Params))
+	for i := range sig.Params {
+		sig.Params[i] = d.string()
+		if defaults[i] = d.string(); defaults[i] != "" {
+			sig.Defaults = defaults
+		}
+	}
+	sig.Rest = d.string()
+	return sig
+}
+
+func (d *decoder) instructions() (code.Instructions, code.LineTable) {
+	ins := code.Instructions(d.read(d.count()))
+	d.validate(ins)
+	if !d.lines {
+		return ins, nil
+	}
+
+	var lines code.LineTable
+	n := d.count()
+	offset := 0
+	for i := 0; i < n && d.err == nil; i++ {
+		offset += int(d.uvarint())
+		pos, end := d.position(), d.position()
+		lines = append(lines, code.LineEntry{Offset: offset, Pos: pos, End: end})
+	}
+	return ins, lines
+}
+
+func (d *decoder) position() token.Position {
+	pos := token.Position{Offset: int(d.uvarint())}
+	pos.Line = int(d.uvarint())
+	pos.Column = int(d.uvarint())
+	return pos
+}
+
+// validate checks that ins is a sequence of known opcodes with all of their
+// operands. What the operands refer to is checked by checkOperands once the
+// whole program is read.
+func (d *decoder) validate(ins code.Instructions) {
+	for i := 0; i < len(ins) && d.err == nil; {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			d.fail("%s at offset %d", err, i)
+			return
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			d.fail("truncated %s at offset %d", def.Name, i)
+			return
+		}
+		i += 1 + width
+	}
+}
+
+// checkOperands checks that the operands of ins, the instructions of fn or
+// of the main program when fn is nil, refer to constants of the right type,
+// builtins, locals and free variables that exist, and that jumps land on
+// instructions of ins. With checkStack, this lets the virtual machine run
+// ins without checking them; it only checks the types of the values it
+// finds in cells and iterators.
+func (d *decoder) checkOperands(ins code.Instructions, fn *object.CompiledFunction, constants []object.Object) {
+	starts := map[int]bool{len(ins): true}
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		starts[i] = true
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+
+	numLocals := 0
+	if fn != nil {
+		numLocals = fn.NumLocals
+	}
+
+	for i := 0; i < len(ins) && d.err == nil; {
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(constants) {
+				d.fail("constant %d out of range at offset %d", operands[0], i)
+			}
+		case code.OpImport:
+			if operands[0] >= len(constants) || constants[operands[0]].Type() != object.STRING_OBJ {
+				d.fail("%s of constant %d that is not a string at offset %d", def.Name, operands[0], i)
+			}
+		case code.OpClosure:
+			if operands[0] >= len(constants) || constants[operands[0]].Type() != object.COMPILED_FUNCTION_OBJ {
+				d.fail("%s of constant %d that is not a function at offset %d", def.Name, operands[0], i)
+			} else if n := numFree(constants[operands[0]].(*object.CompiledFunction)); operands[1] < n {
+				d.fail("%s with %d of %d free variables at offset %d", def.Name, operands[1], n, i)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				d.fail("builtin %d out of range at offset %d", operands[0], i)
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if operands[0] >= numLocals {
+				d.fail("local %d out of range at offset %d", operands[0], i)
+			}
+		case code.OpGetFree, code.OpCurrentClosure, code.OpReturn:
+			if fn == nil {
+				d.fail("%s outside of a function at offset %d", def.Name, i)
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpTry, code.OpNext:
+			if !starts[operands[0]] {
+				d.fail("%s to %d at offset %d", def.Name, operands[0], i)
+			}
+		case code.OpJumpIfPassed:
+			if operands[0] >= numLocals {
+				d.fail("local %d out of range at offset %d", operands[0], i)
+			} else if !starts[operands[1]] {
+				d.fail("%s to %d at offset %d", def.Name, operands[1], i)
+			}
+		}
+		i += 1 + read
+	}
+}
+
+// numArgSlots returns the number of locals holding the arguments of fn.
+func numArgSlots(fn *object.CompiledFunction) int {
+	if fn.Signature != nil && fn.Signature.Rest != "" {
+		return fn.NumParameters + 1
+	}
+	return fn.NumParameters
+}
+
+// numFree returns the number of free variables fn uses.
+func numFree(fn *object.CompiledFunction) int {
+	n := 0
+	for i := 0; i < len(fn.Instructions); {
+		def, _ := code.Lookup(fn.Instructions[i])
+		operands, read := code.ReadOperands(def, fn.Instructions[i+1:])
+		if code.Opcode(fn.Instructions[i]) == code.OpGetFree && operands[0] >= n {
+			n = operands[0] + 1
+		}
+		i += 1 + read
+	}
+	return n
+}
+
+// stackState is what checkStack knows before an instruction runs: the
+// fewest values on the stack of the frame and handlers installed by it on
+// any path reaching the instruction.
+type stackState struct {
+	depth, handlers int
+}
+
+// checkStack checks that no instruction of ins, the instructions of fn or
+// of the main program when fn is nil, takes more values from the stack than
+// the frame put on it, or removes a handler the frame did not install, and
+// that functions end with a return.
+func (d *decoder) checkStack(ins code.Instructions, fn *object.CompiledFunction) {
+	states := map[int]stackState{}
+	var work []int
+	reach := func(at int, s stackState) {
+		old, seen := states[at]
+		if seen && old.depth <= s.depth && old.handlers <= s.handlers {
+			return
+		}
+		if seen {
+			s.depth, s.handlers = minInt(old.depth, s.depth), minInt(old.handlers, s.handlers)
+		}
+		states[at] = s
+		work = append(work, at)
+	}
+
+	reach(0, stackState{})
+	for len(work) > 0 && d.err == nil {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		s := states[i]
+		if i == len(ins) {
+			if fn != nil {
+				d.fail("function %q does not return", fn.Name)
+			}
+			continue
+		}
+
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		pop, push := stackEffect(op, operands)
+		if s.depth < pop {
+			d.fail("%s takes %d values of %d on the stack at offset %d", def.Name, pop, s.depth, i)
+			return
+		}
+		s.depth += push - pop
+
+		switch op {
+		case code.OpJump:
+			reach(operands[0], s)
+		case code.OpJumpNotTruthy, code.OpNext:
+			reach(operands[0], stackState{s.depth - push, s.handlers})
+			reach(next, s)
+		case code.OpJumpIfPassed:
+			reach(operands[1], s)
+			reach(next, s)
+		case code.OpTry:
+			// the handler finds the exception on the stack
+			reach(operands[0], stackState{s.depth + 1, s.handlers})
+			reach(next, stackState{s.depth, s.handlers + 1})
+		case code.OpEndTry:
+			if s.handlers == 0 {
+				d.fail("%s without a handler at offset %d", def.Name, i)
+				return
+			}
+			reach(next, stackState{s.depth, s.handlers - 1})
+		case code.OpReturnValue, code.OpReturn, code.OpThrow, code.OpNoMatch:
+			// no instruction follows
+		default:
+			reach(next, s)
+		}
+	}
+}
+
+// stackEffect returns the number of values the instruction op takes from
+// the stack and the number it puts back. OpNext puts back the item only
+// when it does not jump.
+func stackEffect(op code.Opcode, operands []int) (pop, push int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin,
+		code.OpCurrentClosure, code.OpImport:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal,
+		code.OpNoMatch, code.OpDestructureArray, code.OpReturnValue, code.OpThrow:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpMakeCell, code.OpLoadCell,
+		code.OpIter, code.OpNext, code.OpMatchArray, code.OpArrayRest:
+		return 1, 1
+	case code.OpArray, code.OpHash, code.OpTemplate:
+		return operands[0], 1
+	case code.OpMatchHash:
+		return operands[0] + 1, 1
+	case code.OpDestructureHash:
+		return operands[0] + 1, 0
+	case code.OpSetIndex:
+		return 3, 1
+	case code.OpDup2:
+		return 2, 4
+	case code.OpStoreCell:
+		return 2, 0
+	case code.OpCall:
+		return operands[0] + 1, 1
+	case code.OpCallNamed:
+		// the function, the positional arguments and a name and a value for
+		// each named argument
+		return 1 + operands[0] + 2*operands[1], 1
+	case code.OpClosure:
+		return operands[1], 1
+	}
+	return 0, 0
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
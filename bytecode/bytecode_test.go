@@ -0,0 +1,213 @@
+package bytecode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/vm"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `let add = fn(a, b) {
+	a + b
+};
+let greeting = "hello";
+add(40, 2)`
+
+func compile(t *testing.T, src string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	comp := compiler.New()
+	require.NoError(t, comp.Compile(prog))
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, bc *compiler.Bytecode) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, &File{Source: "add.mk", Bytecode: bc}))
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	bc := compile(t, source)
+	data := encode(t, bc)
+	require.True(t, IsBytecode(data))
+
+	f, err := Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, "add.mk", f.Source)
+	require.Equal(t, bc.Instructions, f.Bytecode.Instructions)
+	require.Equal(t, bc.Lines, f.Bytecode.Lines)
+	require.Equal(t, len(bc.Constants), len(f.Bytecode.Constants))
+	for i, c := range bc.Constants {
+		require.Equal(t, c.Inspect(), f.Bytecode.Constants[i].Inspect())
+	}
+
+	machine := vm.New(f.Bytecode)
+	require.NoError(t, machine.Run())
+	require.Equal(t, "42", machine.LastPoppedStackElem().Inspect())
+}
+
+func TestRoundTripSignature(t *testing.T) {
+	bc := compile(t, `let f = fn(a, [b] = [a], ...r) { [a, b, r] }; f(1, r: 2)`)
+	f, err := Decode(bytes.NewReader(encode(t, bc)))
+	require.NoError(t, err)
+
+	for i, c := range bc.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			require.Equal(t, fn.Signature, f.Bytecode.Constants[i].(*object.CompiledFunction).Signature)
+		}
+	}
+
+	err = vm.New(f.Bytecode).Run()
+	require.EqualError(t, err, "1:48: f(a, [b] = [a], ...r) has no parameter r")
+}
+
+func TestRoundTripNumbers(t *testing.T) {
+	bc := compile(t, `[99999999999999999999 * 2, 1.50 + -0.05, round(2.50 / 3, 2)]`)
+	f, err := Decode(bytes.NewReader(encode(t, bc)))
+	require.NoError(t, err)
+	for i, c := range bc.Constants {
+		require.IsType(t, c, f.Bytecode.Constants[i])
+		require.Equal(t, c.Inspect(), f.Bytecode.Constants[i].Inspect())
+	}
+
+	machine := vm.New(f.Bytecode)
+	require.NoError(t, machine.Run())
+	require.Equal(t, "[199999999999999999998, 1.45, 0.83]", machine.LastPoppedStackElem().Inspect())
+}
+
+func TestStripLines(t *testing.T) {
+	bc := compile(t, source)
+	full := encode(t, bc)
+
+	StripLines(bc)
+	require.False(t, HasLines(bc))
+	stripped := encode(t, bc)
+	require.Less(t, len(stripped), len(full))
+
+	f, err := Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+	require.Nil(t, f.Bytecode.Lines)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := encode(t, compile(t, source))
+
+	_, err := Decode(strings.NewReader("let a = 1;"))
+	require.True(t, errors.Is(err, ErrFormat))
+
+	newer := append([]byte{}, data...)
+	newer[len(Magic)+1] = Version + 1
+	_, err = Decode(bytes.NewReader(newer))
+	require.EqualError(t, err, "unsupported bytecode version 6 (want 5)")
+
+	_, err = Decode(bytes.NewReader(data[:len(data)-3]))
+	require.True(t, errors.Is(err, ErrFormat))
+
+	for i := len(Magic) + 2; i < len(data); i++ {
+		corrupt := append([]byte{}, data...)
+		corrupt[i] ^= 0x5a
+		_, err = Decode(bytes.NewReader(corrupt))
+		require.True(t, errors.Is(err, ErrFormat), "byte %d: %v", i, err)
+	}
+
+	// files with a valid checksum are checked for operands the virtual
+	// machine could not use
+	bad := []code.Instructions{
+		code.Make(code.OpConstant, 9),
+		code.Make(code.OpGetBuiltin, 255),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpJump, 1),
+		code.Make(code.OpClosure, 0, 0),
+		code.Make(code.OpPop),
+		concat(code.Make(code.OpConstant, 0), code.Make(code.OpAdd)),
+		concat(code.Make(code.OpConstant, 0), code.Make(code.OpJumpNotTruthy, 7), code.Make(code.OpConstant, 0), code.Make(code.OpPop)),
+		code.Make(code.OpEndTry),
+		code.Make(code.OpReturn),
+	}
+	for _, ins := range bad {
+		bc := &compiler.Bytecode{Instructions: ins, Constants: []object.Object{&object.Integer{Value: 1}}}
+		_, err = Decode(bytes.NewReader(encode(t, bc)))
+		require.True(t, errors.Is(err, ErrFormat), "%s: %v", ins, err)
+	}
+
+	// and for functions using more free variables than their closures have
+	fn := &object.CompiledFunction{Instructions: concat(code.Make(code.OpGetFree, 1), code.Make(code.OpReturnValue))}
+	bc := &compiler.Bytecode{Instructions: code.Make(code.OpClosure, 0, 1), Constants: []object.Object{fn}}
+	_, err = Decode(bytes.NewReader(encode(t, bc)))
+	require.EqualError(t, err, "malformed bytecode: OpClosure with 1 of 2 free variables at offset 0")
+	fn.Instructions = code.Make(code.OpNull)
+	bc.Instructions = code.Make(code.OpClosure, 0, 0)
+	_, err = Decode(bytes.NewReader(encode(t, bc)))
+	require.EqualError(t, err, `malformed bytecode: function "" does not return`)
+
+	// what slots hold is checked as the program runs
+	bc = &compiler.Bytecode{
+		Instructions: concat(code.Make(code.OpConstant, 0), code.Make(code.OpLoadCell)),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}
+	f, err := Decode(bytes.NewReader(encode(t, bc)))
+	require.NoError(t, err)
+	require.EqualError(t, vm.New(f.Bytecode).Run(), "INTEGER is not a cell")
+}
+
+func concat(ins ...code.Instructions) code.Instructions {
+	var out code.Instructions
+	for _, i := range ins {
+		out = append(out, i...)
+	}
+	return out
+}
+
+func TestDisassemble(t *testing.T) {
+	f := &File{Source: "add.mk", Bytecode: compile(t, source)}
+
+	var out bytes.Buffer
+	require.NoError(t, Disassemble(&out, f, source))
+	require.Equal(t, `; source add.mk
+constants:
+  0 COMPILED_FUNCTION CompiledFunction[add]
+  1 STRING "hello"
+  2 INTEGER 40
+  3 INTEGER 2
+
+main:
+  ; 1: let add = fn(a, b) {
+  0000 OpClosure 0 0
+  0004 OpSetGlobal 0
+  ; 4: let greeting = "hello";
+  0007 OpConstant 1
+  0010 OpSetGlobal 1
+  ; 5: add(40, 2)
+  0013 OpGetGlobal 0
+  0016 OpConstant 2
+  0019 OpConstant 3
+  0022 OpCall 2
+  0024 OpPop
+
+constant 0, fn add (params 2, locals 2):
+  ; 2: a + b
+  0000 OpGetLocal 0
+  0002 OpGetLocal 1
+  0004 OpAdd
+  0005 OpReturnValue
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, Disassemble(&out, f, ""))
+	require.Contains(t, out.String(), "  ; line 5\n  0013 OpGetGlobal 0\n")
+}
@@ -0,0 +1,77 @@
+package bytecode
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/object"
+)
+
+// Disassemble writes the constants and the instructions of f to w in human
+// readable form. Instructions are annotated with the source line they were
+// compiled from whenever the line changes; the text of the line is included
+// when source, the program text, is not empty.
+func Disassemble(w io.Writer, f *File, source string) error {
+	bc := f.Bytecode
+	lines := strings.Split(source, "\n")
+	if source == "" {
+		lines = nil
+	}
+
+	ew := &errWriter{w: w}
+
+	if f.Source != "" {
+		ew.printf("; source %s\n", f.Source)
+	}
+
+	ew.printf("constants:\n")
+	for i, c := range bc.Constants {
+		ew.printf("  %d %s %s\n", i, c.Type(), c.Inspect())
+	}
+
+	ew.printf("\nmain:\n")
+	disassemble(ew, bc.Instructions, bc.Lines, lines)
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		ew.printf("\nconstant %d, fn %s (params %d, locals %d):\n", i, name, fn.NumParameters, fn.NumLocals)
+		disassemble(ew, fn.Instructions, fn.Lines, lines)
+	}
+
+	return ew.err
+}
+
+func disassemble(ew *errWriter, ins code.Instructions, table code.LineTable, lines []string) {
+	line := 0
+	ins.Walk(func(offset int, text string) {
+		if pos, ok := table.Lookup(offset); ok && pos.Line != line {
+			line = pos.Line
+			if line <= len(lines) {
+				ew.printf("  ; %d: %s\n", line, strings.TrimSpace(lines[line-1]))
+			} else {
+				ew.printf("  ; line %d\n", line)
+			}
+		}
+		ew.printf("  %04d %s\n", offset, text)
+	})
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
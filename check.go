@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/report"
+	"github.com/riadafridishibly/go-monkey/typecheck"
+)
+
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey check file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := readSource(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey check: %v\n", err)
+			status = 1
+			continue
+		}
+
+		if err := checkSource(src); err != nil {
+			report.Print(os.Stderr, filename, src, err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// checkSource parses, expands, type checks and compiles a program.
+func checkSource(src string) error {
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		return errs
+	}
+	prog, err := evaluator.Expand(prog)
+	if err != nil {
+		return err
+	}
+
+	if _, errs := typecheck.Check(prog); len(errs) > 0 {
+		return errs
+	}
+	return compiler.New().Compile(prog)
+}
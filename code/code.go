@@ -0,0 +1,283 @@
+// Package code defines the bytecode instruction set of the Monkey virtual
+// machine.
+//
+// An instruction is a one byte opcode followed by its operands. Operands are
+// unsigned and big endian; their widths are listed in the opcode's
+// Definition.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	ins.Walk(func(offset int, text string) {
+		fmt.Fprintf(&out, "%04d %s\n", offset, text)
+	})
+
+	return out.String()
+}
+
+// Walk calls fn with the offset and the disassembly of every instruction in
+// ins, in order.
+func (ins Instructions) Walk(fn func(offset int, text string)) {
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fn(i, fmt.Sprintf("ERROR: %s", err))
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fn(i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpCurrentClosure
+
+	OpArray
+	OpHash
+	OpIndex
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	// Opcodes are part of the bytecode file format; new ones go at the end.
+	OpGetBuiltin
+
+	OpTry
+	OpEndTry
+	OpThrow
+
+	OpIter
+	OpNext
+
+	OpSetIndex
+	OpDup2
+	OpMakeCell
+	OpLoadCell
+	OpStoreCell
+
+	OpImport
+
+	OpMatchArray
+	OpMatchHash
+	OpNoMatch
+
+	OpDestructureArray
+	OpDestructureHash
+	OpArrayRest
+
+	OpCallNamed
+	OpJumpIfPassed
+
+	OpTemplate
+)
+
+// Definition describes an opcode for disassembly and encoding.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}}, // constant index
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}}, // target offset
+	OpJump:          {"OpJump", []int{2}},          // target offset
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}}, // global index
+	OpSetGlobal:      {"OpSetGlobal", []int{2}}, // global index
+	OpGetLocal:       {"OpGetLocal", []int{1}},  // local index
+	OpSetLocal:       {"OpSetLocal", []int{1}},  // local index
+	OpGetFree:        {"OpGetFree", []int{1}},   // free variable index
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpArray: {"OpArray", []int{2}}, // element count
+	OpHash:  {"OpHash", []int{2}},  // key and value count
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}}, // argument count
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}}, // constant index, free variable count
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}}, // builtin index
+
+	OpTry:    {"OpTry", []int{2}}, // handler offset
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	OpIter: {"OpIter", []int{}},
+	OpNext: {"OpNext", []int{2}}, // offset to jump to when done
+
+	OpSetIndex:  {"OpSetIndex", []int{}},
+	OpDup2:      {"OpDup2", []int{}}, // duplicates the top two values
+	OpMakeCell:  {"OpMakeCell", []int{}},
+	OpLoadCell:  {"OpLoadCell", []int{}},
+	OpStoreCell: {"OpStoreCell", []int{}},
+
+	OpImport: {"OpImport", []int{2}}, // constant index of the path
+
+	OpMatchArray: {"OpMatchArray", []int{2, 1}}, // element count, 1 if there is a rest
+	OpMatchHash:  {"OpMatchHash", []int{2}},     // key count
+	OpNoMatch:    {"OpNoMatch", []int{}},
+
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}}, // element count, 1 if there is a rest
+	OpDestructureHash:  {"OpDestructureHash", []int{2}},     // key count
+	OpArrayRest:        {"OpArrayRest", []int{2}},           // index of the first element
+
+	OpCallNamed:    {"OpCallNamed", []int{1, 1}},    // positional and named argument counts
+	OpJumpIfPassed: {"OpJumpIfPassed", []int{1, 2}}, // parameter index, jump target
+
+	OpTemplate: {"OpTemplate", []int{2}}, // number of parts
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction. It returns an empty slice for unknown opcodes.
+// Operands are truncated to their widths, which callers must check.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction and returns them along
+// with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,138 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	line := func(n int) token.Position { return token.Position{Line: n, Column: 1} }
+
+	var table LineTable
+	table.Add(0, line(1))
+	table.Add(3, line(1)) // same position, no new entry
+	table.Add(4, token.Position{})
+	table.Add(6, line(2))
+	table.Add(9, line(3))
+
+	if len(table) != 3 {
+		t.Fatalf("wrong number of entries. want=3, got=%d", len(table))
+	}
+
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{0, 1}, {5, 1}, {6, 2}, {8, 2}, {9, 3}, {100, 3},
+	}
+	for _, tt := range tests {
+		pos, ok := table.Lookup(tt.offset)
+		if !ok || pos.Line != tt.line {
+			t.Errorf("offset %d: want line %d, got=%s", tt.offset, tt.line, pos)
+		}
+	}
+
+	table.Truncate(6)
+	if pos, _ := table.Lookup(9); pos.Line != 1 {
+		t.Errorf("truncated entries still present: %v", table)
+	}
+
+	if _, ok := (LineTable{}).Lookup(0); ok {
+		t.Errorf("empty table returned a position")
+	}
+
+	table.AddSpan(6, line(2), token.Position{Line: 2, Column: 3})
+	entry, ok := table.Entry(7)
+	if !ok || entry.Pos != line(2) || entry.End.Column != 3 {
+		t.Errorf("wrong entry for a span: %+v", entry)
+	}
+}
@@ -0,0 +1,61 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// LineEntry maps the instructions starting at Offset, up to the next entry,
+// to the source span they were compiled from. End is unknown for spans
+// that were not recorded with one.
+type LineEntry struct {
+	Offset int
+	Pos    token.Position
+	End    token.Position
+}
+
+// LineTable maps instruction offsets to source positions. Entries are sorted
+// by offset.
+type LineTable []LineEntry
+
+// Add records that the instructions starting at offset came from pos.
+func (t *LineTable) Add(offset int, pos token.Position) {
+	t.AddSpan(offset, pos, token.Position{})
+}
+
+// AddSpan records that the instructions starting at offset came from the
+// source between pos and end. It is a no-op when pos is unknown or the span
+// is the same as the one of the last entry.
+func (t *LineTable) AddSpan(offset int, pos, end token.Position) {
+	if !pos.IsValid() {
+		return
+	}
+
+	if n := len(*t); n > 0 && (*t)[n-1].Pos == pos && (*t)[n-1].End == end {
+		return
+	}
+	*t = append(*t, LineEntry{Offset: offset, Pos: pos, End: end})
+}
+
+// Truncate drops the entries of instructions at offset and beyond, after the
+// instructions themselves were removed.
+func (t *LineTable) Truncate(offset int) {
+	i := sort.Search(len(*t), func(i int) bool { return (*t)[i].Offset >= offset })
+	*t = (*t)[:i]
+}
+
+// Lookup returns the source position of the instruction at offset.
+func (t LineTable) Lookup(offset int) (token.Position, bool) {
+	entry, ok := t.Entry(offset)
+	return entry.Pos, ok
+}
+
+// Entry returns the entry of the instruction at offset.
+func (t LineTable) Entry(offset int) (LineEntry, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return LineEntry{}, false
+	}
+	return t[i-1], true
+}
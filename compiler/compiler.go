@@ -0,0 +1,1253 @@
+// Package compiler translates Monkey programs into bytecode for the virtual
+// machine.
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/resolver"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// tries holds the finally blocks of the try expressions whose handlers
+	// are installed at the code being compiled, innermost last. Entries of
+	// try expressions without a finally block are nil.
+	tries []*ast.BlockStatement
+
+	// loops holds the loops enclosing the code being compiled, innermost
+	// last.
+	loops []*loop
+}
+
+// loop is a loop being compiled.
+type loop struct {
+	start  int   // where continue jumps to
+	breaks []int // jumps to patch with the end of the loop
+	tries  int   // try expressions enclosing the loop
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos and end span the source of the node being compiled.
+	pos, end token.Position
+
+	// cells holds the declarations of the variables that closures capture
+	// and that are assigned. Locals among them are kept in cells.
+	cells map[*ast.Identifier]bool
+
+	externals        []External
+	externalsEnabled bool
+	globalCells      bool
+
+	// err is the first operand found not to fit its width. It is reported
+	// by Compile, as emit has no error to return.
+	err error
+}
+
+// Error is an error found while compiling a program.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos token.Position, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// External is a global used by a program without being defined by it.
+type External struct {
+	Symbol
+	Pos token.Position // position of the first use
+}
+
+// Bytecode is the result of a compilation: the instructions of the main
+// program, the constant pool they refer to and the source positions of the
+// instructions.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Lines        code.LineTable
+}
+
+// New returns a compiler for a program in which the builtins are
+// predeclared.
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+// NewWithState returns a compiler continuing from the globals and constants
+// of an earlier compilation, as the REPL does line by line.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// EnableExternals makes the compiler treat undefined identifiers as globals
+// provided by the host running the program, instead of reporting them as
+// errors. They are listed by Externals.
+func (c *Compiler) EnableExternals() {
+	c.externalsEnabled = true
+}
+
+// EnableGlobalCells makes the slots of the globals, including externals,
+// hold cells with their values, so that hosts can share the variables
+// themselves between programs.
+func (c *Compiler) EnableGlobalCells() {
+	c.globalCells = true
+}
+
+// Externals returns the globals used but not defined by the programs
+// compiled so far.
+func (c *Compiler) Externals() []External {
+	return c.externals
+}
+
+// SymbolTable returns the table of the globals of the compiled programs.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Lines:        c.scopes[c.scopeIndex].lines,
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if pos, end := nodeSpan(node); pos.IsValid() {
+		outerPos, outerEnd := c.pos, c.end
+		c.pos, c.end = pos, end
+		defer func() { c.pos, c.end = outerPos, outerEnd }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.cells = cellVariables(node)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		c.enterBlock()
+		defer c.leaveBlock()
+
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if err := c.checkRedeclared(ast.PatternNames(node.Name)...); err != nil {
+			return err
+		}
+		name, ok := node.Name.(*ast.Identifier)
+		if !ok {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			value := c.hidden("let")
+			c.storeSymbol(value)
+			return c.destructure(node.Name, value)
+		}
+
+		// define the name first so that functions can refer to themselves
+		return c.bind(c.define(name), node.Value)
+
+	case *ast.ConstStatement:
+		if err := c.checkRedeclared(node.Name); err != nil {
+			return err
+		}
+		c.define(node.Name)
+		return c.bind(c.symbolTable.makeConst(node.Name.Value), node.Value)
+
+	case *ast.ImportStatement:
+		if c.symbolTable.Outer != nil {
+			return errorf(node.Token.Pos, "import is only allowed at the top level")
+		}
+		if err := c.checkRedeclared(node.Name); err != nil {
+			return err
+		}
+		path := &object.String{Value: node.Path.Value}
+		c.emit(code.OpImport, c.addConstant(path))
+		c.define(node.Name)
+		c.storeNew(c.symbolTable.makeConst(node.Name.Value))
+
+	case *ast.ExportStatement:
+		if c.symbolTable.Outer != nil {
+			return errorf(node.Token.Pos, "export is only allowed at the top level")
+		}
+		return c.Compile(node.Binding)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		exit := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compileLoop(node.Body, start); err != nil {
+			return err
+		}
+		c.changeOperand(exit, len(c.currentInstructions()))
+
+	case *ast.ForStatement:
+		if err := c.Compile(node.Iterable); err != nil {
+			return err
+		}
+		c.emit(code.OpIter)
+
+		c.enterBlock()
+		defer c.leaveBlock()
+
+		// the iterator is kept in a variable no program can name
+		iter := c.symbolTable.Define("for " + node.Variable.Value)
+		c.storeSymbol(iter)
+
+		start := len(c.currentInstructions())
+		c.loadSymbol(iter)
+		exit := c.emit(code.OpNext, 9999)
+		c.storeNew(c.define(node.Variable))
+		if err := c.compileLoop(node.Body, start); err != nil {
+			return err
+		}
+		c.changeOperand(exit, len(c.currentInstructions()))
+
+	case *ast.BranchStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			return errorf(node.Token.Pos, "%s outside of a loop", node.Token.Literal)
+		}
+		l := loops[len(loops)-1]
+		if err := c.leaveTries(l.tries); err != nil {
+			return err
+		}
+		if node.Token.Type == token.BREAK {
+			l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+		} else {
+			c.emit(code.OpJump, l.start)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			if !c.externalsEnabled {
+				return errorf(node.Token.Pos, "undefined variable %s", node.Value)
+			}
+			symbol = c.external(node)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.InetegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.BigIntegerLiteral:
+		integer := &object.BigInt{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.DecimalLiteral:
+		decimal, err := object.NewDecimal(node.Unscaled, node.Scale)
+		if err != nil {
+			return errorf(node.Token.Pos, "%s", err)
+		}
+		c.emit(code.OpConstant, c.addConstant(decimal))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.TemplateLiteral:
+		count := 0
+		for i, part := range node.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok && i%2 == 0 && text.Value == "" {
+				continue
+			}
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+			count++
+		}
+		c.emit(code.OpTemplate, count)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// emit an `OpJumpNotTruthy` with a bogus value
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.Consequence); err != nil {
+			return err
+		}
+
+		// emit an `OpJump` with a bogus value
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.TryExpression:
+		return c.compileTry(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		if err := c.compileParameters(node); err != nil {
+			return err
+		}
+
+		if err := c.compileStatements(node.Body.Statements); err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.NumDefinitions()
+		lines := c.scopes[c.scopeIndex].lines
+		instructions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.loadSlot(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Lines:         lines,
+			Signature:     object.NewSignature(node.Parameters, node.Defaults, node.Rest),
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		if len(node.NamedArguments) == 0 {
+			c.emit(code.OpCall, len(node.Arguments))
+			break
+		}
+		for _, a := range node.NamedArguments {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: a.Name.Value}))
+			if err := c.Compile(a.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCallNamed, len(node.Arguments), len(node.NamedArguments))
+
+	default:
+		return errorf(ast.Pos(node), "cannot compile %T", node)
+	}
+
+	return c.err
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+}
+
+// nodeSpan returns the source span instructions compiled from node are
+// mapped to. Operators are mapped to their own token so that runtime errors
+// point at the operation that failed, and for loops to their iterable. The
+// end of the span is unknown for nodes other than operators and identifiers.
+func nodeSpan(node ast.Node) (pos, end token.Position) {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return node.Token.Pos, node.Token.End
+	case *ast.PrefixExpression:
+		return node.Token.Pos, node.Token.End
+	case *ast.CallExpression:
+		return node.Token.Pos, node.Token.End
+	case *ast.IndexExpression:
+		return node.Token.Pos, node.Token.End
+	case *ast.AssignExpression:
+		return node.Token.Pos, node.Token.End
+	case *ast.Identifier:
+		return node.Token.Pos, node.Token.End
+	case *ast.ForStatement:
+		// where values that can not be iterated over are reported
+		return nodeSpan(node.Iterable)
+	}
+	return ast.Pos(node), token.Position{}
+}
+
+func (c *Compiler) compileStatements(list []ast.Statement) error {
+	for _, s := range list {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBlockValue compiles a block whose value is used, as the branches of
+// an if expression are. The value of the last expression statement is left
+// on the stack; blocks ending in anything else produce null.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileTry compiles a try expression. OpTry installs a handler that, when
+// an exception is raised, unwinds the stack to where it was and jumps to
+// the handler code with the exception pushed. The finally block is compiled
+// twice: once on the way out of the expression and once before exceptions
+// escaping it are thrown again.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	handler := c.emit(code.OpTry, 9999)
+	c.pushTry(node.Finally)
+	if err := c.compileBlockValue(node.Block); err != nil {
+		return err
+	}
+	c.popTry()
+	c.emit(code.OpEndTry)
+	jumps := []int{c.emit(code.OpJump, 9999)}
+
+	if node.Catch != nil {
+		c.changeOperand(handler, len(c.currentInstructions()))
+
+		c.enterBlock()
+		if node.CatchParam != nil {
+			c.storeNew(c.define(node.CatchParam))
+		} else {
+			c.emit(code.OpPop)
+		}
+
+		// exceptions of the catch block still run the finally block
+		if node.Finally != nil {
+			handler = c.emit(code.OpTry, 9999)
+			c.pushTry(node.Finally)
+		}
+		err := c.compileBlockValue(node.Catch)
+		c.leaveBlock()
+		if err != nil {
+			return err
+		}
+		if node.Finally != nil {
+			c.popTry()
+			c.emit(code.OpEndTry)
+			jumps = append(jumps, c.emit(code.OpJump, 9999))
+		}
+	}
+
+	if node.Finally != nil {
+		c.changeOperand(handler, len(c.currentInstructions()))
+		if err := c.Compile(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	for _, jump := range jumps {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	if node.Finally != nil {
+		return c.Compile(node.Finally)
+	}
+	return nil
+}
+
+// compileMatch compiles a match expression. The subject is kept in a
+// variable no program can name. Each arm tests it against its pattern and
+// guard, jumping to the next arm when they fail; after the last arm the
+// subject is reported as not matched.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	subject := c.symbolTable.Define("match")
+	c.storeSymbol(subject)
+	load := func() error {
+		c.loadSymbol(subject)
+		return nil
+	}
+
+	var ends []int
+	for _, arm := range node.Arms {
+		c.enterBlock()
+		var fails []int
+		err := c.compilePattern(arm.Pattern, load, &fails)
+		if err == nil && arm.Guard != nil {
+			if err = c.Compile(arm.Guard); err == nil {
+				fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+			}
+		}
+		if err == nil {
+			err = c.compileBlockValue(arm.Body)
+		}
+		c.leaveBlock()
+		if err != nil {
+			return err
+		}
+
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		for _, fail := range fails {
+			c.changeOperand(fail, len(c.currentInstructions()))
+		}
+	}
+
+	c.loadSymbol(subject)
+	c.emit(code.OpNoMatch)
+
+	for _, end := range ends {
+		c.changeOperand(end, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// hidden defines a variable programs can not refer to, for values the
+// compiled code keeps to itself. It is defined in a block of its own, so
+// that hosts do not see it among the globals.
+func (c *Compiler) hidden(name string) Symbol {
+	c.enterBlock()
+	defer c.leaveBlock()
+	return c.symbolTable.Define(name)
+}
+
+// compileParameters defines the parameters of fn. The arguments of a call
+// are in the first slots of the frame, one per parameter followed by the
+// array of the rest arguments. Required names are defined at their slot;
+// the other parameters are bound in order once their default values, which
+// see the parameters before them, are computed.
+func (c *Compiler) compileParameters(fn *ast.FunctionLiteral) error {
+	slots := make([]*Symbol, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		name, ok := p.(*ast.Identifier)
+		if !ok || fn.Defaults != nil && fn.Defaults[i] != nil {
+			slot := c.hidden("param")
+			slots[i] = &slot
+			continue
+		}
+		if symbol := c.define(name); symbol.Cell {
+			c.loadSlot(symbol)
+			c.emit(code.OpMakeCell)
+			c.storeSymbol(symbol)
+		}
+	}
+	var rest Symbol
+	if fn.Rest != nil {
+		rest = c.hidden("rest")
+	}
+
+	for i, p := range fn.Parameters {
+		slot := slots[i]
+		if slot == nil {
+			continue
+		}
+		if fn.Defaults != nil && fn.Defaults[i] != nil {
+			jump := c.emit(code.OpJumpIfPassed, slot.Index, 9999)
+			if err := c.Compile(fn.Defaults[i]); err != nil {
+				return err
+			}
+			c.storeSymbol(*slot)
+			c.changeOperand(jump, slot.Index, len(c.currentInstructions()))
+		}
+		if err := c.destructure(p, *slot); err != nil {
+			return err
+		}
+	}
+	if fn.Rest != nil {
+		c.loadSymbol(rest)
+		c.storeNew(c.define(fn.Rest))
+	}
+	return nil
+}
+
+// destructure binds the names of p, the name of a let statement or a
+// parameter, to the parts of the value of the variable value.
+func (c *Compiler) destructure(p ast.Pattern, value Symbol) error {
+	load := func() error {
+		c.loadSymbol(value)
+		return nil
+	}
+	return c.compilePattern(p, load, nil)
+}
+
+// compilePattern compiles the test of the value load pushes against p, which
+// jumps to one of fails if it does not match, and the definition of the
+// names p binds. Without fails, as for let statements and parameters, the
+// test raises an error instead, and p must not hold literals.
+func (c *Compiler) compilePattern(p ast.Pattern, load func() error, fails *[]int) error {
+	switch p := p.(type) {
+	case *ast.WildcardPattern:
+		// matches anything
+
+	case *ast.Identifier:
+		if err := load(); err != nil {
+			return err
+		}
+		c.storeNew(c.define(p))
+
+	case *ast.InetegerLiteral, *ast.BigIntegerLiteral, *ast.DecimalLiteral, *ast.StringLiteral, *ast.Boolean:
+		if fails == nil {
+			return errorf(ast.Pos(p), "cannot use literal %s in a binding pattern", p)
+		}
+		if err := load(); err != nil {
+			return err
+		}
+		if err := c.Compile(p); err != nil {
+			return err
+		}
+		c.emit(code.OpEqual)
+		*fails = append(*fails, c.emit(code.OpJumpNotTruthy, 9999))
+
+	case *ast.ArrayPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		rest := 0
+		if p.Rest != nil {
+			rest = 1
+		}
+		if fails == nil {
+			c.emitAt(p, code.OpDestructureArray, len(p.Elements), rest)
+		} else {
+			c.emit(code.OpMatchArray, len(p.Elements), rest)
+			*fails = append(*fails, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		for i, elem := range p.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElem := func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+				return nil
+			}
+			if err := c.compilePattern(elem, loadElem, fails); err != nil {
+				return err
+			}
+		}
+		if p.Rest != nil {
+			loadRest := func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				c.emit(code.OpArrayRest, len(p.Elements))
+				return nil
+			}
+			if err := c.compilePattern(p.Rest, loadRest, fails); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		for _, pair := range p.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+		}
+		if fails == nil {
+			c.emitAt(p, code.OpDestructureHash, len(p.Pairs))
+		} else {
+			c.emit(code.OpMatchHash, len(p.Pairs))
+			*fails = append(*fails, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		for _, pair := range p.Pairs {
+			key := pair.Key
+			loadValue := func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				if err := c.Compile(key); err != nil {
+					return err
+				}
+				c.emit(code.OpIndex)
+				return nil
+			}
+			if err := c.compilePattern(pair.Value, loadValue, fails); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return errorf(ast.Pos(p), "cannot compile pattern %T", p)
+	}
+	return nil
+}
+
+// compileLoop compiles the body of a loop starting at start, followed by the
+// jump back to it. Break statements jump to the code that follows.
+func (c *Compiler) compileLoop(body *ast.BlockStatement, start int) error {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{start: start, tries: len(scope.tries)}
+	scope.loops = append(scope.loops, l)
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	c.emit(code.OpJump, start)
+	for _, jump := range l.breaks {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) pushTry(finally *ast.BlockStatement) {
+	c.scopes[c.scopeIndex].tries = append(c.scopes[c.scopeIndex].tries, finally)
+}
+
+func (c *Compiler) popTry() {
+	tries := c.scopes[c.scopeIndex].tries
+	c.scopes[c.scopeIndex].tries = tries[:len(tries)-1]
+}
+
+// leaveTries emits the code jumping out of the try expressions of the
+// current function but the outermost n: their handlers are removed and
+// their finally blocks run, innermost first.
+func (c *Compiler) leaveTries(n int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= n; i-- {
+		// a finally block runs outside of its own try expression
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		c.emit(code.OpEndTry)
+		if tries[i] != nil {
+			if err := c.Compile(tries[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileAssign compiles an assignment, leaving the value stored on the
+// stack.
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	compound := node.Operator != "="
+	op, ok := infixOperators[strings.TrimSuffix(node.Operator, "=")]
+	if compound && !ok {
+		return errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.resolveVariable(target.Value)
+		if !ok && c.externalsEnabled {
+			symbol, ok = c.external(target), true
+		}
+		switch {
+		case !ok:
+			return errorf(target.Token.Pos, "assignment to undeclared variable %s", target.Value)
+		case symbol.Scope == BuiltinScope:
+			return errorf(target.Token.Pos, "cannot assign to builtin %s", target.Value)
+		case symbol.Const:
+			return errorf(target.Token.Pos, "cannot assign to constant %s", target.Value)
+		case symbol.Scope == FreeScope && !symbol.Cell:
+			return errorf(target.Token.Pos, "cannot assign to captured variable %s", target.Value)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.assignSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return errorf(ast.Pos(target), "cannot assign to %s", target)
+	}
+	return nil
+}
+
+// cellVariables returns the declarations of the variables of prog that
+// closures capture and that are assigned somewhere. Captured variables of
+// blocks outside of functions, such as the variable of a top-level loop, are
+// among them too: they are globals, and every run of the block needs a cell
+// of its own for the closures to see the value of that run.
+func cellVariables(prog *ast.Program) map[*ast.Identifier]bool {
+	cells := map[*ast.Identifier]bool{}
+	for _, sym := range resolver.Resolve(prog).Symbols() {
+		topBlock := sym.Scope.Kind == resolver.BlockScope && sym.Scope.Function().Kind == resolver.ProgramScope
+		if sym.Captured && (sym.Assigned || topBlock) {
+			cells[sym.Ident] = true
+		}
+	}
+	return cells
+}
+
+// external defines ident, used by the program without being defined, as a
+// global provided by the host.
+func (c *Compiler) external(ident *ast.Identifier) Symbol {
+	symbol := c.SymbolTable().Define(ident.Value)
+	if c.globalCells {
+		symbol = c.SymbolTable().makeCell(ident.Value)
+	}
+	c.externals = append(c.externals, External{Symbol: symbol, Pos: ident.Token.Pos})
+	return symbol
+}
+
+// define declares the variable ident in the current scope, keeping it in a
+// cell if it is a local that closures capture and assign, or a variable of
+// a top-level block that closures capture, or a global with global cells
+// enabled.
+func (c *Compiler) define(ident *ast.Identifier) Symbol {
+	symbol := c.symbolTable.Define(ident.Value)
+	if (symbol.Scope == LocalScope || c.symbolTable.block) && c.cells[ident] ||
+		c.globalCells && c.symbolTable.Outer == nil {
+		symbol = c.symbolTable.makeCell(ident.Value)
+	}
+	return symbol
+}
+
+// checkRedeclared fails if one of idents names a constant of the current
+// scope, which let, const and import statements can not declare again.
+func (c *Compiler) checkRedeclared(idents ...*ast.Identifier) error {
+	for _, ident := range idents {
+		symbol, ok := c.symbolTable.store[ident.Value]
+		if ok && symbol.Const && symbol.Scope != FreeScope {
+			return errorf(ident.Token.Pos, "cannot redeclare constant %s", ident.Value)
+		}
+	}
+	return nil
+}
+
+// bind compiles value and stores it in the newly defined variable symbol.
+func (c *Compiler) bind(symbol Symbol, value ast.Expression) error {
+	if !symbol.Cell {
+		if err := c.Compile(value); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		return nil
+	}
+
+	// closures in the value capture the cell before it is filled
+	c.emit(code.OpNull)
+	c.emit(code.OpMakeCell)
+	c.storeSymbol(symbol)
+	if err := c.Compile(value); err != nil {
+		return err
+	}
+	c.assignSymbol(symbol)
+	return nil
+}
+
+// loadSymbol loads the value of s.
+func (c *Compiler) loadSymbol(s Symbol) {
+	c.loadSlot(s)
+	if s.Cell {
+		c.emit(code.OpLoadCell)
+	}
+}
+
+// loadSlot loads what the slot of s holds, which is the cell of cell
+// variables.
+func (c *Compiler) loadSlot(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// storeNew stores the value on the stack in the newly defined variable s.
+func (c *Compiler) storeNew(s Symbol) {
+	if s.Cell {
+		c.emit(code.OpMakeCell)
+	}
+	c.storeSymbol(s)
+}
+
+// assignSymbol stores the value on the stack in the existing variable s.
+func (c *Compiler) assignSymbol(s Symbol) {
+	if !s.Cell {
+		c.storeSymbol(s)
+		return
+	}
+	c.loadSlot(s)
+	c.emit(code.OpStoreCell)
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// emitAt emits an instruction attributed to node, which is where the errors
+// it raises are reported.
+func (c *Compiler) emitAt(node ast.Node, op code.Opcode, operands ...int) int {
+	outerPos, outerEnd := c.pos, c.end
+	c.pos, c.end = nodeSpan(node)
+	defer func() { c.pos, c.end = outerPos, outerEnd }()
+	return c.emit(op, operands...)
+}
+
+// checkOperands records an error if an operand of op does not fit its width,
+// where code.Make would silently truncate it.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	if c.err != nil {
+		return
+	}
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return
+	}
+	for i, o := range operands {
+		if limit := 1<<(8*uint(def.OperandWidths[i])) - 1; o < 0 || o > limit {
+			c.err = errorf(c.pos, "%s (%d, the limit is %d)", operandLimit(op, i), o, limit)
+			return
+		}
+	}
+}
+
+// operandLimit describes what exceeds the i-th operand of op.
+func operandLimit(op code.Opcode, i int) string {
+	switch op {
+	case code.OpConstant, code.OpImport:
+		return "too many constants"
+	case code.OpClosure:
+		if i == 0 {
+			return "too many constants"
+		}
+		return "too many free variables"
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return "too many global variables"
+	case code.OpGetLocal, code.OpSetLocal:
+		return "too many local variables"
+	case code.OpGetFree:
+		return "too many free variables"
+	case code.OpArray, code.OpMatchArray, code.OpDestructureArray, code.OpArrayRest:
+		return "too many array elements"
+	case code.OpHash, code.OpMatchHash, code.OpDestructureHash:
+		return "too many hash entries"
+	case code.OpCall, code.OpCallNamed:
+		return "too many arguments"
+	case code.OpJumpIfPassed:
+		if i == 0 {
+			return "too many parameters"
+		}
+	case code.OpTemplate:
+		return "too many template parts"
+	}
+	return "code too long"
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.scopes[c.scopeIndex].lines.AddSpan(posNewInstruction, c.pos, c.end)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lines.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operands)
+	newInstruction := code.Make(op, operands...)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
@@ -0,0 +1,1234 @@
+package compiler
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true == false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpFalse),
+				code.Make(code.OpEqual),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `if (true) { 10 }; 3333;`,
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (true) { let a = 10; } else { 20 }`,
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let one = 1; let two = one; two;`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `["a", 1][0]`,
+			expectedConstants: []interface{}{"a", 1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{1: 2}`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn(a) { a }; f(1);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { fn(b) { a + b } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let countDown = fn(x) { countDown(x - 1); };`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the block gets its own slot for `a`, the outer one is unchanged
+			input:             `let a = 1; if (a) { let a = 2; a }; a`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 24),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpSetGlobal, 1),
+				// 0018
+				code.Make(code.OpGetGlobal, 1),
+				// 0021
+				code.Make(code.OpJump, 25),
+				// 0024
+				code.Make(code.OpNull),
+				// 0025
+				code.Make(code.OpPop),
+				// 0026
+				code.Make(code.OpGetGlobal, 0),
+				// 0029
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { if (a) { let b = a; fn() { b } } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 18),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpSetLocal, 1),
+					// 0009
+					code.Make(code.OpGetLocal, 1),
+					// 0011
+					code.Make(code.OpClosure, 0, 1),
+					// 0015
+					code.Make(code.OpJump, 19),
+					// 0018
+					code.Make(code.OpNull),
+					// 0019
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 16),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the finally block runs on the way out and before rethrowing
+			input:             `try { throw 1 } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 12),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpThrow),
+				// 0007
+				code.Make(code.OpNull),
+				// 0008
+				code.Make(code.OpEndTry),
+				// 0009
+				code.Make(code.OpJump, 17),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpThrow),
+				// 0017
+				code.Make(code.OpConstant, 2),
+				// 0020
+				code.Make(code.OpPop),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { try { return 1; } finally { 2 } }`,
+			expectedConstants: []interface{}{
+				1, 2, 2, 2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 16),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpEndTry),
+					// 0007
+					code.Make(code.OpConstant, 1),
+					// 0010
+					code.Make(code.OpPop),
+					// 0011
+					code.Make(code.OpReturnValue),
+					// 0012
+					code.Make(code.OpEndTry),
+					// 0013
+					code.Make(code.OpJump, 21),
+					// 0016
+					code.Make(code.OpConstant, 2),
+					// 0019
+					code.Make(code.OpPop),
+					// 0020
+					code.Make(code.OpThrow),
+					// 0021
+					code.Make(code.OpConstant, 3),
+					// 0024
+					code.Make(code.OpPop),
+					// 0025
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSymbolTableBlocks(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	b := block.Define("b")
+
+	fn := NewEnclosedSymbolTable(block)
+	c := fn.Define("c")
+
+	inner := NewBlockSymbolTable(fn)
+	d := inner.Define("d")
+
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+	for _, sym := range []Symbol{a, b, c, d} {
+		if sym != expected[sym.Name] {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, expected[sym.Name], sym)
+		}
+	}
+
+	for name, want := range expected {
+		got, ok := inner.Resolve(name)
+		if !ok || got != want {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, want, got)
+		}
+	}
+
+	if global.NumDefinitions() != 2 || inner.NumDefinitions() != 2 {
+		t.Errorf("wrong number of definitions. global=%d, fn=%d",
+			global.NumDefinitions(), inner.NumDefinitions())
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { break; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10),
+				// 0007
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			// the iterator lives in a hidden variable next to x
+			input:             `for (x in [1]) { x }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpNext, 26),
+				// 0016
+				code.Make(code.OpSetGlobal, 1),
+				// 0019
+				code.Make(code.OpGetGlobal, 1),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpJump, 10),
+			},
+		},
+		{
+			// continue leaves the try expression, running its finally block
+			input:             `while (true) { try { continue; } finally { 1 } }`,
+			expectedConstants: []interface{}{1, 1, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 33),
+				// 0004
+				code.Make(code.OpTry, 20),
+				// 0007
+				code.Make(code.OpEndTry),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 0),
+				// 0015
+				code.Make(code.OpNull),
+				// 0016
+				code.Make(code.OpEndTry),
+				// 0017
+				code.Make(code.OpJump, 25),
+				// 0020
+				code.Make(code.OpConstant, 1),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpThrow),
+				// 0025
+				code.Make(code.OpConstant, 2),
+				// 0028
+				code.Make(code.OpPop),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpJump, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = 1; x += 2;`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; a[0] = 2; a[0] *= 2`,
+			expectedConstants: []interface{}{1, 0, 2, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// n is captured and assigned, so it lives in a cell
+			input: `fn() { let n = 0; fn() { n += 1 } }`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpLoadCell),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpStoreCell),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpLoadCell),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpMakeCell),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpStoreCell),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { fn() { a = 2 } }`,
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpStoreCell),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpLoadCell),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpMakeCell),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = [1]; match (x) { [a] if a => a, 1 => 2 }`,
+			expectedConstants: []interface{}{1, 0, 1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				// 0009: the subject
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				// 0015: [a] if a
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpMatchArray, 1, 0),
+				code.Make(code.OpJumpNotTruthy, 47),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpJumpNotTruthy, 47),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpJump, 67),
+				// 0047: 1
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpEqual),
+				code.Make(code.OpJumpNotTruthy, 63),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpJump, 67),
+				// 0063
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpNoMatch),
+				// 0067
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(h) { match (h) { {"k": _} => 1 } }`,
+			expectedConstants: []interface{}{"k", 1, []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMatchHash, 1),
+				code.Make(code.OpJumpNotTruthy, 21),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpJump, 24),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpNoMatch),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...r] = [1];`,
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDestructureArray, 1, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArrayRest, 1),
+				code.Make(code.OpSetGlobal, 2),
+			},
+		},
+		{
+			input: `fn({k}) { k }`,
+			expectedConstants: []interface{}{"k", "k", []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDestructureHash, 1),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNumberLiterals(t *testing.T) {
+	n, _ := new(big.Int).SetString("99999999999999999999", 10)
+	tests := []compilerTestCase{
+		{
+			input: "99999999999999999999 + 1.50",
+			expectedConstants: []interface{}{
+				&object.BigInt{Value: n},
+				&object.Decimal{Unscaled: big.NewInt(150), Scale: 2},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "`a ${1}${2}`",
+			expectedConstants: []interface{}{"a ", 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpTemplate, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "``",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTemplate, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = 2, ...r) { b }`,
+			expectedConstants: []interface{}{2, []code.Instructions{
+				code.Make(code.OpJumpIfPassed, 1, 9),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpSetLocal, 3),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpSetLocal, 4),
+				code.Make(code.OpGetLocal, 3),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `len(1, b: 2)`,
+			expectedConstants: []interface{}{1, "b", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCallNamed, 1, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	c := New()
+	if err := c.Compile(parse(`fn(a, [b] = [1], ...r) { a }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := c.Bytecode().Constants
+	fn := constants[len(constants)-1].(*object.CompiledFunction)
+	if fn.NumParameters != 2 || fn.Signature.Format("f") != "f(a, [b] = [1], ...r)" {
+		t.Errorf("wrong signature. got=%d parameters, %s", fn.NumParameters, fn.Signature.Format("f"))
+	}
+}
+
+func TestImports(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `import "lib/m.mk" as m; export let a = m["x"]; export const b = 1;`,
+			expectedConstants: []interface{}{"lib/m.mk", "x", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 2),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (true) { import "m.mk" as m }`, "1:13: import is only allowed at the top level"},
+		{`fn() { export let a = 1; }`, "1:8: export is only allowed at the top level"},
+		{`import "m.mk" as m; m = 1`, "1:21: cannot assign to constant m"},
+	}
+
+	for _, tt := range errorTests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	err := New().Compile(parse("let a = 1;\nb"))
+	if err == nil || err.Error() != "2:1: undefined variable b" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("if (true) { let x = 1; }; x"))
+	if err == nil || err.Error() != "1:27: undefined variable x" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("if (true) { break; }"))
+	if err == nil || err.Error() != "1:13: break outside of a loop" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("while (true) { fn() { continue; } }"))
+	if err == nil || err.Error() != "1:23: continue outside of a loop" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("let a = 1;\nb += a"))
+	if err == nil || err.Error() != "2:1: assignment to undeclared variable b" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("len = 1"))
+	if err == nil || err.Error() != "1:1: cannot assign to builtin len" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("const a = 1;\na += 1"))
+	if err == nil || err.Error() != "2:1: cannot assign to constant a" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("const f = fn() { let g = fn() { f = 1 } }"))
+	if err == nil || err.Error() != "1:33: cannot assign to constant f" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	err = New().Compile(parse("const a = 1; if (true) { let a = 2; a = 3; }; a = 4"))
+	if err == nil || err.Error() != "1:47: cannot assign to constant a" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+	for input, expected := range map[string]string{
+		"const k = 1; let k = 2;":                 "1:18: cannot redeclare constant k",
+		"const k = 1; const k = 2;":               "1:20: cannot redeclare constant k",
+		"const k = 1; let [a, k] = [1, 2];":       "1:22: cannot redeclare constant k",
+		`import "m.mk" as m; let m = 1;`:          "1:25: cannot redeclare constant m",
+		"let f = fn() { const k = 1; let k = 2 }": "1:33: cannot redeclare constant k",
+	} {
+		err = New().Compile(parse(input))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", input, expected, err)
+		}
+	}
+
+	err = New().Compile(parse("let d = 0." + strings.Repeat("0", 1000) + "1;"))
+	if err == nil || err.Error() != "1:9: decimal with 1001 digits after the point exceeds the precision of 1000" {
+		t.Errorf("wrong error for a decimal literal too precise. got=%v", err)
+	}
+
+	// operands that do not fit their width are rejected, not truncated
+	locals := make([]string, 300)
+	args := make([]string, 300)
+	for i := range locals {
+		locals[i] = fmt.Sprintf("let v%c%c = %d;", 'a'+i/26, 'a'+i%26, i)
+		args[i] = "0"
+	}
+	constants := make([]string, 65537)
+	for i := range constants {
+		constants[i] = fmt.Sprintf("%d;", i)
+	}
+	for input, expected := range map[string]string{
+		"[" + strings.Repeat("true, ", 69999) + "true]":        "1:1: too many array elements (70000, the limit is 65535)",
+		"let f = fn() { " + strings.Join(locals, " ") + " };":  "1:3746: too many local variables (256, the limit is 255)",
+		"let f = fn() {}; f(" + strings.Join(args, ", ") + ")": "1:19: too many arguments (300, the limit is 255)",
+		strings.Join(constants, " "):                           "1:447643: too many constants (65536, the limit is 65535)",
+		"if (true) { " + strings.Repeat("1; ", 20000) + "}; 2": "1:1: code too long (80006, the limit is 65535)",
+	} {
+		err = New().Compile(parse(input))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%.40s...: wrong error. want=%q, got=%v", input, expected, err)
+		}
+	}
+
+	// constants can be shadowed in nested scopes
+	for _, input := range []string{
+		"const k = 1; if (true) { let k = 2; k }",
+		"const k = 1; let f = fn() { k; let k = 2; k }",
+		"let k = 1; const k = 2;",
+	} {
+		if err := New().Compile(parse(input)); err != nil {
+			t.Errorf("%s: unexpected error: %v", input, err)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `const a = 1; let f = fn() { const b = a; b }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	c := New()
+	if err := c.Compile(parse("const a = 1; let b = 2;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	for _, sym := range c.SymbolTable().Symbols() {
+		if sym.Const != (sym.Name == "a") {
+			t.Errorf("wrong Const for %s. got=%t", sym.Name, sym.Const)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `len([]); fn() { len }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestExternals(t *testing.T) {
+	c := New()
+	c.EnableExternals()
+	err := c.Compile(parse("let a = 1;\nlet f = fn() { a + b };\nb"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	externals := c.Externals()
+	if len(externals) != 1 {
+		t.Fatalf("wrong number of externals. got=%d", len(externals))
+	}
+	b := externals[0]
+	if b.Name != "b" || b.Scope != GlobalScope || b.Index != 2 || b.Pos.String() != "2:20" {
+		t.Errorf("wrong external. got=%+v", b)
+	}
+
+	var names []string
+	for _, sym := range c.SymbolTable().Symbols() {
+		names = append(names, sym.Name)
+	}
+	if fmt.Sprint(names) != "[a f b]" {
+		t.Errorf("wrong globals. got=%v", names)
+	}
+
+	c = New()
+	c.EnableExternals()
+	if err := c.Compile(parse("let a = 1;\nlimit = a")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if externals := c.Externals(); len(externals) != 1 || externals[0].Name != "limit" || externals[0].Pos.String() != "2:1" {
+		t.Errorf("wrong externals. got=%+v", externals)
+	}
+
+	// with global cells, globals and externals are loaded from their cells
+	c = New()
+	c.EnableExternals()
+	c.EnableGlobalCells()
+	if err := c.Compile(parse("let a = 1;\nlimit = a")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	for _, sym := range c.SymbolTable().Symbols() {
+		if !sym.Cell {
+			t.Errorf("global %s not in a cell", sym.Name)
+		}
+	}
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpNull),
+		code.Make(code.OpMakeCell),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpStoreCell),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpLoadCell),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpStoreCell),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpLoadCell),
+		code.Make(code.OpPop),
+	})
+	if err := testInstructions([]code.Instructions{expected}, c.Bytecode().Instructions); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q",
+			concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q",
+				i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. want=%d, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - wrong string. want=%q, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+
+		case object.Object:
+			if fmt.Sprintf("%T", actual[i]) != fmt.Sprintf("%T", constant) || actual[i].Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong value. want=%T %s, got=%T %s",
+					i, constant, constant.Inspect(), actual[i], actual[i].Inspect())
+			}
+
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T",
+					i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s",
+					i, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+	BuiltinScope  SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Cell  bool // the slot holds an *object.Cell with the value
+	Const bool // the variable can not be assigned
+}
+
+// SymbolTable maps names to storage slots. There is one table for the
+// program, one for every function and one for every block statement. Block
+// tables hand out slots of the enclosing function (or of the globals), so a
+// block never needs a frame of its own.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	block          bool
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+// NewEnclosedSymbolTable returns the table of a function nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable returns the table of a block statement in outer.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// function returns the table owning the slots of s.
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// NumDefinitions returns the number of slots used by the function (or the
+// program) of s, including the slots of its blocks.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.function().numDefinitions
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	fn := s.function()
+
+	symbol := Symbol{Name: name, Index: fn.numDefinitions}
+	if fn.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	fn.numDefinitions++
+	return symbol
+}
+
+// makeCell keeps the local name, just defined in s, in a cell.
+func (s *SymbolTable) makeCell(name string) Symbol {
+	symbol := s.store[name]
+	symbol.Cell = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// makeConst makes the name, just defined in s, a constant.
+func (s *SymbolTable) makeConst(name string) Symbol {
+	symbol := s.store[name]
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineBuiltin makes name refer to the builtin at index in
+// object.Builtins.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName makes the function being compiled refer to itself by
+// name.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Cell: original.Cell, Const: original.Const}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Symbols returns the symbols defined directly in s, builtins excepted.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, sym := range s.store {
+		if sym.Scope != BuiltinScope {
+			symbols = append(symbols, sym)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Index < symbols[j].Index })
+	return symbols
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// resolveVariable resolves name as the target of an assignment. Inside a
+// function, the name of the function refers to the variable it is bound to
+// rather than to the function itself.
+func (s *SymbolTable) resolveVariable(name string) (Symbol, bool) {
+	return s.resolve(name, true)
+}
+
+func (s *SymbolTable) resolve(name string, variable bool) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok && variable && obj.Scope == FunctionScope {
+		ok = false
+	}
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+
+	obj, ok = s.Outer.resolve(name, variable)
+	if !ok {
+		return obj, ok
+	}
+
+	// blocks share the slots of their function; functions refer to globals
+	// directly, except for the cells of top-level blocks, which they capture
+	if s.block || obj.Scope == GlobalScope && !obj.Cell || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+
+	return s.defineFree(obj), true
+}
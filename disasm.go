@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/riadafridishibly/go-monkey/bytecode"
+)
+
+func disasmCommand(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey disasm file")
+		fmt.Fprintln(flags.Output(), "file is either a compiled program or monkey source.")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	f, src, err := loadProgram(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey disasm: %v\n", err)
+		return 1
+	}
+
+	if err := bytecode.Disassemble(os.Stdout, f, src); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey disasm: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,813 @@
+// Package evaluator interprets Monkey programs by walking their AST.
+//
+// It is the reference the virtual machine is measured against; programs are
+// normally run by the compiler and the vm packages.
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return evalProgram(node, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: object.NULL}
+		}
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		exc := object.Throw(val, ast.Pos(node))
+		return &object.Error{Message: exc.Message, Exception: exc}
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BranchStatement:
+		return &branch{Token: node.Token}
+
+	case *ast.LetStatement:
+		if err := checkRedeclared(env, ast.PatternNames(node.Name)...); err != nil {
+			return err
+		}
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if err := bind(node.Name, val, env); err != nil {
+			return result(nil, err)
+		}
+
+	case *ast.ConstStatement:
+		if err := checkRedeclared(env, node.Name); err != nil {
+			return err
+		}
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.SetConst(node.Name.Value, val)
+
+	case *ast.ImportStatement:
+		imp := env.Importer()
+		if imp == nil {
+			return newError(object.KindImport, "cannot import %q: no module loader", node.Path.Value)
+		}
+		if err := checkRedeclared(env, node.Name); err != nil {
+			return err
+		}
+		mod := result(imp.Import(node.Path.Value))
+		if isError(mod) {
+			return mod
+		}
+		env.SetConst(node.Name.Value, mod)
+
+	case *ast.ExportStatement:
+		return Eval(node.Binding, env)
+
+	case *ast.InetegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.BigIntegerLiteral:
+		return &object.BigInt{Value: node.Value}
+
+	case *ast.DecimalLiteral:
+		return result(object.NewDecimal(node.Unscaled, node.Scale))
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.TemplateLiteral:
+		parts := evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isError(parts[0]) {
+			return parts[0]
+		}
+		return object.Template(parts)
+
+	case *ast.Boolean:
+		return object.NativeBoolToBoolean(node.Value)
+
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return result(object.PrefixWith(hostOf(env), node.Operator, right))
+
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		h := hostOf(env)
+		return result(h.checkAlloc(object.InfixWith(h, node.Operator, left, right)))
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+			Name:       node.Name,
+		}
+
+	case *ast.MacroLiteral:
+		return newError(object.KindError, "macro literals must be bound by a top-level let statement")
+
+	case *ast.CallExpression:
+		if isCallOf(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError(object.KindArgument, "wrong number of arguments to quote: want=1, got=%d", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		if len(node.NamedArguments) == 0 {
+			return applyFunction(hostOf(env), function, args)
+		}
+		names := make([]string, len(node.NamedArguments))
+		values := make([]object.Object, len(node.NamedArguments))
+		for i, arg := range node.NamedArguments {
+			names[i] = arg.Name.Value
+			if values[i] = Eval(arg.Value, env); isError(values[i]) {
+				return values[i]
+			}
+		}
+		return applyNamed(hostOf(env), function, args, names, values)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return result(object.IndexWith(hostOf(env), left, index))
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	default:
+		return newError(object.KindError, "cannot evaluate %T", node)
+	}
+
+	return nil
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		case *branch:
+			return result.outside()
+		}
+	}
+
+	return result
+}
+
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == branchObj {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	h := hostOf(env)
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Get(target.Value)
+		if !ok {
+			if _, ok := object.GetBuiltinByName(target.Value); ok {
+				return newError(object.KindError, "cannot assign to builtin %s", target.Value)
+			}
+			return newError(object.KindError, "assignment to undeclared variable %s", target.Value)
+		}
+		if env.IsConst(target.Value) {
+			return newError(object.KindType, "cannot assign to constant %s", target.Value)
+		}
+
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if operator != "" {
+			if val = result(h.checkAlloc(object.InfixWith(h, operator, current, val))); isError(val) {
+				return val
+			}
+		}
+		env.Assign(target.Value, val)
+		return val
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if operator != "" {
+			if current = result(object.IndexWith(h, left, index)); isError(current) {
+				return current
+			}
+		}
+
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if operator != "" {
+			if val = result(h.checkAlloc(object.InfixWith(h, operator, current, val))); isError(val) {
+				return val
+			}
+		}
+		if err := object.SetIndex(left, index, val); err != nil {
+			return result(nil, err)
+		}
+		if _, err := h.checkAlloc(left, nil); err != nil {
+			return result(nil, err)
+		}
+		return val
+	}
+
+	return newError(object.KindError, "cannot assign to %s", node.Target)
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	var block object.Object
+	if object.IsTruthy(condition) {
+		block = Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		block = Eval(ie.Alternative, env)
+	}
+
+	if block == nil {
+		// empty blocks and blocks ending in a let statement
+		return object.NULL
+	}
+	return block
+}
+
+// evalTryExpression evaluates the try block, and the catch block if it
+// raised an error. The finally block always runs; its errors and returns
+// take over from the result.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	val := Eval(te.Block, env)
+
+	// exceeded limits can not be caught
+	if err, ok := val.(*object.Error); ok && te.Catch != nil && err.Exception.Kind != object.KindLimit {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if te.CatchParam != nil {
+			catchEnv.Set(te.CatchParam.Value, err.Exception)
+		}
+		val = evalBlockStatement(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil {
+		finally := Eval(te.Finally, env)
+		if finally != nil {
+			rt := finally.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == branchObj {
+				return finally
+			}
+		}
+	}
+
+	if val == nil {
+		return object.NULL
+	}
+	return val
+}
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches the subject and whose guard holds, in an environment with the
+// names the pattern binds.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		if !matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+
+		val := evalBlockStatement(arm.Body, armEnv)
+		if val == nil {
+			return object.NULL
+		}
+		return val
+	}
+
+	return result(nil, object.NoMatch(subject))
+}
+
+// matchPattern reports whether val matches p, binding the names of p in
+// env.
+func matchPattern(p ast.Pattern, val object.Object, env *object.Environment) bool {
+	switch p := p.(type) {
+	case *ast.WildcardPattern:
+		return true
+
+	case *ast.Identifier:
+		env.Set(p.Value, val)
+		return true
+
+	case *ast.InetegerLiteral, *ast.BigIntegerLiteral, *ast.DecimalLiteral, *ast.StringLiteral, *ast.Boolean:
+		return object.Equal(Eval(p, env), val)
+
+	case *ast.ArrayPattern:
+		if !object.MatchArray(val, len(p.Elements), p.Rest != nil) {
+			return false
+		}
+		for i, elem := range p.Elements {
+			if !matchPattern(elem, val.(*object.Array).Elements[i], env) {
+				return false
+			}
+		}
+		if p.Rest != nil {
+			return matchPattern(p.Rest, object.ArrayRest(val, len(p.Elements)), env)
+		}
+		return true
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(p.Pairs))
+		for i, pair := range p.Pairs {
+			keys[i] = Eval(pair.Key, env)
+		}
+		if !object.MatchHash(val, keys) {
+			return false
+		}
+		for i, pair := range p.Pairs {
+			value, _ := val.(*object.Hash).Get(keys[i].(object.Hashable))
+			if !matchPattern(pair.Value, value, env) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// bind binds the names of p, the name of a let statement or a parameter, to
+// the parts of val they stand for. Unlike matchPattern it fails with an
+// error if val does not have the shape of p.
+// checkRedeclared returns an error if one of idents names a constant bound
+// in env itself, which let, const and import statements can not declare
+// again.
+func checkRedeclared(env *object.Environment, idents ...*ast.Identifier) *object.Error {
+	for _, ident := range idents {
+		if env.DeclaresConst(ident.Value) {
+			return newError(object.KindType, "cannot redeclare constant %s", ident.Value)
+		}
+	}
+	return nil
+}
+
+func bind(p ast.Pattern, val object.Object, env *object.Environment) error {
+	switch p := p.(type) {
+	case *ast.WildcardPattern:
+		// binds nothing
+
+	case *ast.Identifier:
+		env.Set(p.Value, val)
+
+	case *ast.ArrayPattern:
+		if err := object.DestructureArray(val, len(p.Elements), p.Rest != nil); err != nil {
+			return err
+		}
+		for i, elem := range p.Elements {
+			if err := bind(elem, val.(*object.Array).Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if p.Rest != nil {
+			return bind(p.Rest, object.ArrayRest(val, len(p.Elements)), env)
+		}
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(p.Pairs))
+		for i, pair := range p.Pairs {
+			keys[i] = Eval(pair.Key, env)
+		}
+		if err := object.DestructureHash(val, keys); err != nil {
+			return err
+		}
+		for i, pair := range p.Pairs {
+			value, _ := val.(*object.Hash).Get(keys[i].(object.Hashable))
+			if err := bind(pair.Value, value, env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	limiter := env.Limiter()
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !object.IsTruthy(condition) {
+			return nil
+		}
+
+		if result, done := evalLoopBody(ws.Body, object.NewEnclosedEnvironment(env), limiter); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	iter, err := object.NewIterator(iterable)
+	if err != nil {
+		return result(nil, err)
+	}
+
+	limiter := env.Limiter()
+	for {
+		item, ok := iter.Next()
+		if !ok {
+			return nil
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, item)
+		if result, done := evalLoopBody(fs.Body, loopEnv, limiter); done {
+			return result
+		}
+	}
+}
+
+// evalLoopBody evaluates one iteration of a loop, bounded by limiter if it
+// is not nil, and reports whether the loop ends, along with what the loop
+// then evaluates to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment, limiter object.Limiter) (object.Object, bool) {
+	if limiter != nil {
+		if err := limiter.Enter(); err != nil {
+			return result(nil, err), true
+		}
+		defer limiter.Leave()
+	}
+
+	switch result := evalBlockStatement(body, env).(type) {
+	case *branch:
+		return nil, result.Token.Type == token.BREAK
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	}
+	return nil, false
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := object.GetBuiltinByName(node.Value); ok {
+		return builtin
+	}
+
+	return newError(object.KindError, "identifier not found: %s", node.Value)
+}
+
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(object.KindType, "unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+func applyFunction(h host, fn object.Object, args []object.Object) object.Object {
+	return applyNamed(h, fn, args, nil, nil)
+}
+
+// applyNamed calls fn with the positional arguments args followed by the
+// arguments named names, whose values are named. h is the host of the
+// caller.
+func applyNamed(h host, fn object.Object, args []object.Object, names []string, named []object.Object) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		if len(names) > 0 {
+			return newError(object.KindArgument, "%s: named arguments are not supported by builtins", builtin.Name)
+		}
+		if h.limiter != nil {
+			if err := h.limiter.Permit(builtin); err != nil {
+				return result(nil, err)
+			}
+		}
+		obj, err := builtin.Fn(h, args...)
+		if obj == nil && err == nil {
+			obj = object.NULL
+		}
+		return result(obj, err)
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError(object.KindType, "calling non-function: %s", fn.Type())
+	}
+
+	if h.limiter != nil {
+		if err := h.limiter.Enter(); err != nil {
+			return result(nil, err)
+		}
+		defer h.limiter.Leave()
+	}
+
+	env := object.NewEnclosedEnvironment(function.Env)
+	if err := bindArguments(function, args, names, named, env); err != nil {
+		return err
+	}
+
+	evaluated := evalBlockStatement(function.Body, env)
+	switch evaluated := evaluated.(type) {
+	case *object.ReturnValue:
+		return evaluated.Value
+	case *branch:
+		return evaluated.outside()
+	}
+	if evaluated == nil {
+		return object.NULL
+	}
+	return evaluated
+}
+
+// bindArguments binds the parameters of function to the arguments of a call
+// in env. Default values are evaluated in env, after the parameters before
+// them are bound.
+func bindArguments(function *object.Function, args []object.Object, names []string, named []object.Object, env *object.Environment) object.Object {
+	params := function.Parameters
+	if len(names) == 0 && function.Defaults == nil && function.Rest == nil {
+		if len(args) != len(params) {
+			return result(nil, function.Signature().ArityError(function.Name, len(args)))
+		}
+		for i, param := range params {
+			if err := bind(param, args[i], env); err != nil {
+				return result(nil, err)
+			}
+		}
+		return nil
+	}
+
+	indexes, err := function.Signature().Bind(function.Name, len(args), names)
+	if err != nil {
+		return result(nil, err)
+	}
+	values := make([]object.Object, len(params))
+	copy(values, args)
+	for i, index := range indexes {
+		values[index] = named[i]
+	}
+
+	for i, param := range params {
+		val := values[i]
+		if val == nil {
+			if val = Eval(function.Defaults[i], env); isError(val) {
+				return val
+			}
+		}
+		if err := bind(param, val, env); err != nil {
+			return result(nil, err)
+		}
+	}
+	if function.Rest != nil {
+		var rest []object.Object
+		if len(args) > len(params) {
+			rest = args[len(params):]
+		}
+		env.Set(function.Rest.Value, &object.Array{Elements: append([]object.Object{}, rest...)})
+	}
+	return nil
+}
+
+const branchObj = "BRANCH"
+
+// branch is a break or continue statement on its way to the enclosing loop.
+type branch struct {
+	Token token.Token
+}
+
+func (b *branch) Type() object.ObjectType { return branchObj }
+func (b *branch) Inspect() string         { return b.Token.Literal }
+
+// outside returns the error of a branch that left its function or the
+// program without meeting a loop.
+func (b *branch) outside() *object.Error {
+	return newError(object.KindError, "%s outside of a loop", b.Token.Literal)
+}
+
+// host lets builtins call functions and print to the standard output. Its
+// limiter, if any, bounds the functions and allocations of the builtins.
+type host struct {
+	limiter object.Limiter
+}
+
+// hostOf returns the host of the code evaluated in env.
+func hostOf(env *object.Environment) host {
+	return host{limiter: env.Limiter()}
+}
+
+func (h host) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(h, fn, args)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err.Exception
+	}
+	return result, nil
+}
+
+func (host) Output() io.Writer { return os.Stdout }
+
+func (h host) Alloc(t object.ObjectType, size int) error {
+	if h.limiter == nil {
+		return nil
+	}
+	return h.limiter.Alloc(t, size)
+}
+
+// checkAlloc passes on the outcome of an operation, unless it created a
+// string, an array or a hash the limiter of h does not allow.
+func (h host) checkAlloc(obj object.Object, err error) (object.Object, error) {
+	if err != nil || h.limiter == nil {
+		return obj, err
+	}
+	switch v := obj.(type) {
+	case *object.String:
+		err = h.Alloc(v.Type(), len(v.Value))
+	case *object.Array:
+		err = h.Alloc(v.Type(), len(v.Elements))
+	case *object.Hash:
+		err = h.Alloc(v.Type(), len(v.Keys))
+	}
+	return obj, err
+}
+
+// result turns the outcome of an object operation into an object.
+func result(obj object.Object, err error) object.Object {
+	if err == nil {
+		return obj
+	}
+	var exc *object.Exception
+	if !errors.As(err, &exc) {
+		exc = &object.Exception{Kind: object.KindOf(err), Message: err.Error()}
+	}
+	return &object.Error{Message: exc.Message, Exception: exc}
+}
+
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	msg := fmt.Sprintf(format, a...)
+	return &object.Error{Message: msg, Exception: &object.Exception{Kind: kind, Message: msg}}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + 5 * 2", "15"},
+		{"!true", "false"},
+		{`"a" + "b"`, `"ab"`},
+		{"if (1 > 2) { 10 }", "null"},
+		{"if (1 < 2) { 10 } else { 20 }", "10"},
+		{"let a = 5; let b = a * 2; b", "10"},
+		{"let a = 1; if (true) { let a = 2; a } + a", "3"},
+		{"let a = 1; if (true) { let a = 2; }; a", "1"},
+		{"if (true) { if (true) { return 10; } return 1; }", "10"},
+		{"let f = fn(x) { x * 2 }; f(4)", "8"},
+		{"let f = fn() { }; f()", "null"},
+		{"let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)", "5"},
+		{"[1, 2 * 2][1]", "4"},
+		{`{"a": 1, true: 2}[true]`, "2"},
+		{`try { throw 1 } catch (e) { e["value"] + 1 }`, "2"},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, `"ArithmeticError"`},
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()`, "20"},
+		{`let f = fn(h) { for (k in h) { if (k == "b") { continue; } return k; } }; f({"b": 1, "a": 2})`, `"a"`},
+		{`let f = fn() { while (true) { break; } 5 }; f()`, "5"},
+		{`let x = 1; if (true) { x += 2; let x = 10; x = 20; }; x`, "3"},
+		{`let c = fn() { let n = 0; fn() { n += 1 } }(); c(); c()`, "2"},
+		{`let a = [1, 2]; a[1] *= 5; let h = {}; h["k"] = a; h`, `{"k": [1, 10]}`},
+		{`const a = 1; let f = fn() { let a = 2; a += 1; a }; f() + a`, "4"},
+		{`const a = 1; if (true) { const a = 2; a } + a`, "3"},
+		{`let h = freeze({"a": [1]}); [frozen(h), frozen(h["a"]), frozen([])]`, "[true, true, false]"},
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, `"two"`},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ({"k": 5, "x": 1}) { {"k": 1} => 0, {"k": n} if n > 3 => n * 2 }`, "10"},
+		{`let f = fn(x) { match (x) { [] => 0, [_] => 1, n => n } }; [f([]), f([7]), f(5), f([1, 2])]`, "[0, 1, 5, [1, 2]]"},
+		{`let x = 1; match (2) { x => x }; x`, "1"},
+		{`let [a, [b], ...r] = [1, [2], 3, 4]; [a + b, r]`, "[3, [3, 4]]"},
+		{`let {name, "a b": [c, ..._]} = {"name": "n", "a b": [1, 2]}; [name, c]`, `["n", 1]`},
+		{`let f = fn([a, b], {k}) { a * b + k }; f([2, 3], {"k": 1})`, "7"},
+		{`let f = fn(a, b = a * 2, c = a + b) { [a, b, c] }; [f(1), f(1, 5), f(1, c: 0)]`, "[[1, 2, 3], [1, 5, 6], [1, 2, 0]]"},
+		{`let f = fn(first, ...others) { [first, others] }; [f(1), f(1, 2, 3)]`, "[[1, []], [1, [2, 3]]]"},
+		{`let f = fn(a, b) { a - b }; f(b: 1, a: 10)`, "9"},
+		{`let b = 10; let f = fn(a = b, b = 1) { a }; f()`, "10"},
+		{`fn(a, b = 2, ...r) { a }`, "fn(a, b = 2, ...r) { a }"},
+		{"let n = 2; `${n} items: ${[n, \"s\"]} ${`in ${n * 2}`}`", `"2 items: [2, \"s\"] in 4"`},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"99999999999999999999 - 99999999999999999998", "1"},
+		{"let price = 19.99; let total = price * 3; [total, round(total * 1.08, 2), total / 4]", "[59.97, 64.77, 14.9925]"},
+		{"[0.1 + 0.2 == 0.3, 1 == 1.0, {1: \"a\"}[1.00]]", `[true, true, "a"]`},
+		{`match (2.50) { 2.5 => "x", _ => "y" }`, `"x"`},
+		{`let Vec = {"+": fn(a, b) { new(Vec, {"x": a["x"] + b["x"]}) }, "<": fn(a, b) { a["x"] < b["x"] }, "neg": fn(v) { new(Vec, {"x": -v["x"]}) }}; let v = new(Vec, {"x": 1}); let w = new(Vec, {"x": 3}); [(v + w)["x"], v < w, v > w, (-w)["x"], v == new(Vec, {"x": 1})]`, "[4, true, false, -3, false]"},
+		{`let P = {"==": fn(a, b) { a["id"] == b["id"] }, "[]": fn(h, k) { k * 2 }}; let p = new(P, {"id": 1}); let q = new(P, {"id": 1}); [p == q, p != q, p[21], p["id"]]`, "[true, false, 42, 1]"},
+	}
+
+	for _, tt := range tests {
+		got := testEval(t, tt.input)
+		if got.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, got.Inspect())
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true; 5", "type mismatch: INTEGER + BOOLEAN"},
+		{"if (10 > 1) { true + false; 1 }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"if (true) { let x = 1; }; x", "identifier not found: x"},
+		{"fn(a) { a }()", "wrong number of arguments to fn(a): want=1, got=0"},
+		{"1 / 0", "division by zero"},
+		{`{fn() {}: 1}`, "unusable as hash key: FUNCTION"},
+		{`throw "boom"`, "boom"},
+		{`for (x in 5) { x }`, "cannot iterate over INTEGER"},
+		{`break;`, "break outside of a loop"},
+		{`while (true) { fn() { continue; }() }`, "continue outside of a loop"},
+		{`x = 1`, "assignment to undeclared variable x"},
+		{`len = 1`, "cannot assign to builtin len"},
+		{`let a = []; a[0] = 1`, "array index out of range: 0 with length 0"},
+		{`const a = 1; a = 2`, "cannot assign to constant a"},
+		{`const a = 1; let f = fn() { a += 1 }; f()`, "cannot assign to constant a"},
+		{`const a = 1; let a = 2;`, "cannot redeclare constant a"},
+		{`const a = 1; let [b, a] = [1, 2];`, "cannot redeclare constant a"},
+		{`let f = fn() { const a = 1; const a = 2; }; f()`, "cannot redeclare constant a"},
+		{`let h = freeze({"a": [1]}); h["a"][0] = 2`, "cannot modify frozen ARRAY"},
+		{`match (2) { 1 => 1 }`, "no match for 2"},
+		{`match ([1]) { [a] => a }; a`, "identifier not found: a"},
+		{`let [a, b] = [1];`, "wrong number of elements to destructure: want=2, got=1"},
+		{`let [a, ...b] = [];`, "wrong number of elements to destructure: want>=1, got=0"},
+		{`let {name} = {"age": 1};`, `missing key "name" to destructure`},
+		{`let f = fn([a]) { a }; f(1)`, "cannot destructure INTEGER as an array"},
+		{`let f = fn(a, b = 2) { a }; f()`, "wrong number of arguments to f(a, b = 2): want=1 to 2, got=0"},
+		{`let f = fn(a, b) { a }; f(1, c: 2)`, "f(a, b) has no parameter c"},
+		{`let f = fn(a, b) { a }; f(b: 2)`, "missing argument a to f(a, b)"},
+		{`len(s: "a")`, "len: named arguments are not supported by builtins"},
+		{"`a ${1 + true}`", "type mismatch: INTEGER + BOOLEAN"},
+		{`let p = new({}, {}); p * 2`, `unknown operator: HASH * INTEGER: no "*" method in the prototype`},
+		{`let p = new({}, {}); -p`, `unknown operator: -HASH: no "neg" method in the prototype`},
+	}
+
+	for _, tt := range tests {
+		got, ok := testEval(t, tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error returned", tt.input)
+			continue
+		}
+		if got.Message != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got.Message)
+		}
+	}
+}
+
+// testImporter evaluates the modules it imports, given by their source, in
+// environments of their own and exports all their names.
+type testImporter map[string]string
+
+func (imp testImporter) Import(path string) (*object.Module, error) {
+	src, ok := imp[path]
+	if !ok {
+		return nil, fmt.Errorf("no module %s", path)
+	}
+	program := parser.New(lexer.New(src)).ParseProgram()
+	env := object.NewEnvironment()
+	env.SetImporter(imp)
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	exports := object.NewHash()
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			name := export.Binding.(*ast.LetStatement).Name.String()
+			value, _ := env.Get(name)
+			exports.Set(&object.String{Value: name}, value)
+		}
+	}
+	return &object.Module{Path: path, Exports: exports}, nil
+}
+
+func TestImports(t *testing.T) {
+	imp := testImporter{
+		"m": `let base = 10; export let add = fn(a) { a + base }; import "n" as nested; export let n = nested;`,
+		"n": `export let two = 2;`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string // inspected result, or error message
+	}{
+		{`import "m" as m; m["add"](1)`, "11"},
+		{`import "m" as m; [m["n"]["two"], m]`, `[2, <module "m">]`},
+		{`import "m" as m; m["base"]`, `module "m" has no export "base"`},
+		{`import "x" as x;`, "no module x"},
+		{`import "m" as m; m = 1`, "cannot assign to constant m"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetImporter(imp)
+		got := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		actual := got.Inspect()
+		if err, ok := got.(*object.Error); ok {
+			actual = err.Message
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+
+	got, ok := testEval(t, `import "m" as m;`).(*object.Error)
+	if !ok || got.Message != `cannot import "m": no module loader` || got.Exception.Kind != object.KindImport {
+		t.Errorf("wrong error without importer. got=%v", got)
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
+func TestQuote(t *testing.T) {
+	gensyms = 0
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5 + 8)`, `QUOTE((5 + 8))`},
+		{`quote(foobar)`, `QUOTE(foobar)`},
+		{`quote(unquote(4 + 4) * 2)`, `QUOTE((8 * 2))`},
+		{`let q = quote(4 + 4); quote(unquote(q) + 1)`, `QUOTE(((4 + 4) + 1))`},
+		{`quote(unquote(true == false))`, `QUOTE(false)`},
+		{`quote(unquote([1, "a", {"b": -2}]))`, `QUOTE([1, "a", {"b": -2}])`},
+		{`quote(unquote(9223372036854775807 + 1) + unquote(1.5 * 2))`, `QUOTE((9223372036854775808 + 3.0))`},
+		{`let x = quote(y); quote(fn(x) { x + unquote(x) })`, `QUOTE(fn(x__a) { (x__a + y) })`},
+		{`quote(fn() { let a = 1; let f = fn(b) { a + b }; f })`, `QUOTE(fn() { let a__b = 1; let f__b = fn(b__b) { (a__b + b__b) }; f__b })`},
+	}
+
+	for _, tt := range tests {
+		got := testEval(t, tt.input)
+		if got.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, got.Inspect())
+		}
+	}
+
+	got, ok := testEval(t, `quote(unquote(fn() {}))`).(*object.Error)
+	if !ok || got.Message != "cannot unquote FUNCTION" {
+		t.Errorf("wrong error unquoting a function. got=%v", got)
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infix = macro() { quote(1 + 2) }; infix()`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)`,
+			`((10 - 5) - (2 + 2))`,
+		},
+		{
+			`let unless = macro(cond, cons, alt) {
+				quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let double = macro(x) { quote(unquote(x) * 2) };
+			let quad = macro(x) { quote(double(double(unquote(x)))) };
+			let q = quad(3);`,
+			`let q = ((3 * 2) * 2);`,
+		},
+		{
+			`let thrice = macro(x) { let sum = quote(0); for (i in [1, 2, 3]) { sum = quote(unquote(sum) + unquote(x)) } sum }; thrice(a)`,
+			`(((0 + a) + a) + a)`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		expanded, err := Expand(program)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if expanded.String() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, expanded.String())
+		}
+	}
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`
+let withTmp = macro(body) { quote(fn() { let tmp = 100; unquote(body) }()) };
+let tmp = 1;
+withTmp(tmp + 1)`, "2"},
+		// the names of named arguments are left alone
+		{`
+let f = fn(tmp) { tmp };
+let m = macro() { quote(fn() { let tmp = 1; f(tmp: tmp + 1) }()) };
+m()`, "2"},
+	}
+
+	for _, tt := range tests {
+		program, err := Expand(parser.New(lexer.New(tt.input)).ParseProgram())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Eval(program, object.NewEnvironment())
+		if got.Inspect() != tt.expected {
+			t.Errorf("wrong result. want=%s, got=%s", tt.expected, got.Inspect())
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(x) { 1 }; m(2)`, "1:25: macro m: must return a quote, not INTEGER"},
+		{`let m = macro(x) { y }; m(2)`, "1:25: macro m: identifier not found: y"},
+		{`let m = macro(x) { x }; m()`, "1:25: macro m: wrong number of arguments: want=1, got=0"},
+		{`let m = macro(x) { x }; m(x: 1)`, "1:25: macro m: named arguments are not supported by macros"},
+		{`let m = macro(x) { quote(unquote(fn() {})) }; m(2)`, "1:47: macro m: cannot unquote FUNCTION"},
+		{`let m = macro() { quote(m()) }; m()`, "1:25: macro m: expansion too deep"},
+		{`let f = fn() { macro(x) { x } };`, "1:16: macro literals must be bound by a top-level let statement"},
+	}
+
+	for _, tt := range tests {
+		_, err := Expand(parser.New(lexer.New(tt.input)).ParseProgram())
+		var macroErr *MacroError
+		if !errors.As(err, &macroErr) || err.Error() != tt.expected {
+			t.Errorf("%s: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	got, ok := testEval(t, `let m = macro(x) { x };`).(*object.Error)
+	if !ok || got.Message != "macro literals must be bound by a top-level let statement" {
+		t.Errorf("wrong error evaluating a macro literal. got=%v", got)
+	}
+}
+
+func TestMacroLimits(t *testing.T) {
+	limits := Limits{MaxSteps: 1000, MaxDepth: 50, MaxAlloc: 100}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro() { while (true) {} quote(1) }; m()`, "1:47: macro m: step limit of 1000 exceeded"},
+		{`let m = macro() { for (x in range(10)) { while (true) { try { 1 } catch (e) {} } } quote(1) }; m()`, "1:96: macro m: step limit of 1000 exceeded"},
+		{`let m = macro() { let f = fn(n) { f(n + 1) }; f(0); quote(1) }; m()`, "1:65: macro m: maximum call depth of 50 exceeded"},
+		{`let m = macro() { try { let f = fn() { f() }; f() } catch (e) {} quote(1) }; m()`, "1:78: macro m: maximum call depth of 50 exceeded"},
+		{`let m = macro() { range(1000); quote(1) }; m()`, "1:44: macro m: allocation limit exceeded: ARRAY of size 1000, limit is 100"},
+		{`let m = macro() { let s = "ab"; for (i in range(10)) { s += s } quote(1) }; m()`, "1:77: macro m: allocation limit exceeded: STRING of size 128, limit is 100"},
+		{`let m = macro() { let h = {}; let i = 0; while (i < 200) { h[i] = i; i += 1 } quote(1) }; m()`, "1:91: macro m: allocation limit exceeded: HASH of size 101, limit is 100"},
+	}
+
+	for input, expected := range map[string]string{
+		`let m = macro() { write_file("x", "y"); quote(1) }; m()`:        `1:53: macro m: permission denied: write_file requires capability "fs-write"`,
+		`let m = macro() { quote(unquote(getenv("HOME"))) }; m()`:        `1:53: macro m: permission denied: getenv requires capability "env"`,
+		`let m = macro() { map([1], fn(x) { puts(x) }); quote(1) }; m()`: `1:60: macro m: permission denied: puts requires capability "output"`,
+	} {
+		_, err := Expand(parser.New(lexer.New(input)).ParseProgram())
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: want=%q, got=%v", input, expected, err)
+		}
+	}
+	prog, err := ExpandContext(context.Background(), parser.New(lexer.New(`let m = macro() { quote(unquote(now() * 0)) }; m()`)).ParseProgram(), Limits{Capabilities: []object.Capability{object.CapPure, object.CapTime}})
+	if err != nil || prog.String() != "0" {
+		t.Errorf("wrong expansion with granted capabilities. got=%v, %v", prog, err)
+	}
+
+	for _, tt := range tests {
+		_, err := ExpandContext(context.Background(), parser.New(lexer.New(tt.input)).ParseProgram(), limits)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := object.KindOf(errors.Unwrap(err)); kind != object.KindLimit {
+			t.Errorf("%s: wrong kind of the wrapped error. got=%s", tt.input, kind)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ExpandContext(ctx, parser.New(lexer.New(`let m = macro() { while (true) {} }; m()`)).ParseProgram(), Limits{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error expanding with a done context. got=%v", err)
+	}
+
+	prog, err = ExpandContext(context.Background(), parser.New(lexer.New(`let m = macro() { let f = fn(n) { if (n > 0) { f(n - 1) } }; f(40); quote(1) }; m()`)).ParseProgram(), limits)
+	if err != nil || prog.String() != "1" {
+		t.Errorf("wrong expansion within the limits. got=%v, %v", prog, err)
+	}
+}
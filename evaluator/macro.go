@@ -0,0 +1,469 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// maxExpansionDepth bounds the nesting of macro calls expanding to macro
+// calls, which never ends for a macro expanding to a call of itself.
+const maxExpansionDepth = 100
+
+// MacroError is an error expanding the macros of a program.
+type MacroError struct {
+	Pos token.Position
+	Msg string
+	Err error // the exceeded limit or the error of the done context, if any
+}
+
+func (e *MacroError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *MacroError) Unwrap() error { return e.Err }
+
+// Limits bounds the resources macros may use while they expand. Zero values
+// mean the defaults: DefaultMaxSteps, DefaultMaxDepth, no allocation limit
+// and, for nil Capabilities, only the builtins of object.CapPure.
+type Limits struct {
+	MaxSteps int64 // function calls and loop iterations
+	MaxDepth int   // nested function calls
+	MaxAlloc int   // length of strings in bytes, of arrays and hashes in elements
+
+	// Capabilities lists the capabilities of the builtins macros may call.
+	Capabilities []object.Capability
+}
+
+// The default limits of macro expansion.
+const (
+	DefaultMaxSteps = 10000000
+	DefaultMaxDepth = 1024
+)
+
+// limiter enforces Limits, reporting the first limit exceeded on every
+// later call.
+type limiter struct {
+	ctx    context.Context
+	limits Limits
+	caps   map[object.Capability]bool
+	steps  int64
+	depth  int
+	err    error
+}
+
+// NewLimiter returns a limiter enforcing limits on the evaluations in the
+// environments it is set on, which stop once ctx is done.
+func NewLimiter(ctx context.Context, limits Limits) object.Limiter {
+	return newLimiter(ctx, limits)
+}
+
+func newLimiter(ctx context.Context, limits Limits) *limiter {
+	if limits.MaxSteps <= 0 {
+		limits.MaxSteps = DefaultMaxSteps
+	}
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	caps := map[object.Capability]bool{object.CapPure: limits.Capabilities == nil}
+	for _, c := range limits.Capabilities {
+		caps[c] = true
+	}
+	return &limiter{ctx: ctx, limits: limits, caps: caps}
+}
+
+func (l *limiter) Enter() error {
+	if l.err != nil {
+		return l.err
+	}
+	l.steps++
+	switch {
+	case l.steps > l.limits.MaxSteps:
+		l.err = object.Errorf(object.KindLimit, "step limit of %d exceeded", l.limits.MaxSteps)
+	case l.depth == l.limits.MaxDepth:
+		l.err = object.Errorf(object.KindLimit, "maximum call depth of %d exceeded", l.limits.MaxDepth)
+	default:
+		l.err = l.ctx.Err()
+	}
+	if l.err == nil {
+		l.depth++
+	}
+	return l.err
+}
+
+func (l *limiter) Leave() { l.depth-- }
+
+func (l *limiter) Permit(b *object.Builtin) error {
+	if b.Capability == "" || l.caps[b.Capability] {
+		return nil
+	}
+	return object.Errorf(object.KindPermission, "permission denied: %s requires capability %q", b.Name, b.Capability)
+}
+
+func (l *limiter) Alloc(t object.ObjectType, size int) error {
+	if max := l.limits.MaxAlloc; l.err == nil && max > 0 && size > max {
+		l.err = object.Errorf(object.KindLimit, "allocation limit exceeded: %s of size %d, limit is %d", t, size, max)
+	}
+	return l.err
+}
+
+// Expand expands the macros of program with the default limits, which let
+// macros call pure builtins only, see ExpandContext.
+func Expand(program *ast.Program) (*ast.Program, error) {
+	return ExpandContext(context.Background(), program, Limits{})
+}
+
+// ExpandContext expands the macros of program, which is modified in place
+// and returned. It is DefineMacros and ExpandMacros with an environment of
+// their own, whose macros fail with a *MacroError once they exceed one of
+// limits, call a builtin whose capability limits does not grant, or ctx is
+// done.
+func ExpandContext(ctx context.Context, program *ast.Program, limits Limits) (*ast.Program, error) {
+	env := object.NewEnvironment()
+	env.SetLimiter(newLimiter(ctx, limits))
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(*ast.Program), nil
+}
+
+// DefineMacros binds the macros defined by the top-level let statements of
+// program in env and removes those statements from program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	kept := program.Statements[:0]
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			name, isName := let.Name.(*ast.Identifier)
+			if lit, ok := let.Value.(*ast.MacroLiteral); ok && isName {
+				env.Set(name.Value, &object.Macro{
+					Parameters: lit.Parameters,
+					Body:       lit.Body,
+					Env:        env,
+					Name:       name.Value,
+				})
+				continue
+			}
+		}
+		kept = append(kept, stmt)
+	}
+	program.Statements = kept
+}
+
+// ExpandMacros replaces the calls of the macros bound in env by the code
+// they expand to, and returns the result. The macro is called with the
+// quoted arguments of the call and must return a quote; expansions that
+// call macros again are expanded in turn. program is modified in place.
+//
+// Macro literals that are not bound by DefineMacros are an error.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	expanded, err := expandMacros(program, env, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ast.Inspect(expanded, func(node ast.Node) bool {
+		if lit, ok := node.(*ast.MacroLiteral); ok && err == nil {
+			err = &MacroError{Pos: lit.Token.Pos, Msg: "macro literals must be bound by a top-level let statement"}
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func expandMacros(program ast.Node, env *object.Environment, depth int) (ast.Node, error) {
+	var err error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+		if depth == maxExpansionDepth {
+			err = &MacroError{Pos: ast.Pos(call), Msg: fmt.Sprintf("macro %s: expansion too deep", macro.Name)}
+			return node
+		}
+
+		var expr ast.Expression
+		if expr, err = expandMacro(call, macro); err != nil {
+			return node
+		}
+		var expansion ast.Node
+		if expansion, err = expandMacros(expr, env, depth+1); err != nil {
+			return node
+		}
+		return expansion
+	})
+	return expanded, err
+}
+
+// macroOf returns the macro called by call, if it calls one.
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+// expandMacro returns the expression call expands to.
+func expandMacro(call *ast.CallExpression, macro *object.Macro) (ast.Expression, error) {
+	fail := func(format string, a ...interface{}) error {
+		msg := fmt.Sprintf("macro %s: ", macro.Name) + fmt.Sprintf(format, a...)
+		err := &MacroError{Pos: ast.Pos(call), Msg: msg}
+		if l, ok := macro.Env.Limiter().(*limiter); ok {
+			err.Err = l.err
+		}
+		return err
+	}
+
+	if len(call.NamedArguments) > 0 {
+		return nil, fail("named arguments are not supported by macros")
+	}
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, fail("wrong number of arguments: want=%d, got=%d", len(macro.Parameters), len(call.Arguments))
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for i, param := range macro.Parameters {
+		env.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+	}
+
+	evaluated := evalBlockStatement(macro.Body, env)
+	if rv, ok := evaluated.(*object.ReturnValue); ok {
+		evaluated = rv.Value
+	}
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		return nil, fail("%s", evaluated.Message)
+	case *branch:
+		return nil, fail("%s", evaluated.outside().Message)
+	case *object.Quote:
+		expr, ok := evaluated.Node.(ast.Expression)
+		if !ok {
+			return nil, fail("expanded to a statement, not an expression")
+		}
+		return expr, nil
+	}
+	if evaluated == nil {
+		evaluated = object.NULL
+	}
+	return nil, fail("must return a quote, not %s", evaluated.Type())
+}
+
+// quote returns the quote of a copy of node, in which the calls of unquote
+// are replaced by the AST of their evaluated argument. Names declared in
+// node itself are renamed so that they can not capture or shadow the names
+// of the code the quote ends up in.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node = ast.Copy(node)
+	renameDeclared(node)
+
+	var err *object.Error
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallOf(call, "unquote") || err != nil {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError(object.KindArgument, "wrong number of arguments to unquote: want=1, got=%d", len(call.Arguments))
+			return node
+		}
+
+		val := Eval(call.Arguments[0], env)
+		if e, ok := val.(*object.Error); ok {
+			err = e
+			return node
+		}
+		expr, ok := unquotedNode(val, call.Token)
+		if !ok {
+			err = newError(object.KindType, "cannot unquote %s", val.Type())
+			return node
+		}
+		return expr
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// unquotedNode returns the expression that evaluates to obj, whose nodes
+// get the position of tok.
+func unquotedNode(obj object.Object, tok token.Token) (ast.Expression, bool) {
+	switch obj := obj.(type) {
+	case *object.Quote:
+		expr, ok := ast.Copy(obj.Node).(ast.Expression)
+		return expr, ok
+	case *object.Integer:
+		tok.Type, tok.Literal = token.INT, strconv.FormatInt(obj.Value, 10)
+		return &ast.InetegerLiteral{Token: tok, Value: obj.Value}, true
+	case *object.BigInt:
+		tok.Type, tok.Literal = token.INT, obj.Inspect()
+		return &ast.BigIntegerLiteral{Token: tok, Value: obj.Value}, true
+	case *object.Decimal:
+		tok.Type, tok.Literal = token.DECIMAL, obj.Inspect()
+		return &ast.DecimalLiteral{Token: tok, Unscaled: obj.Unscaled, Scale: obj.Scale}, true
+	case *object.Boolean:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if obj.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}, true
+	case *object.String:
+		tok.Type, tok.Literal = token.STRING, obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}, true
+	case *object.Array:
+		tok.Type, tok.Literal = token.LBRACKET, "["
+		array := &ast.ArrayLiteral{Token: tok, Elements: []ast.Expression{}}
+		for _, e := range obj.Elements {
+			expr, ok := unquotedNode(e, tok)
+			if !ok {
+				return nil, false
+			}
+			array.Elements = append(array.Elements, expr)
+		}
+		return array, true
+	case *object.Hash:
+		tok.Type, tok.Literal = token.LBRACE, "{"
+		hash := &ast.HashLiteral{Token: tok}
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			k, ok := unquotedNode(pair.Key, tok)
+			if !ok {
+				return nil, false
+			}
+			v, ok := unquotedNode(pair.Value, tok)
+			if !ok {
+				return nil, false
+			}
+			hash.Pairs = append(hash.Pairs, ast.HashPair{Key: k, Value: v})
+		}
+		return hash, true
+	}
+	return nil, false
+}
+
+// gensyms counts the names renamed by quote, to keep them unique.
+var gensyms uint64
+
+// renameDeclared gives the names declared in node, outside of the
+// arguments of unquote, fresh names. The fresh names are the original ones
+// followed by two underscores and a letter sequence, like x__a, as Monkey
+// identifiers can not hold digits.
+func renameDeclared(node ast.Node) {
+	declared := map[string]bool{}
+	inspectQuoted(node, func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			for _, name := range ast.PatternNames(n.Name) {
+				declared[name.Value] = true
+			}
+		case *ast.ConstStatement:
+			declared[n.Name.Value] = true
+		case *ast.ForStatement:
+			declared[n.Variable.Value] = true
+		case *ast.TryExpression:
+			if n.CatchParam != nil {
+				declared[n.CatchParam.Value] = true
+			}
+		case *ast.FunctionLiteral:
+			for _, p := range n.Parameters {
+				for _, name := range ast.PatternNames(p) {
+					declared[name.Value] = true
+				}
+			}
+			if n.Rest != nil {
+				declared[n.Rest.Value] = true
+			}
+		case *ast.MatchExpression:
+			for _, arm := range n.Arms {
+				for _, name := range ast.PatternNames(arm.Pattern) {
+					declared[name.Value] = true
+				}
+			}
+		case *ast.MacroLiteral:
+			for _, p := range n.Parameters {
+				declared[p.Value] = true
+			}
+		}
+	})
+	if len(declared) == 0 {
+		return
+	}
+
+	// the names of named arguments refer to parameters of the called
+	// function, which is usually declared outside
+	labels := map[*ast.Identifier]bool{}
+	inspectQuoted(node, func(node ast.Node) {
+		if call, ok := node.(*ast.CallExpression); ok {
+			for _, arg := range call.NamedArguments {
+				labels[arg.Name] = true
+			}
+		}
+	})
+
+	suffix := gensym(atomic.AddUint64(&gensyms, 1) - 1)
+	inspectQuoted(node, func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			if declared[n.Value] && !labels[n] {
+				n.Value += suffix
+				n.Token.Literal = n.Value
+			}
+		case *ast.FunctionLiteral:
+			if declared[n.Name] {
+				n.Name += suffix
+			}
+		}
+	})
+}
+
+// inspectQuoted calls f for the nodes of node, skipping calls of unquote.
+func inspectQuoted(node ast.Node, f func(ast.Node)) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok && isCallOf(call, "unquote") {
+			return false
+		}
+		if node != nil {
+			f(node)
+		}
+		return true
+	})
+}
+
+// gensym returns the suffix of the n-th renaming: __a, __b, ..., __z,
+// __ba, __bb, and so on.
+func gensym(n uint64) string {
+	letters := []byte{byte('a' + n%26)}
+	for n /= 26; n > 0; n /= 26 {
+		letters = append([]byte{byte('a' + n%26)}, letters...)
+	}
+	return "__" + string(letters)
+}
+
+// isCallOf reports whether call calls the identifier name.
+func isCallOf(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
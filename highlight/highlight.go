@@ -0,0 +1,131 @@
+// Package highlight classifies Monkey source into semantic token classes and
+// renders them for terminals, HTML pages and language servers.
+package highlight
+
+import (
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// Class is the semantic class of a span of source text.
+type Class int
+
+const (
+	Keyword Class = iota
+	Identifier
+	Number
+	String
+	Operator
+	Punctuation
+	Comment
+	Error
+)
+
+var classNames = [...]string{
+	Keyword:     "keyword",
+	Identifier:  "identifier",
+	Number:      "number",
+	String:      "string",
+	Operator:    "operator",
+	Punctuation: "punctuation",
+	Comment:     "comment",
+	Error:       "error",
+}
+
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(classNames) {
+		return "unknown"
+	}
+	return classNames[c]
+}
+
+// Span is a classified range of source text.
+type Span struct {
+	Class Class
+	Start token.Position
+	End   token.Position
+	Text  string // source text of the span, quotes included
+}
+
+var operators = map[token.TokenType]bool{
+	token.ASSIGN:   true,
+	token.PLUS:     true,
+	token.MINUS:    true,
+	token.BANG:     true,
+	token.ASTERISK: true,
+	token.SLASH:    true,
+	token.LT:       true,
+	token.GT:       true,
+	token.EQ:       true,
+	token.NOT_EQ:   true,
+
+	token.PLUS_ASSIGN:     true,
+	token.MINUS_ASSIGN:    true,
+	token.ASTERISK_ASSIGN: true,
+	token.SLASH_ASSIGN:    true,
+}
+
+var punctuation = map[token.TokenType]bool{
+	token.COMMA:     true,
+	token.SEMICOLON: true,
+	token.COLON:     true,
+	token.LPAREN:    true,
+	token.RPAREN:    true,
+	token.LBRACE:    true,
+	token.RBRACE:    true,
+	token.LBRACKET:  true,
+	token.RBRACKET:  true,
+
+	token.DOLLAR_LBRACE: true,
+}
+
+var keywords = func() map[token.TokenType]bool {
+	m := make(map[token.TokenType]bool, len(token.Keywords))
+	for _, typ := range token.Keywords {
+		m[typ] = true
+	}
+	return m
+}()
+
+// Classify returns the semantic class of a token type.
+func Classify(typ token.TokenType) Class {
+	switch {
+	case keywords[typ]:
+		return Keyword
+	case operators[typ]:
+		return Operator
+	case punctuation[typ]:
+		return Punctuation
+	}
+
+	switch typ {
+	case token.IDENT:
+		return Identifier
+	case token.INT, token.DECIMAL:
+		return Number
+	case token.STRING, token.BACKTICK, token.TEMPLATE:
+		return String
+	case token.COMMENT:
+		return Comment
+	}
+
+	return Error
+}
+
+// Spans lexes src, keeping comments, and returns the classified spans in
+// source order. Text between spans is whitespace.
+func Spans(src string) []Span {
+	var spans []Span
+
+	lex := lexer.NewWithMode(src, lexer.ScanComments)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		spans = append(spans, Span{
+			Class: Classify(tok.Type),
+			Start: tok.Pos,
+			End:   tok.End,
+			Text:  src[tok.Pos.Offset:tok.End.Offset],
+		})
+	}
+
+	return spans
+}
@@ -0,0 +1,112 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpans(t *testing.T) {
+	req := require.New(t)
+	input := `let s = "hi"; // greet
+if (x != 10.5) { $ }
+` + "`n=${n}`"
+
+	expected := []struct {
+		class Class
+		text  string
+	}{
+		{Keyword, "let"},
+		{Identifier, "s"},
+		{Operator, "="},
+		{String, `"hi"`},
+		{Punctuation, ";"},
+		{Comment, "// greet"},
+		{Keyword, "if"},
+		{Punctuation, "("},
+		{Identifier, "x"},
+		{Operator, "!="},
+		{Number, "10.5"},
+		{Punctuation, ")"},
+		{Punctuation, "{"},
+		{Error, "$"},
+		{Punctuation, "}"},
+		{String, "`"},
+		{String, "n="},
+		{Punctuation, "${"},
+		{Identifier, "n"},
+		{Punctuation, "}"},
+		{String, "`"},
+	}
+
+	spans := Spans(input)
+	req.Len(spans, len(expected))
+	for i, tt := range expected {
+		req.Equal(tt.class, spans[i].Class, "spans[%d] class", i)
+		req.Equal(tt.text, spans[i].Text, "spans[%d] text", i)
+	}
+}
+
+func TestANSI(t *testing.T) {
+	var sb strings.Builder
+	require.NoError(t, ANSI(&sb, "let x = 5;"))
+	require.Equal(t, "\x1b[1;35mlet\x1b[0m x \x1b[33m=\x1b[0m \x1b[36m5\x1b[0m;", sb.String())
+}
+
+func TestHTML(t *testing.T) {
+	var sb strings.Builder
+	require.NoError(t, HTML(&sb, `a < "<b>"`))
+	require.Equal(t,
+		`<span class="mk-identifier">a</span> <span class="mk-operator">&lt;</span> `+
+			`<span class="mk-string">&#34;&lt;b&gt;&#34;</span>`,
+		sb.String())
+}
+
+func TestNonASCII(t *testing.T) {
+	var sb strings.Builder
+	require.NoError(t, HTML(&sb, "x = é"))
+	require.True(t, utf8.ValidString(sb.String()))
+	require.Equal(t,
+		`<span class="mk-identifier">x</span> <span class="mk-operator">=</span> <span class="mk-error">é</span>`,
+		sb.String())
+}
+
+func TestSemanticTokens(t *testing.T) {
+	input := "let x = 1;\n  x \"a\nb\""
+
+	expected := []uint32{
+		0, 0, 3, uint32(Keyword), 0,
+		0, 4, 1, uint32(Identifier), 0,
+		0, 2, 1, uint32(Operator), 0,
+		0, 2, 1, uint32(Number), 0,
+		0, 1, 1, uint32(Punctuation), 0,
+		1, 2, 1, uint32(Identifier), 0,
+		0, 2, 2, uint32(String), 0,
+		1, 0, 2, uint32(String), 0,
+	}
+
+	require.Equal(t, expected, SemanticTokens(input))
+	require.Equal(t, "variable", Legend[Identifier])
+
+	// positions and lengths are in UTF-16 code units, not bytes
+	expected = []uint32{
+		0, 0, 3, uint32(String), 0,
+		0, 4, 1, uint32(Operator), 0,
+		0, 2, 4, uint32(String), 0,
+		0, 4, 1, uint32(Punctuation), 0,
+	}
+	require.Equal(t, expected, SemanticTokens("\"é\" + \"😀\";"))
+
+	// a character the lexer does not know is one token
+	expected = []uint32{
+		0, 0, 3, uint32(Keyword), 0,
+		0, 4, 1, uint32(Identifier), 0,
+		0, 2, 1, uint32(Operator), 0,
+		0, 2, 1, uint32(Error), 0,
+		0, 1, 1, uint32(Punctuation), 0,
+		0, 2, 1, uint32(Identifier), 0,
+	}
+	require.Equal(t, expected, SemanticTokens("let x = é; x"))
+}
@@ -0,0 +1,71 @@
+package highlight
+
+import "strings"
+
+// Legend lists the LSP semantic token types in the order of their indexes in
+// the SemanticTokens output. Servers advertise it in their
+// SemanticTokensLegend.
+var Legend = []string{
+	Keyword:     "keyword",
+	Identifier:  "variable",
+	Number:      "number",
+	String:      "string",
+	Operator:    "operator",
+	Punctuation: "punctuation",
+	Comment:     "comment",
+	Error:       "error",
+}
+
+// SemanticTokens encodes the spans of src in the LSP relative format: five
+// integers per token holding the line delta, the start character delta, the
+// length, the token type index into Legend and the (always empty) modifier
+// set. Lines and characters are zero based, and characters are counted in
+// UTF-16 code units, the default LSP position encoding. Spans crossing a line
+// break are split into one token per line, since not every client supports
+// multiline tokens.
+func SemanticTokens(src string) []uint32 {
+	var (
+		data     []uint32
+		prevLine int
+		prevChar int
+	)
+
+	emit := func(line, char, length int, class Class) {
+		if length == 0 {
+			return
+		}
+		deltaChar := char
+		if line == prevLine {
+			deltaChar = char - prevChar
+		}
+		data = append(data,
+			uint32(line-prevLine), uint32(deltaChar), uint32(length), uint32(class), 0)
+		prevLine, prevChar = line, char
+	}
+
+	for _, s := range Spans(src) {
+		lineStart := s.Start.Offset - (s.Start.Column - 1)
+		line, char := s.Start.Line-1, utf16Len(src[lineStart:s.Start.Offset])
+		parts := strings.Split(s.Text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				line, char = line+1, 0
+			}
+			emit(line, char, utf16Len(strings.TrimSuffix(part, "\r")), s.Class)
+		}
+	}
+
+	return data
+}
+
+// utf16Len returns the number of UTF-16 code units encoding s.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package highlight
+
+import (
+	"html"
+	"io"
+	"strings"
+)
+
+var ansiColors = [...]string{
+	Keyword:     "\x1b[1;35m",
+	Identifier:  "",
+	Number:      "\x1b[36m",
+	String:      "\x1b[32m",
+	Operator:    "\x1b[33m",
+	Punctuation: "",
+	Comment:     "\x1b[90m",
+	Error:       "\x1b[4;31m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// ANSI writes src to w with terminal color escape sequences.
+func ANSI(w io.Writer, src string) error {
+	return render(w, src, nil, func(sb *strings.Builder, s Span) {
+		color := ansiColors[s.Class]
+		if color == "" {
+			sb.WriteString(s.Text)
+			return
+		}
+		sb.WriteString(color)
+		sb.WriteString(s.Text)
+		sb.WriteString(ansiReset)
+	})
+}
+
+// HTML writes src to w as escaped HTML. Every span is wrapped in a
+// <span class="mk-CLASS"> element, so the colors are left to the style sheet.
+// The output is not wrapped in a <pre> element.
+func HTML(w io.Writer, src string) error {
+	return render(w, src, html.EscapeString, func(sb *strings.Builder, s Span) {
+		sb.WriteString(`<span class="mk-`)
+		sb.WriteString(s.Class.String())
+		sb.WriteString(`">`)
+		sb.WriteString(html.EscapeString(s.Text))
+		sb.WriteString(`</span>`)
+	})
+}
+
+// render writes every span with the span function. The text between spans
+// is usually whitespace but may hold input the lexer stopped at, so it is
+// passed through escape when that is set.
+func render(w io.Writer, src string, escape func(string) string, span func(*strings.Builder, Span)) error {
+	var (
+		sb   strings.Builder
+		last int
+	)
+
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+
+	for _, s := range Spans(src) {
+		sb.WriteString(escape(src[last:s.Start.Offset]))
+		span(&sb, s)
+		last = s.End.Offset
+	}
+	sb.WriteString(escape(src[last:]))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
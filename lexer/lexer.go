@@ -1,26 +1,67 @@
 package lexer
 
 import (
-	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/riadafridishibly/go-monkey/token"
 )
 
+// Mode controls optional lexer behaviour.
+type Mode uint
+
+const (
+	// ScanComments makes the lexer return `//` comments as token.COMMENT
+	// instead of skipping them.
+	ScanComments Mode = 1 << iota
+)
+
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
 	ch           byte
+
+	mode   Mode
+	line   int
+	column int
+
+	// templates holds the template literals being read, innermost last.
+	templates []template
+}
+
+// template is the state of a template literal being read. The lexer reads
+// its text until an interpolation starts, and then tokens as usual until the
+// `}` closing the interpolation; braces counts the braces opened in between.
+type template struct {
+	interpolating bool
+	braces        int
 }
 
 func New(input string) *Lexer {
-	lex := &Lexer{input: input}
+	return NewWithMode(input, 0)
+}
+
+func NewWithMode(input string, mode Mode) *Lexer {
+	lex := &Lexer{input: input, mode: mode, line: 1}
 	lex.readChar()
 
 	return lex
 }
 
+// SetLine sets the line number of the first line of the input, for input
+// that continues earlier text, such as the lines read by the REPL. It must be
+// called before the first token is read. Offsets are not changed.
+func (lex *Lexer) SetLine(line int) {
+	lex.line = line
+}
+
 func (lex *Lexer) readChar() {
+	if lex.ch == '\n' {
+		lex.line++
+		lex.column = 0
+	}
+
 	if lex.readPosition >= len(lex.input) {
 		lex.ch = 0
 	} else {
@@ -29,6 +70,7 @@ func (lex *Lexer) readChar() {
 
 	lex.position = lex.readPosition
 	lex.readPosition++
+	lex.column++
 }
 
 func (lex *Lexer) peekChar() byte {
@@ -39,11 +81,36 @@ func (lex *Lexer) peekChar() byte {
 	return lex.input[lex.readPosition]
 }
 
+// pos returns the position of the current character.
+func (lex *Lexer) pos() token.Position {
+	offset := lex.position
+	if offset > len(lex.input) {
+		offset = len(lex.input)
+	}
+
+	return token.Position{Offset: offset, Line: lex.line, Column: lex.column}
+}
+
 func (lex *Lexer) NextToken() token.Token {
 	var tok token.Token
 
+	if n := len(lex.templates); n > 0 && !lex.templates[n-1].interpolating {
+		return lex.templateToken()
+	}
+
 	lex.skipWhitespace()
 
+	for lex.ch == '/' && lex.peekChar() == '/' {
+		pos := lex.pos()
+		comment := lex.readComment()
+		if lex.mode&ScanComments != 0 {
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos, End: lex.pos()}
+		}
+		lex.skipWhitespace()
+	}
+
+	pos := lex.pos()
+
 	switch lex.ch {
 	// operators
 	case '=':
@@ -51,13 +118,16 @@ func (lex *Lexer) NextToken() token.Token {
 			ch := lex.ch
 			lex.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(lex.ch)}
+		} else if lex.peekChar() == '>' {
+			lex.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, lex.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, lex.ch)
+		tok = lex.compound(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, lex.ch)
+		tok = lex.compound(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		if lex.peekChar() == '=' {
 			ch := lex.ch
@@ -67,9 +137,9 @@ func (lex *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, lex.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, lex.ch)
+		tok = lex.compound(token.ASTERISK, token.ASTERISK_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, lex.ch)
+		tok = lex.compound(token.SLASH, token.SLASH_ASSIGN)
 	// comparison
 	case '<':
 		tok = newToken(token.LT, lex.ch)
@@ -77,6 +147,16 @@ func (lex *Lexer) NextToken() token.Token {
 		tok = newToken(token.GT, lex.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, lex.ch)
+	case ':':
+		tok = newToken(token.COLON, lex.ch)
+	case '.':
+		if strings.HasPrefix(lex.input[lex.position:], "...") {
+			lex.readChar()
+			lex.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, lex.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, lex.ch)
 	case ')':
@@ -84,9 +164,35 @@ func (lex *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, lex.ch)
 	case '{':
+		if n := len(lex.templates); n > 0 {
+			lex.templates[n-1].braces++
+		}
 		tok = newToken(token.LBRACE, lex.ch)
 	case '}':
+		if n := len(lex.templates); n > 0 {
+			if lex.templates[n-1].braces == 0 {
+				// the end of the interpolation, back to the text
+				lex.templates[n-1].interpolating = false
+			} else {
+				lex.templates[n-1].braces--
+			}
+		}
 		tok = newToken(token.RBRACE, lex.ch)
+	case '`':
+		lex.templates = append(lex.templates, template{})
+		tok = newToken(token.BACKTICK, lex.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, lex.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, lex.ch)
+	case '"':
+		str, ok := lex.readString()
+		if ok {
+			tok.Type = token.STRING
+		} else {
+			tok.Type = token.ILLEGAL
+		}
+		tok.Literal = str
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -94,33 +200,51 @@ func (lex *Lexer) NextToken() token.Token {
 		if isLetter(lex.ch) {
 			tok.Literal = lex.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, lex.pos()
 
 			return tok
 		} else if isDigit(lex.ch) {
-			tok.Type = token.INT
-			tok.Literal = lex.readNumber()
+			tok.Type, tok.Literal = lex.readNumber()
+			tok.Pos, tok.End = pos, lex.pos()
 
 			return tok
 		} else {
-			fmt.Printf("%q", string(lex.ch))
-			tok = newToken(token.ILLEGAL, lex.ch)
+			// an illegal character is one token, however many bytes
+			_, size := utf8.DecodeRuneInString(lex.input[lex.position:])
+			tok = token.Token{Type: token.ILLEGAL, Literal: lex.input[lex.position : lex.position+size]}
+			for i := 1; i < size; i++ {
+				lex.readChar()
+			}
 		}
 
 	}
 
-	lex.readChar()
+	if tok.Type != token.EOF {
+		lex.readChar()
+	}
+	tok.Pos, tok.End = pos, lex.pos()
 
 	return tok
 }
 
-func (lex *Lexer) readNumber() string {
+// readNumber reads an integer, or a decimal when the digits are followed by
+// a point and more digits.
+func (lex *Lexer) readNumber() (token.TokenType, string) {
 	position := lex.position
+	typ := token.TokenType(token.INT)
 
 	for isDigit(lex.ch) {
 		lex.readChar()
 	}
+	if lex.ch == '.' && isDigit(lex.peekChar()) {
+		typ = token.DECIMAL
+		lex.readChar()
+		for isDigit(lex.ch) {
+			lex.readChar()
+		}
+	}
 
-	return lex.input[position:lex.position]
+	return typ, lex.input[position:lex.position]
 }
 
 func (lex *Lexer) readIdentifier() string {
@@ -133,6 +257,120 @@ func (lex *Lexer) readIdentifier() string {
 	return lex.input[position:lex.position]
 }
 
+// readString reads a double quoted string, leaving the lexer on the closing
+// quote. It reports false when the input ends before the string is closed.
+func (lex *Lexer) readString() (string, bool) {
+	var sb strings.Builder
+
+	for {
+		lex.readChar()
+
+		switch lex.ch {
+		case '"':
+			return sb.String(), true
+		case 0:
+			return sb.String(), false
+		case '\\':
+			lex.readChar()
+			switch lex.ch {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 0:
+				return sb.String(), false
+			default:
+				sb.WriteByte(lex.ch)
+			}
+		default:
+			sb.WriteByte(lex.ch)
+		}
+	}
+}
+
+// templateToken returns the next token of the text of the innermost template
+// literal: a piece of text, the start of an interpolation or the closing
+// backtick. At the end of the input, the literal is unterminated and the
+// token is ILLEGAL.
+func (lex *Lexer) templateToken() token.Token {
+	var tok token.Token
+	pos := lex.pos()
+	n := len(lex.templates)
+
+	switch {
+	case lex.ch == '`':
+		lex.templates = lex.templates[:n-1]
+		tok = newToken(token.BACKTICK, lex.ch)
+		lex.readChar()
+	case lex.ch == '$' && lex.peekChar() == '{':
+		lex.templates[n-1] = template{interpolating: true}
+		tok = token.Token{Type: token.DOLLAR_LBRACE, Literal: "${"}
+		lex.readChar()
+		lex.readChar()
+	case lex.ch == 0:
+		lex.templates = nil
+		tok = token.Token{Type: token.ILLEGAL, Literal: ""}
+	default:
+		tok = token.Token{Type: token.TEMPLATE, Literal: lex.readTemplateText()}
+	}
+
+	tok.Pos, tok.End = pos, lex.pos()
+	return tok
+}
+
+// readTemplateText reads the text of a template literal up to the closing
+// backtick, the next interpolation or the end of the input, and leaves the
+// lexer there. Escapes are those of double quoted strings, and \` and \$
+// stand for the characters themselves.
+func (lex *Lexer) readTemplateText() string {
+	var sb strings.Builder
+
+	for {
+		switch lex.ch {
+		case '`', 0:
+			return sb.String()
+		case '$':
+			if lex.peekChar() == '{' {
+				return sb.String()
+			}
+			sb.WriteByte(lex.ch)
+		case '\\':
+			switch lex.peekChar() {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 0:
+				sb.WriteByte(lex.ch)
+				lex.readChar()
+				return sb.String()
+			default:
+				sb.WriteByte(lex.peekChar())
+			}
+			lex.readChar()
+		default:
+			sb.WriteByte(lex.ch)
+		}
+		lex.readChar()
+	}
+}
+
+// readComment reads a `//` comment up to, but not including, the end of the
+// line.
+func (lex *Lexer) readComment() string {
+	position := lex.position
+
+	for lex.ch != '\n' && lex.ch != 0 {
+		lex.readChar()
+	}
+
+	return lex.input[position:lex.position]
+}
+
 func (lex *Lexer) skipWhitespace() {
 	for lex.ch == ' ' || lex.ch == '\t' || lex.ch == '\n' || lex.ch == '\r' {
 		lex.readChar()
@@ -149,6 +387,17 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// compound returns the token of the operator op at the current character,
+// or of its compound assignment form when an '=' follows.
+func (lex *Lexer) compound(op, assign token.TokenType) token.Token {
+	if lex.peekChar() == '=' {
+		ch := lex.ch
+		lex.readChar()
+		return token.Token{Type: assign, Literal: string(ch) + string(lex.ch)}
+	}
+	return newToken(op, lex.ch)
+}
+
 func newToken(tokType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokType, Literal: string(ch)}
 }
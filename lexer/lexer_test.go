@@ -131,3 +131,327 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenStringsAndBrackets(t *testing.T) {
+	input := `"foobar" "foo bar" "a\"b\n" [1, 2]; {"foo": "bar"} // trailing
+	"unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "a\"b\n"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.ILLEGAL, "unterminated"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenCompoundAssign(t *testing.T) {
+	input := `x += 1; x -= 2; x *= 3; x /= 4; x = +1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenMatch(t *testing.T) {
+	input := `match (x) { 1 => a, _ if a == b => c }`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.IF, "if"},
+		{token.IDENT, "a"},
+		{token.EQ, "=="},
+		{token.IDENT, "b"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "c"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenEllipsis(t *testing.T) {
+	input := `[a, ...rest] ..`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := `12.50 -0.5 99999999999999999999 1. 2...`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.DECIMAL, "12.50"},
+		{token.MINUS, "-"},
+		{token.DECIMAL, "0.5"},
+		{token.INT, "99999999999999999999"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.INT, "2"},
+		{token.ELLIPSIS, "..."},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenTemplate(t *testing.T) {
+	input := "`a ${b + {\"c\": `d${e}`}[\"c\"]} \\` \\${f}\n`x `open"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.BACKTICK, "`", 1, 1},
+		{token.TEMPLATE, "a ", 1, 2},
+		{token.DOLLAR_LBRACE, "${", 1, 4},
+		{token.IDENT, "b", 1, 6},
+		{token.PLUS, "+", 1, 8},
+		{token.LBRACE, "{", 1, 10},
+		{token.STRING, "c", 1, 11},
+		{token.COLON, ":", 1, 14},
+		{token.BACKTICK, "`", 1, 16},
+		{token.TEMPLATE, "d", 1, 17},
+		{token.DOLLAR_LBRACE, "${", 1, 18},
+		{token.IDENT, "e", 1, 20},
+		{token.RBRACE, "}", 1, 21},
+		{token.BACKTICK, "`", 1, 22},
+		{token.RBRACE, "}", 1, 23},
+		{token.LBRACKET, "[", 1, 24},
+		{token.STRING, "c", 1, 25},
+		{token.RBRACKET, "]", 1, 28},
+		{token.RBRACE, "}", 1, 29},
+		{token.TEMPLATE, " ` ${f}\n", 1, 30},
+		{token.BACKTICK, "`", 2, 1},
+		{token.IDENT, "x", 2, 2},
+		{token.BACKTICK, "`", 2, 4},
+		{token.TEMPLATE, "open", 2, 5},
+		{token.ILLEGAL, "", 2, 9},
+		{token.EOF, "", 2, 9},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("tests[%d] - wrong position. expected=%d:%d, got=%s",
+				i, tt.line, tt.column, tok.Pos)
+		}
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	input := "// header\nlet x = 1; // one\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.COMMENT, "// header", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "x", 2, 5},
+		{token.ASSIGN, "=", 2, 7},
+		{token.INT, "1", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "// one", 2, 12},
+		{token.EOF, "", 3, 1},
+	}
+
+	l := lexer.NewWithMode(input, lexer.ScanComments)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%s",
+				i, tt.line, tt.column, tok.Pos)
+		}
+
+		if tok.Type != token.EOF && input[tok.Pos.Offset:tok.End.Offset] != tok.Literal {
+			t.Fatalf("tests[%d] - span wrong. got=%q",
+				i, input[tok.Pos.Offset:tok.End.Offset])
+		}
+	}
+
+	l = lexer.New(input)
+	if tok := l.NextToken(); tok.Type != token.LET {
+		t.Fatalf("comments should be skipped by default. got=%q", tok.Type)
+	}
+}
+
+func TestSetLine(t *testing.T) {
+	l := lexer.New("a\n  b")
+	l.SetLine(5)
+
+	for _, want := range []string{"5:1", "6:3"} {
+		if tok := l.NextToken(); tok.Pos.String() != want {
+			t.Errorf("%s: wrong position. want=%s, got=%s", tok.Literal, want, tok.Pos)
+		}
+	}
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	input := "a é😀\xff;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		column, end     int
+	}{
+		{token.IDENT, "a", 1, 2},
+		{token.ILLEGAL, "é", 3, 5},
+		{token.ILLEGAL, "😀", 5, 9},
+		{token.ILLEGAL, "\xff", 9, 10},
+		{token.SEMICOLON, ";", 10, 11},
+		{token.EOF, "", 11, 11},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Column != tt.column || tok.End.Column != tt.end {
+			t.Fatalf("tests[%d] - wrong span. expected=1:%d-1:%d, got=%s-%s",
+				i, tt.column, tt.end, tok.Pos, tok.End)
+		}
+	}
+}
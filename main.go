@@ -9,7 +9,27 @@ import (
 	"github.com/riadafridishibly/go-monkey/repl"
 )
 
+// commands are the subcommands of the monkey tool. Without a subcommand the
+// REPL is started.
+var commands = map[string]func(args []string) int{
+	"build":  buildCommand,
+	"check":  checkCommand,
+	"disasm": disasmCommand,
+	"parse":  parseCommand,
+	"run":    runCommand,
+	"vet":    vetCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(cmd(os.Args[2:]))
+	}
+
 	currentUser, err := user.Current()
 
 	if err != nil {
@@ -0,0 +1,221 @@
+// Package module loads the modules that Monkey programs import.
+//
+// A module is a source file. The statement
+//
+//	import "lib/math.mk" as math
+//
+// loads lib/math.mk, relative to the directory of the importing file, runs it
+// with globals of its own and binds math to the module. The names the module
+// declares with top-level `export let` and `export const` statements are its
+// exports, which programs read by indexing it: math["sqrt"](16). They hold
+// the values the names have once the module has run.
+//
+// Modules imported by a program running in a VM run with the context,
+// capabilities and output of that VM, and count against its limits; see
+// vm.VM.Inherit. Their macros expand within the context, limits and
+// capabilities of that VM too; modules loaded otherwise expand theirs with
+// the default limits of evaluator.Expand.
+//
+// A Loader runs every module once and hands the same module to all the
+// programs importing it. An import leading back to a module that is still
+// being loaded is reported with the chain of imports that closes the cycle.
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/vm"
+)
+
+// Loader loads modules from a file system. Module paths are slash-separated
+// and relative to the root of the file system, as for fs.FS; imports can not
+// reach outside of it. A Loader is not safe for concurrent use.
+type Loader struct {
+	fsys    fs.FS
+	modules map[string]*object.Module // loaded modules by path
+
+	// Configure, if set, is called with the VM of every module before it
+	// runs, after it inherits from the importing VM, for example to restrict
+	// its capabilities further.
+	Configure func(*vm.VM)
+}
+
+// NewLoader returns a loader reading modules from fsys.
+func NewLoader(fsys fs.FS) *Loader {
+	return &Loader{fsys: fsys, modules: map[string]*object.Module{}}
+}
+
+// Importer returns the importer for the program at name, which resolves the
+// paths it imports relative to the directory of name.
+func (l *Loader) Importer(name string) object.Importer {
+	return &importer{loader: l, chain: []string{name}}
+}
+
+// Load returns the module at name, running it unless it was loaded before.
+func (l *Loader) Load(name string) (*object.Module, error) {
+	return l.load(nil, name, nil)
+}
+
+// load loads the module at name for the program running in parent, which is
+// nil for modules not imported by a running program.
+func (l *Loader) load(parent *vm.VM, name string, chain []string) (*object.Module, error) {
+	if mod, ok := l.modules[name]; ok {
+		return mod, nil
+	}
+
+	// chain never holds loaded modules, so name being in it closes a cycle
+	chain = append(chain[:len(chain):len(chain)], name)
+	for _, p := range chain[:len(chain)-1] {
+		if p == name {
+			return nil, &CycleError{Chain: chain}
+		}
+	}
+
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, &Error{Path: name, Err: err}
+	}
+	src := string(data)
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		return nil, &Error{Path: name, Src: src, Err: errs}
+	}
+	ctx, limits := context.Background(), evaluator.Limits{}
+	if parent != nil {
+		l := parent.Limits()
+		ctx, limits = parent.Context(), evaluator.Limits{
+			MaxSteps:     l.MaxSteps,
+			MaxDepth:     l.MaxDepth,
+			MaxAlloc:     l.MaxAlloc,
+			Capabilities: parent.Capabilities(),
+		}
+	}
+	prog, err = evaluator.ExpandContext(ctx, prog, limits)
+	if err != nil {
+		return nil, &Error{Path: name, Src: src, Err: err}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(prog); err != nil {
+		return nil, &Error{Path: name, Src: src, Err: err}
+	}
+
+	globals := make([]object.Object, vm.GlobalsSize)
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+	machine.SetImporter(&importer{loader: l, chain: chain})
+	if parent != nil {
+		machine.Inherit(parent)
+	}
+	if l.Configure != nil {
+		l.Configure(machine)
+	}
+	if err := machine.Run(); err != nil {
+		return nil, &Error{Path: name, Src: src, Err: err}
+	}
+
+	exports := object.NewHash()
+	for _, export := range exportedNames(prog) {
+		sym, _ := comp.SymbolTable().Resolve(export)
+		value := globals[sym.Index]
+		if value == nil {
+			value = object.NULL
+		}
+		exports.Set(&object.String{Value: export}, value)
+	}
+	exports.Frozen = true
+
+	mod := &object.Module{Path: name, Exports: exports}
+	l.modules[name] = mod
+	return mod, nil
+}
+
+// exportedNames returns the names of the export statements of prog.
+func exportedNames(prog *ast.Program) []string {
+	var names []string
+	for _, stmt := range prog.Statements {
+		export, ok := stmt.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		switch binding := export.Binding.(type) {
+		case *ast.LetStatement:
+			for _, name := range ast.PatternNames(binding.Name) {
+				names = append(names, name.Value)
+			}
+		case *ast.ConstStatement:
+			names = append(names, binding.Name.Value)
+		}
+	}
+	return names
+}
+
+// importer loads the modules imported by the last module of chain.
+type importer struct {
+	loader *Loader
+	chain  []string // the importing module and the modules importing it, outermost first
+}
+
+func (imp *importer) Import(p string) (*object.Module, error) {
+	return imp.ImportFrom(nil, p)
+}
+
+func (imp *importer) ImportFrom(parent *vm.VM, p string) (*object.Module, error) {
+	name := path.Join(path.Dir(imp.chain[len(imp.chain)-1]), p)
+	if !fs.ValidPath(name) {
+		return nil, object.Errorf(object.KindImport, "invalid import path %q", p)
+	}
+	return imp.loader.load(parent, name, imp.chain)
+}
+
+// Error is an error in a module: a module that can not be read, or a syntax,
+// compile or runtime error in its source Src.
+type Error struct {
+	Path string
+	Src  string // empty if the module could not be read
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Kind returns the kind of the runtime error raised by the module, or
+// object.KindImport if the module could not be loaded.
+func (e *Error) Kind() object.ErrorKind {
+	var runtimeErr *vm.Error
+	if errors.As(e.Err, &runtimeErr) {
+		return runtimeErr.Kind
+	}
+	return object.KindImport
+}
+
+// CycleError reports an import leading back to a module being loaded. Chain
+// lists the imports from the first module loaded to the repeated one.
+type CycleError struct {
+	Chain []string
+}
+
+func (e *CycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+func (e *CycleError) Kind() object.ErrorKind { return object.KindImport }
@@ -0,0 +1,180 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/vm"
+	"github.com/stretchr/testify/require"
+)
+
+// run runs src as the program main.mk, importing modules with l.
+func run(t *testing.T, l *Loader, src string) (object.Object, error) {
+	t.Helper()
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	comp := compiler.New()
+	require.NoError(t, comp.Compile(prog))
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetImporter(l.Importer("main.mk"))
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+func TestLoad(t *testing.T) {
+	req := require.New(t)
+
+	fsys := fstest.MapFS{
+		"lib/math.mk": {Data: []byte(`
+import "util.mk" as util
+let hidden = 2;
+export let square = fn(x) { x * x };
+export const two = util["double"](1);
+export let later = 1;
+let later = 5;`)},
+		"lib/util.mk": {Data: []byte(`
+import "../config.mk" as config
+export let double = fn(x) { x * config["factor"] };`)},
+		"config.mk": {Data: []byte(`export let factor = 2;`)},
+	}
+
+	runs := 0
+	l := NewLoader(fsys)
+	l.Configure = func(*vm.VM) { runs++ }
+
+	result, err := run(t, l, `
+import "lib/math.mk" as math
+import "lib/util.mk" as util
+let hidden = 1;
+[math["square"](3), math["two"], util["double"](5), math["later"], hidden]`)
+	req.NoError(err)
+	req.Equal("[9, 2, 10, 5, 1]", result.Inspect())
+	req.Equal(3, runs)
+
+	mod, err := l.Load("lib/math.mk")
+	req.NoError(err)
+	req.Equal("lib/math.mk", mod.Path)
+	req.True(mod.Exports.Frozen)
+	req.Len(mod.Exports.Keys, 3)
+	req.Equal(3, runs)
+
+	_, err = run(t, l, `import "lib/math.mk" as math; math["hidden"]`)
+	req.EqualError(err, `1:35: module "lib/math.mk" has no export "hidden"`)
+}
+
+func TestLoadErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.mk":      {Data: []byte(`import "lib/b.mk" as b`)},
+		"lib/b.mk":  {Data: []byte(`import "../a.mk" as a`)},
+		"self.mk":   {Data: []byte(`import "self.mk" as self`)},
+		"syntax.mk": {Data: []byte(`import "a.mk" b`)},
+		"type.mk":   {Data: []byte("let f = fn() {\n  1 + true\n};\nexport let x = f();")},
+		"throw.mk":  {Data: []byte(`throw "boom";`)},
+		"main.mk":   {Data: []byte(`import "a.mk" as a`)},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		kind     object.ErrorKind
+	}{
+		{`import "a.mk" as a`, "1:1: a.mk: 1:1: lib/b.mk: 1:1: import cycle: main.mk -> a.mk -> lib/b.mk -> a.mk", object.KindImport},
+		{`import "main.mk" as m`, "1:1: import cycle: main.mk -> main.mk", object.KindImport},
+		{`import "self.mk" as s`, "1:1: self.mk: 1:1: import cycle: main.mk -> self.mk -> self.mk", object.KindImport},
+		{`import "missing.mk" as m`, "1:1: missing.mk: file does not exist", object.KindImport},
+		{`import "../out.mk" as m`, `1:1: invalid import path "../out.mk"`, object.KindImport},
+		{`import "syntax.mk" as m`, `1:1: syntax.mk: 1:15: expected token "AS" but got "IDENT"`, object.KindImport},
+		{`import "type.mk" as m`, "1:1: type.mk: 2:5: type mismatch: INTEGER + BOOLEAN", object.KindType},
+		{`import "throw.mk" as m`, "1:1: throw.mk: 1:1: boom", object.KindError},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, NewLoader(fsys), tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := err.(*vm.Error).Kind; kind != tt.kind {
+			t.Errorf("%s: wrong kind. want=%s, got=%s", tt.input, tt.kind, kind)
+		}
+	}
+
+	_, err := NewLoader(fsys).Load("missing.mk")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	var cycle *CycleError
+	_, err = NewLoader(fsys).Load("a.mk")
+	require.True(t, errors.As(err, &cycle))
+	require.Equal(t, []string{"a.mk", "lib/b.mk", "a.mk"}, cycle.Chain)
+
+	var modErr *Error
+	_, err = run(t, NewLoader(fsys), `import "type.mk" as m`)
+	require.True(t, errors.As(err, &modErr))
+	require.Equal(t, "type.mk", modErr.Path)
+	require.Equal(t, string(fsys["type.mk"].Data), modErr.Src)
+}
+
+func TestInherit(t *testing.T) {
+	fsys := fstest.MapFS{
+		"env.mk":   {Data: []byte(`export let home = getenv("HOME");`)},
+		"loop.mk":  {Data: []byte(`while (true) {}`)},
+		"deep.mk":  {Data: []byte(`let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; export let x = f(50);`)},
+		"macro.mk": {Data: []byte(`let m = macro() { while (true) {} quote(1) }; export let x = m();`)},
+	}
+
+	compile := func(src string) *vm.VM {
+		p := parser.New(lexer.New(src))
+		prog := p.ParseProgram()
+		require.Empty(t, p.Errors())
+		comp := compiler.New()
+		require.NoError(t, comp.Compile(prog))
+		machine := vm.New(comp.Bytecode())
+		machine.SetImporter(NewLoader(fsys).Importer("main.mk"))
+		return machine
+	}
+
+	machine := compile(`import "env.mk" as env`)
+	machine.SetCapabilities(object.CapPure)
+	var permErr *vm.PermissionError
+	require.True(t, errors.As(machine.Run(), &permErr))
+	require.Equal(t, object.CapEnv, permErr.Capability)
+
+	machine = compile(`import "loop.mk" as loop`)
+	machine.SetLimits(vm.Limits{MaxSteps: 10000})
+	var stepErr *vm.StepLimitError
+	require.True(t, errors.As(machine.Run(), &stepErr))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	machine = compile(`import "loop.mk" as loop`)
+	require.True(t, errors.Is(machine.RunContext(ctx), context.Canceled))
+
+	machine = compile(`import "deep.mk" as deep`)
+	machine.SetLimits(vm.Limits{MaxDepth: 20})
+	var depthErr *vm.DepthLimitError
+	require.True(t, errors.As(machine.Run(), &depthErr))
+
+	machine = compile(`import "deep.mk" as deep`)
+	machine.SetLimits(vm.Limits{MaxDepth: 60})
+	require.NoError(t, machine.Run())
+
+	machine = compile(`import "macro.mk" as mac`)
+	machine.SetLimits(vm.Limits{MaxSteps: 10000})
+	err := machine.Run()
+	require.EqualError(t, err, "1:1: macro.mk: 1:62: macro m: step limit of 10000 exceeded")
+
+	machine = compile(`import "macro.mk" as mac`)
+	require.True(t, errors.Is(machine.RunContext(ctx), context.Canceled))
+}
@@ -0,0 +1,634 @@
+package monkey
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/riadafridishibly/go-monkey/object"
+)
+
+// ConversionError reports a value that cannot be converted between Go and
+// Monkey.
+type ConversionError struct {
+	Path string // where the value was found, as in "users[1].age"; empty for the value itself
+	From string // Monkey type or Go type of the value
+	To   string // Go type or "monkey value"
+}
+
+func (e *ConversionError) Error() string {
+	msg := fmt.Sprintf("cannot convert %s to %s", e.From, e.To)
+	if e.Path == "" {
+		return msg
+	}
+	return e.Path + ": " + msg
+}
+
+var (
+	valueType  = reflect.TypeOf((*Value)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToValue converts a Go value to a Monkey value.
+//
+// Integers of all sizes and *big.Int become integers, floats decimals with
+// the shortest digits that read back as the same float, bools booleans and
+// strings strings. NaN and infinities cannot be converted.
+// Slices and arrays become arrays and maps with string, integer or bool keys
+// become hashes, sorted by key. Structs become hashes of their exported
+// fields, keyed by the field name or by the name given in a `monkey:"name"`
+// tag; fields tagged `monkey:"-"` are skipped. Nil pointers, slices, maps
+// and interfaces become null, other pointers the value they point to.
+//
+// Functions become builtins converting their arguments with FromValue and
+// their result with ToValue. They may return nothing, a value, an error or a
+// value and an error.
+//
+// Values already of type Value are returned as they are. Values containing
+// themselves, through pointers, maps or slices, cannot be converted.
+func ToValue(v interface{}) (Value, error) {
+	if v == nil {
+		return object.NULL, nil
+	}
+	return toValue(reflect.ValueOf(v), "", visiting{})
+}
+
+// visiting holds the Go pointers, maps and slices, or the Monkey arrays and
+// hashes, whose conversion is in progress, to detect values that contain
+// themselves.
+type visiting map[interface{}]bool
+
+// goRef identifies a Go pointer, map or slice.
+type goRef struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// enter marks ref as being converted. It reports false if it already is,
+// because the value contains itself.
+func (v visiting) enter(ref interface{}) bool {
+	if v[ref] {
+		return false
+	}
+	v[ref] = true
+	return true
+}
+
+func (v visiting) leave(ref interface{}) {
+	delete(v, ref)
+}
+
+func toValue(rv reflect.Value, path string, seen visiting) (Value, error) {
+	nilable := rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface
+	if rv.Type().Implements(valueType) && !(nilable && rv.IsNil()) {
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type() == bigIntType && !rv.IsNil() {
+		return object.NewInteger(new(big.Int).Set(rv.Interface().(*big.Int))), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return object.NativeBoolToBoolean(rv.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, &ConversionError{Path: path, From: fmt.Sprintf("%s %d", rv.Type(), rv.Uint()), To: "INTEGER"}
+		}
+		return &object.Integer{Value: int64(rv.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, &ConversionError{Path: path, From: fmt.Sprintf("%s %v", rv.Type(), f), To: "DECIMAL"}
+		}
+		bits := 64
+		if rv.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return object.ParseDecimal(strconv.FormatFloat(f, 'f', -1, bits))
+
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return object.NULL, nil
+		}
+		if rv.Kind() == reflect.Ptr {
+			ref := goRef{ptr: rv.Pointer(), typ: rv.Type()}
+			if !seen.enter(ref) {
+				return nil, cycleError(rv, path)
+			}
+			defer seen.leave(ref)
+		}
+		return toValue(rv.Elem(), path, seen)
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice {
+			if rv.IsNil() {
+				return object.NULL, nil
+			}
+			ref := goRef{ptr: rv.Pointer(), len: rv.Len(), typ: rv.Type()}
+			if !seen.enter(ref) {
+				return nil, cycleError(rv, path)
+			}
+			defer seen.leave(ref)
+		}
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			el, err := toValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return object.NULL, nil
+		}
+		ref := goRef{ptr: rv.Pointer(), typ: rv.Type()}
+		if !seen.enter(ref) {
+			return nil, cycleError(rv, path)
+		}
+		defer seen.leave(ref)
+		return mapToHash(rv, path, seen)
+
+	case reflect.Struct:
+		return structToHash(rv, path, seen)
+
+	case reflect.Func:
+		if rv.IsNil() {
+			return object.NULL, nil
+		}
+		return funcToBuiltin("", rv)
+	}
+
+	return nil, &ConversionError{Path: path, From: rv.Type().String(), To: "monkey value"}
+}
+
+// cycleError reports the Go value rv, found again inside itself at path.
+func cycleError(rv reflect.Value, path string) error {
+	return &ConversionError{Path: path, From: "cyclic " + rv.Type().String(), To: "monkey value"}
+}
+
+func mapToHash(rv reflect.Value, path string, seen visiting) (Value, error) {
+	type pair struct {
+		key   object.Hashable
+		value reflect.Value
+	}
+
+	pairs := make([]pair, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := toValue(iter.Key(), path, seen)
+		if err != nil {
+			return nil, err
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, &ConversionError{Path: path, From: rv.Type().String(), To: "HASH"}
+		}
+		pairs = append(pairs, pair{hashKey, iter.Value()})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].key.(Value), pairs[j].key.(Value))
+	})
+
+	hash := object.NewHash()
+	for _, p := range pairs {
+		value, err := toValue(p.value, fmt.Sprintf("%s[%s]", path, p.key.(Value).Inspect()), seen)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(p.key, value)
+	}
+	return hash, nil
+}
+
+// lessKey orders hash keys, grouping them by type first. Integers and
+// decimals are grouped together, by value.
+func lessKey(a, b Value) bool {
+	if isNumber(a) && isNumber(b) {
+		if c := object.CompareNumbers(a, b); c != 0 {
+			return c < 0
+		}
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *object.String:
+		return a.Value < b.(*object.String).Value
+	case *object.Boolean:
+		return !a.Value && b.(*object.Boolean).Value
+	}
+	return false
+}
+
+func isNumber(v Value) bool {
+	return v.Type() == object.INTEGER_OBJ || v.Type() == object.DECIMAL_OBJ
+}
+
+func structToHash(rv reflect.Value, path string, seen visiting) (Value, error) {
+	hash := object.NewHash()
+	for _, f := range structFields(rv.Type()) {
+		value, err := toValue(rv.Field(f.index), joinPath(path, f.name), seen)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&object.String{Value: f.name}, value)
+	}
+	return hash, nil
+}
+
+type field struct {
+	name  string
+	index int
+}
+
+// structFields returns the exported fields of t along with their names in
+// Monkey.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, field{name: name, index: i})
+	}
+	return fields
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// funcToBuiltin wraps the Go function fn in a builtin.
+func funcToBuiltin(name string, fn reflect.Value) (*object.Builtin, error) {
+	t := fn.Type()
+
+	switch t.NumOut() {
+	case 0:
+	case 1:
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, &ConversionError{From: t.String(), To: "BUILTIN"}
+		}
+	default:
+		return nil, &ConversionError{From: t.String(), To: "BUILTIN"}
+	}
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	numIn := t.NumIn()
+	prefix := ""
+	if name != "" {
+		prefix = name + ": "
+	}
+
+	call := func(_ object.Host, args ...object.Object) (object.Object, error) {
+		if t.IsVariadic() {
+			if len(args) < numIn-1 {
+				return nil, fmt.Errorf("%swrong number of arguments: want at least %d, got=%d", prefix, numIn-1, len(args))
+			}
+		} else if len(args) != numIn {
+			return nil, fmt.Errorf("%swrong number of arguments: want=%d, got=%d", prefix, numIn, len(args))
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var argType reflect.Type
+			if t.IsVariadic() && i >= numIn-1 {
+				argType = t.In(numIn - 1).Elem()
+			} else {
+				argType = t.In(i)
+			}
+
+			in[i] = reflect.New(argType).Elem()
+			if err := fromValue(arg, in[i], fmt.Sprintf("argument %d", i+1), visiting{}); err != nil {
+				return nil, fmt.Errorf("%s%w", prefix, err)
+			}
+		}
+
+		out := fn.Call(in)
+		if returnsError {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return nil, err.Interface().(error)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return object.NULL, nil
+		}
+
+		result, err := toValue(out[0], "result", visiting{})
+		if err != nil {
+			return nil, fmt.Errorf("%s%w", prefix, err)
+		}
+		return result, nil
+	}
+
+	return &object.Builtin{Name: name, Fn: call}, nil
+}
+
+// RegisterFunc makes the Go function fn callable from scripts as name. Its
+// arguments and result are converted as by FromValue and ToValue.
+func (in *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return fmt.Errorf("RegisterFunc: %T is not a function", fn)
+	}
+
+	builtin, err := funcToBuiltin(name, rv)
+	if err != nil {
+		return err
+	}
+	in.Set(name, builtin)
+	return nil
+}
+
+// FromValue stores the Go equivalent of the Monkey value v in the value ptr
+// points to. The conversions are the reverse of those of ToValue; hashes can
+// be stored in maps and structs, where keys without a matching field are
+// ignored. Integers can also be stored in a *big.Int, and decimals and
+// integers in floats, rounded to the nearest float. Stored in an empty
+// interface, integers become int64, or *big.Int when they do not fit,
+// decimals float64, arrays []interface{} and hashes map[string]interface{},
+// or map[interface{}]interface{} when they have keys other than strings.
+// Arrays and hashes containing themselves cannot be converted.
+func FromValue(v Value, ptr interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("FromValue: want a non-nil pointer, got %T", ptr)
+	}
+	return fromValue(v, rv.Elem(), "", visiting{})
+}
+
+func fromValue(v Value, dst reflect.Value, path string, seen visiting) error {
+	if v == nil {
+		v = object.NULL
+	}
+
+	mismatch := func() error {
+		return &ConversionError{Path: path, From: string(v.Type()), To: dst.Type().String()}
+	}
+
+	if reflect.TypeOf(v).AssignableTo(dst.Type()) && dst.Type() != reflect.TypeOf((*interface{})(nil)).Elem() {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	if dst.Type() == bigIntType && v.Type() == object.INTEGER_OBJ {
+		dst.Set(reflect.ValueOf(new(big.Int).Set(integerValue(v))))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch()
+		}
+		native, err := nativeValue(v, path, seen)
+		if err != nil {
+			return err
+		}
+		if native == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(native))
+		}
+		return nil
+
+	case reflect.Ptr:
+		if v == object.NULL {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		elem := reflect.New(dst.Type().Elem())
+		if err := fromValue(v, elem.Elem(), path, seen); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+
+	switch v.(type) {
+	case *object.Array, *object.Hash:
+		if !seen.enter(v) {
+			return &ConversionError{Path: path, From: "cyclic " + string(v.Type()), To: dst.Type().String()}
+		}
+		defer seen.leave(v)
+	}
+
+	switch v := v.(type) {
+	case *object.Null:
+		switch dst.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Func:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+
+	case *object.Boolean:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(v.Value)
+			return nil
+		}
+
+	case *object.Integer, *object.BigInt, *object.Decimal:
+		if dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64 {
+			f, err := strconv.ParseFloat(v.Inspect(), dst.Type().Bits())
+			if err != nil {
+				return &ConversionError{Path: path, From: string(v.Type()) + " " + v.Inspect(), To: dst.Type().String()}
+			}
+			dst.SetFloat(f)
+			return nil
+		}
+		n, ok := v.(*object.Integer)
+		if !ok {
+			break
+		}
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(n.Value) {
+				return &ConversionError{Path: path, From: "INTEGER " + n.Inspect(), To: dst.Type().String()}
+			}
+			dst.SetInt(n.Value)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n.Value < 0 || dst.OverflowUint(uint64(n.Value)) {
+				return &ConversionError{Path: path, From: "INTEGER " + n.Inspect(), To: dst.Type().String()}
+			}
+			dst.SetUint(uint64(n.Value))
+			return nil
+		}
+
+	case *object.String:
+		if dst.Kind() == reflect.String {
+			dst.SetString(v.Value)
+			return nil
+		}
+
+	case *object.Array:
+		switch dst.Kind() {
+		case reflect.Slice:
+			slice := reflect.MakeSlice(dst.Type(), len(v.Elements), len(v.Elements))
+			for i, el := range v.Elements {
+				if err := fromValue(el, slice.Index(i), fmt.Sprintf("%s[%d]", path, i), seen); err != nil {
+					return err
+				}
+			}
+			dst.Set(slice)
+			return nil
+		case reflect.Array:
+			if dst.Len() != len(v.Elements) {
+				return &ConversionError{Path: path, From: fmt.Sprintf("ARRAY of length %d", len(v.Elements)), To: dst.Type().String()}
+			}
+			for i, el := range v.Elements {
+				if err := fromValue(el, dst.Index(i), fmt.Sprintf("%s[%d]", path, i), seen); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case *object.Hash:
+		switch dst.Kind() {
+		case reflect.Map:
+			m := reflect.MakeMapWithSize(dst.Type(), len(v.Keys))
+			for _, k := range v.Keys {
+				pair := v.Pairs[k]
+				elemPath := fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())
+
+				key := reflect.New(dst.Type().Key()).Elem()
+				if err := fromValue(pair.Key, key, elemPath, seen); err != nil {
+					return err
+				}
+				value := reflect.New(dst.Type().Elem()).Elem()
+				if err := fromValue(pair.Value, value, elemPath, seen); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, value)
+			}
+			dst.Set(m)
+			return nil
+		case reflect.Struct:
+			for _, f := range structFields(dst.Type()) {
+				value, ok := v.Get(&object.String{Value: f.name})
+				if !ok {
+					continue
+				}
+				if err := fromValue(value, dst.Field(f.index), joinPath(path, f.name), seen); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return mismatch()
+}
+
+// nativeValue returns the natural Go representation of v.
+func nativeValue(v Value, path string, seen visiting) (interface{}, error) {
+	switch v.(type) {
+	case *object.Array, *object.Hash:
+		if !seen.enter(v) {
+			return nil, &ConversionError{Path: path, From: "cyclic " + string(v.Type()), To: "interface {}"}
+		}
+		defer seen.leave(v)
+	}
+
+	switch v := v.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return v.Value, nil
+	case *object.Integer:
+		return v.Value, nil
+	case *object.BigInt:
+		return new(big.Int).Set(v.Value), nil
+	case *object.Decimal:
+		f, err := strconv.ParseFloat(v.Inspect(), 64)
+		if err != nil {
+			return nil, &ConversionError{Path: path, From: "DECIMAL " + v.Inspect(), To: "float64"}
+		}
+		return f, nil
+	case *object.String:
+		return v.Value, nil
+
+	case *object.Array:
+		elements := make([]interface{}, len(v.Elements))
+		for i, el := range v.Elements {
+			native, err := nativeValue(el, fmt.Sprintf("%s[%d]", path, i), seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+
+	case *object.Hash:
+		stringKeys := true
+		for _, k := range v.Keys {
+			if k.Type != object.STRING_OBJ {
+				stringKeys = false
+			}
+		}
+
+		strs := map[string]interface{}{}
+		mixed := map[interface{}]interface{}{}
+		for _, k := range v.Keys {
+			pair := v.Pairs[k]
+			native, err := nativeValue(pair.Value, fmt.Sprintf("%s[%s]", path, pair.Key.Inspect()), seen)
+			if err != nil {
+				return nil, err
+			}
+			key, _ := nativeValue(pair.Key, path, seen)
+			if stringKeys {
+				strs[key.(string)] = native
+			} else {
+				mixed[key] = native
+			}
+		}
+		if stringKeys {
+			return strs, nil
+		}
+		return mixed, nil
+	}
+
+	// functions and other values are kept as they are
+	return v, nil
+}
+
+// integerValue returns the value of an integer as a big.Int.
+func integerValue(v Value) *big.Int {
+	if i, ok := v.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return v.(*object.BigInt).Value
+}
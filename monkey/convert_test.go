@@ -0,0 +1,264 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City string `monkey:"city"`
+	Zip  string `monkey:"-"`
+}
+
+type user struct {
+	Name    string   `monkey:"name"`
+	Age     uint8    `monkey:"age"`
+	Tags    []string `monkey:"tags"`
+	Address *address `monkey:"address"`
+	Admin   bool
+	secret  string
+}
+
+func TestToValue(t *testing.T) {
+	tests := []struct {
+		in       interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint32(7), "7"},
+		{true, "true"},
+		{"hi", `"hi"`},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{[]string(nil), "null"},
+		{map[string]int{"b": 2, "a": 1}, `{"a": 1, "b": 2}`},
+		{map[int]string{2: "b", 1: "a"}, `{1: "a", 2: "b"}`},
+		{&object.Integer{Value: 5}, "5"},
+		{new(big.Int).Lsh(big.NewInt(1), 64), "18446744073709551616"},
+		{big.NewInt(-3), "-3"},
+		{map[*big.Int]bool{new(big.Int).Lsh(big.NewInt(1), 64): true}, "{18446744073709551616: true}"},
+		{
+			user{Name: "ann", Age: 30, Tags: []string{"x"}, Address: &address{City: "Oslo", Zip: "0150"}, secret: "s"},
+			`{"name": "ann", "age": 30, "tags": ["x"], "address": {"city": "Oslo"}, "Admin": false}`,
+		},
+		{user{}, `{"name": "", "age": 0, "tags": null, "address": null, "Admin": false}`},
+		{1.5, "1.5"},
+		{[]float64{0.1, -2, 1e21}, "[0.1, -2, 1000000000000000000000]"},
+		{float32(0.1), "0.1"},
+		{map[float64]bool{2.5: true, -1: false, 0.25: true}, "{-1: false, 0.25: true, 2.5: true}"},
+		{map[interface{}]int{1.5: 0, 2: 1, -3: 2, 0.5: 3, "a": 4}, `{-3: 2, 0.5: 3, 1.5: 0, 2: 1, "a": 4}`},
+	}
+
+	for _, tt := range tests {
+		v, err := ToValue(tt.in)
+		require.NoError(t, err, "%#v", tt.in)
+		require.Equal(t, tt.expected, v.Inspect(), "%#v", tt.in)
+	}
+}
+
+func TestToValueErrors(t *testing.T) {
+	tests := []struct {
+		in       interface{}
+		expected string
+	}{
+		{complex(1, 2), "cannot convert complex128 to monkey value"},
+		{uint64(1 << 63), "cannot convert uint64 9223372036854775808 to INTEGER"},
+		{map[string][]interface{}{"k": {1, math.NaN()}}, `["k"][1]: cannot convert float64 NaN to DECIMAL`},
+		{struct{ Ch chan int }{}, "Ch: cannot convert chan int to monkey value"},
+		{func() (int, int) { return 0, 0 }, "cannot convert func() (int, int) to BUILTIN"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToValue(tt.in)
+		var cerr *ConversionError
+		require.True(t, errors.As(err, &cerr), "%#v: %v", tt.in, err)
+		require.EqualError(t, err, tt.expected)
+	}
+
+	type node struct {
+		Value int
+		Next  *node
+	}
+	n := &node{Value: 1}
+	n.Next = &node{Value: 2, Next: n}
+	_, err := ToValue(n)
+	require.EqualError(t, err, "Next.Next: cannot convert cyclic *monkey.node to monkey value")
+
+	loop := []interface{}{1, nil}
+	loop[1] = loop
+	_, err = ToValue(loop)
+	require.EqualError(t, err, "[1]: cannot convert cyclic []interface {} to monkey value")
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	_, err = ToValue(m)
+	require.EqualError(t, err, `["self"]: cannot convert cyclic map[string]interface {} to monkey value`)
+
+	// values shared without a cycle are converted every time they occur
+	shared := &address{City: "Oslo"}
+	v, err := ToValue([]*address{shared, shared})
+	require.NoError(t, err)
+	require.Equal(t, `[{"city": "Oslo"}, {"city": "Oslo"}]`, v.Inspect())
+}
+
+func TestFromValue(t *testing.T) {
+	in := New()
+	prog, err := in.Compile(`{"name": "bob", "age": 41, "tags": ["a", "b"], "address": {"city": "Rome"}, "extra": 1}`)
+	require.NoError(t, err)
+	v, err := in.Run(context.Background(), prog, nil)
+	require.NoError(t, err)
+
+	var u user
+	require.NoError(t, FromValue(v, &u))
+	require.Equal(t, user{Name: "bob", Age: 41, Tags: []string{"a", "b"}, Address: &address{City: "Rome"}}, u)
+
+	var m map[string]interface{}
+	require.NoError(t, FromValue(v, &m))
+	require.Equal(t, int64(41), m["age"])
+	require.Equal(t, []interface{}{"a", "b"}, m["tags"])
+	require.Equal(t, map[string]interface{}{"city": "Rome"}, m["address"])
+
+	var native interface{}
+	h := object.NewHash()
+	h.Set(&object.Integer{Value: 1}, object.NULL)
+	require.NoError(t, FromValue(h, &native))
+	require.Equal(t, map[interface{}]interface{}{int64(1): nil}, native)
+
+	var arr [2]int
+	require.NoError(t, FromValue(&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}}, &arr))
+	require.Equal(t, [2]int{1, 2}, arr)
+
+	var obj object.Object
+	require.NoError(t, FromValue(object.TRUE, &obj))
+	require.Equal(t, object.TRUE, obj)
+
+	p := &address{}
+	require.NoError(t, FromValue(object.NULL, &p))
+	require.Nil(t, p)
+
+	large := object.NewInteger(new(big.Int).Lsh(big.NewInt(1), 64))
+	var n *big.Int
+	require.NoError(t, FromValue(large, &n))
+	require.Equal(t, "18446744073709551616", n.String())
+	require.NoError(t, FromValue(&object.Integer{Value: 7}, &n))
+	require.Equal(t, "7", n.String())
+	require.NoError(t, FromValue(large, &native))
+	require.Equal(t, n.Lsh(big.NewInt(1), 64), native)
+	require.Error(t, FromValue(large, new(int64)))
+
+	dec, err := object.ParseDecimal("2.50")
+	require.NoError(t, err)
+	var f float64
+	require.NoError(t, FromValue(dec, &f))
+	require.Equal(t, 2.5, f)
+	var f32 float32
+	require.NoError(t, FromValue(&object.Integer{Value: 3}, &f32))
+	require.Equal(t, float32(3), f32)
+	require.NoError(t, FromValue(dec, &native))
+	require.Equal(t, 2.5, native)
+}
+
+func TestFromValueErrors(t *testing.T) {
+	integer := func(n int64) object.Object { return &object.Integer{Value: n} }
+	str := func(s string) object.Object { return &object.String{Value: s} }
+
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "age"}, str("old"))
+
+	tests := []struct {
+		v        object.Object
+		ptr      interface{}
+		expected string
+	}{
+		{str("x"), new(int), "cannot convert STRING to int"},
+		{integer(300), new(uint8), "cannot convert INTEGER 300 to uint8"},
+		{integer(-1), new(uint), "cannot convert INTEGER -1 to uint"},
+		{object.NULL, new(bool), "cannot convert NULL to bool"},
+		{&object.Array{Elements: []object.Object{integer(1), str("2")}}, new([]int), "[1]: cannot convert STRING to int"},
+		{&object.Array{Elements: []object.Object{integer(1)}}, new([2]int), "cannot convert ARRAY of length 1 to [2]int"},
+		{hash, new(user), "age: cannot convert STRING to uint8"},
+		{hash, new(map[string]int), `["age"]: cannot convert STRING to int`},
+		{&object.Decimal{Unscaled: big.NewInt(15), Scale: 1}, new(int), "cannot convert DECIMAL to int"},
+		{&object.Decimal{Unscaled: new(big.Int).Exp(big.NewInt(10), big.NewInt(400), nil)}, new(float64), "cannot convert DECIMAL 1" + strings.Repeat("0", 400) + " to float64"},
+	}
+
+	for _, tt := range tests {
+		err := FromValue(tt.v, tt.ptr)
+		var cerr *ConversionError
+		require.True(t, errors.As(err, &cerr), "%s: %v", tt.v.Inspect(), err)
+		require.EqualError(t, err, tt.expected)
+	}
+
+	require.EqualError(t, FromValue(integer(1), 1), "FromValue: want a non-nil pointer, got int")
+
+	cyclic := &object.Array{Elements: []object.Object{nil}}
+	cyclic.Elements[0] = cyclic
+	require.EqualError(t, FromValue(cyclic, new(interface{})), "[0]: cannot convert cyclic ARRAY to interface {}")
+	require.EqualError(t, FromValue(cyclic, new([]interface{})), "[0]: cannot convert cyclic ARRAY to interface {}")
+}
+
+func TestRegisterFunc(t *testing.T) {
+	in := New()
+	require.NoError(t, in.RegisterFunc("greet", func(name string, times int) string {
+		return strings.Repeat("hi "+name+" ", times)
+	}))
+	require.NoError(t, in.RegisterFunc("sum", func(nums ...int) int {
+		total := 0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	}))
+	require.NoError(t, in.RegisterFunc("check", func(ok bool) error {
+		if !ok {
+			return fmt.Errorf("check failed")
+		}
+		return nil
+	}))
+	require.NoError(t, in.RegisterFunc("lookup", func(u user) (*address, error) { return u.Address, nil }))
+	require.Error(t, in.RegisterFunc("bad", 42))
+
+	tests := []struct {
+		src      string
+		expected string
+		err      string
+	}{
+		{src: `greet("bo", 2)`, expected: `"hi bo hi bo "`},
+		{src: `sum()`, expected: "0"},
+		{src: `sum(1, 2, 3)`, expected: "6"},
+		{src: `check(true)`, expected: "null"},
+		{src: `lookup({"address": {"city": "Oslo"}})`, expected: `{"city": "Oslo"}`},
+		{src: `lookup({})`, expected: "null"},
+		{src: `check(false)`, err: "1:6: check failed"},
+		{src: `greet("bo")`, err: "1:6: greet: wrong number of arguments: want=2, got=1"},
+		{src: `greet("bo", "2")`, err: "1:6: greet: argument 2: cannot convert STRING to int"},
+		{src: `sum(1, true)`, err: "1:4: sum: argument 2: cannot convert BOOLEAN to int"},
+	}
+
+	for _, tt := range tests {
+		result, err := run(t, in, tt.src, nil)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err, tt.src)
+			continue
+		}
+		require.NoError(t, err, tt.src)
+		require.Equal(t, tt.expected, result.Inspect(), tt.src)
+	}
+
+	// funcs converted by ToValue check their arguments too
+	fn, err := ToValue(func(n int) int { return n + 1 })
+	require.NoError(t, err)
+	result, err := run(t, in, "f(1)", map[string]Value{"f": fn})
+	require.NoError(t, err)
+	require.Equal(t, "2", result.Inspect())
+}
@@ -0,0 +1,391 @@
+// Package monkey embeds the Monkey language in Go programs.
+//
+// An Interpreter compiles scripts once and runs them any number of times:
+//
+//	in := monkey.New()
+//	in.Register("log", func(args ...monkey.Value) (monkey.Value, error) {
+//		log.Println(args)
+//		return nil, nil
+//	})
+//	prog, err := in.Compile(`if (age > 17) { log("adult") }`)
+//	...
+//	result, err := in.Run(ctx, prog, map[string]monkey.Value{
+//		"age": &object.Integer{Value: 21},
+//	})
+//
+// Scripts may use globals they do not define. They are looked up when the
+// program runs, first in the globals passed to Run and then in the globals
+// of the interpreter. The top-level let and const statements of a script
+// set globals of the interpreter, which later scripts and Get can see, and
+// so do the assignments of a script to the globals of the interpreter.
+// Functions keep sharing the globals of the script defining them. Later
+// scripts can neither assign to nor redeclare the globals set by const
+// statements or SetConst.
+//
+// The limits and capabilities of an interpreter bound the macros of the
+// scripts it compiles as well as the scripts it runs.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/token"
+	"github.com/riadafridishibly/go-monkey/vm"
+)
+
+// Value is a Monkey value.
+type Value = object.Object
+
+// Func is a Go function callable from scripts. A nil result is turned into
+// null; a non-nil error stops the script with a RuntimeError.
+type Func func(args ...Value) (Value, error)
+
+// Interpreter holds the globals shared by the scripts it runs. It is safe
+// for concurrent use, but scripts running at the same time must not modify
+// the same globals, nor the arrays and hashes they hold. Share values with
+// concurrent scripts through SetConst, frozen with object.Freeze.
+type Interpreter struct {
+	mu      sync.Mutex
+	globals map[string]*object.Cell
+	consts  map[string]bool // globals scripts can not assign to
+	limits  vm.Limits
+
+	capabilities []Capability
+	output       io.Writer
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithMaxSteps stops scripts executing more than n instructions with a
+// *StepLimitError.
+func WithMaxSteps(n int64) Option {
+	return func(in *Interpreter) { in.limits.MaxSteps = n }
+}
+
+// WithMaxDepth stops scripts nesting more than n function calls with a
+// *DepthLimitError. The default is 1024.
+func WithMaxDepth(n int) Option {
+	return func(in *Interpreter) { in.limits.MaxDepth = n }
+}
+
+// WithMaxAlloc stops scripts creating strings longer than n bytes, or arrays
+// and hashes of more than n elements, with an *AllocLimitError.
+func WithMaxAlloc(n int) Option {
+	return func(in *Interpreter) { in.limits.MaxAlloc = n }
+}
+
+// WithOutput makes builtins such as puts print to w instead of the standard
+// output.
+func WithOutput(w io.Writer) Option {
+	return func(in *Interpreter) { in.output = w }
+}
+
+// Capability names a group of builtins with the same access to the host.
+type Capability = object.Capability
+
+// The capabilities of the builtins.
+const (
+	CapPure    = object.CapPure
+	CapTime    = object.CapTime
+	CapFSRead  = object.CapFSRead
+	CapFSWrite = object.CapFSWrite
+	CapEnv     = object.CapEnv
+	CapRandom  = object.CapRandom
+	CapOutput  = object.CapOutput
+)
+
+// WithCapabilities grants scripts only the builtins of caps; calling any
+// other builtin fails with a *PermissionError. Functions registered with the
+// interpreter need no capability. By default only CapPure and CapOutput are
+// granted; pass the other capabilities to let scripts reach the host.
+func WithCapabilities(caps ...Capability) Option {
+	return func(in *Interpreter) {
+		in.capabilities = append([]Capability{}, caps...)
+	}
+}
+
+// PermissionError is the error of a script calling a builtin whose
+// capability was not granted, wrapped in a *RuntimeError.
+type PermissionError = vm.PermissionError
+
+// The errors of the limits, wrapped in a *RuntimeError.
+type (
+	StepLimitError  = vm.StepLimitError
+	DepthLimitError = vm.DepthLimitError
+	AllocLimitError = vm.AllocLimitError
+)
+
+// New returns an interpreter without globals whose scripts may only call the
+// builtins of CapPure and CapOutput.
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		globals:      map[string]*object.Cell{},
+		consts:       map[string]bool{},
+		capabilities: []Capability{CapPure, CapOutput},
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	return in
+}
+
+// Set sets the global name to v.
+func (in *Interpreter) Set(name string, v Value) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.globals[name] = &object.Cell{Value: v}
+	delete(in.consts, name)
+}
+
+// SetConst sets the global name to v and keeps scripts from assigning to
+// it. Freeze v with object.Freeze to keep scripts from changing its
+// elements too.
+func (in *Interpreter) SetConst(name string, v Value) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.globals[name] = &object.Cell{Value: v}
+	in.consts[name] = true
+}
+
+// Get returns the value of the global name.
+func (in *Interpreter) Get(name string) (Value, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	cell, ok := in.globals[name]
+	if !ok {
+		return nil, false
+	}
+	return cell.Value, true
+}
+
+// Register makes fn callable from scripts as name.
+func (in *Interpreter) Register(name string, fn Func) {
+	in.Set(name, &object.Builtin{Name: name, Fn: func(_ object.Host, args ...object.Object) (object.Object, error) {
+		return fn(args...)
+	}})
+}
+
+// Program is a compiled script.
+type Program struct {
+	bytecode   *compiler.Bytecode
+	numGlobals int
+	globals    []compiler.Symbol   // top-level names, by slot
+	externals  []compiler.External // names to be provided by Run
+	decls      map[string]token.Position
+}
+
+// Compile compiles source. Syntax errors are reported as an ErrorList,
+// other errors as an *Error.
+func (in *Interpreter) Compile(source string) (*Program, error) {
+	return in.CompileContext(context.Background(), source)
+}
+
+// CompileContext is Compile, stopping the macros of source once they
+// exceed the step, depth or allocation limit of the interpreter or ctx is
+// done. The *Error then wraps the limit error or the error of ctx. Macros
+// may only call the builtins of the capabilities of the interpreter.
+func (in *Interpreter) CompileContext(ctx context.Context, source string) (*Program, error) {
+	p := parser.New(lexer.New(source))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		list := make(ErrorList, len(errs))
+		for i, e := range errs {
+			list[i] = &Error{Pos: e.Pos, Msg: e.Msg}
+		}
+		return nil, list
+	}
+	prog, err := evaluator.ExpandContext(ctx, prog, evaluator.Limits{
+		MaxSteps: in.limits.MaxSteps,
+		MaxDepth: in.limits.MaxDepth,
+		MaxAlloc: in.limits.MaxAlloc,
+
+		Capabilities: in.capabilities,
+	})
+	if err != nil {
+		e := err.(*evaluator.MacroError)
+		return nil, &Error{Pos: e.Pos, Msg: e.Msg, Err: e.Err}
+	}
+
+	comp := compiler.New()
+	comp.EnableExternals()
+	comp.EnableGlobalCells()
+	if err := comp.Compile(prog); err != nil {
+		if e, ok := err.(*compiler.Error); ok {
+			return nil, &Error{Pos: e.Pos, Msg: e.Msg}
+		}
+		return nil, err
+	}
+
+	return &Program{
+		bytecode:   comp.Bytecode(),
+		numGlobals: comp.SymbolTable().NumDefinitions(),
+		globals:    comp.SymbolTable().Symbols(),
+		externals:  comp.Externals(),
+		decls:      declarations(prog),
+	}, nil
+}
+
+// declarations returns the positions of the names declared by the top-level
+// statements of prog.
+func declarations(prog *ast.Program) map[string]token.Position {
+	decls := map[string]token.Position{}
+	for _, stmt := range prog.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Binding
+		}
+		var names []*ast.Identifier
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			names = ast.PatternNames(stmt.Name)
+		case *ast.ConstStatement:
+			names = []*ast.Identifier{stmt.Name}
+		case *ast.ImportStatement:
+			names = []*ast.Identifier{stmt.Name}
+		}
+		for _, name := range names {
+			if _, ok := decls[name.Value]; !ok {
+				decls[name.Value] = name.Token.Pos
+			}
+		}
+	}
+	return decls
+}
+
+// Run runs program and returns the value of its last expression statement,
+// or of its top-level return statement. globals provides values for the
+// globals of this run only; they take precedence over the globals of the
+// interpreter. Errors raised while the program runs are *RuntimeError,
+// including the program being stopped by ctx.
+func (in *Interpreter) Run(ctx context.Context, program *Program, globals map[string]Value) (Value, error) {
+	// the globals are kept in cells, which the interpreter shares with
+	// later programs and the functions of the program keep using
+	store := make([]object.Object, program.numGlobals)
+	machine := vm.NewWithGlobalsStore(program.bytecode, store)
+
+	in.mu.Lock()
+	for _, sym := range program.globals {
+		if pos, ok := program.decls[sym.Name]; ok && in.consts[sym.Name] {
+			in.mu.Unlock()
+			return nil, &Error{Pos: pos, Msg: fmt.Sprintf("cannot redeclare constant %s", sym.Name)}
+		}
+	}
+	for _, ext := range program.externals {
+		if v, ok := globals[ext.Name]; ok {
+			store[ext.Index] = &object.Cell{Value: v}
+			continue
+		}
+		cell, ok := in.globals[ext.Name]
+		if !ok {
+			in.mu.Unlock()
+			return nil, &Error{Pos: ext.Pos, Msg: fmt.Sprintf("undefined: %s", ext.Name)}
+		}
+		if in.consts[ext.Name] {
+			machine.SetConst(ext.Index, ext.Name)
+		}
+		store[ext.Index] = cell
+	}
+	in.mu.Unlock()
+
+	machine.SetLimits(in.limits)
+	machine.SetCapabilities(in.capabilities...)
+	if in.output != nil {
+		machine.SetOutput(in.output)
+	}
+	if err := machine.RunContext(ctx); err != nil {
+		if e, ok := err.(*vm.Error); ok {
+			return nil, &RuntimeError{Kind: e.Kind, Pos: e.Pos, End: e.End, Msg: e.Message, Trace: e.Trace, Err: e.Err}
+		}
+		return nil, err
+	}
+
+	in.mu.Lock()
+	for _, sym := range program.globals {
+		// constants set while the program ran are kept too
+		cell, ok := store[sym.Index].(*object.Cell)
+		if ok && sym.Cell && !program.isExternal(sym) && !in.consts[sym.Name] {
+			in.globals[sym.Name] = cell
+			if sym.Const {
+				in.consts[sym.Name] = true
+			}
+		}
+	}
+	in.mu.Unlock()
+
+	result := machine.LastPoppedStackElem()
+	if result == nil {
+		result = object.NULL
+	}
+	return result, nil
+}
+
+func (p *Program) isExternal(sym compiler.Symbol) bool {
+	for _, ext := range p.externals {
+		if ext.Index == sym.Index {
+			return true
+		}
+	}
+	return false
+}
+
+// Error is an error found while compiling a script, or a global the script
+// uses that was not provided when it ran.
+type Error struct {
+	Pos token.Position
+	Msg string
+	Err error // the limit error or the error of the context stopping macros, if any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorList is the list of syntax errors of a script.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// RuntimeError is an error raised while a script runs, at the source span
+// from Pos to End. Err is the underlying error, such as the error returned
+// by a Go function, a limit error or the error of a done context.
+type RuntimeError struct {
+	Kind  ErrorKind
+	Pos   token.Position
+	End   token.Position
+	Msg   string
+	Trace []TraceEntry // innermost call first
+	Err   error
+}
+
+// ErrorKind classifies runtime errors, such as "TypeError".
+type ErrorKind = object.ErrorKind
+
+// TraceEntry is a function call in progress when a RuntimeError was raised.
+type TraceEntry = vm.TraceEntry
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
@@ -0,0 +1,355 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, in *Interpreter, src string, globals map[string]Value) (Value, error) {
+	t.Helper()
+
+	prog, err := in.Compile(src)
+	require.NoError(t, err)
+	return in.Run(context.Background(), prog, globals)
+}
+
+func TestRun(t *testing.T) {
+	in := New()
+	in.Set("base", &object.Integer{Value: 10})
+	in.Register("double", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("double: want 1 argument, got %d", len(args))
+		}
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("double: want INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: n.Value * 2}, nil
+	})
+
+	prog, err := in.Compile("let total = double(base + x); total + 1")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		x    int64
+		want string
+	}{{1, "23"}, {5, "31"}} {
+		result, err := in.Run(context.Background(), prog, map[string]Value{
+			"x": &object.Integer{Value: tt.x},
+		})
+		require.NoError(t, err)
+		require.Equal(t, tt.want, result.Inspect())
+	}
+
+	total, ok := in.Get("total")
+	require.True(t, ok)
+	require.Equal(t, "30", total.Inspect())
+
+	// globals of a run shadow those of the interpreter
+	result, err := run(t, in, "base", map[string]Value{"base": object.TRUE})
+	require.NoError(t, err)
+	require.Equal(t, object.TRUE, result)
+
+	// later scripts see the globals set by earlier ones
+	result, err = run(t, in, "total * 2", nil)
+	require.NoError(t, err)
+	require.Equal(t, "60", result.Inspect())
+
+	result, err = run(t, in, "let a = 1;", nil)
+	require.NoError(t, err)
+	require.Equal(t, object.NULL, result)
+
+	result, err = run(t, in, "let twice = macro(x) { quote(unquote(x) * 2) }; twice(total)", nil)
+	require.NoError(t, err)
+	require.Equal(t, "60", result.Inspect())
+}
+
+func TestErrors(t *testing.T) {
+	in := New()
+	in.Register("fail", func(args ...Value) (Value, error) {
+		return nil, errors.New("failed")
+	})
+
+	_, err := in.Compile("let a = 1;\nlet = 2;\nlet = 3;")
+	var list ErrorList
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 4)
+	require.Equal(t, "3:5", list[2].Pos.String())
+	require.Equal(t, "2:5", list[0].Pos.String())
+	require.EqualError(t, list[0], `2:5: expected token "IDENT" but got "="`)
+
+	prog, err := in.Compile("let a = 1;\nmissing + a")
+	require.NoError(t, err)
+	_, err = in.Run(context.Background(), prog, nil)
+	var cerr *Error
+	require.True(t, errors.As(err, &cerr))
+	require.EqualError(t, err, "2:1: undefined: missing")
+
+	_, err = run(t, in, "let f = fn() {\n  1 + fail()\n};\nf()", nil)
+	var rerr *RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, "2:11", rerr.Pos.String())
+	require.Equal(t, "failed", rerr.Msg)
+	require.Equal(t, object.KindError, rerr.Kind)
+	require.Len(t, rerr.Trace, 2)
+	require.Equal(t, "f", rerr.Trace[0].Function)
+	require.Equal(t, "4:2", rerr.Trace[1].Pos.String())
+
+	_, err = in.Compile("let m = macro(x) { 1 };\nm(1)")
+	require.True(t, errors.As(err, &cerr))
+	require.EqualError(t, err, "2:1: macro m: must return a quote, not INTEGER")
+
+	_, err = run(t, in, `"a" - 1`, nil)
+	require.EqualError(t, err, "1:5: type mismatch: STRING - INTEGER")
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, object.KindType, rerr.Kind)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prog, err = in.Compile("1")
+	require.NoError(t, err)
+	_, err = in.Run(ctx, prog, nil)
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestConst(t *testing.T) {
+	in := New()
+	in.SetConst("limits", object.Freeze(&object.Array{Elements: []object.Object{&object.Integer{Value: 10}}}))
+
+	result, err := run(t, in, "limits[0] * 2", nil)
+	require.NoError(t, err)
+	require.Equal(t, "20", result.Inspect())
+
+	_, err = run(t, in, "limits = [1]", nil)
+	require.EqualError(t, err, "1:8: cannot assign to constant limits")
+	var rerr *RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, object.KindType, rerr.Kind)
+
+	_, err = run(t, in, "limits[0] = 1", nil)
+	require.EqualError(t, err, "1:11: cannot modify frozen ARRAY")
+
+	// the constants of earlier scripts stay constant
+	_, err = run(t, in, "const max = 3; let min = 1;", nil)
+	require.NoError(t, err)
+	_, err = run(t, in, "min = 2; max = 4", nil)
+	require.EqualError(t, err, "1:14: cannot assign to constant max")
+	v, _ := in.Get("max")
+	require.Equal(t, "3", v.Inspect())
+	// like any assignment, the one before the error is kept
+	v, _ = in.Get("min")
+	require.Equal(t, "2", v.Inspect())
+
+	// globals of a run are never constant
+	result, err = run(t, in, "max = 5; max", map[string]Value{"max": &object.Integer{Value: 4}})
+	require.NoError(t, err)
+	require.Equal(t, "5", result.Inspect())
+
+	// scripts can not redeclare constants
+	_, err = run(t, in, "let max = 6;", nil)
+	require.EqualError(t, err, "1:5: cannot redeclare constant max")
+	_, err = run(t, in, "let x = 1; export const limits = [2];", nil)
+	require.EqualError(t, err, "1:25: cannot redeclare constant limits")
+	v, _ = in.Get("max")
+	require.Equal(t, "3", v.Inspect())
+	_, ok := in.Get("x")
+	require.False(t, ok)
+
+	// the host can make a global assignable again
+	in.Set("max", &object.Integer{Value: 6})
+	in.Set("limits", object.NULL)
+	result, err = run(t, in, "max += 1; limits = max", nil)
+	require.NoError(t, err)
+	require.Equal(t, "7", result.Inspect())
+}
+
+func TestGlobals(t *testing.T) {
+	in := New()
+
+	// assignments to the globals of the interpreter are kept
+	_, err := run(t, in, "let base = 10;", nil)
+	require.NoError(t, err)
+	_, err = run(t, in, "base = 20;", nil)
+	require.NoError(t, err)
+	v, _ := in.Get("base")
+	require.Equal(t, "20", v.Inspect())
+
+	// but not assignments to the globals of a run
+	_, err = run(t, in, "base = 30;", map[string]Value{"base": &object.Integer{Value: 1}})
+	require.NoError(t, err)
+	v, _ = in.Get("base")
+	require.Equal(t, "20", v.Inspect())
+
+	// functions share the globals of the script defining them
+	_, err = run(t, in, "let counter = 0; let inc = fn() { counter += 1 };", nil)
+	require.NoError(t, err)
+	_, err = run(t, in, "inc(); inc();", nil)
+	require.NoError(t, err)
+	result, err := run(t, in, "inc(); counter", nil)
+	require.NoError(t, err)
+	require.Equal(t, "3", result.Inspect())
+	_, err = run(t, in, "counter = 10; inc()", nil)
+	require.NoError(t, err)
+	v, _ = in.Get("counter")
+	require.Equal(t, "11", v.Inspect())
+
+	// a global declared again is a new variable
+	_, err = run(t, in, "let counter = 0;", nil)
+	require.NoError(t, err)
+	result, err = run(t, in, "inc(); counter", nil)
+	require.NoError(t, err)
+	require.Equal(t, "0", result.Inspect())
+}
+
+// TestConcurrentRuns is meant for go test -race.
+func TestConcurrentRuns(t *testing.T) {
+	in := New()
+	config := object.NewHash()
+	config.Set(&object.String{Value: "rate"}, &object.Integer{Value: 1})
+	in.SetConst("config", object.Freeze(config))
+	prog, err := in.Compile(`let seen = config; try { config["rate"] = 2 } catch (e) { str(e) }`)
+	require.NoError(t, err)
+
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			result, err := in.Run(context.Background(), prog, nil)
+			if err == nil && result.Inspect() != `"TypeError: cannot modify frozen HASH"` {
+				err = fmt.Errorf("wrong result %s", result.Inspect())
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	in := New(WithCapabilities(CapPure, CapTime))
+	in.Register("host", func(args ...Value) (Value, error) { return object.TRUE, nil })
+
+	result, err := run(t, in, `len("abc") + now() * 0`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "3", result.Inspect())
+
+	result, err = run(t, in, `host()`, nil)
+	require.NoError(t, err)
+	require.Equal(t, object.TRUE, result)
+
+	for _, tt := range []struct {
+		src string
+		cap Capability
+	}{
+		{`read_file("/etc/passwd")`, CapFSRead},
+		{`write_file("x", "y")`, CapFSWrite},
+		{`getenv("HOME")`, CapEnv},
+		{`random(6)`, CapRandom},
+	} {
+		_, err := run(t, in, tt.src, nil)
+		var permErr *PermissionError
+		require.True(t, errors.As(err, &permErr), "%s: %v", tt.src, err)
+		require.Equal(t, tt.cap, permErr.Capability)
+		require.Contains(t, err.Error(), fmt.Sprintf("requires capability %q", tt.cap))
+	}
+
+	// only pure builtins and output are granted by default
+	var out bytes.Buffer
+	_, err = run(t, New(WithOutput(&out)), `puts(len("abc"))`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "3\n", out.String())
+	_, err = run(t, New(), `getenv("HOME")`, nil)
+	require.EqualError(t, err, `1:7: permission denied: getenv requires capability "env"`)
+
+	// nothing is granted by an empty list
+	_, err = run(t, New(WithCapabilities()), `len("")`, nil)
+	require.EqualError(t, err, `1:4: permission denied: len requires capability "pure"`)
+}
+
+func TestOutput(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithOutput(&out))
+
+	_, err := run(t, in, `map(["a", "b"], fn(x) { puts(x) })`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "a\nb\n", out.String())
+
+	_, err = run(t, New(WithCapabilities(CapPure)), `puts(1)`, nil)
+	require.EqualError(t, err, `1:5: permission denied: puts requires capability "output"`)
+}
+
+func TestLimits(t *testing.T) {
+	recurse := "let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; f(n)"
+	n := func(v int64) map[string]Value { return map[string]Value{"n": &object.Integer{Value: v}} }
+
+	in := New(WithMaxSteps(1000), WithMaxDepth(20), WithMaxAlloc(8))
+
+	_, err := run(t, in, recurse, n(10))
+	require.NoError(t, err)
+
+	_, err = run(t, in, recurse, n(30))
+	var depthErr *DepthLimitError
+	require.True(t, errors.As(err, &depthErr), "%v", err)
+	require.Equal(t, 20, depthErr.Limit)
+
+	var rerr *RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, "1:44", rerr.Pos.String())
+
+	_, err = run(t, New(WithMaxSteps(1000)), recurse, n(500))
+	var stepErr *StepLimitError
+	require.True(t, errors.As(err, &stepErr), "%v", err)
+
+	_, err = run(t, in, `"monkey" + "shines"`, nil)
+	var allocErr *AllocLimitError
+	require.True(t, errors.As(err, &allocErr), "%v", err)
+	require.EqualError(t, err, "1:10: allocation limit exceeded: STRING of size 12, limit is 8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	unbounded := New(WithMaxDepth(1 << 30))
+	prog, err := unbounded.Compile("let loop = fn() { loop() }; loop()")
+	require.NoError(t, err)
+	_, err = unbounded.Run(ctx, prog, nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+}
+
+func TestMacroLimits(t *testing.T) {
+	in := New(WithMaxSteps(1000), WithMaxDepth(20))
+
+	_, err := in.Compile("let m = macro() { while (true) {} quote(1) };\nm()")
+	require.EqualError(t, err, "2:1: macro m: step limit of 1000 exceeded")
+	var cerr *Error
+	require.True(t, errors.As(err, &cerr))
+	require.Equal(t, object.KindLimit, object.KindOf(cerr.Err))
+
+	_, err = in.Compile("let m = macro() { let f = fn() { f() }; f() };\nm()")
+	require.EqualError(t, err, "2:1: macro m: maximum call depth of 20 exceeded")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New().CompileContext(ctx, "let m = macro() { while (true) {} };\nm()")
+	require.True(t, errors.Is(err, context.Canceled), "%v", err)
+
+	// macros only call the builtins the interpreter grants
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	src := fmt.Sprintf("let m = macro() { write_file(%q, \"x\"); quote(1) };\nm()", path)
+	_, err = New().Compile(src)
+	require.EqualError(t, err, `2:1: macro m: permission denied: write_file requires capability "fs-write"`)
+	_, statErr := os.Stat(path)
+	require.True(t, os.IsNotExist(statErr))
+
+	_, err = New(WithCapabilities(CapPure, CapFSWrite)).Compile(src)
+	require.NoError(t, err)
+	_, statErr = os.Stat(path)
+	require.NoError(t, statErr)
+}
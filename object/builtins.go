@@ -0,0 +1,664 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// Capability names a group of builtins with the same access to the host.
+// Interpreters grant capabilities to the programs they run.
+type Capability string
+
+const (
+	CapPure    Capability = "pure"     // no access to the host
+	CapTime    Capability = "time"     // reading the clock
+	CapFSRead  Capability = "fs-read"  // reading files
+	CapFSWrite Capability = "fs-write" // writing files
+	CapEnv     Capability = "env"      // reading environment variables
+	CapRandom  Capability = "random"   // random numbers
+	CapOutput  Capability = "output"   // printing to the output of the host
+)
+
+// Capabilities lists all capabilities.
+var Capabilities = []Capability{CapPure, CapTime, CapFSRead, CapFSWrite, CapEnv, CapRandom, CapOutput}
+
+// Builtins are the functions predeclared in every program. The compiler
+// refers to them by their index, so new builtins go at the end.
+var Builtins = []*Builtin{
+	{Name: "len", Capability: CapPure, Fn: builtinLen},
+	{Name: "now", Capability: CapTime, Fn: builtinNow},
+	{Name: "read_file", Capability: CapFSRead, Fn: builtinReadFile},
+	{Name: "write_file", Capability: CapFSWrite, Fn: builtinWriteFile},
+	{Name: "getenv", Capability: CapEnv, Fn: builtinGetenv},
+	{Name: "random", Capability: CapRandom, Fn: builtinRandom},
+	{Name: "first", Capability: CapPure, Fn: builtinFirst},
+	{Name: "last", Capability: CapPure, Fn: builtinLast},
+	{Name: "rest", Capability: CapPure, Fn: builtinRest},
+	{Name: "push", Capability: CapPure, Fn: builtinPush},
+	{Name: "puts", Capability: CapOutput, Fn: builtinPuts},
+	{Name: "type", Capability: CapPure, Fn: builtinType},
+	{Name: "str", Capability: CapPure, Fn: builtinStr},
+	{Name: "int", Capability: CapPure, Fn: builtinInt},
+	{Name: "keys", Capability: CapPure, Fn: builtinKeys},
+	{Name: "values", Capability: CapPure, Fn: builtinValues},
+	{Name: "range", Capability: CapPure, Fn: builtinRange},
+	{Name: "map", Capability: CapPure, Fn: builtinMap},
+	{Name: "filter", Capability: CapPure, Fn: builtinFilter},
+	{Name: "reduce", Capability: CapPure, Fn: builtinReduce},
+	{Name: "freeze", Capability: CapPure, Fn: builtinFreeze},
+	{Name: "frozen", Capability: CapPure, Fn: builtinFrozen},
+	{Name: "signature", Capability: CapPure, Fn: builtinSignature},
+	{Name: "decimal", Capability: CapPure, Fn: builtinDecimal},
+	{Name: "round", Capability: CapPure, Fn: builtinRound},
+	{Name: "new", Capability: CapPure, Fn: builtinNew},
+	{Name: "prototype", Capability: CapPure, Fn: builtinPrototype},
+}
+
+// GetBuiltinByName returns the builtin called name.
+func GetBuiltinByName(name string) (*Builtin, bool) {
+	for _, b := range Builtins {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// BuiltinNames returns the names of the builtins.
+func BuiltinNames() []string {
+	names := make([]string, len(Builtins))
+	for i, b := range Builtins {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// checkArgs checks that the builtin name was called with arguments of
+// types. FUNCTION_OBJ stands for any callable value.
+func checkArgs(name string, args []Object, types ...ObjectType) error {
+	if len(args) != len(types) {
+		return Errorf(KindArgument, "%s: wrong number of arguments: want=%d, got=%d", name, len(types), len(args))
+	}
+	for i, t := range types {
+		if typeOf(args[i]) != t {
+			return Errorf(KindType, "%s: argument %d must be %s, got %s", name, i+1, t, args[i].Type())
+		}
+	}
+	return nil
+}
+
+// typeOf returns the type of obj as scripts see it: all callable values are
+// functions.
+func typeOf(obj Object) ObjectType {
+	switch obj.(type) {
+	case *Function, *Closure, *Builtin:
+		return FUNCTION_OBJ
+	}
+	return obj.Type()
+}
+
+func builtinLen(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "len: wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(len(arg.Value))}, nil
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}, nil
+	case *Hash:
+		return &Integer{Value: int64(len(arg.Keys))}, nil
+	}
+	return nil, Errorf(KindType, "len: argument 1 must be STRING, ARRAY or HASH, got %s", args[0].Type())
+}
+
+// builtinNow returns the current time in milliseconds since the Unix epoch.
+func builtinNow(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("now", args); err != nil {
+		return nil, err
+	}
+	return &Integer{Value: time.Now().UnixNano() / int64(time.Millisecond)}, nil
+}
+
+func builtinReadFile(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("read_file", args, STRING_OBJ); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(args[0].(*String).Value)
+	if err != nil {
+		return nil, fmt.Errorf("read_file: %w", err)
+	}
+	return &String{Value: string(data)}, nil
+}
+
+func builtinWriteFile(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("write_file", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return nil, err
+	}
+	err := os.WriteFile(args[0].(*String).Value, []byte(args[1].(*String).Value), 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("write_file: %w", err)
+	}
+	return NULL, nil
+}
+
+// builtinGetenv returns the value of an environment variable, or null when
+// it is not set.
+func builtinGetenv(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("getenv", args, STRING_OBJ); err != nil {
+		return nil, err
+	}
+	value, ok := os.LookupEnv(args[0].(*String).Value)
+	if !ok {
+		return NULL, nil
+	}
+	return &String{Value: value}, nil
+}
+
+// builtinRandom returns a random integer in [0, n).
+func builtinRandom(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("random", args, INTEGER_OBJ); err != nil {
+		return nil, err
+	}
+	if _, ok := args[0].(*BigInt); ok {
+		return nil, Errorf(KindValue, "random: argument 1 is too large, got %s", args[0].Inspect())
+	}
+	n := args[0].(*Integer).Value
+	if n <= 0 {
+		return nil, Errorf(KindValue, "random: argument 1 must be positive, got %d", n)
+	}
+	rng.Lock()
+	defer rng.Unlock()
+	return &Integer{Value: rng.Int63n(n)}, nil
+}
+
+func builtinFirst(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("first", args, ARRAY_OBJ); err != nil {
+		return nil, err
+	}
+	elements := args[0].(*Array).Elements
+	if len(elements) == 0 {
+		return NULL, nil
+	}
+	return elements[0], nil
+}
+
+func builtinLast(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("last", args, ARRAY_OBJ); err != nil {
+		return nil, err
+	}
+	elements := args[0].(*Array).Elements
+	if len(elements) == 0 {
+		return NULL, nil
+	}
+	return elements[len(elements)-1], nil
+}
+
+// builtinRest returns a new array of all elements but the first, or null
+// for an empty array.
+func builtinRest(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("rest", args, ARRAY_OBJ); err != nil {
+		return nil, err
+	}
+	elements := args[0].(*Array).Elements
+	if len(elements) == 0 {
+		return NULL, nil
+	}
+	rest := make([]Object, len(elements)-1)
+	copy(rest, elements[1:])
+	return &Array{Elements: rest}, nil
+}
+
+// builtinPush returns a new array with the element appended; the array
+// itself is left unchanged.
+func builtinPush(h Host, args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, Errorf(KindArgument, "push: wrong number of arguments: want=2, got=%d", len(args))
+	}
+	if err := checkArgs("push", args[:1], ARRAY_OBJ); err != nil {
+		return nil, err
+	}
+	elements := args[0].(*Array).Elements
+	if err := h.Alloc(ARRAY_OBJ, len(elements)+1); err != nil {
+		return nil, err
+	}
+	pushed := make([]Object, len(elements)+1)
+	copy(pushed, elements)
+	pushed[len(elements)] = args[1]
+	return &Array{Elements: pushed}, nil
+}
+
+// builtinPuts prints each argument on a line of its own. Strings are
+// printed without quotes.
+func builtinPuts(h Host, args ...Object) (Object, error) {
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(h.Output(), toString(arg)); err != nil {
+			return nil, fmt.Errorf("puts: %w", err)
+		}
+	}
+	return NULL, nil
+}
+
+// builtinType returns the name of the type of its argument, such as
+// "INTEGER". All callable values are of type "FUNCTION".
+func builtinType(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "type: wrong number of arguments: want=1, got=%d", len(args))
+	}
+	return &String{Value: string(typeOf(args[0]))}, nil
+}
+
+func builtinStr(h Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "str: wrong number of arguments: want=1, got=%d", len(args))
+	}
+	if s, ok := args[0].(*String); ok {
+		return s, nil
+	}
+
+	// arrays sharing their elements can have texts far larger than
+	// themselves, so the length is checked before the text is built
+	for max := 1 << 12; ; max *= 4 {
+		size, complete := textLen(args[0], max)
+		if err := h.Alloc(STRING_OBJ, size); err != nil {
+			return nil, err
+		}
+		if complete {
+			break
+		}
+	}
+	return &String{Value: toString(args[0])}, nil
+}
+
+// textLen returns the length of the inspection of obj, counting at least
+// the brackets, separators and quotes of arrays, hashes and strings. It
+// stops counting once the length is over max, and reports whether it
+// counted everything.
+func textLen(obj Object, max int) (int, bool) {
+	size := 0
+	var count func(obj Object) bool
+	count = func(obj Object) bool {
+		switch obj := obj.(type) {
+		case *String:
+			size += len(obj.Value) + 2
+		case *Array:
+			size += 2 * (len(obj.Elements) + 1)
+			for _, el := range obj.Elements {
+				if !count(el) {
+					return false
+				}
+			}
+		case *Hash:
+			size += 4*len(obj.Keys) + 2
+			for _, k := range obj.Keys {
+				pair := obj.Pairs[k]
+				if !count(pair.Key) || !count(pair.Value) {
+					return false
+				}
+			}
+		case *BigInt:
+			size += numberLen(obj.Value, 0, max-size)
+		case *Decimal:
+			size += numberLen(obj.Unscaled, obj.Scale, max-size)
+		default:
+			size += len(obj.Inspect())
+		}
+		return size <= max
+	}
+	complete := count(obj)
+	return size, complete
+}
+
+// numberLen returns the length of the text of the number n × 10^-scale, or
+// a bound larger than max without formatting it when the bound of its
+// length is larger than max.
+func numberLen(n *big.Int, scale, max int) int {
+	// a sign, a point, a leading zero and the digits of n, of which
+	// there are at most BitLen × log10(2) + 1
+	bound := 3 + scale + n.BitLen()*30103/100000 + 1
+	if bound > max {
+		return bound
+	}
+	if scale == 0 {
+		return len(n.String())
+	}
+	return len((&Decimal{Unscaled: n, Scale: scale}).Inspect())
+}
+
+// builtinInt converts a string holding a decimal integer, a boolean or a
+// decimal, dropping its fractional part, to an integer.
+func builtinInt(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "int: wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return arg, nil
+	case *Decimal:
+		return NewInteger(arg.Round(0, RoundDown).Unscaled), nil
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}, nil
+		}
+		return &Integer{Value: 0}, nil
+	case *String:
+		n, ok := new(big.Int).SetString(arg.Value, 10)
+		if !ok {
+			return nil, Errorf(KindValue, "int: cannot convert %s to INTEGER", arg.Inspect())
+		}
+		return NewInteger(n), nil
+	}
+	return nil, Errorf(KindType, "int: argument 1 must be INTEGER, DECIMAL, STRING or BOOLEAN, got %s", args[0].Type())
+}
+
+// builtinKeys returns the keys of a hash in insertion order.
+func builtinKeys(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("keys", args, HASH_OBJ); err != nil {
+		return nil, err
+	}
+	hash := args[0].(*Hash)
+	keys := make([]Object, len(hash.Keys))
+	for i, k := range hash.Keys {
+		keys[i] = hash.Pairs[k].Key
+	}
+	return &Array{Elements: keys}, nil
+}
+
+// builtinValues returns the values of a hash in the insertion order of
+// their keys.
+func builtinValues(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("values", args, HASH_OBJ); err != nil {
+		return nil, err
+	}
+	hash := args[0].(*Hash)
+	values := make([]Object, len(hash.Keys))
+	for i, k := range hash.Keys {
+		values[i] = hash.Pairs[k].Value
+	}
+	return &Array{Elements: values}, nil
+}
+
+// builtinRange returns the array of integers from start up to, but not
+// including, end: range(end), range(start, end) or range(start, end, step).
+func builtinRange(h Host, args ...Object) (Object, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, Errorf(KindArgument, "range: wrong number of arguments: want=1 to 3, got=%d", len(args))
+	}
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		if _, ok := arg.(*BigInt); ok {
+			return nil, Errorf(KindValue, "range: argument %d is too large, got %s", i+1, arg.Inspect())
+		}
+		n, ok := arg.(*Integer)
+		if !ok {
+			return nil, Errorf(KindType, "range: argument %d must be INTEGER, got %s", i+1, arg.Type())
+		}
+		bounds[i] = n.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, Errorf(KindValue, "range: step must not be zero")
+	}
+
+	n := rangeLen(start, end, step)
+	if n > maxRangeLen {
+		return nil, Errorf(KindValue, "range: too many elements, got %d", n)
+	}
+	if err := h.Alloc(ARRAY_OBJ, int(n)); err != nil {
+		return nil, err
+	}
+	elements := make([]Object, n)
+	for i := range elements {
+		// wraps around like the unsigned arithmetic of rangeLen
+		elements[i] = &Integer{Value: int64(uint64(start) + uint64(i)*uint64(step))}
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// maxRangeLen bounds the length of the arrays range makes, which would not
+// fit in memory anyway.
+const maxRangeLen = math.MaxInt32
+
+// rangeLen returns the number of integers from start up to end, excluded,
+// by step. The differences are computed as unsigned integers, which hold
+// them even when they overflow an int64.
+func rangeLen(start, end, step int64) uint64 {
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/uint64(-step) + 1
+	}
+	return 0
+}
+
+// builtinMap returns the array of the results of calling a function on each
+// element of an array.
+func builtinMap(h Host, args ...Object) (Object, error) {
+	if err := checkArgs("map", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return nil, err
+	}
+	elements := args[0].(*Array).Elements
+	if err := h.Alloc(ARRAY_OBJ, len(elements)); err != nil {
+		return nil, err
+	}
+	mapped := make([]Object, len(elements))
+	for i, el := range elements {
+		result, err := h.Call(args[1], el)
+		if err != nil {
+			return nil, err
+		}
+		mapped[i] = result
+	}
+	return &Array{Elements: mapped}, nil
+}
+
+// builtinFilter returns the array of the elements of an array for which a
+// function returns a truthy value.
+func builtinFilter(h Host, args ...Object) (Object, error) {
+	if err := checkArgs("filter", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return nil, err
+	}
+	filtered := []Object{}
+	for _, el := range args[0].(*Array).Elements {
+		result, err := h.Call(args[1], el)
+		if err != nil {
+			return nil, err
+		}
+		if IsTruthy(result) {
+			filtered = append(filtered, el)
+		}
+	}
+	return &Array{Elements: filtered}, nil
+}
+
+// builtinReduce folds an array into a value: reduce(array, fn, initial)
+// calls fn(acc, element) for each element, starting with acc = initial.
+func builtinReduce(h Host, args ...Object) (Object, error) {
+	if len(args) != 3 {
+		return nil, Errorf(KindArgument, "reduce: wrong number of arguments: want=3, got=%d", len(args))
+	}
+	if err := checkArgs("reduce", args[:2], ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return nil, err
+	}
+	acc := args[2]
+	for _, el := range args[0].(*Array).Elements {
+		result, err := h.Call(args[1], acc, el)
+		if err != nil {
+			return nil, err
+		}
+		acc = result
+	}
+	return acc, nil
+}
+
+// toString returns the text of a string, or the inspection of other values.
+func toString(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return s.Value
+	}
+	return obj.Inspect()
+}
+
+var rng = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// builtinFreeze makes its argument, and the arrays and hashes in it,
+// immutable and returns it.
+func builtinFreeze(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "freeze: wrong number of arguments: want=1, got=%d", len(args))
+	}
+	return Freeze(args[0]), nil
+}
+
+// builtinFrozen reports whether its argument can not be changed.
+func builtinFrozen(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "frozen: wrong number of arguments: want=1, got=%d", len(args))
+	}
+	return NativeBoolToBoolean(IsFrozen(args[0])), nil
+}
+
+// builtinSignature describes the parameters of a function with a hash of
+// its "name", or null for anonymous functions, the names or patterns of its
+// "params", their "defaults", with null for required parameters, the number
+// of "required" parameters and the name of its "rest" parameter, or null.
+func builtinSignature(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("signature", args, FUNCTION_OBJ); err != nil {
+		return nil, err
+	}
+
+	var name string
+	var sig *Signature
+	switch fn := args[0].(type) {
+	case *Function:
+		name, sig = fn.Name, fn.Signature()
+	case *Closure:
+		name, sig = fn.Fn.Name, fn.Fn.Signature
+	}
+	if sig == nil {
+		return nil, Errorf(KindValue, "signature: %s has no signature", args[0].Inspect())
+	}
+
+	orNull := func(s string) Object {
+		if s == "" {
+			return NULL
+		}
+		return &String{Value: s}
+	}
+	params := make([]Object, len(sig.Params))
+	defaults := make([]Object, len(sig.Params))
+	for i, p := range sig.Params {
+		params[i] = &String{Value: p}
+		defaults[i] = NULL
+		if i < len(sig.Defaults) {
+			defaults[i] = orNull(sig.Defaults[i])
+		}
+	}
+
+	hash := NewHash()
+	hash.Set(&String{Value: "name"}, orNull(name))
+	hash.Set(&String{Value: "params"}, &Array{Elements: params})
+	hash.Set(&String{Value: "defaults"}, &Array{Elements: defaults})
+	hash.Set(&String{Value: "required"}, &Integer{Value: int64(sig.Required())})
+	hash.Set(&String{Value: "rest"}, orNull(sig.Rest))
+	return hash, nil
+}
+
+// builtinDecimal converts an integer, or a string holding a decimal number,
+// to a decimal.
+func builtinDecimal(_ Host, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindArgument, "decimal: wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return decimalOf(arg), nil
+	case *Decimal:
+		return arg, nil
+	case *String:
+		d, err := ParseDecimal(arg.Value)
+		if err != nil {
+			return nil, Errorf(KindValue, "decimal: cannot convert %s to DECIMAL", arg.Inspect())
+		}
+		return d, nil
+	}
+	return nil, Errorf(KindType, "decimal: argument 1 must be INTEGER, DECIMAL or STRING, got %s", args[0].Type())
+}
+
+// builtinRound returns a number as a decimal with the given number of
+// digits after the point, 0 by default, rounded with the mode of the given
+// name in Roundings, half_even by default: round(x), round(x, places) or
+// round(x, places, mode).
+func builtinRound(_ Host, args ...Object) (Object, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, Errorf(KindArgument, "round: wrong number of arguments: want=1 to 3, got=%d", len(args))
+	}
+	if !isNumber(args[0]) {
+		return nil, Errorf(KindType, "round: argument 1 must be INTEGER or DECIMAL, got %s", args[0].Type())
+	}
+
+	places, mode := 0, RoundHalfEven
+	if len(args) > 1 {
+		n, ok := args[1].(*Integer)
+		if !ok && args[1].Type() != INTEGER_OBJ {
+			return nil, Errorf(KindType, "round: argument 2 must be INTEGER, got %s", args[1].Type())
+		}
+		if !ok || n.Value < 0 || n.Value > MaxScale {
+			return nil, Errorf(KindValue, "round: places must be between 0 and %d, got %s", MaxScale, args[1].Inspect())
+		}
+		places = int(n.Value)
+	}
+	if len(args) > 2 {
+		name, ok := args[2].(*String)
+		if !ok {
+			return nil, Errorf(KindType, "round: argument 3 must be STRING, got %s", args[2].Type())
+		}
+		if mode, ok = Roundings[name.Value]; !ok {
+			return nil, Errorf(KindValue, "round: unknown rounding mode %s", name.Inspect())
+		}
+	}
+	return decimalOf(args[0]).Round(places, mode), nil
+}
+
+// builtinNew returns a copy of a hash of fields with the given prototype,
+// whose methods overload the operators on it: new(proto, fields).
+func builtinNew(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("new", args, HASH_OBJ, HASH_OBJ); err != nil {
+		return nil, err
+	}
+	fields := args[1].(*Hash)
+	hash := NewHash()
+	for _, k := range fields.Keys {
+		pair := fields.Pairs[k]
+		hash.Set(pair.Key.(Hashable), pair.Value)
+	}
+	hash.Proto = args[0].(*Hash)
+	return hash, nil
+}
+
+// builtinPrototype returns the prototype of a hash, or null if it has none.
+func builtinPrototype(_ Host, args ...Object) (Object, error) {
+	if err := checkArgs("prototype", args, HASH_OBJ); err != nil {
+		return nil, err
+	}
+	if proto := args[0].(*Hash).Proto; proto != nil {
+		return proto, nil
+	}
+	return NULL, nil
+}
@@ -0,0 +1,120 @@
+package object
+
+// Environment binds names to values for the evaluator.
+type Environment struct {
+	store  map[string]Object
+	consts map[string]bool // names bound by SetConst
+	outer  *Environment
+
+	importer Importer
+	limiter  Limiter
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: map[string]Object{}}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// SetImporter makes the import statements evaluated in env and in the
+// environments it encloses load modules with imp.
+func (env *Environment) SetImporter(imp Importer) {
+	env.importer = imp
+}
+
+// Importer returns the importer of env or of the innermost environment
+// enclosing it that has one.
+func (env *Environment) Importer() Importer {
+	for e := env; e != nil; e = e.outer {
+		if e.importer != nil {
+			return e.importer
+		}
+	}
+	return nil
+}
+
+// Limiter bounds the resources of evaluations. The evaluator calls Enter
+// before every function call and loop iteration and Leave after it, Permit
+// before calling a builtin, and Alloc before creating a value, as builtins
+// call Host.Alloc. An error from Enter, Permit or Alloc stops the
+// evaluation.
+type Limiter interface {
+	Enter() error
+	Leave()
+	Permit(b *Builtin) error
+	Alloc(t ObjectType, size int) error
+}
+
+// SetLimiter makes the evaluations in env and in the environments it
+// encloses report to l.
+func (env *Environment) SetLimiter(l Limiter) {
+	env.limiter = l
+}
+
+// Limiter returns the limiter of env or of the innermost environment
+// enclosing it that has one.
+func (env *Environment) Limiter() Limiter {
+	for e := env; e != nil; e = e.outer {
+		if e.limiter != nil {
+			return e.limiter
+		}
+	}
+	return nil
+}
+
+// Get looks name up in env and its enclosing environments.
+func (env *Environment) Get(name string) (Object, bool) {
+	obj, ok := env.store[name]
+	if !ok && env.outer != nil {
+		return env.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Assign rebinds name in the innermost of env and its enclosing environments
+// that binds it, and reports whether there is one.
+func (env *Environment) Assign(name string, val Object) bool {
+	for e := env; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			e.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// IsConst reports whether the binding of name found by Get is a constant.
+func (env *Environment) IsConst(name string) bool {
+	for e := env; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			return e.consts[name]
+		}
+	}
+	return false
+}
+
+// DeclaresConst reports whether env itself binds name to a constant.
+func (env *Environment) DeclaresConst(name string) bool {
+	return env.consts[name]
+}
+
+// Set binds name in env itself.
+func (env *Environment) Set(name string, val Object) Object {
+	env.store[name] = val
+	delete(env.consts, name)
+	return val
+}
+
+// SetConst binds name in env itself to a value that can not be assigned.
+func (env *Environment) SetConst(name string, val Object) Object {
+	env.Set(name, val)
+	if env.consts == nil {
+		env.consts = map[string]bool{}
+	}
+	env.consts[name] = true
+	return val
+}
@@ -0,0 +1,53 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies runtime errors.
+type ErrorKind string
+
+const (
+	KindError      ErrorKind = "Error"           // errors of no other kind
+	KindType       ErrorKind = "TypeError"       // values of the wrong type
+	KindArgument   ErrorKind = "ArgumentError"   // calls with the wrong number of arguments
+	KindValue      ErrorKind = "ValueError"      // values of the right type out of range
+	KindArithmetic ErrorKind = "ArithmeticError" // division by zero
+	KindPermission ErrorKind = "PermissionError" // builtins without their capability
+	KindLimit      ErrorKind = "LimitError"      // exceeded limits and done contexts
+	KindImport     ErrorKind = "ImportError"     // modules that can not be loaded
+)
+
+// kindError is an error message of a known kind.
+type kindError struct {
+	kind ErrorKind
+	msg  string
+}
+
+func (e *kindError) Error() string   { return e.msg }
+func (e *kindError) Kind() ErrorKind { return e.kind }
+
+// Errorf formats an error of the given kind.
+func Errorf(kind ErrorKind, format string, a ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, a...)}
+}
+
+// KindOf returns the kind of err: the kind of an exception or the kind
+// reported by the Kind method of the first error in its chain that has one,
+// KindLimit for done contexts and KindError otherwise.
+func KindOf(err error) ErrorKind {
+	var exc *Exception
+	if errors.As(err, &exc) {
+		return exc.Kind
+	}
+	var k interface{ Kind() ErrorKind }
+	if errors.As(err, &k) {
+		return k.Kind()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return KindLimit
+	}
+	return KindError
+}
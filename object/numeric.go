@@ -0,0 +1,373 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// BigInt is an integer that does not fit in an int64. Integer arithmetic
+// promotes its result to a BigInt when it overflows and demotes it again
+// when it fits, so that scripts only ever see exact integers.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+func (b *BigInt) HashKey() HashKey { return bigHashKey(b.Value) }
+
+// bigHashKey returns the key of an integer too large for an int64, which
+// can not collide with the keys of small integers by value.
+func bigHashKey(n *big.Int) HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(n.String()))
+	return HashKey{Type: INTEGER_OBJ, Value: h.Sum64()}
+}
+
+// NewInteger returns n as an *Integer if it fits in an int64 and as a
+// *BigInt otherwise.
+func NewInteger(n *big.Int) Object {
+	if n.IsInt64() {
+		return &Integer{Value: n.Int64()}
+	}
+	return &BigInt{Value: n}
+}
+
+// Decimal is an exact decimal number, Unscaled × 10^-Scale. The scale is
+// the number of digits after the point and is kept by the arithmetic, so
+// that 1.50 + 1 is 2.50.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+func (d *Decimal) Inspect() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale > 0 {
+		if len(digits) <= d.Scale {
+			digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+	}
+	if d.Unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// HashKey returns the same key for decimals that are equal whatever their
+// scale, and the key of the integer for decimals with an integer value, so
+// that 1.0 and 1 are the same key like they are equal.
+func (d *Decimal) HashKey() HashKey {
+	n := d.normalize(0)
+	if n.Scale == 0 {
+		return NewInteger(n.Unscaled).(Hashable).HashKey()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(n.Inspect()))
+	return HashKey{Type: DECIMAL_OBJ, Value: h.Sum64()}
+}
+
+// MaxScale is the largest number of digits after the point of a decimal.
+// Literals and operations giving decimals with more fail with a ValueError,
+// which keeps repeated products from growing without bounds.
+const MaxScale = 1000
+
+// NewDecimal returns the decimal unscaled × 10^-scale, or an error if scale
+// is negative or larger than MaxScale.
+func NewDecimal(unscaled *big.Int, scale int) (*Decimal, error) {
+	if err := checkScale(scale); err != nil {
+		return nil, err
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}, nil
+}
+
+func checkScale(scale int) error {
+	if scale < 0 || scale > MaxScale {
+		return Errorf(KindValue, "decimal with %d digits after the point exceeds the precision of %d", scale, MaxScale)
+	}
+	return nil
+}
+
+// ParseDecimal parses a decimal number written as digits with an optional
+// sign and fractional part, like -12.50, with at most MaxScale digits after
+// the point.
+func ParseDecimal(s string) (*Decimal, error) {
+	digits := strings.TrimPrefix(s, "-")
+	point := strings.IndexByte(digits, '.')
+	scale := 0
+	if point >= 0 {
+		scale = len(digits) - point - 1
+		digits = digits[:point] + digits[point+1:]
+	}
+	if digits == "" || point == 0 || scale == 0 && point > 0 || strings.Trim(digits, "0123456789") != "" {
+		return nil, Errorf(KindValue, "invalid decimal %q", s)
+	}
+
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(s, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return NewDecimal(unscaled, scale)
+}
+
+// Rounding is the way Round drops digits.
+type Rounding int
+
+const (
+	RoundHalfEven Rounding = iota // to the nearest, ties to the even neighbour
+	RoundHalfUp                   // to the nearest, ties away from zero
+	RoundHalfDown                 // to the nearest, ties towards zero
+	RoundUp                       // away from zero
+	RoundDown                     // towards zero
+	RoundCeiling                  // towards positive infinity
+	RoundFloor                    // towards negative infinity
+)
+
+// Roundings maps the names of the rounding modes scripts pass to round to
+// the modes.
+var Roundings = map[string]Rounding{
+	"half_even": RoundHalfEven,
+	"half_up":   RoundHalfUp,
+	"half_down": RoundHalfDown,
+	"up":        RoundUp,
+	"down":      RoundDown,
+	"ceiling":   RoundCeiling,
+	"floor":     RoundFloor,
+}
+
+// DivisionPlaces is the number of digits the quotient of a decimal
+// division has beyond those of its operands, rounded half to even.
+const DivisionPlaces = 16
+
+// Round returns d with places digits after the point, rounded with mode
+// when digits are dropped and padded with zeros otherwise. places must not
+// be larger than MaxScale.
+func (d *Decimal) Round(places int, mode Rounding) *Decimal {
+	if places >= d.Scale {
+		return &Decimal{Unscaled: scaleUp(d.Unscaled, places-d.Scale), Scale: places}
+	}
+	return &Decimal{Unscaled: quo(d.Unscaled, pow10(d.Scale-places), mode), Scale: places}
+}
+
+// normalize returns d without the trailing zeros after the point, keeping
+// at least min digits.
+func (d *Decimal) normalize(min int) *Decimal {
+	unscaled, scale := d.Unscaled, d.Scale
+	ten := big.NewInt(10)
+	for scale > min {
+		q, r := new(big.Int).QuoRem(unscaled, ten, new(big.Int))
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, scale = q, scale-1
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func scaleUp(n *big.Int, places int) *big.Int {
+	if places == 0 {
+		return n
+	}
+	return new(big.Int).Mul(n, pow10(places))
+}
+
+// quo returns n / m rounded with mode.
+func quo(n, m *big.Int, mode Rounding) *big.Int {
+	q, r := new(big.Int).QuoRem(n, m, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	sign := n.Sign() * m.Sign()
+	half := new(big.Int).Abs(r)
+	half.Lsh(half, 1)
+	tie := half.Cmp(new(big.Int).Abs(m))
+
+	var away bool
+	switch mode {
+	case RoundHalfEven:
+		away = tie > 0 || tie == 0 && q.Bit(0) == 1
+	case RoundHalfUp:
+		away = tie >= 0
+	case RoundHalfDown:
+		away = tie > 0
+	case RoundUp:
+		away = true
+	case RoundDown:
+		away = false
+	case RoundCeiling:
+		away = sign > 0
+	case RoundFloor:
+		away = sign < 0
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+// isNumber reports whether obj is an integer or a decimal.
+func isNumber(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt, *Decimal:
+		return true
+	}
+	return false
+}
+
+// bigOf returns the value of an integer as a big.Int.
+func bigOf(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return obj.Value
+	}
+	return nil
+}
+
+// decimalOf returns the value of a number as a decimal.
+func decimalOf(obj Object) *Decimal {
+	if d, ok := obj.(*Decimal); ok {
+		return d
+	}
+	return &Decimal{Unscaled: bigOf(obj)}
+}
+
+// numberInfix applies op to two numbers. Integers stay integers, promoted
+// to big integers when they overflow an int64, and mixing an integer with a
+// decimal gives a decimal.
+func numberInfix(op string, left, right Object) (Object, error) {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	switch {
+	case lok && rok:
+		return integerInfix(op, l.Value, r.Value)
+	case left.Type() == DECIMAL_OBJ || right.Type() == DECIMAL_OBJ:
+		return decimalInfix(op, decimalOf(left), decimalOf(right))
+	}
+	return bigInfix(op, bigOf(left), bigOf(right))
+}
+
+func integerInfix(op string, left, right int64) (Object, error) {
+	switch op {
+	case "+":
+		if sum := left + right; (sum > left) == (right > 0) {
+			return &Integer{Value: sum}, nil
+		}
+	case "-":
+		if diff := left - right; (diff < left) == (right > 0) {
+			return &Integer{Value: diff}, nil
+		}
+	case "*":
+		product := left * right
+		if left == 0 || product/left == right && !(left == -1 && right == math.MinInt64) {
+			return &Integer{Value: product}, nil
+		}
+	case "/":
+		if right == 0 {
+			return nil, Errorf(KindArithmetic, "division by zero")
+		}
+		if left != math.MinInt64 || right != -1 {
+			return &Integer{Value: left / right}, nil
+		}
+	case "<":
+		return NativeBoolToBoolean(left < right), nil
+	case ">":
+		return NativeBoolToBoolean(left > right), nil
+	default:
+		return nil, Errorf(KindType, "unknown operator: %s %s %s", INTEGER_OBJ, op, INTEGER_OBJ)
+	}
+	// the result overflows
+	return bigInfix(op, big.NewInt(left), big.NewInt(right))
+}
+
+func bigInfix(op string, left, right *big.Int) (Object, error) {
+	switch op {
+	case "+":
+		return NewInteger(new(big.Int).Add(left, right)), nil
+	case "-":
+		return NewInteger(new(big.Int).Sub(left, right)), nil
+	case "*":
+		return NewInteger(new(big.Int).Mul(left, right)), nil
+	case "/":
+		if right.Sign() == 0 {
+			return nil, Errorf(KindArithmetic, "division by zero")
+		}
+		return NewInteger(new(big.Int).Quo(left, right)), nil
+	case "<":
+		return NativeBoolToBoolean(left.Cmp(right) < 0), nil
+	case ">":
+		return NativeBoolToBoolean(left.Cmp(right) > 0), nil
+	}
+	return nil, Errorf(KindType, "unknown operator: %s %s %s", INTEGER_OBJ, op, INTEGER_OBJ)
+}
+
+// decimalInfix applies op to two decimals. Sums and differences have the
+// scale of the operand with more digits after the point, products the sum
+// of the scales. Quotients get DivisionPlaces more digits, without the
+// trailing zeros among them. Products and quotients with more than MaxScale
+// digits after the point are an error.
+func decimalInfix(op string, left, right *Decimal) (Object, error) {
+	scale := left.Scale
+	if right.Scale > scale {
+		scale = right.Scale
+	}
+	l := scaleUp(left.Unscaled, scale-left.Scale)
+	r := scaleUp(right.Unscaled, scale-right.Scale)
+
+	switch op {
+	case "+":
+		return &Decimal{Unscaled: new(big.Int).Add(l, r), Scale: scale}, nil
+	case "-":
+		return &Decimal{Unscaled: new(big.Int).Sub(l, r), Scale: scale}, nil
+	case "*":
+		// checked before multiplying, so that the product is never computed
+		if err := checkScale(left.Scale + right.Scale); err != nil {
+			return nil, err
+		}
+		return &Decimal{Unscaled: new(big.Int).Mul(left.Unscaled, right.Unscaled), Scale: left.Scale + right.Scale}, nil
+	case "/":
+		if r.Sign() == 0 {
+			return nil, Errorf(KindArithmetic, "division by zero")
+		}
+		q := quo(scaleUp(l, scale+DivisionPlaces), r, RoundHalfEven)
+		d := (&Decimal{Unscaled: q, Scale: scale + DivisionPlaces}).normalize(scale)
+		return NewDecimal(d.Unscaled, d.Scale)
+	case "<":
+		return NativeBoolToBoolean(l.Cmp(r) < 0), nil
+	case ">":
+		return NativeBoolToBoolean(l.Cmp(r) > 0), nil
+	}
+	return nil, Errorf(KindType, "unknown operator: %s %s %s", DECIMAL_OBJ, op, DECIMAL_OBJ)
+}
+
+// CompareNumbers returns -1, 0 or +1 as the number left is less than, equal
+// to or greater than the number right.
+func CompareNumbers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	switch {
+	case lok && rok:
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		}
+		return 0
+	case left.Type() == DECIMAL_OBJ || right.Type() == DECIMAL_OBJ:
+		diff, _ := decimalInfix("-", decimalOf(left), decimalOf(right))
+		return diff.(*Decimal).Unscaled.Sign()
+	}
+	return bigOf(left).Cmp(bigOf(right))
+}
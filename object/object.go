@@ -0,0 +1,408 @@
+// Package object defines the run-time values shared by the evaluator and
+// the virtual machine.
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ = "INTEGER"
+	DECIMAL_OBJ = "DECIMAL"
+	BOOLEAN_OBJ = "BOOLEAN"
+	NULL_OBJ    = "NULL"
+	STRING_OBJ  = "STRING"
+	ARRAY_OBJ   = "ARRAY"
+	HASH_OBJ    = "HASH"
+
+	ERROR_OBJ        = "ERROR"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	EXCEPTION_OBJ    = "EXCEPTION"
+	ITERATOR_OBJ     = "ITERATOR"
+	CELL_OBJ         = "CELL"
+	MODULE_OBJ       = "MODULE"
+	QUOTE_OBJ        = "QUOTE"
+
+	FUNCTION_OBJ          = "FUNCTION"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	MACRO_OBJ             = "MACRO"
+	BUILTIN_OBJ           = "BUILTIN"
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Hashable is implemented by the values that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return fmt.Sprintf("%q", s.Value) }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type Array struct {
+	Elements []Object
+	Frozen   bool // the elements can not be replaced
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := make([]string, 0, len(a.Elements))
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps its pairs in insertion order.
+type Hash struct {
+	Pairs  map[HashKey]HashPair
+	Keys   []HashKey
+	Frozen bool  // no pair can be added or replaced
+	Proto  *Hash // the prototype, whose methods overload operators; nil if none
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Set adds or replaces the value of key.
+func (h *Hash) Set(key Hashable, value Object) {
+	hk := key.HashKey()
+	if _, ok := h.Pairs[hk]; !ok {
+		h.Keys = append(h.Keys, hk)
+	}
+	h.Pairs[hk] = HashPair{Key: key.(Object), Value: value}
+}
+
+// Get returns the value stored under key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := make([]string, 0, len(h.Keys))
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Error is an error the evaluator unwinds with, carrying the exception
+// that try expressions catch.
+type Error struct {
+	Message   string
+	Exception *Exception
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// Exception is a value thrown by a program, or a runtime error caught by it.
+// Programs read its fields by indexing it with "kind", "message", "line",
+// "column" and "value", the thrown value.
+type Exception struct {
+	Kind    ErrorKind
+	Message string
+	Pos     token.Position // where it was raised
+	Value   Object         // null for runtime errors
+}
+
+// Throw returns the exception of throwing v at pos. Exceptions are thrown
+// again as they are.
+func Throw(v Object, pos token.Position) *Exception {
+	if exc, ok := v.(*Exception); ok {
+		return exc
+	}
+	return &Exception{Kind: KindError, Message: toString(v), Pos: pos, Value: v}
+}
+
+func (e *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (e *Exception) Inspect() string  { return string(e.Kind) + ": " + e.Message }
+func (e *Exception) Error() string    { return e.Message }
+
+// Field returns the field name of e, or null if there is none.
+func (e *Exception) Field(name string) Object {
+	switch name {
+	case "kind":
+		return &String{Value: string(e.Kind)}
+	case "message":
+		return &String{Value: e.Message}
+	case "line":
+		return &Integer{Value: int64(e.Pos.Line)}
+	case "column":
+		return &Integer{Value: int64(e.Pos.Column)}
+	case "value":
+		if e.Value != nil {
+			return e.Value
+		}
+	}
+	return NULL
+}
+
+// ReturnValue wraps the value of a return statement while the evaluator
+// unwinds to the enclosing function call.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// Iterator steps through the values a for loop binds: the elements of an
+// array, the keys of a hash in insertion order or the characters of a
+// string.
+type Iterator struct {
+	Items []Object
+	next  int
+}
+
+// NewIterator returns an iterator over obj.
+func NewIterator(obj Object) (*Iterator, error) {
+	switch obj := obj.(type) {
+	case *Array:
+		return &Iterator{Items: obj.Elements}, nil
+	case *Hash:
+		keys := make([]Object, len(obj.Keys))
+		for i, key := range obj.Keys {
+			keys[i] = obj.Pairs[key].Key
+		}
+		return &Iterator{Items: keys}, nil
+	case *String:
+		var chars []Object
+		for _, c := range obj.Value {
+			chars = append(chars, &String{Value: string(c)})
+		}
+		return &Iterator{Items: chars}, nil
+	}
+	return nil, Errorf(KindType, "cannot iterate over %s", obj.Type())
+}
+
+// Next returns the next value, if there is one.
+func (it *Iterator) Next() (Object, bool) {
+	if it.next == len(it.Items) {
+		return nil, false
+	}
+	it.next++
+	return it.Items[it.next-1], true
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Module is an imported module. Programs read its exports by indexing it
+// with their names.
+type Module struct {
+	Path    string
+	Exports *Hash // frozen, keyed by name
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + strconv.Quote(m.Path) + ">" }
+
+// Importer loads the modules of import statements.
+type Importer interface {
+	// Import returns the module at path, which is relative to the module
+	// importing it.
+	Import(path string) (*Module, error)
+}
+
+// Quote is an unevaluated AST node, the result of quote(expr).
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Cell holds a local variable that closures capture and assign, so that
+// they share it with the function declaring it.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return "cell(" + c.Value.Inspect() + ")" }
+
+// Function is a function literal evaluated by the evaluator.
+type Function struct {
+	Parameters []ast.Pattern
+	Defaults   []ast.Expression // nil, or the default value of each parameter
+	Rest       *ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Name       string
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString(f.Signature().Format(""))
+	out.WriteString(" { ")
+	out.WriteString(f.Body.String())
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Signature returns the signature of the function.
+func (f *Function) Signature() *Signature {
+	return NewSignature(f.Parameters, f.Defaults, f.Rest)
+}
+
+// Macro is a macro literal bound by a top-level let statement, which is
+// expanded before the program runs.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Name       string
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	params := make([]string, 0, len(m.Parameters))
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	return "macro(" + strings.Join(params, ", ") + ") { " + m.Body.String() + " }"
+}
+
+// CompiledFunction is a function literal compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	Lines         code.LineTable
+	Signature     *Signature // the parameters, for calls other than of exactly NumParameters arguments
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%s]", functionName(cf.Name))
+}
+
+// Closure is a compiled function along with the free variables it captured.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+
+	// Namespace is the namespace of the program creating the closure. It
+	// is nil for closures that run in the namespace of their caller.
+	Namespace *Namespace
+}
+
+// Namespace holds the constant pool and the globals of a compiled program,
+// which its functions refer to by index. Functions of an imported module
+// keep using the namespace of the module when other programs call them.
+type Namespace struct {
+	Constants []Object
+	Globals   []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%s]", functionName(c.Fn.Name))
+}
+
+// Host is the interpreter calling a builtin.
+type Host interface {
+	// Call calls the function fn with args and returns its result.
+	Call(fn Object, args ...Object) (Object, error)
+	// Output returns the writer builtins print to.
+	Output() io.Writer
+	// Alloc returns an error if the program may not create a value of type
+	// t and the given size: the length of a string in bytes, or the number
+	// of elements of an array or a hash. Builtins call it before they build
+	// large values.
+	Alloc(t ObjectType, size int) error
+}
+
+// BuiltinFunction is the Go implementation of a builtin. A nil result is
+// turned into null.
+type BuiltinFunction func(h Host, args ...Object) (Object, error)
+
+// Builtin is a function implemented in Go. Calling it requires its
+// capability, if it has one.
+type Builtin struct {
+	Name       string
+	Capability Capability
+	Fn         BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string {
+	return fmt.Sprintf("Builtin[%s]", functionName(b.Name))
+}
+
+func functionName(name string) string {
+	if name == "" {
+		return "<anonymous>"
+	}
+	return name
+}
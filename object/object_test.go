@@ -0,0 +1,858 @@
+package object
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+
+	if (&Integer{Value: 1}).HashKey() == TRUE.HashKey() {
+		t.Errorf("values of different types have same hash keys")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	h := NewHash()
+	h.Set(&String{Value: "b"}, &Integer{Value: 1})
+	h.Set(&String{Value: "a"}, &Integer{Value: 2})
+	h.Set(&String{Value: "b"}, &Integer{Value: 3})
+
+	require.Equal(t, `{"b": 3, "a": 2}`, h.Inspect())
+
+	value, ok := h.Get(&String{Value: "a"})
+	require.True(t, ok)
+	require.Equal(t, int64(2), value.(*Integer).Value)
+}
+
+func TestIterator(t *testing.T) {
+	h := NewHash()
+	h.Set(&String{Value: "b"}, &Integer{Value: 1})
+	h.Set(&Integer{Value: 1}, &Integer{Value: 2})
+
+	tests := []struct {
+		iterable Object
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, TRUE}}, []string{"1", "true"}},
+		{h, []string{`"b"`, "1"}},
+		{&String{Value: "hé"}, []string{`"h"`, `"é"`}},
+		{&Array{}, nil},
+	}
+
+	for _, tt := range tests {
+		iter, err := NewIterator(tt.iterable)
+		require.NoError(t, err)
+
+		var got []string
+		for item, ok := iter.Next(); ok; item, ok = iter.Next() {
+			got = append(got, item.Inspect())
+		}
+		require.Equal(t, tt.expected, got)
+	}
+
+	_, err := NewIterator(NULL)
+	require.EqualError(t, err, "cannot iterate over NULL")
+	require.Equal(t, KindType, KindOf(err))
+}
+
+func TestSetIndex(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+	require.NoError(t, SetIndex(array, &Integer{Value: 1}, TRUE))
+	require.Equal(t, "[1, true]", array.Inspect())
+
+	hash := NewHash()
+	require.NoError(t, SetIndex(hash, &String{Value: "a"}, &Integer{Value: 1}))
+	require.NoError(t, SetIndex(hash, &String{Value: "a"}, &Integer{Value: 2}))
+	require.Equal(t, `{"a": 2}`, hash.Inspect())
+
+	errs := []struct {
+		left, index Object
+		expected    string
+	}{
+		{array, &Integer{Value: 2}, "array index out of range: 2 with length 2"},
+		{array, &Integer{Value: -1}, "array index out of range: -1 with length 2"},
+		{array, &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}, "array index out of range: 18446744073709551616 with length 2"},
+		{array, TRUE, "array index must be INTEGER, got BOOLEAN"},
+		{hash, array, "unusable as hash key: ARRAY"},
+		{&String{Value: "ab"}, &Integer{Value: 0}, "index assignment not supported: STRING"},
+	}
+	for _, tt := range errs {
+		require.EqualError(t, SetIndex(tt.left, tt.index, NULL), tt.expected)
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 2})
+
+	require.True(t, inner.Assign("a", &Integer{Value: 3}))
+	require.True(t, inner.Assign("b", &Integer{Value: 4}))
+	require.False(t, inner.Assign("c", &Integer{Value: 5}))
+
+	a, _ := outer.Get("a")
+	require.Equal(t, "3", a.Inspect())
+	_, ok := outer.Get("b")
+	require.False(t, ok)
+	_, ok = inner.Get("c")
+	require.False(t, ok)
+}
+
+func TestEnvironmentConst(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetConst("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	require.True(t, inner.IsConst("a"))
+	require.False(t, inner.IsConst("b"))
+
+	inner.Set("a", &Integer{Value: 2})
+	require.False(t, inner.IsConst("a"))
+	require.True(t, outer.IsConst("a"))
+
+	outer.Set("a", &Integer{Value: 3})
+	require.False(t, outer.IsConst("a"))
+}
+
+type testImporter struct{}
+
+func (testImporter) Import(path string) (*Module, error) { return nil, nil }
+
+func TestEnvironmentImporter(t *testing.T) {
+	outer := NewEnvironment()
+	inner := NewEnclosedEnvironment(outer)
+	require.Nil(t, inner.Importer())
+
+	outer.SetImporter(testImporter{})
+	require.Equal(t, testImporter{}, inner.Importer())
+}
+
+func TestModuleIndex(t *testing.T) {
+	req := require.New(t)
+
+	exports := NewHash()
+	exports.Set(&String{Value: "pi"}, &Integer{Value: 3})
+	mod := &Module{Path: "lib/math.mk", Exports: exports}
+	req.Equal(`<module "lib/math.mk">`, mod.Inspect())
+
+	v, err := Index(mod, &String{Value: "pi"})
+	req.NoError(err)
+	req.Equal("3", v.Inspect())
+
+	_, err = Index(mod, &String{Value: "e"})
+	req.EqualError(err, `module "lib/math.mk" has no export "e"`)
+	req.Equal(KindValue, KindOf(err))
+
+	_, err = Index(mod, &Integer{Value: 0})
+	req.EqualError(err, "module export name must be STRING, got INTEGER")
+}
+
+func TestFreeze(t *testing.T) {
+	req := require.New(t)
+
+	inner := &Array{Elements: []Object{&Integer{Value: 1}}}
+	hash := NewHash()
+	hash.Set(&String{Value: "a"}, inner)
+	outer := &Array{Elements: []Object{hash}}
+	outer.Elements = append(outer.Elements, outer)
+
+	req.False(IsFrozen(outer))
+	req.True(IsFrozen(&Integer{Value: 1}))
+	req.Equal(outer, Freeze(outer))
+	req.True(IsFrozen(outer))
+	req.True(IsFrozen(hash))
+	req.True(IsFrozen(inner))
+
+	req.EqualError(SetIndex(outer, &Integer{Value: 0}, NULL), "cannot modify frozen ARRAY")
+	req.EqualError(SetIndex(hash, &String{Value: "b"}, NULL), "cannot modify frozen HASH")
+	req.Equal(KindType, KindOf(SetIndex(inner, &Integer{Value: 0}, NULL)))
+	req.Equal(1, len(inner.Elements))
+}
+
+func TestInfix(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	arr := &Array{}
+
+	tests := []struct {
+		op          string
+		left, right Object
+		expected    string
+		err         string
+	}{
+		{op: "+", left: one, right: two, expected: "3"},
+		{op: "-", left: one, right: two, expected: "-1"},
+		{op: "*", left: two, right: two, expected: "4"},
+		{op: "/", left: two, right: one, expected: "2"},
+		{op: "/", left: two, right: &Integer{}, err: "division by zero"},
+		{op: "<", left: one, right: two, expected: "true"},
+		{op: ">", left: one, right: two, expected: "false"},
+		{op: "==", left: one, right: &Integer{Value: 1}, expected: "true"},
+		{op: "==", left: one, right: TRUE, expected: "false"},
+		{op: "!=", left: one, right: TRUE, expected: "true"},
+		{op: "==", left: arr, right: arr, expected: "true"},
+		{op: "==", left: arr, right: &Array{}, expected: "false"},
+		{op: "==", left: NULL, right: NULL, expected: "true"},
+		{op: "+", left: &String{Value: "a"}, right: &String{Value: "b"}, expected: `"ab"`},
+		{op: "==", left: &String{Value: "a"}, right: &String{Value: "a"}, expected: "true"},
+		{op: "<", left: &String{Value: "a"}, right: &String{Value: "b"}, expected: "true"},
+		{op: "-", left: &String{Value: "a"}, right: &String{Value: "b"}, err: "unknown operator: STRING - STRING"},
+		{op: "+", left: one, right: TRUE, err: "type mismatch: INTEGER + BOOLEAN"},
+		{op: "+", left: TRUE, right: FALSE, err: "unknown operator: BOOLEAN + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		result, err := Infix(tt.op, tt.left, tt.right)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, result.Inspect(), "%s %s %s", tt.left.Inspect(), tt.op, tt.right.Inspect())
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	num := func(v string) Object {
+		if d, err := ParseDecimal(v); err == nil && d.Scale > 0 {
+			return d
+		}
+		n, _ := new(big.Int).SetString(v, 10)
+		return NewInteger(n)
+	}
+
+	tests := []struct {
+		op          string
+		left, right string
+		expected    string
+		err         string
+	}{
+		{op: "+", left: "9223372036854775807", right: "1", expected: "9223372036854775808"},
+		{op: "-", left: "-9223372036854775808", right: "1", expected: "-9223372036854775809"},
+		{op: "*", left: "4294967296", right: "4294967296", expected: "18446744073709551616"},
+		{op: "*", left: "-1", right: "-9223372036854775808", expected: "9223372036854775808"},
+		{op: "/", left: "-9223372036854775808", right: "-1", expected: "9223372036854775808"},
+		{op: "-", left: "9223372036854775808", right: "1", expected: "9223372036854775807"},
+		{op: "/", left: "18446744073709551616", right: "0", err: "division by zero"},
+		{op: ">", left: "18446744073709551616", right: "1", expected: "true"},
+		{op: "==", left: "18446744073709551616", right: "18446744073709551616", expected: "true"},
+		{op: "+", left: "0.1", right: "0.2", expected: "0.3"},
+		{op: "+", left: "1.50", right: "1", expected: "2.50"},
+		{op: "-", left: "1", right: "1.25", expected: "-0.25"},
+		{op: "*", left: "19.99", right: "3", expected: "59.97"},
+		{op: "*", left: "1.5", right: "0.25", expected: "0.375"},
+		{op: "/", left: "10.00", right: "4", expected: "2.50"},
+		{op: "/", left: "1", right: "3.0", expected: "0.33333333333333333"},
+		{op: "/", left: "2.0", right: "3", expected: "0.66666666666666667"},
+		{op: "/", left: "1.5", right: "0.0", err: "division by zero"},
+		{op: "+", left: "18446744073709551616", right: "0.5", expected: "18446744073709551616.5"},
+		{op: "<", left: "0.3", right: "0.31", expected: "true"},
+		{op: ">", left: "2", right: "1.99", expected: "true"},
+		{op: "==", left: "1", right: "1.00", expected: "true"},
+		{op: "==", left: "1.10", right: "1.1", expected: "true"},
+		{op: "!=", left: "1.1", right: "1.01", expected: "true"},
+	}
+
+	for _, tt := range tests {
+		left, right := num(tt.left), num(tt.right)
+		result, err := Infix(tt.op, left, right)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, result.Inspect(), "%s %s %s", tt.left, tt.op, tt.right)
+	}
+
+	req := require.New(t)
+	result, err := Prefix("-", &Integer{Value: math.MinInt64})
+	req.NoError(err)
+	req.Equal("9223372036854775808", result.Inspect())
+	req.IsType(&BigInt{}, result)
+
+	result, err = Infix("-", result, &Integer{Value: 1})
+	req.NoError(err)
+	req.IsType(&Integer{}, result, "results that fit are demoted")
+
+	result, err = Prefix("-", num("0.05"))
+	req.NoError(err)
+	req.Equal("-0.05", result.Inspect())
+
+	_, err = Infix("+", num("1.5"), &String{Value: "a"})
+	req.EqualError(err, "type mismatch: DECIMAL + STRING")
+
+	hash := NewHash()
+	hash.Set(num("1").(Hashable), TRUE)
+	hash.Set(num("2.50").(Hashable), TRUE)
+	hash.Set(num("18446744073709551616").(Hashable), TRUE)
+	for _, key := range []string{"1.0", "2.5", "18446744073709551616.000"} {
+		_, ok := hash.Get(num(key).(Hashable))
+		req.True(ok, key)
+	}
+	req.Len(hash.Keys, 3)
+
+	for _, invalid := range []string{"", "-", ".5", "1.", "1.2.3", "1e5", "+1"} {
+		_, err := ParseDecimal(invalid)
+		req.Error(err, invalid)
+	}
+	d, err := ParseDecimal("-0.001")
+	req.NoError(err)
+	req.Equal("-0.001", d.Inspect())
+	req.Equal("0.0", d.Round(1, RoundHalfEven).Inspect())
+
+	// the scale of decimals is bounded, so repeated products end in an error
+	_, err = ParseDecimal("0." + strings.Repeat("1", MaxScale+1))
+	req.EqualError(err, "decimal with 1001 digits after the point exceeds the precision of 1000")
+	square := num("0.1")
+	for i := 0; i < 9; i++ {
+		square, err = Infix("*", square, square)
+		req.NoError(err)
+	}
+	req.Equal(512, square.(*Decimal).Scale)
+	_, err = Infix("*", square, square)
+	req.EqualError(err, "decimal with 1024 digits after the point exceeds the precision of 1000")
+	req.Equal(KindValue, KindOf(err))
+	_, err = Infix("/", &Decimal{Unscaled: big.NewInt(1), Scale: MaxScale}, num("3"))
+	req.EqualError(err, "decimal with 1016 digits after the point exceeds the precision of 1000")
+}
+
+func TestPrefixAndIndex(t *testing.T) {
+	req := require.New(t)
+
+	result, err := Prefix("-", &Integer{Value: 5})
+	req.NoError(err)
+	req.Equal("-5", result.Inspect())
+
+	result, err = Prefix("!", NULL)
+	req.NoError(err)
+	req.Equal(TRUE, result)
+
+	result, err = Prefix("!", &Integer{Value: 0})
+	req.NoError(err)
+	req.Equal(FALSE, result)
+
+	_, err = Prefix("-", TRUE)
+	req.EqualError(err, "unknown operator: -BOOLEAN")
+
+	arr := &Array{Elements: []Object{&Integer{Value: 7}}}
+	result, err = Index(arr, &Integer{Value: 0})
+	req.NoError(err)
+	req.Equal("7", result.Inspect())
+
+	result, err = Index(arr, &Integer{Value: 1})
+	req.NoError(err)
+	req.Equal(NULL, result)
+
+	result, err = Index(arr, &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)})
+	req.NoError(err)
+	req.Equal(NULL, result)
+
+	_, err = Index(arr, TRUE)
+	req.EqualError(err, "array index must be INTEGER, got BOOLEAN")
+
+	_, err = Index(NewHash(), arr)
+	req.EqualError(err, "unusable as hash key: ARRAY")
+
+	_, err = Index(&Integer{Value: 1}, arr)
+	req.EqualError(err, "index operator not supported: INTEGER")
+}
+
+func TestBuiltins(t *testing.T) {
+	req := require.New(t)
+
+	call := func(name string, args ...Object) (Object, error) {
+		b, ok := GetBuiltinByName(name)
+		req.True(ok, name)
+		return b.Fn(&testHost{}, args...)
+	}
+
+	for _, b := range Builtins {
+		req.Contains(Capabilities, b.Capability, b.Name)
+	}
+
+	result, err := call("len", &String{Value: "four"})
+	req.NoError(err)
+	req.Equal("4", result.Inspect())
+
+	_, err = call("len", &Integer{Value: 1})
+	req.EqualError(err, "len: argument 1 must be STRING, ARRAY or HASH, got INTEGER")
+
+	result, err = call("now")
+	req.NoError(err)
+	req.Greater(result.(*Integer).Value, int64(0))
+
+	path := t.TempDir() + "/file.txt"
+	result, err = call("write_file", &String{Value: path}, &String{Value: "data"})
+	req.NoError(err)
+	req.Equal(NULL, result)
+
+	result, err = call("read_file", &String{Value: path})
+	req.NoError(err)
+	req.Equal(`"data"`, result.Inspect())
+
+	_, err = call("read_file", &Integer{Value: 1})
+	req.EqualError(err, "read_file: argument 1 must be STRING, got INTEGER")
+
+	t.Setenv("MONKEY_TEST_VAR", "set")
+	result, err = call("getenv", &String{Value: "MONKEY_TEST_VAR"})
+	req.NoError(err)
+	req.Equal(`"set"`, result.Inspect())
+
+	result, err = call("getenv", &String{Value: "MONKEY_TEST_UNSET"})
+	req.NoError(err)
+	req.Equal(NULL, result)
+
+	result, err = call("random", &Integer{Value: 3})
+	req.NoError(err)
+	n := result.(*Integer).Value
+	req.True(n >= 0 && n < 3)
+
+	_, err = call("random", &Integer{Value: 0})
+	req.EqualError(err, "random: argument 1 must be positive, got 0")
+
+	_, err = call("random")
+	req.EqualError(err, "random: wrong number of arguments: want=1, got=0")
+}
+
+func TestKindOf(t *testing.T) {
+	req := require.New(t)
+
+	_, err := Infix("/", &Integer{Value: 1}, &Integer{Value: 0})
+	req.Equal(KindArithmetic, KindOf(err))
+	req.Equal(KindArithmetic, KindOf(fmt.Errorf("wrapped: %w", err)))
+
+	_, err = Prefix("-", TRUE)
+	req.Equal(KindType, KindOf(err))
+
+	req.Equal(KindLimit, KindOf(context.Canceled))
+	req.Equal(KindError, KindOf(errors.New("plain")))
+}
+
+// testHost calls builtins only and collects the output. Values larger than
+// maxAlloc, if set, can not be created.
+type testHost struct {
+	out      bytes.Buffer
+	maxAlloc int
+}
+
+func (h *testHost) Call(fn Object, args ...Object) (Object, error) {
+	b, ok := fn.(*Builtin)
+	if !ok {
+		return nil, fmt.Errorf("calling non-function: %s", fn.Type())
+	}
+	return b.Fn(h, args...)
+}
+
+func (h *testHost) Output() io.Writer { return &h.out }
+
+func (h *testHost) Alloc(t ObjectType, size int) error {
+	if h.maxAlloc > 0 && size > h.maxAlloc {
+		return fmt.Errorf("%s of size %d is too large", t, size)
+	}
+	return nil
+}
+
+func TestCoreBuiltins(t *testing.T) {
+	i := func(n int64) Object { return &Integer{Value: n} }
+	s := func(v string) Object { return &String{Value: v} }
+	arr := func(elements ...Object) Object { return &Array{Elements: elements} }
+	dec := func(v string) Object {
+		d, err := ParseDecimal(v)
+		require.NoError(t, err)
+		return d
+	}
+	s2i := func(v string) Object {
+		n, _ := new(big.Int).SetString(v, 10)
+		return NewInteger(n)
+	}
+
+	hash := NewHash()
+	hash.Set(s("b").(Hashable), i(2))
+	hash.Set(s("a").(Hashable), i(1))
+
+	add := &Builtin{Name: "add", Fn: func(_ Host, args ...Object) (Object, error) {
+		return Infix("+", args[0], args[1])
+	}}
+	odd := &Builtin{Name: "odd", Fn: func(_ Host, args ...Object) (Object, error) {
+		return NativeBoolToBoolean(args[0].(*Integer).Value%2 == 1), nil
+	}}
+	fail := &Builtin{Name: "fail", Fn: func(_ Host, args ...Object) (Object, error) {
+		return nil, fmt.Errorf("fail: %s", args[0].Inspect())
+	}}
+	f := &Closure{Fn: &CompiledFunction{Name: "f", NumParameters: 2, Signature: &Signature{
+		Params:   []string{"a", "[b, c]"},
+		Defaults: []string{"", "[1, 2]"},
+		Rest:     "others",
+	}}}
+	anonymous := &Closure{Fn: &CompiledFunction{Signature: &Signature{Params: []string{}}}}
+
+	tests := []struct {
+		name     string
+		args     []Object
+		expected string // inspected result, or error
+	}{
+		{"len", []Object{arr(i(1), i(2))}, "2"},
+		{"len", []Object{hash}, "2"},
+		{"len", []Object{}, "len: wrong number of arguments: want=1, got=0"},
+
+		{"first", []Object{arr(i(1), i(2))}, "1"},
+		{"first", []Object{arr()}, "null"},
+		{"first", []Object{s("ab")}, "first: argument 1 must be ARRAY, got STRING"},
+		{"first", []Object{arr(), arr()}, "first: wrong number of arguments: want=1, got=2"},
+
+		{"last", []Object{arr(i(1), i(2))}, "2"},
+		{"last", []Object{arr()}, "null"},
+		{"last", []Object{i(1)}, "last: argument 1 must be ARRAY, got INTEGER"},
+
+		{"rest", []Object{arr(i(1), i(2), i(3))}, "[2, 3]"},
+		{"rest", []Object{arr(i(1))}, "[]"},
+		{"rest", []Object{arr()}, "null"},
+		{"rest", []Object{hash}, "rest: argument 1 must be ARRAY, got HASH"},
+
+		{"push", []Object{arr(i(1)), i(2)}, "[1, 2]"},
+		{"push", []Object{arr(), arr()}, "[[]]"},
+		{"push", []Object{i(1), i(2)}, "push: argument 1 must be ARRAY, got INTEGER"},
+		{"push", []Object{arr()}, "push: wrong number of arguments: want=2, got=1"},
+
+		{"puts", []Object{}, "null"},
+		{"puts", []Object{s("a"), i(1)}, "null"},
+
+		{"type", []Object{i(1)}, `"INTEGER"`},
+		{"type", []Object{s("")}, `"STRING"`},
+		{"type", []Object{NULL}, `"NULL"`},
+		{"type", []Object{add}, `"FUNCTION"`},
+		{"type", []Object{&Closure{Fn: &CompiledFunction{}}}, `"FUNCTION"`},
+		{"type", []Object{}, "type: wrong number of arguments: want=1, got=0"},
+
+		{"str", []Object{i(-4)}, `"-4"`},
+		{"str", []Object{s("x")}, `"x"`},
+		{"str", []Object{arr(s("x"), TRUE)}, `"[\"x\", true]"`},
+		{"str", []Object{i(1), i(2)}, "str: wrong number of arguments: want=1, got=2"},
+
+		{"int", []Object{s("-42")}, "-42"},
+		{"int", []Object{i(7)}, "7"},
+		{"int", []Object{TRUE}, "1"},
+		{"int", []Object{FALSE}, "0"},
+		{"int", []Object{s("4x")}, `int: cannot convert "4x" to INTEGER`},
+		{"int", []Object{NULL}, "int: argument 1 must be INTEGER, DECIMAL, STRING or BOOLEAN, got NULL"},
+
+		{"keys", []Object{hash}, `["b", "a"]`},
+		{"keys", []Object{NewHash()}, "[]"},
+		{"keys", []Object{arr()}, "keys: argument 1 must be HASH, got ARRAY"},
+
+		{"values", []Object{hash}, "[2, 1]"},
+		{"values", []Object{s("")}, "values: argument 1 must be HASH, got STRING"},
+
+		{"range", []Object{i(3)}, "[0, 1, 2]"},
+		{"range", []Object{i(2), i(5)}, "[2, 3, 4]"},
+		{"range", []Object{i(5), i(0), i(-2)}, "[5, 3, 1]"},
+		{"range", []Object{i(5), i(2)}, "[]"},
+		{"range", []Object{i(math.MaxInt64 - 7), i(math.MaxInt64), i(10)}, "[9223372036854775800]"},
+		{"range", []Object{i(math.MaxInt64 - 3), i(math.MaxInt64), i(2)}, "[9223372036854775804, 9223372036854775806]"},
+		{"range", []Object{i(math.MinInt64 + 3), i(math.MinInt64), i(math.MinInt64)}, "[-9223372036854775805]"},
+		{"range", []Object{i(math.MinInt64), i(math.MaxInt64), i(math.MaxInt64)}, "[-9223372036854775808, -1, 9223372036854775806]"},
+		{"range", []Object{i(math.MinInt64), i(math.MaxInt64)}, "range: too many elements, got 18446744073709551615"},
+		{"range", []Object{i(0), i(5), i(0)}, "range: step must not be zero"},
+		{"range", []Object{i(0), s("5")}, "range: argument 2 must be INTEGER, got STRING"},
+		{"range", []Object{}, "range: wrong number of arguments: want=1 to 3, got=0"},
+
+		{"map", []Object{arr(i(1), i(2)), odd}, "[true, false]"},
+		{"map", []Object{arr(), fail}, "[]"},
+		{"map", []Object{arr(i(1)), fail}, "fail: 1"},
+		{"map", []Object{arr(), i(1)}, "map: argument 2 must be FUNCTION, got INTEGER"},
+		{"map", []Object{odd, arr()}, "map: argument 1 must be ARRAY, got BUILTIN"},
+
+		{"filter", []Object{arr(i(1), i(2), i(3)), odd}, "[1, 3]"},
+		{"filter", []Object{arr(i(1)), fail}, "fail: 1"},
+		{"filter", []Object{arr()}, "filter: wrong number of arguments: want=2, got=1"},
+
+		{"reduce", []Object{arr(i(1), i(2), i(3)), add, i(10)}, "16"},
+		{"reduce", []Object{arr(), add, s("init")}, `"init"`},
+		{"reduce", []Object{arr(s("a"), s("b")), add, s("")}, `"ab"`},
+		{"reduce", []Object{arr(i(1)), add, s("")}, "type mismatch: STRING + INTEGER"},
+		{"reduce", []Object{arr(), add}, "reduce: wrong number of arguments: want=3, got=2"},
+		{"reduce", []Object{arr(), NULL, i(0)}, "reduce: argument 2 must be FUNCTION, got NULL"},
+
+		{"signature", []Object{f}, `{"name": "f", "params": ["a", "[b, c]"], "defaults": [null, "[1, 2]"], "required": 1, "rest": "others"}`},
+		{"signature", []Object{anonymous}, `{"name": null, "params": [], "defaults": [], "required": 0, "rest": null}`},
+		{"signature", []Object{add}, "signature: Builtin[add] has no signature"},
+		{"signature", []Object{i(1)}, "signature: argument 1 must be FUNCTION, got INTEGER"},
+		{"int", []Object{dec("-7.9")}, "-7"},
+		{"int", []Object{s("123456789012345678901")}, "123456789012345678901"},
+		{"random", []Object{s2i("123456789012345678901")}, "random: argument 1 is too large, got 123456789012345678901"},
+		{"range", []Object{s2i("123456789012345678901")}, "range: argument 1 is too large, got 123456789012345678901"},
+		{"decimal", []Object{i(3)}, "3"},
+		{"decimal", []Object{s("-0.50")}, "-0.50"},
+		{"decimal", []Object{s("1.")}, `decimal: cannot convert "1." to DECIMAL`},
+		{"decimal", []Object{TRUE}, "decimal: argument 1 must be INTEGER, DECIMAL or STRING, got BOOLEAN"},
+		{"round", []Object{dec("2.5")}, "2"},
+		{"round", []Object{dec("2.675"), i(2)}, "2.68"},
+		{"round", []Object{dec("2.665"), i(2)}, "2.66"},
+		{"round", []Object{dec("2.665"), i(2), s("half_up")}, "2.67"},
+		{"round", []Object{dec("-2.665"), i(2), s("half_down")}, "-2.66"},
+		{"round", []Object{dec("1.21"), i(1), s("up")}, "1.3"},
+		{"round", []Object{dec("-1.29"), i(1), s("down")}, "-1.2"},
+		{"round", []Object{dec("-1.21"), i(1), s("ceiling")}, "-1.2"},
+		{"round", []Object{dec("-1.21"), i(1), s("floor")}, "-1.3"},
+		{"round", []Object{i(7), i(2)}, "7.00"},
+		{"round", []Object{dec("1.5"), i(-1)}, "round: places must be between 0 and 1000, got -1"},
+		{"round", []Object{dec("1.5"), i(0), s("nearest")}, `round: unknown rounding mode "nearest"`},
+		{"round", []Object{s("1.5")}, "round: argument 1 must be INTEGER or DECIMAL, got STRING"},
+		{"round", []Object{}, "round: wrong number of arguments: want=1 to 3, got=0"},
+		{"new", []Object{hash, hash}, `{"b": 2, "a": 1}`},
+		{"new", []Object{i(1), hash}, "new: argument 1 must be HASH, got INTEGER"},
+		{"new", []Object{hash}, "new: wrong number of arguments: want=2, got=1"},
+		{"prototype", []Object{hash}, "null"},
+		{"prototype", []Object{arr()}, "prototype: argument 1 must be HASH, got ARRAY"},
+	}
+
+	for n, tt := range tests {
+		b, ok := GetBuiltinByName(tt.name)
+		if !ok {
+			t.Fatalf("no builtin %s", tt.name)
+		}
+
+		result, err := b.Fn(&testHost{}, tt.args...)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("tests[%d] %s: want=%s, got=%s", n, tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestBuiltinAlloc(t *testing.T) {
+	h := &testHost{maxAlloc: 10}
+	call := func(name string, args ...Object) error {
+		b, _ := GetBuiltinByName(name)
+		_, err := b.Fn(h, args...)
+		return err
+	}
+	small := &Array{Elements: make([]Object, 10)}
+	for i := range small.Elements {
+		small.Elements[i] = &Integer{Value: int64(i)}
+	}
+
+	require.EqualError(t, call("range", &Integer{Value: 100000000}), "ARRAY of size 100000000 is too large")
+	require.EqualError(t, call("push", small, NULL), "ARRAY of size 11 is too large")
+	require.NoError(t, call("range", &Integer{Value: 10}))
+	require.NoError(t, call("str", &Integer{Value: 1234567890}))
+
+	// the text of arrays sharing elements doubles with every level
+	nested := Object(small)
+	for i := 0; i < 40; i++ {
+		nested = &Array{Elements: []Object{nested, nested}}
+	}
+	h.maxAlloc = 1 << 20
+	err := call("str", nested)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "STRING of size")
+	require.NoError(t, call("str", small))
+
+	// the length of numbers is bounded before they are formatted
+	h.maxAlloc = 100
+	huge := new(big.Int).Lsh(big.NewInt(1), 100000)
+	require.EqualError(t, call("str", &Decimal{Unscaled: huge, Scale: MaxScale}), "STRING of size 31107 is too large")
+	require.NoError(t, call("str", &Decimal{Unscaled: big.NewInt(12345), Scale: 20}))
+}
+
+func TestPutsOutput(t *testing.T) {
+	h := &testHost{}
+	puts, _ := GetBuiltinByName("puts")
+
+	_, err := puts.Fn(h, &String{Value: "hello"}, &Array{Elements: []Object{&String{Value: "x"}}}, NULL)
+	require.NoError(t, err)
+	require.Equal(t, "hello\n[\"x\"]\nnull\n", h.out.String())
+}
+
+func TestSignature(t *testing.T) {
+	sig := &Signature{Params: []string{"a", "b", "c"}, Defaults: []string{"", "2", "a + b"}}
+	rest := &Signature{Params: []string{"first"}, Rest: "others"}
+	plain := &Signature{Params: []string{"a", "b"}}
+
+	require.Equal(t, "f(a, b = 2, c = a + b)", sig.Format("f"))
+	require.Equal(t, "fn(first, ...others)", rest.Format(""))
+	require.Equal(t, 1, sig.Required())
+	require.True(t, plain.Plain())
+	require.False(t, rest.Plain())
+
+	tests := []struct {
+		sig        *Signature
+		positional int
+		names      []string
+		expected   string // indexes of the named arguments, or error
+	}{
+		{sig, 1, nil, "[]"},
+		{sig, 3, nil, "[]"},
+		{sig, 1, []string{"c"}, "[2]"},
+		{sig, 0, []string{"c", "a"}, "[2 0]"},
+		{rest, 4, nil, "[]"},
+		{sig, 0, nil, "wrong number of arguments to f(a, b = 2, c = a + b): want=1 to 3, got=0"},
+		{sig, 4, nil, "wrong number of arguments to f(a, b = 2, c = a + b): want=1 to 3, got=4"},
+		{rest, 0, nil, "wrong number of arguments to f(first, ...others): want at least 1, got=0"},
+		{plain, 1, nil, "wrong number of arguments to f(a, b): want=2, got=1"},
+		{sig, 1, []string{"d"}, "f(a, b = 2, c = a + b) has no parameter d"},
+		{sig, 1, []string{"a"}, "argument a to f(a, b = 2, c = a + b) given twice"},
+		{sig, 0, []string{"b"}, "missing argument a to f(a, b = 2, c = a + b)"},
+		{rest, 0, []string{"others"}, "f(first, ...others) has no parameter others"},
+	}
+
+	for _, tt := range tests {
+		indexes, err := tt.sig.Bind("f", tt.positional, tt.names)
+		got := fmt.Sprint(indexes)
+		if err != nil {
+			got = err.Error()
+			require.Equal(t, KindArgument, KindOf(err))
+		}
+		require.Equal(t, tt.expected, got, "%s %d %v", tt.sig.Format("f"), tt.positional, tt.names)
+	}
+}
+
+func TestOverload(t *testing.T) {
+	req := require.New(t)
+	h := &testHost{}
+	str := func(v string) *String { return &String{Value: v} }
+
+	// money values are hashes {"cents": n} whose methods are builtins
+	cents := func(obj Object) Object {
+		if hash, ok := obj.(*Hash); ok {
+			value, _ := hash.Get(str("cents"))
+			return value
+		}
+		return obj
+	}
+	money := NewHash()
+	newMoney := func(n Object) Object {
+		fields := NewHash()
+		fields.Set(str("cents"), n)
+		m, err := builtinNew(h, money, fields)
+		req.NoError(err)
+		return m
+	}
+	method := func(fn func(args ...Object) (Object, error)) *Builtin {
+		return &Builtin{Name: "method", Fn: func(_ Host, args ...Object) (Object, error) { return fn(args...) }}
+	}
+	money.Set(str("+"), method(func(args ...Object) (Object, error) {
+		sum, err := Infix("+", cents(args[0]), cents(args[1]))
+		return newMoney(sum), err
+	}))
+	money.Set(str("=="), method(func(args ...Object) (Object, error) {
+		return Infix("==", cents(args[0]), cents(args[1]))
+	}))
+	money.Set(str(">"), method(func(args ...Object) (Object, error) {
+		return Infix(">", cents(args[0]), cents(args[1]))
+	}))
+	money.Set(str("neg"), method(func(args ...Object) (Object, error) {
+		n, err := Prefix("-", cents(args[0]))
+		return newMoney(n), err
+	}))
+	money.Set(str("[]"), method(func(args ...Object) (Object, error) {
+		return &String{Value: "missing " + args[1].Inspect()}, nil
+	}))
+
+	a, b := newMoney(&Integer{Value: 150}), newMoney(&Integer{Value: 150})
+	proto, err := builtinPrototype(h, a)
+	req.NoError(err)
+	req.Same(money, proto)
+
+	tests := []struct {
+		op          string
+		left, right Object
+		expected    string
+		err         string
+	}{
+		{op: "+", left: a, right: b, expected: `{"cents": 300}`},
+		{op: "+", left: a, right: &Integer{Value: 5}, expected: `{"cents": 155}`},
+		{op: "+", left: &Integer{Value: 5}, right: a, expected: `{"cents": 155}`},
+		{op: "==", left: a, right: b, expected: "true"},
+		{op: "!=", left: a, right: b, expected: "false"},
+		{op: "==", left: a, right: &Integer{Value: 150}, expected: "true"},
+		{op: ">", left: a, right: &Integer{Value: 100}, expected: "true"},
+		{op: "<", left: a, right: &Integer{Value: 100}, expected: "false"},
+		{op: "<", left: &Integer{Value: 100}, right: a, expected: "true"},
+		{op: "-", left: a, right: b, err: `unknown operator: HASH - HASH: no "-" method in the prototype`},
+		{op: "*", left: &Integer{Value: 2}, right: a, err: `unknown operator: INTEGER * HASH: no "*" method in the prototype`},
+		{op: "+", left: NewHash(), right: NewHash(), err: "unknown operator: HASH + HASH"},
+	}
+
+	for _, tt := range tests {
+		result, err := InfixWith(h, tt.op, tt.left, tt.right)
+		if tt.err != "" {
+			req.EqualError(err, tt.err)
+			continue
+		}
+		req.NoError(err)
+		req.Equal(tt.expected, result.Inspect(), "%s %s %s", tt.left.Inspect(), tt.op, tt.right.Inspect())
+	}
+
+	result, err := PrefixWith(h, "-", a)
+	req.NoError(err)
+	req.Equal(`{"cents": -150}`, result.Inspect())
+
+	result, err = PrefixWith(h, "!", a)
+	req.NoError(err)
+	req.Equal(FALSE, result)
+
+	plain, err := builtinNew(h, NewHash(), NewHash())
+	req.NoError(err)
+	_, err = PrefixWith(h, "-", plain)
+	req.EqualError(err, `unknown operator: -HASH: no "neg" method in the prototype`)
+
+	result, err = InfixWith(h, "==", plain, plain)
+	req.NoError(err)
+	req.Equal(TRUE, result, "hashes without a == method compare by identity")
+
+	result, err = IndexWith(h, a, str("cents"))
+	req.NoError(err)
+	req.Equal("150", result.Inspect())
+
+	result, err = IndexWith(h, a, &Integer{Value: 1})
+	req.NoError(err)
+	req.Equal(`"missing 1"`, result.Inspect())
+
+	// without a [] method missing keys are looked up in the prototype chain
+	base := NewHash()
+	base.Set(str("unit"), str("EUR"))
+	derived, _ := builtinNew(h, base, NewHash())
+	child, _ := builtinNew(h, derived.(*Hash), NewHash())
+	result, err = IndexWith(h, child, str("unit"))
+	req.NoError(err)
+	req.Equal(`"EUR"`, result.Inspect())
+
+	result, err = IndexWith(h, child, str("none"))
+	req.NoError(err)
+	req.Equal(NULL, result)
+
+	_, err = IndexWith(h, child, &Array{})
+	req.EqualError(err, "unusable as hash key: ARRAY")
+}
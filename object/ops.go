@@ -0,0 +1,317 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// NativeBoolToBoolean returns the shared TRUE or FALSE object.
+func NativeBoolToBoolean(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+// IsTruthy reports whether obj counts as true in a condition. Only false
+// and null are falsy.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// Equal reports whether two values are equal. Numbers, booleans, strings
+// and null compare by value, everything else by identity. Numbers are equal
+// to numbers of the same value whatever their type, so 1 == 1.0, and values
+// of other different types are never equal.
+func Equal(left, right Object) bool {
+	if isNumber(left) && isNumber(right) {
+		return CompareNumbers(left, right) == 0
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *Boolean:
+		return left.Value == right.(*Boolean).Value
+	case *String:
+		return left.Value == right.(*String).Value
+	case *Null:
+		return true
+	}
+	return left == right
+}
+
+// Prefix applies the prefix operator op to right.
+func Prefix(op string, right Object) (Object, error) {
+	switch op {
+	case "!":
+		return NativeBoolToBoolean(!IsTruthy(right)), nil
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			if right.Value != math.MinInt64 {
+				return &Integer{Value: -right.Value}, nil
+			}
+			return NewInteger(new(big.Int).Neg(big.NewInt(right.Value))), nil
+		case *BigInt:
+			return NewInteger(new(big.Int).Neg(right.Value)), nil
+		case *Decimal:
+			return &Decimal{Unscaled: new(big.Int).Neg(right.Unscaled), Scale: right.Scale}, nil
+		}
+	}
+	return nil, Errorf(KindType, "unknown operator: %s%s", op, right.Type())
+}
+
+// Infix applies the binary operator op to left and right. Numbers of
+// different types can be mixed, other operands must have the same type.
+func Infix(op string, left, right Object) (Object, error) {
+	switch op {
+	case "==":
+		return NativeBoolToBoolean(Equal(left, right)), nil
+	case "!=":
+		return NativeBoolToBoolean(!Equal(left, right)), nil
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return numberInfix(op, left, right)
+	}
+	if left.Type() != right.Type() {
+		return nil, Errorf(KindType, "type mismatch: %s %s %s", left.Type(), op, right.Type())
+	}
+
+	switch left := left.(type) {
+	case *String:
+		return stringInfix(op, left.Value, right.(*String).Value)
+	}
+
+	return nil, Errorf(KindType, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+func stringInfix(op string, left, right string) (Object, error) {
+	switch op {
+	case "+":
+		return &String{Value: left + right}, nil
+	case "<":
+		return NativeBoolToBoolean(left < right), nil
+	case ">":
+		return NativeBoolToBoolean(left > right), nil
+	}
+	return nil, Errorf(KindType, "unknown operator: %s %s %s", STRING_OBJ, op, STRING_OBJ)
+}
+
+// Template returns the string a template literal builds from the values
+// of its parts: strings as they are and other values as str converts them.
+func Template(parts []Object) Object {
+	var sb strings.Builder
+	for _, part := range parts {
+		sb.WriteString(toString(part))
+	}
+	return &String{Value: sb.String()}
+}
+
+// Index returns left[index]. Indexes out of range and missing keys give
+// null.
+func Index(left, index Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		if _, ok := index.(*BigInt); ok {
+			return NULL, nil
+		}
+		i, ok := index.(*Integer)
+		if !ok {
+			return nil, Errorf(KindType, "array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NULL, nil
+		}
+		return left.Elements[i.Value], nil
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return nil, Errorf(KindType, "unusable as hash key: %s", index.Type())
+		}
+		if value, ok := left.Get(key); ok {
+			return value, nil
+		}
+		return NULL, nil
+	case *Module:
+		name, ok := index.(*String)
+		if !ok {
+			return nil, Errorf(KindType, "module export name must be STRING, got %s", index.Type())
+		}
+		value, ok := left.Exports.Get(name)
+		if !ok {
+			return nil, Errorf(KindValue, "module %q has no export %q", left.Path, name.Value)
+		}
+		return value, nil
+	case *Exception:
+		name, ok := index.(*String)
+		if !ok {
+			return nil, Errorf(KindType, "exception field must be STRING, got %s", index.Type())
+		}
+		return left.Field(name.Value), nil
+	}
+	return nil, Errorf(KindType, "index operator not supported: %s", left.Type())
+}
+
+// SetIndex stores value at index of left, an array or a hash. Arrays do not
+// grow, so the index of an array must be in range. Frozen arrays and hashes
+// can not be changed.
+func SetIndex(left, index, value Object) error {
+	switch left := left.(type) {
+	case *Array:
+		if left.Frozen {
+			return Errorf(KindType, "cannot modify frozen ARRAY")
+		}
+		if i, ok := index.(*BigInt); ok {
+			return Errorf(KindValue, "array index out of range: %s with length %d", i.Inspect(), len(left.Elements))
+		}
+		i, ok := index.(*Integer)
+		if !ok {
+			return Errorf(KindType, "array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return Errorf(KindValue, "array index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+		return nil
+	case *Hash:
+		if left.Frozen {
+			return Errorf(KindType, "cannot modify frozen HASH")
+		}
+		key, ok := index.(Hashable)
+		if !ok {
+			return Errorf(KindType, "unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, value)
+		return nil
+	}
+	return Errorf(KindType, "index assignment not supported: %s", left.Type())
+}
+
+// MatchArray reports whether obj is an array of n elements, the values an
+// array pattern of n elements can match, or of at least n elements if the
+// pattern has a rest.
+func MatchArray(obj Object, n int, rest bool) bool {
+	array, ok := obj.(*Array)
+	return ok && (len(array.Elements) == n || rest && len(array.Elements) > n)
+}
+
+// DestructureArray returns the error of binding obj to an array pattern of n
+// elements, with a rest if rest is set, or nil if the pattern matches it.
+func DestructureArray(obj Object, n int, rest bool) error {
+	array, ok := obj.(*Array)
+	if !ok {
+		return Errorf(KindType, "cannot destructure %s as an array", obj.Type())
+	}
+	if MatchArray(obj, n, rest) {
+		return nil
+	}
+	if rest {
+		return Errorf(KindValue, "wrong number of elements to destructure: want>=%d, got=%d", n, len(array.Elements))
+	}
+	return Errorf(KindValue, "wrong number of elements to destructure: want=%d, got=%d", n, len(array.Elements))
+}
+
+// DestructureHash returns the error of binding obj to a hash pattern with
+// the given keys, or nil if the pattern matches it.
+func DestructureHash(obj Object, keys []Object) error {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return Errorf(KindType, "cannot destructure %s as a hash", obj.Type())
+	}
+	for _, key := range keys {
+		k, ok := key.(Hashable)
+		if !ok {
+			return Errorf(KindType, "unusable as hash key: %s", key.Type())
+		}
+		if _, ok := hash.Get(k); !ok {
+			return Errorf(KindValue, "missing key %s to destructure", key.Inspect())
+		}
+	}
+	return nil
+}
+
+// ArrayRest returns a new array of the elements of the array obj from index
+// n on, the value the rest of an array pattern of n elements matches.
+func ArrayRest(obj Object, n int) Object {
+	elements := obj.(*Array).Elements[n:]
+	return &Array{Elements: append([]Object{}, elements...)}
+}
+
+// MatchHash reports whether obj is a hash holding all of keys, the values a
+// hash pattern with those keys can match.
+func MatchHash(obj Object, keys []Object) bool {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return false
+	}
+	for _, key := range keys {
+		k, ok := key.(Hashable)
+		if !ok {
+			return false
+		}
+		if _, ok := hash.Get(k); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NoMatch returns the error of a match expression none of whose arms
+// matches subject.
+func NoMatch(subject Object) error {
+	return Errorf(KindValue, "no match for %s", subject.Inspect())
+}
+
+// Freeze makes obj and the arrays and hashes it contains immutable, and
+// returns obj.
+func Freeze(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Array:
+		if obj.Frozen {
+			break
+		}
+		obj.Frozen = true
+		for _, e := range obj.Elements {
+			Freeze(e)
+		}
+	case *Hash:
+		if obj.Frozen {
+			break
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Pairs {
+			Freeze(pair.Key)
+			Freeze(pair.Value)
+		}
+	}
+	return obj
+}
+
+// IsFrozen reports whether obj can not be changed. Only arrays and hashes
+// can be changed, unless they are frozen.
+func IsFrozen(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Frozen
+	case *Hash:
+		return obj.Frozen
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package object
+
+// Hashes with a prototype, made by the builtin new, can overload operators
+// with methods stored in the prototype, or in its own prototype and so on,
+// under these keys:
+//
+//	"+", "-", "*", "/"  binary arithmetic, called with (left, right)
+//	"==", "<", ">"      comparisons, called with (left, right)
+//	"neg"               unary minus, called with the operand
+//	"[]"                indexing, called with (hash, index)
+//
+// The method of the left operand is tried before the method of the right
+// operand, and both get the operands in source order. The results of
+// comparisons are turned into booleans. != negates the result of ==, and
+// a < b calls the ">" method as b > a when there is no "<" method, and the
+// other way around. Without a "==" method hashes compare by identity, as
+// usual; other operators without a method fail.
+
+// method returns the method the prototype chain of obj defines under name.
+func method(obj Object, name string) (Object, bool) {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return nil, false
+	}
+	key := &String{Value: name}
+	for proto := hash.Proto; proto != nil; proto = proto.Proto {
+		if m, ok := proto.Get(key); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// hasProto reports whether obj is a hash with a prototype.
+func hasProto(obj Object) bool {
+	hash, ok := obj.(*Hash)
+	return ok && hash.Proto != nil
+}
+
+// InfixWith is Infix calling the methods overloading op when an operand is
+// a hash with a prototype. h calls the methods.
+func InfixWith(h Host, op string, left, right Object) (Object, error) {
+	if !hasProto(left) && !hasProto(right) {
+		return Infix(op, left, right)
+	}
+
+	// call calls the method name of a, or else of b, with a and b
+	call := func(name string, a, b Object) (Object, bool, error) {
+		m, ok := method(a, name)
+		if !ok {
+			m, ok = method(b, name)
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		result, err := h.Call(m, a, b)
+		if err == nil && (name == "==" || name == "<" || name == ">") {
+			// comparisons always give booleans
+			result = NativeBoolToBoolean(IsTruthy(result))
+		}
+		return result, true, err
+	}
+
+	switch op {
+	case "==", "!=":
+		result, ok, err := call("==", left, right)
+		switch {
+		case !ok:
+			return Infix(op, left, right)
+		case err == nil && op == "!=":
+			result = NativeBoolToBoolean(result == FALSE)
+		}
+		return result, err
+	case "<", ">":
+		if result, ok, err := call(op, left, right); ok {
+			return result, err
+		}
+		flipped := ">"
+		if op == ">" {
+			flipped = "<"
+		}
+		if result, ok, err := call(flipped, right, left); ok {
+			return result, err
+		}
+	default:
+		if result, ok, err := call(op, left, right); ok {
+			return result, err
+		}
+	}
+	return nil, Errorf(KindType, "unknown operator: %s %s %s: no %q method in the prototype", left.Type(), op, right.Type(), op)
+}
+
+// PrefixWith is Prefix calling the "neg" method of a hash with a prototype
+// for unary minus. h calls the method.
+func PrefixWith(h Host, op string, right Object) (Object, error) {
+	if op != "-" || !hasProto(right) {
+		return Prefix(op, right)
+	}
+	if m, ok := method(right, "neg"); ok {
+		return h.Call(m, right)
+	}
+	return nil, Errorf(KindType, "unknown operator: -%s: no %q method in the prototype", right.Type(), "neg")
+}
+
+// IndexWith is Index for hashes with a prototype: keys missing from the
+// hash are passed to its "[]" method, or looked up in the prototype chain
+// when there is none, so that hashes share the values of their prototype.
+// h calls the method.
+func IndexWith(h Host, left, index Object) (Object, error) {
+	hash, ok := left.(*Hash)
+	if !ok || hash.Proto == nil {
+		return Index(left, index)
+	}
+
+	if key, ok := index.(Hashable); ok {
+		if value, ok := hash.Get(key); ok {
+			return value, nil
+		}
+	}
+	if m, ok := method(hash, "[]"); ok {
+		return h.Call(m, hash, index)
+	}
+	for proto := hash.Proto; proto != nil; proto = proto.Proto {
+		value, err := Index(proto, index)
+		if err != nil || value != NULL {
+			return value, err
+		}
+	}
+	return NULL, nil
+}
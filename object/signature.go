@@ -0,0 +1,132 @@
+package object
+
+import (
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+)
+
+// Signature describes the parameters of a function, for binding the
+// arguments of calls and for error messages.
+type Signature struct {
+	Params   []string // the names, or the patterns, of the parameters
+	Defaults []string // the source of the default values, "" for required parameters
+	Rest     string   // the name of the rest parameter, "" if there is none
+}
+
+// NewSignature returns the signature of a function literal with the given
+// parameters, default values and rest parameter.
+func NewSignature(params []ast.Pattern, defaults []ast.Expression, rest *ast.Identifier) *Signature {
+	sig := &Signature{Params: make([]string, len(params))}
+	for i, p := range params {
+		sig.Params[i] = p.String()
+	}
+	if defaults != nil {
+		sig.Defaults = make([]string, len(defaults))
+		for i, d := range defaults {
+			if d != nil {
+				sig.Defaults[i] = d.String()
+			}
+		}
+	}
+	if rest != nil {
+		sig.Rest = rest.Value
+	}
+	return sig
+}
+
+// Required returns the number of parameters without a default value, which
+// come before the others.
+func (s *Signature) Required() int {
+	n := 0
+	for n < len(s.Params) && (n >= len(s.Defaults) || s.Defaults[n] == "") {
+		n++
+	}
+	return n
+}
+
+// Plain reports whether every parameter is required and there is no rest
+// parameter, so that calls must pass exactly len(s.Params) arguments.
+func (s *Signature) Plain() bool {
+	return s.Rest == "" && s.Required() == len(s.Params)
+}
+
+// Format returns the signature as written in the source, preceded by name,
+// or by fn for anonymous functions: `f(a, b = 2, ...rest)`.
+func (s *Signature) Format(name string) string {
+	if name == "" {
+		name = "fn"
+	}
+
+	params := make([]string, 0, len(s.Params)+1)
+	for i, p := range s.Params {
+		if i < len(s.Defaults) && s.Defaults[i] != "" {
+			p += " = " + s.Defaults[i]
+		}
+		params = append(params, p)
+	}
+	if s.Rest != "" {
+		params = append(params, "..."+s.Rest)
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// ArityError returns the error for a call of the function name passing got
+// arguments.
+func (s *Signature) ArityError(name string, got int) error {
+	required := s.Required()
+	switch {
+	case s.Rest != "":
+		return Errorf(KindArgument, "wrong number of arguments to %s: want at least %d, got=%d", s.Format(name), required, got)
+	case required < len(s.Params):
+		return Errorf(KindArgument, "wrong number of arguments to %s: want=%d to %d, got=%d", s.Format(name), required, len(s.Params), got)
+	default:
+		return Errorf(KindArgument, "wrong number of arguments to %s: want=%d, got=%d", s.Format(name), len(s.Params), got)
+	}
+}
+
+// Bind checks the arguments of a call of the function name passing
+// positional arguments followed by arguments with the given names, and
+// returns the index of the parameter each named argument is bound to.
+// Parameters are bound by name only if they are plain names.
+func (s *Signature) Bind(name string, positional int, names []string) ([]int, error) {
+	if positional > len(s.Params) && s.Rest == "" {
+		return nil, s.ArityError(name, positional+len(names))
+	}
+
+	passed := make([]bool, len(s.Params))
+	for i := 0; i < positional && i < len(s.Params); i++ {
+		passed[i] = true
+	}
+
+	indexes := make([]int, len(names))
+	for i, n := range names {
+		index := -1
+		for j, p := range s.Params {
+			if p == n {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return nil, Errorf(KindArgument, "%s has no parameter %s", s.Format(name), n)
+		}
+		if passed[index] {
+			return nil, Errorf(KindArgument, "argument %s to %s given twice", n, s.Format(name))
+		}
+		passed[index] = true
+		indexes[i] = index
+	}
+
+	for i, required := 0, s.Required(); i < required; i++ {
+		if passed[i] {
+			continue
+		}
+		if len(names) == 0 {
+			return nil, s.ArityError(name, positional)
+		}
+		return nil, Errorf(KindArgument, "missing argument %s to %s", s.Params[i], s.Format(name))
+	}
+
+	return indexes, nil
+}
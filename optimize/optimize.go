@@ -0,0 +1,222 @@
+// Package optimize rewrites Monkey programs into cheaper, equivalent ones.
+//
+// Only expressions whose operands are all literals are folded, and only when
+// the result can not differ from evaluating them at run time. Anything that
+// would fail at run time, like `1 / 0` or `-true`, is left for the runtime to
+// report.
+package optimize
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// Optimize folds constant integer and boolean expressions of prog, removes
+// double negations of booleans and drops the branches of if expressions
+// that can never run. prog is modified in place and returned.
+func Optimize(prog *ast.Program) *ast.Program {
+	return ast.Modify(prog, optimize).(*ast.Program)
+}
+
+func optimize(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.PrefixExpression:
+		return foldPrefix(n)
+	case *ast.InfixExpression:
+		return foldInfix(n)
+	case *ast.IfExpression:
+		return foldIf(n)
+	case *ast.Program:
+		n.Statements = dropDeadStatements(n.Statements)
+	case *ast.BlockStatement:
+		n.Statements = dropDeadStatements(n.Statements)
+	}
+	return node
+}
+
+func foldPrefix(n *ast.PrefixExpression) ast.Expression {
+	switch n.Operator {
+	case "-":
+		if i, ok := n.Right.(*ast.InetegerLiteral); ok && i.Value != math.MinInt64 {
+			return integer(n.Token, -i.Value)
+		}
+	case "!":
+		if value, ok := truthiness(n.Right); ok {
+			return boolean(n.Token, !value)
+		}
+		// !!x is x when x is already a boolean
+		if inner, ok := n.Right.(*ast.PrefixExpression); ok && inner.Operator == "!" && isBoolean(inner.Right) {
+			return inner.Right
+		}
+	}
+	return n
+}
+
+func foldInfix(n *ast.InfixExpression) ast.Expression {
+	if left, ok := n.Left.(*ast.InetegerLiteral); ok {
+		if right, ok := n.Right.(*ast.InetegerLiteral); ok {
+			return foldIntegers(n, left.Value, right.Value)
+		}
+	}
+
+	if left, ok := n.Left.(*ast.Boolean); ok {
+		if right, ok := n.Right.(*ast.Boolean); ok {
+			switch n.Operator {
+			case "==":
+				return boolean(n.Token, left.Value == right.Value)
+			case "!=":
+				return boolean(n.Token, left.Value != right.Value)
+			}
+		}
+	}
+
+	return n
+}
+
+func foldIntegers(n *ast.InfixExpression, left, right int64) ast.Expression {
+	switch n.Operator {
+	case "+", "-", "*":
+		l, r := big.NewInt(left), big.NewInt(right)
+		switch n.Operator {
+		case "+":
+			l.Add(l, r)
+		case "-":
+			l.Sub(l, r)
+		case "*":
+			l.Mul(l, r)
+		}
+		if !l.IsInt64() {
+			// leave the promotion to a big integer for run time
+			return n
+		}
+		return integer(n.Token, l.Int64())
+	case "/":
+		if right == 0 || left == math.MinInt64 && right == -1 {
+			// keep the division by zero error, or the promotion, for run time
+			return n
+		}
+		return integer(n.Token, left/right)
+	case "<":
+		return boolean(n.Token, left < right)
+	case ">":
+		return boolean(n.Token, left > right)
+	case "==":
+		return boolean(n.Token, left == right)
+	case "!=":
+		return boolean(n.Token, left != right)
+	}
+	return n
+}
+
+// foldIf removes the branch of an if expression with a constant condition
+// that can not run. When the remaining branch is a single expression the
+// whole if expression is replaced by it. Blocks with more statements keep
+// their own scope and stay in an `if (true)`.
+func foldIf(n *ast.IfExpression) ast.Expression {
+	value, ok := truthiness(n.Condition)
+	if !ok {
+		return n
+	}
+
+	taken := n.Consequence
+	if !value {
+		taken = n.Alternative
+	}
+
+	if taken == nil {
+		// an if without else evaluates to null; the statement level pass
+		// drops it when its value is unused
+		return n
+	}
+
+	if len(taken.Statements) == 1 {
+		if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+			return stmt.Expression
+		}
+	}
+
+	return &ast.IfExpression{
+		Token:       n.Token,
+		Condition:   boolean(n.Token, true),
+		Consequence: taken,
+	}
+}
+
+// dropDeadStatements removes `if (false) { ... }` statements without else.
+// The last statement is kept since its value may be the result of the block.
+func dropDeadStatements(list []ast.Statement) []ast.Statement {
+	kept := list[:0]
+	for i, stmt := range list {
+		if i < len(list)-1 && isDeadIf(stmt) {
+			continue
+		}
+		kept = append(kept, stmt)
+	}
+	return kept
+}
+
+func isDeadIf(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	ifExpr, ok := es.Expression.(*ast.IfExpression)
+	if !ok || ifExpr.Alternative != nil {
+		return false
+	}
+	value, ok := truthiness(ifExpr.Condition)
+	return ok && !value
+}
+
+// truthiness reports whether expr is a literal and, if so, whether it counts
+// as true in a condition. Only false is falsy among literals.
+func truthiness(expr ast.Expression) (value bool, ok bool) {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return expr.Value, true
+	case *ast.InetegerLiteral, *ast.BigIntegerLiteral, *ast.DecimalLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// isBoolean reports whether expr always evaluates to a boolean.
+func isBoolean(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		return expr.Operator == "!"
+	case *ast.InfixExpression:
+		switch expr.Operator {
+		case "<", ">", "==", "!=":
+			// comparisons of values of different types fail at run time,
+			// but never produce anything other than a boolean
+			return true
+		}
+	}
+	return false
+}
+
+func integer(tok token.Token, value int64) *ast.InetegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.InetegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: literal, Pos: tok.Pos, End: tok.End},
+		Value: value,
+	}
+}
+
+func boolean(tok token.Token, value bool) *ast.Boolean {
+	typ, literal := token.TokenType(token.FALSE), "false"
+	if value {
+		typ, literal = token.TRUE, "true"
+	}
+	return &ast.Boolean{
+		Token: token.Token{Type: typ, Literal: literal, Pos: tok.Pos, End: tok.End},
+		Value: value,
+	}
+}
@@ -0,0 +1,61 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/parser"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-(5 * 10) + 2 == -48", "true"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"10 > 5 != false", "true"},
+		{"true == !false", "true"},
+		{"!5", "false"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"1 + x + 2", "((1 + x) + 2)"},
+
+		// errors are left for run time
+		{"1 / 0", "(1 / 0)"},
+		{"10 / (5 - 5)", "(10 / 0)"},
+		{"-true", "(-true)"},
+		{"true + 1", "(true + 1)"},
+		{"1 == true", "(1 == true)"},
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},
+		{"-4611686018427387904 * 2 / -1", "(-9223372036854775808 / -1)"},
+		{"if (1.5) { a } else { b }", "a"},
+
+		// double negation
+		{"!!(a < b)", "(a < b)"},
+		{"!!!(a < b)", "(!(a < b))"},
+		{"!!a", "(!(!a))"},
+
+		// dead branches
+		{"if (1 < 2) { a } else { b }", "a"},
+		{"if (false) { a } else { b }", "b"},
+		{"if (true) { let x = 1; x } else { b }", "if (true) { let x = 1; x }"},
+		{"if (false) { let x = 1; x } else { let y = 2; y }", "if (true) { let y = 2; y }"},
+		{"if (x) { a } else { b }", "if (x) { a } else { b }"},
+		{"if (false) { a }; b", "b"},
+		{"b; if (false) { a }", "b; if (false) { a }"},
+		{"fn() { if (1 > 2) { a }; if (2 > 1) { return b; } }", "fn() { if (true) { return b; } }"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		prog := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parse errors for %q: %v", tt.input, p.Errors())
+		}
+
+		actual := Optimize(prog).String()
+		if actual != tt.expected {
+			t.Errorf("Optimize(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
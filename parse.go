@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/optimize"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/report"
+)
+
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	optimized := flags.Bool("O", false, "print the program after constant folding")
+	expand := flags.Bool("expand", false, "print the program after macro expansion")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey parse [-O] [-expand] [file]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey parse: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		report.Print(os.Stderr, flags.Arg(0), src, errs)
+		return 1
+	}
+
+	if *expand {
+		if prog, err = evaluator.Expand(prog); err != nil {
+			report.Print(os.Stderr, flags.Arg(0), src, err)
+			return 1
+		}
+	}
+	if *optimized {
+		prog = optimize.Optimize(prog)
+	}
+
+	for _, stmt := range prog.Statements {
+		if line := stmt.String(); strings.HasSuffix(line, ";") {
+			fmt.Println(line)
+		} else {
+			fmt.Println(line + ";")
+		}
+	}
+	return 0
+}
+
+// readSource reads the named file, or standard input when the name is empty
+// or "-".
+func readSource(filename string) (string, error) {
+	if filename == "" || filename == "-" {
+		src, err := io.ReadAll(os.Stdin)
+		return string(src), err
+	}
+
+	src, err := os.ReadFile(filename)
+	return string(src), err
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/riadafridishibly/go-monkey/ast"
 	"github.com/riadafridishibly/go-monkey/lexer"
@@ -14,7 +16,7 @@ type Parser struct {
 	currToken token.Token
 	peekToken token.Token
 
-	errors []string
+	errors ErrorList
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -28,8 +30,21 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.DECIMAL, p.parseDecimalLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.BACKTICK, p.parseTemplateLiteral)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	// register for infix operators
 	p.registerInfix(token.PLUS, p.parseInfixExpression)     // a + b
@@ -40,6 +55,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)   // a != b
 	p.registerInfix(token.LT, p.parseInfixExpression)       // a < b
 	p.registerInfix(token.GT, p.parseInfixExpression)       // a > b
+	p.registerInfix(token.LPAREN, p.parseCallExpression)    // a(b, c)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression) // a[b]
+
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)          // a = b
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)     // a += b
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)    // a -= b
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression) // a *= b
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)    // a /= b
 
 	p.nextToken()
 	p.nextToken()
@@ -52,18 +75,54 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+// Error is a syntax error at the token between Pos and End.
+type Error struct {
+	Pos token.Position
+	End token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of syntax errors.
+type ErrorList []Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Errors returns the messages of the syntax errors found so far.
 func (p *Parser) Errors() []string {
+	var msgs []string
+	for _, e := range p.errors {
+		msgs = append(msgs, e.Msg)
+	}
+	return msgs
+}
+
+// ErrorList returns the syntax errors found so far along with their
+// positions.
+func (p *Parser) ErrorList() ErrorList {
 	return p.errors
 }
 
+// errorf records a syntax error at tok.
+func (p *Parser) errorf(tok token.Token, format string, args ...interface{}) {
+	p.errors = append(p.errors, Error{Pos: tok.Pos, End: tok.End, Msg: fmt.Sprintf(format, args...)})
+}
+
 func (p *Parser) peekError(expectedToken token.TokenType) {
-	msg := fmt.Sprintf("expected token %q but got %q", expectedToken, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken, "expected token %q but got %q", expectedToken, p.peekToken.Type)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefixParseFn for prefix %q", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.currToken, "no prefixParseFn for prefix %q", t)
 }
 
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
@@ -101,10 +160,40 @@ func (p *Parser) parseStatement() ast.Statement {
 		if let := p.parseLetStatement(); let != nil {
 			return let
 		}
+	case token.CONST:
+		if stmt := p.parseConstStatement(); stmt != nil {
+			return stmt
+		}
+	case token.IMPORT:
+		if stmt := p.parseImportStatement(); stmt != nil {
+			return stmt
+		}
+	case token.EXPORT:
+		if stmt := p.parseExportStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
 		if ret := p.parseReturnStatement(); ret != nil {
 			return ret
 		}
+	case token.THROW:
+		if throw := p.parseThrowStatement(); throw != nil {
+			return throw
+		}
+	case token.WHILE:
+		if loop := p.parseWhileStatement(); loop != nil {
+			return loop
+		}
+	case token.FOR:
+		if loop := p.parseForStatement(); loop != nil {
+			return loop
+		}
+	case token.BREAK, token.CONTINUE:
+		stmt := &ast.BranchStatement{Token: p.currToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
 	default:
 		if def := p.parseExpressionStatement(); def != nil {
 			return def
@@ -115,34 +204,243 @@ func (p *Parser) parseStatement() ast.Statement {
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currToken} // token.LET
+	if stmt.Name = p.parseBindingPattern(); stmt.Name == nil {
+		return nil
+	}
+	if !p.parseBinding(stmt.Name, &stmt.Type, &stmt.Value) {
+		return nil
+	}
+	return stmt
+}
 
-	// on success consumes current token
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.currToken} // token.CONST
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
-
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	if !p.parseBinding(stmt.Name, &stmt.Type, &stmt.Value) {
+		return nil
+	}
+	return stmt
+}
+
+// parseBindingPattern parses the name of a let statement or a function
+// parameter: an identifier, or an array or hash pattern that binds names
+// only. The pattern starts at the next token.
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	if !p.peekTokenIs(token.LBRACKET) && !p.peekTokenIs(token.LBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	p.nextToken()
+	pat := p.parsePattern()
+	if pat == nil {
+		return nil
+	}
+	if lit, ok := literalPattern(pat); ok {
+		p.errorf(lit, "cannot use literal %s in a binding pattern", lit.Literal)
+		return nil
+	}
+	return pat
+}
+
+// literalPattern returns the token of the first literal in p, which only
+// match arms may use.
+func literalPattern(p ast.Pattern) (token.Token, bool) {
+	switch p := p.(type) {
+	case *ast.InetegerLiteral:
+		return p.Token, true
+	case *ast.BigIntegerLiteral:
+		return p.Token, true
+	case *ast.DecimalLiteral:
+		return p.Token, true
+	case *ast.StringLiteral:
+		return p.Token, true
+	case *ast.Boolean:
+		return p.Token, true
+	case *ast.ArrayPattern:
+		for _, e := range p.Elements {
+			if tok, ok := literalPattern(e); ok {
+				return tok, true
+			}
+		}
+	case *ast.HashPattern:
+		for _, pair := range p.Pairs {
+			if tok, ok := literalPattern(pair.Value); ok {
+				return tok, true
+			}
+		}
+	}
+	return token.Token{}, false
+}
+
+// parseBinding parses the `: type = value` part of let and const statements
+// following name, where the type annotation is optional.
+func (p *Parser) parseBinding(name ast.Pattern, typ *ast.TypeExpr, value *ast.Expression) bool {
+	// on success consumes current token
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if *typ = p.parseType(); *typ == nil {
+			return false
+		}
+	}
 
 	// check and consume `=`
 	if !p.expectPeek(token.ASSIGN) {
-		return nil
+		return false
+	}
+
+	p.nextToken()
+	*value = p.parseExpression(LOWEST)
+
+	// let the function know its own name, for error messages and recursion
+	fn, isFn := (*value).(*ast.FunctionLiteral)
+	if ident, ok := name.(*ast.Identifier); ok && isFn {
+		fn.Name = ident.Value
 	}
 
-	for !p.currentTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
+	return true
+}
+
+// parseImportStatement parses `import "path" as name`.
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.AS) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
+// parseExportStatement parses `export let ...` and `export const ...`.
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.currToken}
+
+	p.nextToken()
+	switch p.currToken.Type {
+	case token.LET:
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Binding = let
+			return stmt
+		}
+	case token.CONST:
+		if c := p.parseConstStatement(); c != nil {
+			stmt.Binding = c
+			return stmt
+		}
+	default:
+		p.errorf(p.currToken, "expected let or const after export but got %q", p.currToken.Type)
+	}
+	return nil
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currToken}
 
+	// a bare `return` is allowed before `;` and `}`
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
 	// consume current token
 	p.nextToken()
 
-	// TODO: now skipping everything else!
-	for !p.currentTokenIs(token.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseWhileStatement parses `while (cond) { ... }`.
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseForStatement parses `for (x in iterable) { ... }`.
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -161,6 +459,12 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
@@ -169,6 +473,8 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
 }
 
 func (p *Parser) peekPrecendence() int {
@@ -206,17 +512,43 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+// parseAssignExpression parses `target = value` and its compound forms.
+// Assignments are right associative, so `a = b = 1` assigns 1 to both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expr := &ast.AssignExpression{Token: p.currToken, Target: target, Operator: p.currToken.Literal}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		return nil
+	default:
+		p.errorf(p.currToken, "cannot assign to %s", target.String())
+		return nil
+	}
+
+	p.nextToken()
+	expr.Value = p.parseExpression(ASSIGN - 1)
+	if expr.Value == nil {
+		return nil
+	}
+	return expr
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 }
 
+// parseIntegerLiteral parses an integer literal, which is a
+// BigIntegerLiteral when it does not fit in an int64.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.InetegerLiteral{Token: p.currToken}
 
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		if n, ok := new(big.Int).SetString(p.currToken.Literal, 0); ok {
+			return &ast.BigIntegerLiteral{Token: p.currToken, Value: n}
+		}
+		p.errorf(p.currToken, "could not parse %q as integer", p.currToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -224,6 +556,21 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	lit := &ast.DecimalLiteral{Token: p.currToken}
+
+	point := strings.IndexByte(p.currToken.Literal, '.')
+	digits := p.currToken.Literal[:point] + p.currToken.Literal[point+1:]
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		p.errorf(p.currToken, "could not parse %q as decimal", p.currToken.Literal)
+		return nil
+	}
+	lit.Unscaled, lit.Scale = unscaled, len(p.currToken.Literal)-point-1
+
+	return lit
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	// Current token is either `!` or `-`
 	expr := &ast.PrefixExpression{
@@ -252,14 +599,606 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.currToken, Value: p.currentTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+}
+
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	lit := &ast.TemplateLiteral{Token: p.currToken}
+	text := &ast.StringLiteral{Token: token.Token{Type: token.TEMPLATE, Pos: p.currToken.End, End: p.currToken.End}}
+
+	for {
+		p.nextToken()
+		switch p.currToken.Type {
+		case token.TEMPLATE:
+			text = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+		case token.DOLLAR_LBRACE:
+			lit.Parts = append(lit.Parts, text)
+			if p.peekTokenIs(token.RBRACE) {
+				p.errorf(p.peekToken, "empty interpolation in template literal")
+				return nil
+			}
+			p.nextToken()
+			expr := p.parseExpression(LOWEST)
+			if expr == nil || !p.expectPeek(token.RBRACE) {
+				return nil
+			}
+			lit.Parts = append(lit.Parts, expr)
+			text = &ast.StringLiteral{Token: token.Token{Type: token.TEMPLATE, Pos: p.currToken.End, End: p.currToken.End}}
+
+		case token.BACKTICK:
+			lit.Parts = append(lit.Parts, text)
+			return lit
+
+		default:
+			p.errorf(lit.Token, "unterminated template literal")
+			return nil
+		}
+	}
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	// consume `(`
+	p.nextToken()
+
+	expr := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return expr
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expr := &ast.IfExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expr.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expr.Alternative = p.parseBlockStatement()
+	}
+
+	return expr
+}
+
+// parseTryExpression parses `try { ... } catch (e) { ... } finally { ... }`.
+// The parameter of catch is optional, and so is either clause, but not both.
+func (p *Parser) parseTryExpression() ast.Expression {
+	expr := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expr.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expr.CatchParam = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expr.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expr.Finally = p.parseBlockStatement()
+	}
+
+	if expr.Catch == nil && expr.Finally == nil {
+		p.errorf(p.peekToken, "expected catch or finally after try block, got %q", p.peekToken.Type)
+		return nil
+	}
+
+	return expr
+}
+
+// parseMatchExpression parses `match (subject) { pattern if guard => body,
+// ... }`. A body starting with `{` is a block, any other body a single
+// expression. The comma after an arm is optional if its body is a block.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expr := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+
+		p.nextToken()
+		block := p.currentTokenIs(token.LBRACE)
+		if block {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			stmt := &ast.ExpressionStatement{Token: p.currToken, Expression: p.parseExpression(LOWEST)}
+			if stmt.Expression == nil {
+				return nil
+			}
+			arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+		}
+		expr.Arms = append(expr.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !block && !p.peekTokenIs(token.RBRACE) {
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return expr
+}
+
+// parsePattern parses a pattern of a match arm: a number, string or
+// boolean literal, a name, the wildcard `_`, an array pattern [p, q] or
+// [p, ...rest] or a hash pattern {key: p} or {name}. On return the current
+// token is the last token of the pattern.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currToken.Type {
+	case token.IDENT:
+		if p.currToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.currToken}
+		}
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	case token.INT, token.DECIMAL:
+		return p.parseNumberPattern()
+
+	case token.MINUS:
+		// negative numbers are literals in patterns
+		minus := p.currToken
+		if p.peekTokenIs(token.DECIMAL) {
+			p.nextToken()
+		} else if !p.expectPeek(token.INT) {
+			return nil
+		}
+		p.currToken.Literal = "-" + p.currToken.Literal
+		p.currToken.Pos = minus.Pos
+		return p.parseNumberPattern()
+
+	case token.STRING:
+		return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+	case token.TRUE, token.FALSE:
+		return &ast.Boolean{Token: p.currToken, Value: p.currentTokenIs(token.TRUE)}
+
+	case token.LBRACKET:
+		pat := &ast.ArrayPattern{Token: p.currToken, Elements: []ast.Pattern{}}
+		for !p.peekTokenIs(token.RBRACKET) {
+			if len(pat.Elements) > 0 && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			if p.peekTokenIs(token.ELLIPSIS) {
+				// the rest comes last: `[a, ...rest]`
+				p.nextToken()
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				pat.Rest = p.parsePattern()
+				if !p.expectPeek(token.RBRACKET) {
+					return nil
+				}
+				return pat
+			}
+			p.nextToken()
+			elem := p.parsePattern()
+			if elem == nil {
+				return nil
+			}
+			pat.Elements = append(pat.Elements, elem)
+		}
+		p.nextToken()
+		return pat
+
+	case token.LBRACE:
+		pat := &ast.HashPattern{Token: p.currToken, Pairs: []ast.HashPatternPair{}}
+		for !p.peekTokenIs(token.RBRACE) {
+			if len(pat.Pairs) > 0 && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			p.nextToken()
+			tok := p.currToken
+			var key ast.Expression
+			switch k := p.parsePattern().(type) {
+			case nil:
+				return nil
+			case *ast.InetegerLiteral:
+				key = k
+			case *ast.BigIntegerLiteral:
+				key = k
+			case *ast.DecimalLiteral:
+				key = k
+			case *ast.StringLiteral:
+				key = k
+			case *ast.Boolean:
+				key = k
+			case *ast.Identifier:
+				if !p.peekTokenIs(token.COLON) {
+					// `{name}` is short for `{"name": name}`
+					key := &ast.StringLiteral{Token: k.Token, Value: k.Value}
+					pat.Pairs = append(pat.Pairs, ast.HashPatternPair{Key: key, Value: k})
+					continue
+				}
+				p.errorf(tok, "hash pattern keys must be literals, got %s", k)
+				return nil
+			default:
+				p.errorf(tok, "hash pattern keys must be literals, got %s", k)
+				return nil
+			}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := p.parsePattern()
+			if value == nil {
+				return nil
+			}
+			pat.Pairs = append(pat.Pairs, ast.HashPatternPair{Key: key, Value: value})
+		}
+		p.nextToken()
+		return pat
+	}
+
+	p.errorf(p.currToken, "expected a pattern but got %q", p.currToken.Type)
+	return nil
+}
+
+// parseNumberPattern parses the integer or decimal literal of a pattern.
+func (p *Parser) parseNumberPattern() ast.Pattern {
+	var lit ast.Expression
+	if p.currentTokenIs(token.DECIMAL) {
+		lit = p.parseDecimalLiteral()
+	} else {
+		lit = p.parseIntegerLiteral()
+	}
+	if pat, ok := lit.(ast.Pattern); ok {
+		return pat
+	}
+	return nil
+}
+
+// parseBlockStatement parses statements up to the closing `}`. The current
+// token must be the opening `{`; on return it is the closing `}`.
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.currToken}
+	p.nextToken()
+
+	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	if !p.currentTokenIs(token.RBRACE) {
+		p.errorf(p.currToken, "expected token %q but got %q", token.RBRACE, p.currToken.Type)
+	}
+
+	return block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	fn := &ast.FunctionLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.parseFunctionParameters(fn) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if fn.ReturnType = p.parseType(); fn.ReturnType == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	fn.Body = p.parseBlockStatement()
+
+	return fn
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	fn := &ast.FunctionLiteral{Token: macro.Token}
+	if !p.parseFunctionParameters(fn) {
+		return nil
+	}
+	if fn.Rest != nil {
+		p.errorf(fn.Rest.Token, "macros can not have a rest parameter")
+		return nil
+	}
+	macro.Parameters = make([]*ast.Identifier, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		ident, ok := param.(*ast.Identifier)
+		if !ok {
+			p.errorf(token.Token{Pos: ast.Pos(param)}, "macro parameters must be names")
+			return nil
+		}
+		if fn.ParameterTypes != nil && fn.ParameterTypes[i] != nil {
+			p.errorf(ident.Token, "macro parameters can not be annotated")
+			return nil
+		}
+		if fn.Defaults != nil && fn.Defaults[i] != nil {
+			p.errorf(ident.Token, "macro parameters can not have defaults")
+			return nil
+		}
+		macro.Parameters[i] = ident
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	macro.Body = p.parseBlockStatement()
+
+	return macro
+}
+
+// parseFunctionParameters parses the parameters of fn up to the closing
+// `)`: patterns with optional type annotations and default values, and a
+// rest parameter at the end. Parameters after one with a default must have
+// a default too.
+func (p *Parser) parseFunctionParameters(fn *ast.FunctionLiteral) bool {
+	fn.Parameters = []ast.Pattern{}
+	var types []ast.TypeExpr
+	var defaults []ast.Expression
+	annotated, defaulted, reported := false, false, false
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(fn.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+			return false
+		}
+
+		if p.peekTokenIs(token.ELLIPSIS) {
+			// the rest parameter comes last: `fn(a, ...rest)`
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			fn.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			break
+		}
+
+		param := p.parseBindingPattern()
+		if param == nil {
+			return false
+		}
+		fn.Parameters = append(fn.Parameters, param)
+
+		var typ ast.TypeExpr
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if typ = p.parseType(); typ == nil {
+				return false
+			}
+			annotated = true
+		}
+		types = append(types, typ)
+
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			if def = p.parseExpression(LOWEST); def == nil {
+				return false
+			}
+			defaulted = true
+		} else if defaulted && !reported {
+			// reported without giving up, the rest of the literal parses
+			p.errorf(token.Token{Pos: ast.Pos(param)}, "parameter %s without a default follows one with a default", param)
+			reported = true
+		}
+		defaults = append(defaults, def)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return false
+	}
+
+	if annotated {
+		fn.ParameterTypes = types
+	}
+	if defaulted {
+		fn.Defaults = defaults
+	}
+	return true
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expr := &ast.CallExpression{Token: p.currToken, Function: function}
+	p.parseCallArguments(expr)
+	return expr
+}
+
+// parseCallArguments parses the arguments of call up to the closing `)`.
+// Named arguments, `name: value`, follow the others.
+func (p *Parser) parseCallArguments(call *ast.CallExpression) {
+	call.Arguments = []ast.Expression{}
+	ok := true
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(call.Arguments)+len(call.NamedArguments) > 0 && !p.expectPeek(token.COMMA) {
+			call.Arguments = nil
+			return
+		}
+		p.nextToken()
+
+		if p.currentTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			name := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			p.nextToken()
+			p.nextToken()
+			arg := ast.NamedArgument{Name: name, Value: p.parseExpression(LOWEST)}
+			call.NamedArguments = append(call.NamedArguments, arg)
+			continue
+		}
+
+		if len(call.NamedArguments) > 0 && ok {
+			p.errorf(p.currToken, "positional argument follows named arguments")
+			ok = false
+		}
+		call.Arguments = append(call.Arguments, p.parseExpression(LOWEST))
+	}
+
+	p.nextToken()
+	if !ok {
+		call.Arguments = nil
+	}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token. The current token must be the opening delimiter.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expr := &ast.IndexExpression{Token: p.currToken, Left: left}
+
+	p.nextToken()
+	expr.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return expr
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
 const (
 	LOWEST = iota + 1
+	ASSIGN
 	EQUALS
 	LESSGREATER
 	SUM
 	PRODUCT
 	PREFIX
 	CALL
+	INDEX
 )
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -274,3 +1213,70 @@ type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
 )
+
+// parseType parses a type annotation: a type name like int, an array type
+// [T], a hash type {K: V} or a function type fn(T, U): R.
+func (p *Parser) parseType() ast.TypeExpr {
+	switch p.currToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.currToken, Name: p.currToken.Literal}
+
+	case token.LBRACKET:
+		typ := &ast.ArrayType{Token: p.currToken}
+		p.nextToken()
+		if typ.Element = p.parseType(); typ.Element == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return typ
+
+	case token.LBRACE:
+		typ := &ast.HashType{Token: p.currToken}
+		p.nextToken()
+		if typ.Key = p.parseType(); typ.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if typ.Value = p.parseType(); typ.Value == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return typ
+
+	case token.FUNCTION:
+		typ := &ast.FunctionType{Token: p.currToken, Parameters: []ast.TypeExpr{}}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		for !p.peekTokenIs(token.RPAREN) {
+			if len(typ.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			typ.Parameters = append(typ.Parameters, param)
+		}
+		p.nextToken()
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if typ.Result = p.parseType(); typ.Result == nil {
+			return nil
+		}
+		return typ
+	}
+
+	p.errorf(p.currToken, "expected a type but got %q", p.currToken.Type)
+	return nil
+}
@@ -43,10 +43,50 @@ func testLetStatement(req *require.Assertions, s ast.Statement, name string) {
 	req.Equal(s.TokenLiteral(), "let", "Expected TokenLiteral to be let")
 	letStmt, ok := s.(*ast.LetStatement)
 	req.True(ok, "s not a *ast.LetStatement")
-	req.Equal(letStmt.Name.Value, name, "letStmt.Name.Value should be equal")
+	ident, ok := letStmt.Name.(*ast.Identifier)
+	req.True(ok, "letStmt.Name not a *ast.Identifier")
+	req.Equal(ident.Value, name, "letStmt.Name.Value should be equal")
 	req.Equal(letStmt.Name.TokenLiteral(), name)
 }
 
+func TestConstStatement(t *testing.T) {
+	req := require.New(t)
+	prog := parseProgram(t, `const limit = 10; const f = fn() { limit }`)
+	req.Len(prog.Statements, 2)
+
+	stmt, ok := prog.Statements[0].(*ast.ConstStatement)
+	req.True(ok, "not a *ast.ConstStatement")
+	req.Equal("limit", stmt.Name.Value)
+	req.Equal("const limit = 10;", stmt.String())
+
+	fn := prog.Statements[1].(*ast.ConstStatement).Value.(*ast.FunctionLiteral)
+	req.Equal("f", fn.Name)
+}
+
+func TestImportExport(t *testing.T) {
+	req := require.New(t)
+	prog := parseProgram(t, `import "lib/math.mk" as math; export let a = 1; export const b = math`)
+	req.Len(prog.Statements, 3)
+
+	imp, ok := prog.Statements[0].(*ast.ImportStatement)
+	req.True(ok, "not a *ast.ImportStatement")
+	req.Equal("lib/math.mk", imp.Path.Value)
+	req.Equal("math", imp.Name.Value)
+	req.Equal(`import "lib/math.mk" as math;`, imp.String())
+
+	export, ok := prog.Statements[1].(*ast.ExportStatement)
+	req.True(ok, "not a *ast.ExportStatement")
+	req.IsType(&ast.LetStatement{}, export.Binding)
+	req.Equal("export let a = 1;", export.String())
+	req.IsType(&ast.ConstStatement{}, prog.Statements[2].(*ast.ExportStatement).Binding)
+
+	p := New(lexer.New("export fn() {}"))
+	p.ParseProgram()
+	errs := p.ErrorList()
+	req.NotEmpty(errs)
+	req.EqualError(errs[0], `1:8: expected let or const after export but got "FUNCTION"`)
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `
 return 5;
@@ -278,7 +318,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4); ((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -296,6 +336,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"3 > 5 == false",
+			"((3 > 5) == false)",
+		},
+		{
+			"1 + (2 + 3) + 4",
+			"((1 + (2 + 3)) + 4)",
+		},
+		{
+			"-(5 + 5)",
+			"(-(5 + 5))",
+		},
+		{
+			"!(true == true)",
+			"(!(true == true))",
+		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -312,3 +384,502 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		}
 	}
 }
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := New(l)
+	prog := p.ParseProgram()
+	checkParserErrors(t, p)
+	return prog
+}
+
+func TestLetAndReturnValues(t *testing.T) {
+	req := require.New(t)
+
+	prog := parseProgram(t, `let x = 5; let y = true; let add = fn(a, b) { return a + b; }; return y;`)
+	req.Len(prog.Statements, 4)
+
+	expected := []string{"5", "true", "fn(a, b) { return (a + b); }"}
+	for i, value := range expected {
+		let, ok := prog.Statements[i].(*ast.LetStatement)
+		req.True(ok, "statement %d is not *ast.LetStatement", i)
+		req.Equal(value, let.Value.String())
+	}
+
+	fn := prog.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	req.Equal("add", fn.Name)
+
+	ret := prog.Statements[3].(*ast.ReturnStatement)
+	req.Equal("y", ret.ReturnValue.String())
+
+	prog = parseProgram(t, `fn() { return; }`)
+	body := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral).Body
+	req.Len(body.Statements, 1)
+	req.Nil(body.Statements[0].(*ast.ReturnStatement).ReturnValue)
+}
+
+func TestIfExpression(t *testing.T) {
+	req := require.New(t)
+
+	prog := parseProgram(t, `if (x < y) { x } else { y; z }`)
+	req.Len(prog.Statements, 1)
+
+	expr, ok := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	req.True(ok, "expected *ast.IfExpression")
+	req.Equal("(x < y)", expr.Condition.String())
+	req.Len(expr.Consequence.Statements, 1)
+	req.NotNil(expr.Alternative)
+	req.Len(expr.Alternative.Statements, 2)
+
+	prog = parseProgram(t, `if (x) { x }`)
+	expr = prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	req.Nil(expr.Alternative)
+}
+
+func TestFunctionLiteralParameters(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		fn, ok := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("expected *ast.FunctionLiteral. got=%T", prog.Statements[0])
+		}
+
+		if len(fn.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("expected %d parameters. got=%d", len(tt.expectedParams), len(fn.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			param, ok := fn.Parameters[i].(*ast.Identifier)
+			if !ok || param.Value != ident {
+				t.Errorf("parameter %d: expected %q. got=%q", i, ident, fn.Parameters[i])
+			}
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	req := require.New(t)
+	prog := parseProgram(t, `
+let x: int = 5;
+const h: {string: [int]} = {};
+let f = fn(a: int, b, c: fn(int, bool): null): string { b };
+let g = fn(a) { a };
+`)
+	req.Len(prog.Statements, 4)
+
+	let := prog.Statements[0].(*ast.LetStatement)
+	req.IsType(&ast.NamedType{}, let.Type)
+	req.Equal("let x: int = 5;", let.String())
+
+	hash, ok := prog.Statements[1].(*ast.ConstStatement).Type.(*ast.HashType)
+	req.True(ok, "not a *ast.HashType")
+	req.Equal("string", hash.Key.String())
+	req.IsType(&ast.ArrayType{}, hash.Value)
+
+	fn := prog.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	req.Len(fn.ParameterTypes, 3)
+	req.Nil(fn.ParameterTypes[1])
+	req.IsType(&ast.FunctionType{}, fn.ParameterTypes[2])
+	req.Equal("string", fn.ReturnType.String())
+	req.Equal("fn(a: int, b, c: fn(int, bool): null): string { b }", fn.String())
+
+	fn = prog.Statements[3].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	req.Nil(fn.ParameterTypes)
+	req.Nil(fn.ReturnType)
+
+	for input, expected := range map[string]string{
+		`let x: = 5;`:            `1:8: expected a type but got "="`,
+		`fn(a: [int) {}`:         `1:11: expected token "]" but got ")"`,
+		`let f: fn(int) = 1;`:    `1:16: expected token ":" but got "="`,
+		`macro(a: int) { a }`:    `1:7: macro parameters can not be annotated`,
+		`let h: {string} = {};`:  `1:15: expected token ":" but got "}"`,
+		`fn(a): 5 { a }`:         `1:8: expected a type but got "INT"`,
+		`let y: int, string = 1`: `1:11: expected token "=" but got ","`,
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		req.NotEmpty(errs, input)
+		req.EqualError(errs[0], expected, input)
+	}
+}
+
+func TestMacroLiteral(t *testing.T) {
+	req := require.New(t)
+	prog := parseProgram(t, `macro(x, y) { x + y; }`)
+	req.Len(prog.Statements, 1)
+
+	macro, ok := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MacroLiteral)
+	req.True(ok, "not a *ast.MacroLiteral")
+	req.Len(macro.Parameters, 2)
+	req.Equal("x", macro.Parameters[0].Value)
+	req.Equal("y", macro.Parameters[1].Value)
+	req.Len(macro.Body.Statements, 1)
+	req.Equal("macro(x, y) { (x + y) }", macro.String())
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 0 => a }`, `match (x) { 0 => { a } }`},
+		{`match (x) { 0 => a, _ => b, }`, `match (x) { 0 => { a }, _ => { b } }`},
+		{`match (x) { -1 => a, "s" => b, true => c }`, `match (x) { -1 => { a }, "s" => { b }, true => { c } }`},
+		{`match (x) { n if n > 1 => n * 2, n => n }`, `match (x) { n if (n > 1) => { (n * 2) }, n => { n } }`},
+		{`match (x) { [] => 0, [a, [b, _]] => b }`, `match (x) { [] => { 0 }, [a, [b, _]] => { b } }`},
+		{`match (x) { {"kind": k, 1: [v]} => v, {} => 0 }`, `match (x) { {"kind": k, 1: [v]} => { v }, {} => { 0 } }`},
+		{`match (x) { 1 => { let y = 2; y } 2 => { 3 } }`, `match (x) { 1 => { let y = 2; y }, 2 => { 3 } }`},
+		{`let y = match (f(x)) { _ => 1 };`, `let y = match (f(x)) { _ => { 1 } };`},
+		{`match (x) {}`, `match (x) {  }`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+
+	req := require.New(t)
+	for input, expected := range map[string]string{
+		`match x { _ => 1 }`:             `1:7: expected token "(" but got "IDENT"`,
+		`match (x) { 1 => a 2 => b }`:    `1:20: expected token "," but got "INT"`,
+		`match (x) { 1 a }`:              `1:15: expected token "=>" but got "IDENT"`,
+		`match (x) { f(a) => 1 }`:        `1:14: expected token "=>" but got "("`,
+		`match (x) { {k: v} => 1 }`:      `1:14: hash pattern keys must be literals, got k`,
+		`match (x) { [1 2] => 1 }`:       `1:16: expected token "," but got "INT"`,
+		`match (x) { * => 1 }`:           `1:13: expected a pattern but got "*"`,
+		`match (x) { 1 if => 1 }`:        `1:18: no prefixParseFn for prefix "=>"`,
+		`match (x) { - "a" => 1 }`:       `1:15: expected token "INT" but got "STRING"`,
+		`match (x) { {"a" 1} => 1 }`:     `1:18: expected token ":" but got "INT"`,
+		`match (x) { 1 => a, 2 => b c }`: `1:28: expected token "," but got "IDENT"`,
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		req.NotEmpty(errs, input)
+		req.EqualError(errs[0], expected, input)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = x;`, `let [a, b] = x;`},
+		{`let [a, ...rest] = x;`, `let [a, ...rest] = x;`},
+		{`let [_, [b], ..._] = x;`, `let [_, [b], ..._] = x;`},
+		{`let {name, age} = p;`, `let {name, age} = p;`},
+		{`let {"first name": first, 1: [one]} = p;`, `let {"first name": first, 1: [one]} = p;`},
+		{`let [a, b]: [int] = x;`, `let [a, b]: [int] = x;`},
+		{`fn([a, b], {c}, d) { a }`, `fn([a, b], {c}, d) { a }`},
+		{`match (x) { [a, ...r] => r, {k} => k }`, `match (x) { [a, ...r] => { r }, {k} => { k } }`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+
+	req := require.New(t)
+	for input, expected := range map[string]string{
+		`let [a, 1] = x;`:     `1:9: cannot use literal 1 in a binding pattern`,
+		`let {"a": "b"} = x;`: `1:11: cannot use literal b in a binding pattern`,
+		`let [...r, a] = x;`:  `1:10: expected token "]" but got ","`,
+		`let [...1] = x;`:     `1:9: expected token "IDENT" but got "INT"`,
+		`let {_} = x;`:        `1:6: hash pattern keys must be literals, got _`,
+		`fn(a, [1]) { a }`:    `1:8: cannot use literal 1 in a binding pattern`,
+		`macro([a]) { a }`:    `1:7: macro parameters must be names`,
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		req.NotEmpty(errs, input)
+		req.EqualError(errs[0], expected, input)
+	}
+}
+
+func TestParameterDefaultsAndNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b = 2) { a }`, `fn(a, b = 2) { a }`},
+		{`fn(a, b = a * 2, c = "s") { a }`, `fn(a, b = (a * 2), c = "s") { a }`},
+		{`fn(first, ...others) { others }`, `fn(first, ...others) { others }`},
+		{`fn(...all) { all }`, `fn(...all) { all }`},
+		{`fn(a: int = 1, [b] = [2], ...r) { a }`, `fn(a: int = 1, [b] = [2], ...r) { a }`},
+		{`f(b: 3)`, `f(b: 3)`},
+		{`f(1, c: x + 1, b: 2)`, `f(1, c: (x + 1), b: 2)`},
+		{`f(g(a: 1))`, `f(g(a: 1))`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+
+	fn := parseProgram(t, `fn(a, b = 2, ...r) { a }`).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	require.Len(t, fn.Defaults, 2)
+	require.Nil(t, fn.Defaults[0])
+	require.Equal(t, "2", fn.Defaults[1].String())
+	require.Equal(t, "r", fn.Rest.Value)
+
+	req := require.New(t)
+	for input, expected := range map[string]string{
+		`fn(a = 1, b) { a }`:     `1:11: parameter b without a default follows one with a default`,
+		`fn(...r, a) { a }`:      `1:8: expected token ")" but got ","`,
+		`fn(...[a]) { a }`:       `1:7: expected token "IDENT" but got "["`,
+		`f(a: 1, 2)`:             `1:9: positional argument follows named arguments`,
+		`macro(a = 1) { a }`:     `1:7: macro parameters can not have defaults`,
+		`macro(a, ...r) { a }`:   `1:13: macros can not have a rest parameter`,
+		`let m = fn(a b) { a };`: `1:14: expected token "," but got "IDENT"`,
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		req.NotEmpty(errs, input)
+		req.EqualError(errs[0], expected, input)
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	req := require.New(t)
+
+	prog := parseProgram(t, "99999999999999999999; 12.50; -0.5;")
+	big, ok := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.BigIntegerLiteral)
+	req.True(ok)
+	req.Equal("99999999999999999999", big.Value.String())
+
+	dec, ok := prog.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.DecimalLiteral)
+	req.True(ok)
+	req.Equal("1250", dec.Unscaled.String())
+	req.Equal(2, dec.Scale)
+	req.Equal("1:23", ast.Pos(dec).String())
+
+	req.Equal("(-0.5)", prog.Statements[2].String())
+
+	prog = parseProgram(t, `match (x) { -1.5 => a, 2.0 => b, 99999999999999999999 => c, {1.5: d} => d }`)
+	req.Equal("match (x) { -1.5 => { a }, 2.0 => { b }, 99999999999999999999 => { c }, {1.5: d} => { d } }", prog.String())
+	arm := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression).Arms[0]
+	neg, ok := arm.Pattern.(*ast.DecimalLiteral)
+	req.True(ok)
+	req.Equal("-15", neg.Unscaled.String())
+
+	p := New(lexer.New("let [a, 1.5] = x;"))
+	p.ParseProgram()
+	req.NotEmpty(p.ErrorList())
+	req.EqualError(p.ErrorList()[0], "1:9: cannot use literal 1.5 in a binding pattern")
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`plain`", "`plain`"},
+		{"``", "``"},
+		{"`${n} items`", "`${n} items`"},
+		{"`a ${x + 1} b ${f(y)}`", "`a ${(x + 1)} b ${f(y)}`"},
+		{"`${ {\"k\": `in ${v}`}[\"k\"] }`", "`${({\"k\": `in ${v}`}[\"k\"])}`"},
+		{"`\\` \\${x} \\\\`", "`\\` \\${x} \\\\`"},
+		{"`a` + b", "(`a` + b)"},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+
+	req := require.New(t)
+	prog := parseProgram(t, "let s = `x ${a}${b + c}`;")
+	lit, ok := prog.Statements[0].(*ast.LetStatement).Value.(*ast.TemplateLiteral)
+	req.True(ok)
+	req.Len(lit.Parts, 5)
+	for i, expected := range []string{`"x "`, "a", `""`, "(b + c)", `""`} {
+		req.Equal(expected, lit.Parts[i].String())
+	}
+	req.Equal("1:14", ast.Pos(lit.Parts[1]).String())
+	req.Equal("1:18", ast.Pos(lit.Parts[3]).String())
+
+	for input, expected := range map[string]string{
+		"`open ${a}":    "1:1: unterminated template literal",
+		"`a ${} b`":     "1:6: empty interpolation in template literal",
+		"`a ${b c} d`":  `1:8: expected token "}" but got "IDENT"`,
+		"let x = `${`;": "1:12: unterminated template literal",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		req.NotEmpty(errs, input)
+		req.EqualError(errs[0], expected, input)
+	}
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello world"`, `"hello world"`},
+		{`[]`, `[]`},
+		{`[1, 2 * 2, "three"]`, `[1, (2 * 2), "three"]`},
+		{`{}`, `{}`},
+		{`{"one": 1, "two": 1 + 1, true: x}`, `{"one": 1, "two": (1 + 1), true: x}`},
+		{`myArray[1 + 1]`, `(myArray[(1 + 1)])`},
+		{`h["a"]["b"]`, `((h["a"])["b"])`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "x";`, `throw "x";`},
+		{`try { a } catch (e) { e }`, `try { a } catch (e) { e }`},
+		{`try { a } catch { b }`, `try { a } catch { b }`},
+		{`try { a } finally { b }`, `try { a } finally { b }`},
+		{`let x = try { a } catch (e) { b } finally { c };`, `let x = try { a } catch (e) { b } finally { c };`},
+		{`fn() { throw f(1) }`, `fn() { throw f(1); }`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`while (x < 10) { f(x) }`, `while (x < 10) { f(x) }`},
+		{`for (x in range(3)) { if (x) { break; } continue; }`, `for (x in range(3)) { if (x) { break; }; continue; }`},
+		{`for (k in {"a": 1}) { k }`, `for (k in {"a": 1}) { k }`},
+		{`while (x) { x }; for (k in x) { k }; x`, `while (x) { x }; for (k in x) { k }; x`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestStringReparses(t *testing.T) {
+	inputs := []string{
+		`fn(a, b) { a; b; puts(a) }`,
+		`let f = fn(x) { if (x > 1) { x } else { -x } }; f(2); -1`,
+		`if (x) { 1 } else { let y = 2; y }`,
+		`while (!done) { step() }; for (k in h) { if (k) { break; } continue; }; k`,
+		`try { f() } catch (e) { e; 1 } finally { g() }`,
+		`match (x) { [a] if a => { a; a }, _ => 0 }`,
+	}
+
+	for _, input := range inputs {
+		printed := parseProgram(t, input).String()
+		if reparsed := parseProgram(t, printed).String(); reparsed != printed {
+			t.Errorf("%s: printed %q, reprinted %q", input, printed, reparsed)
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x = 1`, `(x = 1)`},
+		{`x = y = 1 + 2`, `(x = (y = (1 + 2)))`},
+		{`a[0] += b * 2`, `((a[0]) += (b * 2))`},
+		{`h["k"]["j"] -= 1`, `(((h["k"])["j"]) -= 1)`},
+		{`x *= 2; x /= 2;`, `(x *= 2); (x /= 2)`},
+		{`f(x = 1)`, `f((x = 1))`},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input)
+		if actual := prog.String(); actual != tt.expected {
+			t.Errorf("expected %q. got=%q", tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New("f() = 1"))
+	p.ParseProgram()
+	errs := p.ErrorList()
+	if len(errs) == 0 || errs[0].Error() != "1:5: cannot assign to f()" {
+		t.Errorf("wrong errors. got=%v", errs)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []string{
+		"let = 5;",
+		"if (x { x }",
+		"fn(a, 1) {}",
+		`{"a" 1}`,
+		"{ x",
+		"try { x }",
+		"try { x } catch (1) { x }",
+		"throw;",
+		"while x { x }",
+		"for (1 in x) { x }",
+		"for (x of y) { x }",
+		"const x;",
+		"const = 1",
+		"import math",
+		`import "math" math`,
+		`import "math" as 1`,
+		"export 1",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors for %q", input)
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	p := New(lexer.New("let a = 1;\nlet = 5;"))
+	p.ParseProgram()
+
+	errs := p.ErrorList()
+	if len(errs) == 0 {
+		t.Fatalf("expected errors")
+	}
+	if got := errs[0].Error(); got != `2:5: expected token "IDENT" but got "="` {
+		t.Errorf("wrong error. got=%q", got)
+	}
+}
@@ -2,32 +2,89 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/highlight"
 	"github.com/riadafridishibly/go-monkey/lexer"
-	"github.com/riadafridishibly/go-monkey/token"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/report"
+	"github.com/riadafridishibly/go-monkey/vm"
 )
 
 const PROMPT = ">> "
 
+// Start reads programs line by line and runs them on the virtual machine.
+// Globals and macros defined on one line stay visible on the following ones. Lines are
+// numbered from the start of the session, so errors can show the lines of
+// the functions they were raised in.
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
+	var history []string
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	macroEnv := object.NewEnvironment()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
 
 	for {
-		fmt.Print(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 
 		if !scanned {
 			return
 		}
 
-		line := scanner.Text()
+		history = append(history, scanner.Text())
+		src := strings.Join(history, "\n")
+
+		l := lexer.New(scanner.Text())
+		l.SetLine(len(history))
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if errs := p.ErrorList(); len(errs) != 0 {
+			report.Print(out, "", src, errs)
+			continue
+		}
+
+		// macros may only call pure builtins, within the default limits
+		macroEnv.SetLimiter(evaluator.NewLimiter(context.Background(), evaluator.Limits{}))
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			report.Print(out, "", src, err)
+			continue
+		}
+		program = expanded.(*ast.Program)
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			report.Print(out, "", src, err)
+			continue
+		}
 
-		lex := lexer.New(line)
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, globals)
+		machine.SetOutput(out)
+		if err := machine.Run(); err != nil {
+			report.Print(out, "", src, err)
+			continue
+		}
 
-		for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
-			fmt.Printf("%#v\n", tok)
+		if last := machine.LastPoppedStackElem(); last != nil {
+			highlight.ANSI(out, last.Inspect())
+			fmt.Fprintln(out)
 		}
 	}
 }
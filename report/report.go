@@ -0,0 +1,137 @@
+// Package report prints the errors of Monkey programs with excerpts of the
+// source they refer to:
+//
+//	TypeError: type mismatch: INTEGER + BOOLEAN
+//	  at add (script.mk:2:5)
+//	    2 |   a + b
+//	      |     ^
+//	  at <main> (script.mk:4:4)
+//	    4 | add(1, true)
+//	      |    ^
+//
+// Syntax, macro, type and compile errors are printed the same way, with a single
+// location.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/token"
+	"github.com/riadafridishibly/go-monkey/typecheck"
+	"github.com/riadafridishibly/go-monkey/vm"
+)
+
+// Location is a source span an error refers to, with the name of the
+// function executing there, if any.
+type Location struct {
+	Function string
+	Pos, End token.Position
+}
+
+// Print writes err to w. Errors of the parser, the macro expander, the type
+// checker, the compiler and the virtual machine are printed with excerpts of src, which
+// may be empty when the source is not available. filename names the source
+// in locations; it may be empty too. Other errors are printed as they are.
+func Print(w io.Writer, filename, src string, err error) {
+	var (
+		syntaxErrs parser.ErrorList
+		compileErr *compiler.Error
+		macroErr   *evaluator.MacroError
+		typeErrs   typecheck.ErrorList
+		runtimeErr *vm.Error
+	)
+
+	switch {
+	case errors.As(err, &syntaxErrs):
+		for _, e := range syntaxErrs {
+			Write(w, filename, src, "SyntaxError", e.Msg, Location{Pos: e.Pos, End: e.End})
+		}
+	case errors.As(err, &compileErr):
+		Write(w, filename, src, "CompileError", compileErr.Msg, Location{Pos: compileErr.Pos})
+	case errors.As(err, &macroErr):
+		Write(w, filename, src, "MacroError", macroErr.Msg, Location{Pos: macroErr.Pos})
+	case errors.As(err, &typeErrs):
+		for _, e := range typeErrs {
+			Write(w, filename, src, "TypeError", e.Msg, Location{Pos: e.Pos, End: e.End})
+		}
+	case errors.As(err, &runtimeErr):
+		trace := make([]Location, len(runtimeErr.Trace))
+		for i, entry := range runtimeErr.Trace {
+			trace[i] = Location{Function: entry.Function, Pos: entry.Pos, End: entry.End}
+		}
+		Write(w, filename, src, string(runtimeErr.Kind), runtimeErr.Message, trace...)
+	default:
+		fmt.Fprintln(w, err)
+	}
+}
+
+// Write writes an error of the given kind and message, followed by each of
+// the locations with an excerpt of src.
+func Write(w io.Writer, filename, src, kind, msg string, locations ...Location) {
+	fmt.Fprintf(w, "%s: %s\n", kind, msg)
+
+	lines := strings.Split(src, "\n")
+	width := 0
+	for _, loc := range locations {
+		if n := len(fmt.Sprint(loc.Pos.Line)); n > width {
+			width = n
+		}
+	}
+
+	for _, loc := range locations {
+		where := loc.Pos.String()
+		if filename != "" {
+			where = filename + ":" + where
+		}
+
+		switch {
+		case !loc.Pos.IsValid() && loc.Function != "":
+			fmt.Fprintf(w, "  at %s\n", loc.Function)
+			continue
+		case !loc.Pos.IsValid():
+			continue
+		case loc.Function != "":
+			fmt.Fprintf(w, "  at %s (%s)\n", loc.Function, where)
+		default:
+			fmt.Fprintf(w, "  at %s\n", where)
+		}
+
+		if src == "" || loc.Pos.Line > len(lines) {
+			continue
+		}
+		line := strings.TrimRight(lines[loc.Pos.Line-1], "\r")
+		fmt.Fprintf(w, "    %*d | %s\n", width, loc.Pos.Line, line)
+		fmt.Fprintf(w, "    %*s | %s\n", width, "", marker(line, loc.Pos, loc.End))
+	}
+}
+
+// marker returns the line of carets under the span from pos to end of line.
+// Tabs before the span are kept so that the carets line up with the source.
+func marker(line string, pos, end token.Position) string {
+	start := pos.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+
+	var sb strings.Builder
+	for _, c := range line[:start] {
+		if c == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+
+	n := 1
+	if end.Line == pos.Line && end.Column > pos.Column {
+		n = end.Column - pos.Column
+	}
+	sb.WriteString(strings.Repeat("^", n))
+	return sb.String()
+}
@@ -0,0 +1,149 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/token"
+	"github.com/riadafridishibly/go-monkey/typecheck"
+	"github.com/riadafridishibly/go-monkey/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, src string) error {
+	t.Helper()
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		return errs
+	}
+	prog, err := evaluator.Expand(prog)
+	if err != nil {
+		return err
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(prog); err != nil {
+		return err
+	}
+	return vm.New(comp.Bytecode()).Run()
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			"let add = fn(a, b) {\n\ta + b\n};\nlet f = fn(x) { add(x, true) };\nf(1);",
+			`TypeError: type mismatch: INTEGER + BOOLEAN
+  at add (test.mk:2:4)
+    2 | 	a + b
+      | 	  ^
+  at f (test.mk:4:20)
+    4 | let f = fn(x) { add(x, true) };
+      |                    ^
+  at <main> (test.mk:5:2)
+    5 | f(1);
+      |  ^
+`,
+		},
+		{
+			"map([1], fn(x) { x / 0 })",
+			`ArithmeticError: division by zero
+  at <anonymous> (test.mk:1:20)
+    1 | map([1], fn(x) { x / 0 })
+      |                    ^
+  at <main> (test.mk:1:4)
+    1 | map([1], fn(x) { x / 0 })
+      |    ^
+`,
+		},
+		{
+			"let x 5;\nlet y = <;",
+			`SyntaxError: expected token "=" but got "INT"
+  at test.mk:1:7
+    1 | let x 5;
+      |       ^
+SyntaxError: no prefixParseFn for prefix "<"
+  at test.mk:2:9
+    2 | let y = <;
+      |         ^
+`,
+		},
+		{
+			"let a = 1;\nlet b = missing;",
+			`CompileError: undefined variable missing
+  at test.mk:2:9
+    2 | let b = missing;
+      |         ^
+`,
+		},
+		{
+			"let twice = macro(x) { quote(unquote(x) * 2) };\ntwice(1, 2);",
+			`MacroError: macro twice: wrong number of arguments: want=1, got=2
+  at test.mk:2:1
+    2 | twice(1, 2);
+      | ^
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		Print(&buf, "test.mk", tt.src, run(t, tt.src))
+		require.Equal(t, tt.expected, buf.String(), tt.src)
+	}
+}
+
+func TestPrintWithoutSource(t *testing.T) {
+	var buf bytes.Buffer
+	Print(&buf, "", "", run(t, "let f = fn() { -true }; f()"))
+	require.Equal(t, "TypeError: unknown operator: -BOOLEAN\n  at f (1:16)\n  at <main> (1:26)\n", buf.String())
+
+	buf.Reset()
+	Print(&buf, "test.mk", "", errors.New("open test.mk: no such file"))
+	require.Equal(t, "open test.mk: no such file\n", buf.String())
+}
+
+func TestPrintTypeErrors(t *testing.T) {
+	src := "let x: int = 1;\nx + \"s\";\nx = true;"
+	p := parser.New(lexer.New(src))
+	_, errs := typecheck.Check(p.ParseProgram())
+
+	var buf bytes.Buffer
+	Print(&buf, "test.mk", src, errs)
+	require.Equal(t, `TypeError: type mismatch: int + string
+  at test.mk:2:1
+    2 | x + "s";
+      | ^^^^^^^
+TypeError: cannot assign bool to x of type int
+  at test.mk:3:5
+    3 | x = true;
+      |     ^^^^
+`, buf.String())
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	src := "1\n2\n3\n4\n5\n6\n7\n8\n9\nten + 1"
+	loc := Location{
+		Function: "g",
+		Pos:      token.Position{Offset: 18, Line: 10, Column: 1},
+		End:      token.Position{Offset: 21, Line: 10, Column: 4},
+	}
+
+	Write(&buf, "", src, "Error", "boom", Location{Function: "native"}, loc)
+	require.Equal(t, `Error: boom
+  at native
+  at g (10:1)
+    10 | ten + 1
+       | ^^^
+`, buf.String())
+}
@@ -0,0 +1,369 @@
+// Package resolver links every identifier of a Monkey program to the let
+// statement or function parameter that declares it.
+//
+// The program, every function literal and every block statement open a new
+// lexical scope; the parameters of a function live in the scope of its body,
+// and the names bound by the pattern of a match arm in the scope of its
+// body.
+// A let name is visible in its own value, so functions can call themselves.
+// Declaring a name again in the same scope replaces the earlier binding for
+// the statements that follow.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// ScopeKind tells which construct opened a scope.
+type ScopeKind int
+
+const (
+	UniverseScope ScopeKind = iota // predeclared names
+	ProgramScope
+	FunctionScope
+	BlockScope
+)
+
+var scopeKindNames = [...]string{
+	UniverseScope: "universe",
+	ProgramScope:  "program",
+	FunctionScope: "function",
+	BlockScope:    "block",
+}
+
+func (k ScopeKind) String() string { return scopeKindNames[k] }
+
+// SymbolKind tells how a name was declared.
+type SymbolKind int
+
+const (
+	Predeclared SymbolKind = iota
+	Let
+	Param
+	CatchParam
+	LoopVar
+	Const
+	Import
+	MatchVar
+)
+
+var symbolKindNames = [...]string{
+	Predeclared: "predeclared",
+	Let:         "let",
+	Param:       "param",
+	CatchParam:  "catch",
+	LoopVar:     "loop",
+	Const:       "const",
+	Import:      "import",
+	MatchVar:    "match",
+}
+
+func (k SymbolKind) String() string { return symbolKindNames[k] }
+
+// Symbol is a single declaration.
+type Symbol struct {
+	Name  string
+	Kind  SymbolKind
+	Scope *Scope
+
+	// Decl is the statement or expression declaring the symbol, such as an
+	// *ast.LetStatement, an *ast.FunctionLiteral or an *ast.MatchExpression;
+	// nil for predeclared names.
+	Decl ast.Node
+	// Ident is the identifier being declared; nil for predeclared names.
+	Ident *ast.Identifier
+
+	// Uses lists the identifiers referring to the symbol in source order.
+	Uses []*ast.Identifier
+	// Captured is set when the symbol is used from a function nested in
+	// the function (or program) declaring it.
+	Captured bool
+	// Assigned is set when the symbol is the target of an assignment.
+	Assigned bool
+	// Shadows is the symbol of an enclosing scope that this declaration
+	// hides, if any.
+	Shadows *Symbol
+}
+
+// Pos returns the position of the declaring identifier.
+func (sym *Symbol) Pos() token.Position {
+	if sym.Ident == nil {
+		return token.Position{}
+	}
+	return sym.Ident.Token.Pos
+}
+
+// Scope is a lexical scope.
+type Scope struct {
+	Kind     ScopeKind
+	Node     ast.Node // *ast.Program, *ast.FunctionLiteral or *ast.BlockStatement
+	Outer    *Scope
+	Children []*Scope
+	Symbols  []*Symbol // in declaration order, including replaced ones
+
+	names map[string]*Symbol
+}
+
+func newScope(kind ScopeKind, node ast.Node, outer *Scope) *Scope {
+	s := &Scope{Kind: kind, Node: node, Outer: outer, names: map[string]*Symbol{}}
+	if outer != nil {
+		outer.Children = append(outer.Children, s)
+	}
+	return s
+}
+
+// LookupLocal returns the symbol currently bound to name in s itself.
+func (s *Scope) LookupLocal(name string) *Symbol {
+	return s.names[name]
+}
+
+// Lookup returns the symbol currently bound to name in s or its enclosing
+// scopes. After Resolve returns, "currently" means at the end of each scope.
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Outer {
+		if sym, ok := s.names[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Function returns the innermost function or program scope enclosing s.
+func (s *Scope) Function() *Scope {
+	for s.Kind == BlockScope {
+		s = s.Outer
+	}
+	return s
+}
+
+func (s *Scope) declare(sym *Symbol) {
+	sym.Scope = s
+	if s.Outer != nil {
+		sym.Shadows = s.Outer.Lookup(sym.Name)
+	}
+	s.names[sym.Name] = sym
+	s.Symbols = append(s.Symbols, sym)
+}
+
+// Error reports the use of an undeclared name.
+type Error struct {
+	Pos  token.Position
+	Name string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: undefined: %s", e.Pos, e.Name)
+}
+
+// Info is the symbol table of a program.
+type Info struct {
+	Universe *Scope
+	Program  *Scope
+
+	// Defs maps declaring identifiers to their symbols.
+	Defs map[*ast.Identifier]*Symbol
+	// Uses maps referring identifiers to their symbols. Undefined names
+	// are missing.
+	Uses map[*ast.Identifier]*Symbol
+	// Scopes maps the *ast.Program, *ast.FunctionLiteral and
+	// *ast.BlockStatement nodes to the scopes they open.
+	Scopes map[ast.Node]*Scope
+
+	// Errors lists the undefined names in source order.
+	Errors []*Error
+
+	symbols []*Symbol
+}
+
+// SymbolOf returns the symbol an identifier declares or refers to.
+func (info *Info) SymbolOf(ident *ast.Identifier) *Symbol {
+	if sym, ok := info.Defs[ident]; ok {
+		return sym
+	}
+	return info.Uses[ident]
+}
+
+// Symbols returns every symbol declared by the program in declaration order.
+func (info *Info) Symbols() []*Symbol {
+	return info.symbols
+}
+
+// Resolve builds the symbol table of prog. The predeclared names, such as
+// builtins and host globals, are visible everywhere and are never undefined.
+func Resolve(prog *ast.Program, predeclared ...string) *Info {
+	info := &Info{
+		Defs:   map[*ast.Identifier]*Symbol{},
+		Uses:   map[*ast.Identifier]*Symbol{},
+		Scopes: map[ast.Node]*Scope{},
+	}
+
+	info.Universe = newScope(UniverseScope, nil, nil)
+	for _, name := range predeclared {
+		info.Universe.declare(&Symbol{Name: name, Kind: Predeclared})
+	}
+
+	r := &resolver{info: info}
+	info.Program = r.open(ProgramScope, prog, info.Universe)
+	r.statements(info.Program, prog.Statements)
+
+	return info
+}
+
+type resolver struct {
+	info *Info
+}
+
+func (r *resolver) open(kind ScopeKind, node ast.Node, outer *Scope) *Scope {
+	s := newScope(kind, node, outer)
+	r.info.Scopes[node] = s
+	return s
+}
+
+func (r *resolver) declare(s *Scope, kind SymbolKind, decl ast.Node, ident *ast.Identifier) {
+	sym := &Symbol{Name: ident.Value, Kind: kind, Decl: decl, Ident: ident}
+	s.declare(sym)
+	r.info.Defs[ident] = sym
+	r.info.symbols = append(r.info.symbols, sym)
+}
+
+func (r *resolver) use(s *Scope, ident *ast.Identifier) {
+	sym := s.Lookup(ident.Value)
+	if sym == nil {
+		r.info.Errors = append(r.info.Errors, &Error{Pos: ident.Token.Pos, Name: ident.Value})
+		return
+	}
+
+	sym.Uses = append(sym.Uses, ident)
+	r.info.Uses[ident] = sym
+	if sym.Kind != Predeclared && sym.Scope.Function() != s.Function() {
+		sym.Captured = true
+	}
+}
+
+func (r *resolver) statements(s *Scope, list []ast.Statement) {
+	for _, stmt := range list {
+		r.statement(s, stmt)
+	}
+}
+
+func (r *resolver) statement(s *Scope, stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if ident, ok := stmt.Name.(*ast.Identifier); ok {
+			// declared first, so that functions can refer to themselves
+			r.declare(s, Let, stmt, ident)
+			r.expression(s, stmt.Value)
+			break
+		}
+		r.expression(s, stmt.Value)
+		for _, name := range ast.PatternNames(stmt.Name) {
+			r.declare(s, Let, stmt, name)
+		}
+	case *ast.ConstStatement:
+		r.declare(s, Const, stmt, stmt.Name)
+		r.expression(s, stmt.Value)
+	case *ast.ImportStatement:
+		r.declare(s, Import, stmt, stmt.Name)
+	case *ast.ExportStatement:
+		r.statement(s, stmt.Binding)
+	case *ast.ReturnStatement:
+		r.expression(s, stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		r.expression(s, stmt.Value)
+	case *ast.WhileStatement:
+		r.expression(s, stmt.Condition)
+		r.statement(s, stmt.Body)
+	case *ast.ForStatement:
+		r.expression(s, stmt.Iterable)
+		body := r.open(BlockScope, stmt.Body, s)
+		r.declare(body, LoopVar, stmt, stmt.Variable)
+		r.statements(body, stmt.Body.Statements)
+	case *ast.ExpressionStatement:
+		r.expression(s, stmt.Expression)
+	case *ast.BlockStatement:
+		r.statements(r.open(BlockScope, stmt, s), stmt.Statements)
+	}
+}
+
+func (r *resolver) expression(s *Scope, expr ast.Expression) {
+	switch expr := expr.(type) {
+	case nil:
+		// missing return value
+	case *ast.Identifier:
+		r.use(s, expr)
+	case *ast.FunctionLiteral:
+		fn := r.open(FunctionScope, expr, s)
+		r.info.Scopes[expr.Body] = fn
+		for i, p := range expr.Parameters {
+			if expr.Defaults != nil {
+				// defaults see the parameters before them
+				r.expression(fn, expr.Defaults[i])
+			}
+			for _, name := range ast.PatternNames(p) {
+				r.declare(fn, Param, expr, name)
+			}
+		}
+		if expr.Rest != nil {
+			r.declare(fn, Param, expr, expr.Rest)
+		}
+		r.statements(fn, expr.Body.Statements)
+	case *ast.CallExpression:
+		r.expression(s, expr.Function)
+		for _, arg := range expr.Arguments {
+			r.expression(s, arg)
+		}
+		for _, arg := range expr.NamedArguments {
+			r.expression(s, arg.Value)
+		}
+	case *ast.IfExpression:
+		r.expression(s, expr.Condition)
+		r.statement(s, expr.Consequence)
+		if expr.Alternative != nil {
+			r.statement(s, expr.Alternative)
+		}
+	case *ast.AssignExpression:
+		r.expression(s, expr.Target)
+		if ident, ok := expr.Target.(*ast.Identifier); ok {
+			if sym := r.info.Uses[ident]; sym != nil {
+				sym.Assigned = true
+			}
+		}
+		r.expression(s, expr.Value)
+	case *ast.TryExpression:
+		r.statement(s, expr.Block)
+		if expr.Catch != nil {
+			catch := r.open(BlockScope, expr.Catch, s)
+			if expr.CatchParam != nil {
+				r.declare(catch, CatchParam, expr, expr.CatchParam)
+			}
+			r.statements(catch, expr.Catch.Statements)
+		}
+		if expr.Finally != nil {
+			r.statement(s, expr.Finally)
+		}
+	case *ast.MatchExpression:
+		r.expression(s, expr.Subject)
+		for _, arm := range expr.Arms {
+			body := r.open(BlockScope, arm.Body, s)
+			for _, name := range ast.PatternNames(arm.Pattern) {
+				r.declare(body, MatchVar, expr, name)
+			}
+			r.expression(body, arm.Guard)
+			r.statements(body, arm.Body.Statements)
+		}
+	default:
+		// every other expression only has sub-expressions as children
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if n == nil || n == ast.Node(expr) {
+				return true
+			}
+			if sub, ok := n.(ast.Expression); ok {
+				r.expression(s, sub)
+			}
+			return false
+		})
+	}
+}
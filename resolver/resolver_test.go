@@ -0,0 +1,273 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	return prog
+}
+
+// identifiers returns the identifiers of prog named name in source order.
+func identifiers(prog *ast.Program, name string) []*ast.Identifier {
+	var idents []*ast.Identifier
+	ast.Inspect(prog, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Value == name {
+			idents = append(idents, ident)
+		}
+		return true
+	})
+	return idents
+}
+
+func TestResolveUses(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `
+let x = 1;
+let f = fn(x, y) {
+	if (y) { let x = 2; x } else { x }
+};
+f(x, 2);
+`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	xs := identifiers(prog, "x")
+	req.Len(xs, 6)
+
+	global := info.SymbolOf(xs[0])
+	param := info.SymbolOf(xs[1])
+	block := info.SymbolOf(xs[2])
+
+	req.Equal(Let, global.Kind)
+	req.Equal(ProgramScope, global.Scope.Kind)
+	req.IsType(&ast.LetStatement{}, global.Decl)
+
+	req.Equal(Param, param.Kind)
+	req.Equal(FunctionScope, param.Scope.Kind)
+	req.IsType(&ast.FunctionLiteral{}, param.Decl)
+	req.Equal(global, param.Shadows)
+
+	req.Equal(BlockScope, block.Scope.Kind)
+	req.Equal(param, block.Shadows)
+
+	req.Equal(block, info.SymbolOf(xs[3]))
+	req.Equal(param, info.SymbolOf(xs[4]))
+	req.Equal(global, info.SymbolOf(xs[5]))
+
+	req.Len(global.Uses, 1)
+	req.Len(param.Uses, 1)
+	req.False(global.Captured)
+}
+
+func TestResolveScopes(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let f = fn(a) { if (a) { a } };`)
+	info := Resolve(prog)
+
+	fn := prog.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	ifExpr := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+
+	req.Equal(info.Program, info.Scopes[prog])
+	req.Equal(info.Scopes[fn], info.Scopes[fn.Body])
+	req.Equal(info.Scopes[fn], info.Scopes[ifExpr.Consequence].Outer)
+	req.Equal(info.Scopes[fn], info.Scopes[ifExpr.Consequence].Function())
+	req.Equal([]*Scope{info.Scopes[fn]}, info.Program.Children)
+	req.NotNil(info.Scopes[fn].LookupLocal("a"))
+	req.Nil(info.Scopes[fn].LookupLocal("f"))
+	req.NotNil(info.Scopes[fn].Lookup("f"))
+}
+
+func TestResolveCatchParam(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let e = 1; try { e } catch (e) { e } finally { e };`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	es := identifiers(prog, "e")
+	req.Len(es, 5)
+
+	global := info.SymbolOf(es[0])
+	param := info.SymbolOf(es[2])
+	req.Equal(CatchParam, param.Kind)
+	req.Equal(BlockScope, param.Scope.Kind)
+	req.Equal(global, param.Shadows)
+
+	req.Equal(global, info.SymbolOf(es[1]))
+	req.Equal(param, info.SymbolOf(es[3]))
+	req.Equal(global, info.SymbolOf(es[4]))
+}
+
+func TestResolveMatchVar(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let x = 1; match (x) { [x] if x => x, _ => x };`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	xs := identifiers(prog, "x")
+	req.Len(xs, 6)
+
+	global := info.SymbolOf(xs[0])
+	bound := info.SymbolOf(xs[2])
+	req.Equal(MatchVar, bound.Kind)
+	req.Equal(BlockScope, bound.Scope.Kind)
+	req.Equal(global, bound.Shadows)
+
+	req.Equal(global, info.SymbolOf(xs[1]))
+	req.Equal(bound, info.SymbolOf(xs[3]))
+	req.Equal(bound, info.SymbolOf(xs[4]))
+	req.Equal(global, info.SymbolOf(xs[5]))
+}
+
+func TestResolveDefaultsAndNamedArguments(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let b = 1; let f = fn(a = b, b = a, ...r) { r }; f(b: b)`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	bs := identifiers(prog, "b")
+	req.Len(bs, 5)
+	global := info.SymbolOf(bs[0])
+	req.Equal(global, info.SymbolOf(bs[1]))
+	req.Equal(Param, info.SymbolOf(bs[2]).Kind)
+	req.Nil(info.SymbolOf(bs[3]), "the name of a named argument is not a use")
+	req.Equal(global, info.SymbolOf(bs[4]))
+	req.Len(global.Uses, 2)
+
+	as := identifiers(prog, "a")
+	req.Equal(info.SymbolOf(as[0]), info.SymbolOf(as[1]))
+
+	rs := identifiers(prog, "r")
+	req.Equal(Param, info.SymbolOf(rs[0]).Kind)
+	req.Equal(info.SymbolOf(rs[0]), info.SymbolOf(rs[1]))
+}
+
+func TestResolveLoopVar(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let x = [1]; for (x in x) { x } while (x) { let x = 1; x }`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	xs := identifiers(prog, "x")
+	req.Len(xs, 7)
+
+	global := info.SymbolOf(xs[0])
+	loopVar := info.SymbolOf(xs[1])
+	req.Equal(LoopVar, loopVar.Kind)
+	req.Equal(BlockScope, loopVar.Scope.Kind)
+	req.Equal(global, info.SymbolOf(xs[2]))
+	req.Equal(loopVar, info.SymbolOf(xs[3]))
+	req.Equal(global, info.SymbolOf(xs[4]))
+	req.Equal(info.SymbolOf(xs[5]), info.SymbolOf(xs[6]))
+	req.Equal(global, info.SymbolOf(xs[5]).Shadows)
+}
+
+func TestResolveAssigned(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let a = 1; let b = [a]; let f = fn() { a += 1; b[0] = 2 };`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	a := info.SymbolOf(identifiers(prog, "a")[0])
+	b := info.SymbolOf(identifiers(prog, "b")[0])
+	req.True(a.Assigned)
+	req.True(a.Captured)
+	req.False(b.Assigned)
+	req.Len(a.Uses, 2)
+}
+
+func TestResolveConst(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `const a = 1; let f = fn() { const b = a; b };`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	a := info.SymbolOf(identifiers(prog, "a")[0])
+	b := info.SymbolOf(identifiers(prog, "b")[0])
+	req.Equal(Const, a.Kind)
+	req.Equal("const", a.Kind.String())
+	req.True(a.Captured)
+	req.Equal(Const, b.Kind)
+	req.Equal(info.Scopes[prog.Statements[1].(*ast.LetStatement).Value], b.Scope)
+}
+
+func TestResolveImport(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `import "m.mk" as m; export let f = fn() { m };`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	m := info.SymbolOf(identifiers(prog, "m")[0])
+	req.Equal(Import, m.Kind)
+	req.Equal("import", m.Kind.String())
+	req.Equal(prog.Statements[0], m.Decl)
+	req.True(m.Captured)
+
+	f := info.SymbolOf(identifiers(prog, "f")[0])
+	req.Equal(Let, f.Kind)
+	req.Equal(info.Program, f.Scope)
+}
+
+func TestResolveRecursionAndCaptures(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `
+let counter = fn() {
+	let n = 0;
+	let m = 1;
+	fn() { n + counter() };
+	m
+};
+`)
+	info := Resolve(prog)
+	req.Empty(info.Errors)
+
+	n := info.SymbolOf(identifiers(prog, "n")[0])
+	m := info.SymbolOf(identifiers(prog, "m")[0])
+	counter := info.SymbolOf(identifiers(prog, "counter")[0])
+
+	req.True(n.Captured)
+	req.False(m.Captured)
+	req.True(counter.Captured)
+	req.Len(counter.Uses, 1)
+}
+
+func TestResolveRebinding(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let x = 1; x; let x = x + 1; x;`)
+	info := Resolve(prog)
+
+	xs := identifiers(prog, "x")
+	first, second := info.SymbolOf(xs[0]), info.SymbolOf(xs[2])
+
+	req.NotEqual(first, second)
+	req.Equal(first, info.SymbolOf(xs[1]))
+	// the name is in scope in its own value
+	req.Equal(second, info.SymbolOf(xs[3]))
+	req.Equal(second, info.SymbolOf(xs[4]))
+	req.Equal([]*Symbol{first, second}, info.Symbols())
+	req.Equal([]*Symbol{first, second}, info.Program.Symbols)
+}
+
+func TestResolveUndefined(t *testing.T) {
+	req := require.New(t)
+	prog := parse(t, `let f = fn(a) { if (a) { let b = 1; } b + len(c) };`)
+	info := Resolve(prog, "len")
+
+	req.Len(info.Errors, 2)
+	req.Equal("1:39: undefined: b", info.Errors[0].Error())
+	req.Equal("1:47: undefined: c", info.Errors[1].Error())
+
+	builtin := info.Universe.LookupLocal("len")
+	req.Equal(Predeclared, builtin.Kind)
+	req.Len(builtin.Uses, 1)
+	req.False(builtin.Captured)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/riadafridishibly/go-monkey/module"
+	"github.com/riadafridishibly/go-monkey/report"
+	"github.com/riadafridishibly/go-monkey/vm"
+)
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey run file")
+		fmt.Fprintln(flags.Output(), "file is either a compiled program or monkey source.")
+		fmt.Fprintln(flags.Output(), "Imports are resolved relative to the source file and can not leave its directory.")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	f, src, err := loadProgram(flags.Arg(0))
+	if err != nil && src != "" {
+		report.Print(os.Stderr, flags.Arg(0), src, err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey run: %v\n", err)
+		return 1
+	}
+
+	machine := vm.New(f.Bytecode)
+	loader := module.NewLoader(os.DirFS(filepath.Dir(f.Source)))
+	machine.SetImporter(loader.Importer(filepath.Base(f.Source)))
+	if err := machine.Run(); err != nil {
+		// report errors in imported modules with the source of the module
+		filename := f.Source
+		var modErr *module.Error
+		for errors.As(err, &modErr) && modErr.Src != "" {
+			filename, src, err = filepath.Join(filepath.Dir(f.Source), modErr.Path), modErr.Src, modErr.Err
+		}
+		report.Print(os.Stderr, filename, src, err)
+		return 1
+	}
+	return 0
+}
@@ -1,10 +1,31 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+// Position describes a location in the source text.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in bytes, starting at 1
+}
+
+// IsValid reports whether the position was set by the lexer.
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first byte of the token
+	End     Position // position immediately after the token
 }
 
 const (
@@ -12,8 +33,16 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers + literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   // 1343456
+	IDENT   = "IDENT"   // add, foobar, x, y, ...
+	INT     = "INT"     // 1343456
+	DECIMAL = "DECIMAL" // 12.50
+	STRING  = "STRING"  // "foo bar"
+	COMMENT = "COMMENT" // // only produced in lexer.ScanComments mode
+
+	// Template literals: `text ${expr} text`
+	BACKTICK      = "`"
+	DOLLAR_LBRACE = "${"
+	TEMPLATE      = "TEMPLATE" // text between the backticks and interpolations
 
 	// Operators
 	ASSIGN   = "="
@@ -28,32 +57,72 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
 )
 
 var Keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"as":       AS,
+	"macro":    MACRO,
+	"match":    MATCH,
 }
 
 func LookupIdent(ident string) TokenType {
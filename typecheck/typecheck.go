@@ -0,0 +1,986 @@
+// Package typecheck finds the type errors of Monkey programs before they
+// run.
+//
+// Names, parameters and function results can be annotated with types:
+//
+//	let limit: int = 10;
+//	let repeat = fn(s: string, n: int): string { ... };
+//
+// The types are int, bool, string, null and any, arrays [T], hashes {K: V}
+// and functions fn(T, U): R. The types of everything else are inferred,
+// Hindley-Milner style. Functions bound by let statements are polymorphic:
+// `let id = fn(x) { x }` has the type fn('a): 'a and can be called with
+// values of any type.
+//
+// Monkey itself is dynamically typed. Where a program mixes types in a way
+// that works at run time, like an array holding integers and strings or an
+// if expression without an else branch, the value gets the type any instead
+// of an error being reported. Values of type any are accepted everywhere,
+// and the operations on them are not checked.
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// Error is a type error spanning the source from Pos to End. End is not
+// valid when the end of the span is unknown.
+type Error struct {
+	Pos token.Position
+	End token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of type errors.
+type ErrorList []Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Info holds the types inferred for a program.
+type Info struct {
+	types map[ast.Node]Type
+}
+
+// TypeOf returns the type of an expression, or of the name declared by an
+// identifier, or nil if the node has none.
+func (info *Info) TypeOf(node ast.Node) Type {
+	t, ok := info.types[node]
+	if !ok {
+		return nil
+	}
+	return resolve(t)
+}
+
+// Check infers the types of prog and returns them, along with the type
+// errors found, sorted by position.
+func Check(prog *ast.Program) (*Info, ErrorList) {
+	c := &checker{info: &Info{types: map[ast.Node]Type{}}}
+	c.statements(prog.Statements, newScope(nil))
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Pos.Offset < c.errors[j].Pos.Offset
+	})
+	return c.info, c.errors
+}
+
+// scheme is the type of a name. The variables of polymorphic types are
+// replaced by fresh ones every time the name is used.
+type scheme struct {
+	vars []*Variable
+	typ  Type
+	// let is the name declared by the let statement without annotation
+	// declaring the variable, if any, whose type assignments can widen
+	let *ast.Identifier
+}
+
+type scope struct {
+	names map[string]*scheme
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: map[string]*scheme{}, outer: outer}
+}
+
+func (s *scope) lookup(name string) (*scheme, bool) {
+	for ; s != nil; s = s.outer {
+		if sch, ok := s.names[name]; ok {
+			return sch, true
+		}
+	}
+	return nil, false
+}
+
+// function is the function literal being checked.
+type function struct {
+	name      string
+	result    Type   // the annotated result type, if any
+	annotated bool   // whether the result type is annotated
+	returns   []Type // the types returned, if it is not
+}
+
+type checker struct {
+	info   *Info
+	errors ErrorList
+	level  int       // the nesting of let statements
+	nextID int       // of type variables
+	fn     *function // nil at the top level
+	trail  []*Variable
+}
+
+func (c *checker) errorf(node ast.Node, format string, args ...interface{}) {
+	c.errors = append(c.errors, Error{Pos: ast.Pos(node), End: end(node), Msg: fmt.Sprintf(format, args...)})
+}
+
+// end returns the position after node, for the nodes whose last token the
+// AST keeps.
+func end(node ast.Node) token.Position {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return n.Token.End
+	case *ast.InetegerLiteral:
+		return n.Token.End
+	case *ast.BigIntegerLiteral:
+		return n.Token.End
+	case *ast.DecimalLiteral:
+		return n.Token.End
+	case *ast.Boolean:
+		return n.Token.End
+	case *ast.StringLiteral:
+		return n.Token.End
+	case *ast.PrefixExpression:
+		return end(n.Right)
+	case *ast.InfixExpression:
+		return end(n.Right)
+	case *ast.AssignExpression:
+		return end(n.Value)
+	case *ast.NamedType:
+		return n.Token.End
+	}
+	return token.Position{}
+}
+
+func (c *checker) newVar() *Variable {
+	c.nextID++
+	return &Variable{id: c.nextID, level: c.level}
+}
+
+func (c *checker) declare(s *scope, name *ast.Identifier, t Type) {
+	s.names[name.Value] = &scheme{typ: t}
+	c.info.types[name] = t
+}
+
+// statements checks a list of statements and returns the type of its value,
+// the value of the last statement.
+func (c *checker) statements(list []ast.Statement, s *scope) Type {
+	var t Type = Null
+	for _, stmt := range list {
+		t = c.statement(stmt, s)
+	}
+	return t
+}
+
+func (c *checker) statement(stmt ast.Statement, s *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if stmt.Expression != nil {
+			return c.expr(stmt.Expression, s)
+		}
+
+	case *ast.LetStatement:
+		c.binding(stmt.Name, stmt.Type, stmt.Value, s)
+
+	case *ast.ConstStatement:
+		c.binding(stmt.Name, stmt.Type, stmt.Value, s)
+
+	case *ast.ImportStatement:
+		c.declare(s, stmt.Name, Any)
+
+	case *ast.ExportStatement:
+		return c.statement(stmt.Binding, s)
+
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			c.returnValue(Null, stmt)
+		} else {
+			c.returnValue(c.expr(stmt.ReturnValue, s), stmt.ReturnValue)
+		}
+		// the statements leaving a block have no value of their own
+		return c.newVar()
+
+	case *ast.ThrowStatement:
+		c.expr(stmt.Value, s)
+		return c.newVar()
+
+	case *ast.BranchStatement:
+		return c.newVar()
+
+	case *ast.WhileStatement:
+		c.expr(stmt.Condition, s)
+		c.statements(stmt.Body.Statements, newScope(s))
+
+	case *ast.ForStatement:
+		inner := newScope(s)
+		c.declare(inner, stmt.Variable, c.iterate(stmt.Iterable, s))
+		c.statements(stmt.Body.Statements, inner)
+
+	case *ast.BlockStatement:
+		return c.statements(stmt.Statements, newScope(s))
+	}
+	return Null
+}
+
+// binding checks a let or const statement. Functions are polymorphic, and
+// can call themselves.
+func (c *checker) binding(pat ast.Pattern, annotation ast.TypeExpr, value ast.Expression, s *scope) {
+	var want Type
+	if annotation != nil {
+		want = c.annotated(annotation)
+	}
+
+	name, isName := pat.(*ast.Identifier)
+	if !isName {
+		t := c.expr(value, s)
+		if want != nil {
+			if !c.assignable(want, t) {
+				c.errorf(value, "cannot use %s as %s in declaration of %s", t, want, pat)
+			}
+			t = want
+		}
+		c.pattern(pat, t, s)
+		return
+	}
+
+	c.level++
+	_, isFunction := value.(*ast.FunctionLiteral)
+	var self Type
+	if isFunction {
+		self = want
+		if self == nil {
+			self = c.newVar()
+		}
+		s.names[name.Value] = &scheme{typ: self}
+	}
+	t := c.expr(value, s)
+	if self != nil && !c.unify(self, t) && want != nil {
+		c.errorf(value, "cannot use %s as %s in declaration of %s", t, want, name.Value)
+		want = nil
+	}
+	c.level--
+
+	if want != nil {
+		if !isFunction && !c.assignable(want, t) {
+			c.errorf(value, "cannot use %s as %s in declaration of %s", t, want, name.Value)
+		}
+		t = want
+	}
+
+	c.info.types[name] = t
+	if isFunction {
+		s.names[name.Value] = c.generalize(t)
+	} else {
+		sch := &scheme{typ: t}
+		if annotation == nil {
+			sch.let = name
+		}
+		s.names[name.Value] = sch
+	}
+}
+
+// returnValue records that the current function returns a value of type t,
+// given by node.
+func (c *checker) returnValue(t Type, node ast.Node) {
+	switch {
+	case c.fn == nil:
+		// a return statement ending the program
+	case c.fn.annotated:
+		if !c.assignable(c.fn.result, t) {
+			c.errorf(node, "cannot use %s as %s in return value of %s", t, c.fn.result, functionName(c.fn.name))
+		}
+	default:
+		c.fn.returns = append(c.fn.returns, t)
+	}
+}
+
+func functionName(name string) string {
+	if name == "" {
+		return "<anonymous>"
+	}
+	return name
+}
+
+// annotated returns the type of a type annotation.
+func (c *checker) annotated(typ ast.TypeExpr) Type {
+	switch typ := typ.(type) {
+	case *ast.NamedType:
+		if b, ok := basics[typ.Name]; ok {
+			return b
+		}
+		c.errorf(typ, "unknown type %s", typ.Name)
+	case *ast.ArrayType:
+		return &Array{Element: c.annotated(typ.Element)}
+	case *ast.HashType:
+		return &Hash{Key: c.annotated(typ.Key), Value: c.annotated(typ.Value)}
+	case *ast.FunctionType:
+		params := make([]Type, len(typ.Parameters))
+		for i, p := range typ.Parameters {
+			params[i] = c.annotated(p)
+		}
+		return &Function{Parameters: params, Result: c.annotated(typ.Result)}
+	}
+	return Any
+}
+
+func (c *checker) expr(expr ast.Expression, s *scope) Type {
+	t := c.infer(expr, s)
+	c.info.types[expr] = t
+	return t
+}
+
+func (c *checker) infer(expr ast.Expression, s *scope) Type {
+	switch expr := expr.(type) {
+	case *ast.InetegerLiteral, *ast.BigIntegerLiteral:
+		return Int
+
+	case *ast.DecimalLiteral:
+		return Decimal
+
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.TemplateLiteral:
+		// any value can be embedded
+		for _, part := range expr.Parts {
+			c.expr(part, s)
+		}
+		return String
+
+	case *ast.Identifier:
+		if sch, ok := s.lookup(expr.Value); ok {
+			return c.instantiate(sch)
+		}
+		if sch, ok := builtins[expr.Value]; ok {
+			return c.instantiate(sch)
+		}
+		// undefined names are left to the compiler
+		return Any
+
+	case *ast.PrefixExpression:
+		return c.prefix(expr, c.expr(expr.Right, s))
+
+	case *ast.InfixExpression:
+		left := c.expr(expr.Left, s)
+		right := c.expr(expr.Right, s)
+		return c.infix(expr, expr.Operator, left, right)
+
+	case *ast.AssignExpression:
+		return c.assign(expr, s)
+
+	case *ast.IfExpression:
+		c.expr(expr.Condition, s)
+		t := c.statements(expr.Consequence.Statements, newScope(s))
+		if expr.Alternative == nil {
+			return c.join(t, Null)
+		}
+		return c.join(t, c.statements(expr.Alternative.Statements, newScope(s)))
+
+	case *ast.TryExpression:
+		t := c.statements(expr.Block.Statements, newScope(s))
+		if expr.Catch != nil {
+			inner := newScope(s)
+			if expr.CatchParam != nil {
+				c.declare(inner, expr.CatchParam, Any)
+			}
+			t = c.join(t, c.statements(expr.Catch.Statements, inner))
+		}
+		if expr.Finally != nil {
+			c.statements(expr.Finally.Statements, newScope(s))
+		}
+		return t
+
+	case *ast.MatchExpression:
+		subject := c.expr(expr.Subject, s)
+		var t Type
+		for _, arm := range expr.Arms {
+			inner := newScope(s)
+			c.pattern(arm.Pattern, subject, inner)
+			if arm.Guard != nil {
+				c.expr(arm.Guard, inner)
+			}
+			body := c.statements(arm.Body.Statements, inner)
+			if t == nil {
+				t = body
+			} else {
+				t = c.join(t, body)
+			}
+		}
+		if t == nil {
+			return Any
+		}
+		return t
+
+	case *ast.FunctionLiteral:
+		return c.function(expr, s)
+
+	case *ast.CallExpression:
+		return c.call(expr, s)
+
+	case *ast.ArrayLiteral:
+		var elem Type = c.newVar()
+		for _, e := range expr.Elements {
+			elem = c.join(elem, c.expr(e, s))
+		}
+		return &Array{Element: elem}
+
+	case *ast.HashLiteral:
+		var key, value Type = c.newVar(), c.newVar()
+		for _, p := range expr.Pairs {
+			key = c.join(key, c.expr(p.Key, s))
+			value = c.join(value, c.expr(p.Value, s))
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.index(expr, s)
+	}
+	return Any
+}
+
+func (c *checker) function(fn *ast.FunctionLiteral, s *scope) Type {
+	inner := newScope(s)
+	params := make([]Type, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		if fn.ParameterTypes != nil && fn.ParameterTypes[i] != nil {
+			params[i] = c.annotated(fn.ParameterTypes[i])
+		} else {
+			params[i] = c.newVar()
+		}
+		if fn.Defaults != nil && fn.Defaults[i] != nil {
+			if t := c.expr(fn.Defaults[i], inner); !c.assignable(params[i], t) {
+				c.errorf(fn.Defaults[i], "cannot use %s as %s in default value of %s", t, params[i], p)
+			}
+		}
+		c.pattern(p, params[i], inner)
+	}
+	if fn.Rest != nil {
+		c.declare(inner, fn.Rest, &Array{Element: Any})
+	}
+
+	ctx := &function{name: fn.Name}
+	if fn.ReturnType != nil {
+		ctx.result, ctx.annotated = c.annotated(fn.ReturnType), true
+	}
+
+	outer := c.fn
+	c.fn = ctx
+	var last ast.Node = fn
+	if n := len(fn.Body.Statements); n > 0 {
+		last = fn.Body.Statements[n-1]
+	}
+	c.returnValue(c.statements(fn.Body.Statements, inner), last)
+	c.fn = outer
+
+	result := ctx.result
+	if !ctx.annotated {
+		result = c.newVar()
+		for _, t := range ctx.returns {
+			result = c.join(result, t)
+		}
+	}
+	if fn.Defaults != nil || fn.Rest != nil {
+		// the number of arguments varies, which function types can not
+		// express, so calls are left unchecked
+		return Any
+	}
+	return &Function{Parameters: params, Result: result}
+}
+
+func (c *checker) call(call *ast.CallExpression, s *scope) Type {
+	callee := c.expr(call.Function, s)
+	args := make([]Type, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = c.expr(arg, s)
+	}
+
+	if len(call.NamedArguments) > 0 {
+		// function types do not know the names of the parameters
+		for _, arg := range call.NamedArguments {
+			c.expr(arg.Value, s)
+		}
+		return Any
+	}
+
+	name := "function"
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+
+	switch fn := prune(callee).(type) {
+	case *Function:
+		n := len(fn.Parameters)
+		switch {
+		case fn.Variadic && len(args) < n-1:
+			c.errorf(call, "wrong number of arguments to %s: want at least %d, got=%d", name, n-1, len(args))
+			return fn.Result
+		case !fn.Variadic && len(args) != n:
+			c.errorf(call, "wrong number of arguments to %s: want=%d, got=%d", name, n, len(args))
+			return fn.Result
+		}
+		for i, arg := range args {
+			param := fn.Parameters[n-1]
+			if i < n {
+				param = fn.Parameters[i]
+			}
+			if !c.assignable(param, arg) {
+				c.errorf(call.Arguments[i], "cannot use %s as %s in argument %d to %s", arg, param, i+1, name)
+			}
+		}
+		return fn.Result
+
+	case *Variable:
+		result := c.newVar()
+		c.unify(fn, &Function{Parameters: args, Result: result})
+		return result
+	}
+
+	if callee == Any {
+		return Any
+	}
+	c.errorf(call.Function, "calling non-function: %s", callee)
+	return Any
+}
+
+func (c *checker) prefix(expr *ast.PrefixExpression, right Type) Type {
+	switch expr.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if prune(right) == Decimal {
+			return Decimal
+		}
+		if !c.unify(right, Int) {
+			c.errorf(expr, "unknown operator: -%s", right)
+			return Any
+		}
+		return Int
+	}
+	return Any
+}
+
+// infix returns the type of applying op to operands of type left and
+// right. Both operands of arithmetic and comparisons must have the same
+// type, except that integers and decimals mix into decimals.
+func (c *checker) infix(node ast.Node, op string, left, right Type) Type {
+	switch op {
+	case "==", "!=":
+		return Bool
+	}
+
+	if l, r := prune(left), prune(right); l == Decimal && (r == Int || r == Decimal) || r == Decimal && l == Int {
+		switch op {
+		case "+", "-", "*", "/":
+			return Decimal
+		case "<", ">":
+			return Bool
+		}
+		c.errorf(node, "unknown operator: %s %s %s", l, op, r)
+		return Any
+	}
+
+	if !c.unify(left, right) {
+		c.errorf(node, "type mismatch: %s %s %s", left, op, right)
+		return Any
+	}
+
+	t := prune(left)
+	switch t {
+	case Any:
+		// not checked
+	case Int, Decimal:
+	case String:
+		if op != "+" && op != "<" && op != ">" {
+			c.errorf(node, "unknown operator: %s %s %s", t, op, t)
+			return Any
+		}
+	default:
+		switch {
+		case op == "-" || op == "*" || op == "/":
+			if c.unify(t, Int) {
+				t = Int
+				break
+			}
+			fallthrough
+		case !isVariable(t):
+			c.errorf(node, "unknown operator: %s %s %s", t, op, t)
+			return Any
+		}
+	}
+
+	if op == "<" || op == ">" {
+		return Bool
+	}
+	return t
+}
+
+func isVariable(t Type) bool {
+	_, ok := prune(t).(*Variable)
+	return ok
+}
+
+func (c *checker) assign(expr *ast.AssignExpression, s *scope) Type {
+	value := c.expr(expr.Value, s)
+	op := strings.TrimSuffix(expr.Operator, "=")
+
+	var current Type
+	var what string
+	switch target := expr.Target.(type) {
+	case *ast.Identifier:
+		sch, ok := s.lookup(target.Value)
+		if !ok {
+			// undefined names are left to the compiler
+			return value
+		}
+		current = c.instantiate(sch)
+		c.info.types[target] = current
+		what = target.Value
+	case *ast.IndexExpression:
+		current = c.expr(target, s)
+		what = "element"
+	default:
+		return value
+	}
+
+	if op != "" {
+		value = c.infix(expr, op, current, value)
+	}
+	if !c.assignable(current, value) && !c.widen(expr.Target, current, value, s) {
+		c.errorf(expr.Value, "cannot assign %s to %s of type %s", value, what, current)
+	}
+	return value
+}
+
+// assignable reports whether a value of type t can be used where one of
+// type want is, unifying them. Integers can be used as decimals, which
+// arithmetic promotes them to.
+func (c *checker) assignable(want, t Type) bool {
+	if prune(want) == Decimal && prune(t) == Int {
+		return true
+	}
+	return c.unify(want, t)
+}
+
+// widen makes target, a variable or an element of type current, a decimal
+// when it is an int assigned a value of type value that is a decimal, as
+// the assignment makes it one. Only the variables of let statements without
+// a type annotation are widened. It reports whether target was.
+func (c *checker) widen(target ast.Expression, current, value Type, s *scope) bool {
+	if prune(current) != Int || prune(value) != Decimal {
+		return false
+	}
+	switch target := target.(type) {
+	case *ast.Identifier:
+		sch, ok := s.lookup(target.Value)
+		if !ok || sch.let == nil {
+			return false
+		}
+		sch.typ = Decimal
+		c.info.types[target] = Decimal
+		c.info.types[sch.let] = Decimal
+		return true
+	case *ast.IndexExpression:
+		switch container := prune(c.info.types[target.Left]).(type) {
+		case *Array:
+			container.Element = Decimal
+			return true
+		case *Hash:
+			container.Value = Decimal
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) index(expr *ast.IndexExpression, s *scope) Type {
+	left := c.expr(expr.Left, s)
+	index := c.expr(expr.Index, s)
+
+	switch l := prune(left).(type) {
+	case *Array:
+		if !c.unify(index, Int) {
+			c.errorf(expr.Index, "array index must be int, got %s", index)
+		}
+		return l.Element
+	case *Hash:
+		if !c.unify(l.Key, index) {
+			c.errorf(expr.Index, "hash key must be %s, got %s", l.Key, index)
+		}
+		return l.Value
+	case *Variable:
+		return Any
+	}
+
+	if left != Any {
+		c.errorf(expr.Left, "index operator not supported: %s", left)
+	}
+	return Any
+}
+
+// pattern declares the names bound by matching a value of type t against p,
+// in a match arm, a let statement or a parameter. Patterns that can not
+// match a value of type t are not errors, as arms are then just never taken,
+// and the names they bind are any.
+func (c *checker) pattern(p ast.Pattern, t Type, s *scope) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		c.declare(s, p, t)
+	case *ast.ArrayPattern:
+		var elem Type = Any
+		if a, ok := prune(t).(*Array); ok {
+			elem = a.Element
+		}
+		for _, e := range p.Elements {
+			c.pattern(e, elem, s)
+		}
+		if p.Rest != nil {
+			c.pattern(p.Rest, &Array{Element: elem}, s)
+		}
+	case *ast.HashPattern:
+		var value Type = Any
+		if h, ok := prune(t).(*Hash); ok {
+			value = h.Value
+		}
+		for _, pair := range p.Pairs {
+			c.pattern(pair.Value, value, s)
+		}
+	}
+}
+
+// iterate returns the type of the values a for loop over expr binds.
+func (c *checker) iterate(expr ast.Expression, s *scope) Type {
+	t := c.expr(expr, s)
+	switch t := prune(t).(type) {
+	case *Array:
+		return t.Element
+	case *Hash:
+		return t.Key
+	case *Variable:
+		return Any
+	}
+
+	switch t {
+	case String:
+		return String
+	case Any:
+		return Any
+	}
+	c.errorf(expr, "cannot iterate over %s", t)
+	return Any
+}
+
+// join returns the type of a value that has either type a or type b: their
+// unified type, or any if they do not unify or either is any.
+func (c *checker) join(a, b Type) Type {
+	if prune(a) != Any && prune(b) != Any && c.unify(a, b) {
+		return a
+	}
+	return Any
+}
+
+// unify makes a and b the same type by binding their variables, and
+// reports whether they could be. Nothing is bound if they can not.
+func (c *checker) unify(a, b Type) bool {
+	ok := c.unifyTypes(a, b)
+	if !ok {
+		for _, v := range c.trail {
+			v.instance = nil
+		}
+	}
+	c.trail = c.trail[:0]
+	return ok
+}
+
+func (c *checker) unifyTypes(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b || a == Any || b == Any {
+		return true
+	}
+	if v, ok := a.(*Variable); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*Variable); ok {
+		return c.bind(v, a)
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && c.unifyTypes(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && c.unifyTypes(a.Key, b.Key) && c.unifyTypes(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) || a.Variadic != b.Variadic {
+			return false
+		}
+		for i := range a.Parameters {
+			if !c.unifyTypes(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return c.unifyTypes(a.Result, b.Result)
+	}
+	return false
+}
+
+func (c *checker) bind(v *Variable, t Type) bool {
+	if occurs(v, t) {
+		return false
+	}
+	lowerLevels(t, v.level)
+	v.instance = t
+	c.trail = append(c.trail, v)
+	return true
+}
+
+// occurs reports whether v occurs in t.
+func occurs(v *Variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		return t == v
+	case *Array:
+		return occurs(v, t.Element)
+	case *Hash:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Parameters {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, t.Result)
+	}
+	return false
+}
+
+// lowerLevels lowers the level of the variables of t to at most level, as
+// they are now part of the type of a variable introduced at that level.
+func lowerLevels(t Type, level int) {
+	for _, v := range variables(t) {
+		if v.level > level {
+			v.level = level
+		}
+	}
+}
+
+// variables returns the variables of t that were not unified.
+func variables(t Type) []*Variable {
+	var vars []*Variable
+	seen := map[*Variable]bool{}
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if !seen[t] {
+				seen[t] = true
+				vars = append(vars, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Hash:
+			collect(t.Key)
+			collect(t.Value)
+		case *Function:
+			for _, p := range t.Parameters {
+				collect(p)
+			}
+			collect(t.Result)
+		}
+	}
+	collect(t)
+	return vars
+}
+
+// generalize returns the scheme of t in which the variables introduced
+// since the current let statement stand for any type.
+func (c *checker) generalize(t Type) *scheme {
+	sch := &scheme{typ: t}
+	for _, v := range variables(t) {
+		if v.level > c.level {
+			sch.vars = append(sch.vars, v)
+		}
+	}
+	return sch
+}
+
+// instantiate returns the type of sch with fresh variables.
+func (c *checker) instantiate(sch *scheme) Type {
+	if len(sch.vars) == 0 {
+		return sch.typ
+	}
+	fresh := make(map[*Variable]Type, len(sch.vars))
+	for _, v := range sch.vars {
+		fresh[v] = c.newVar()
+	}
+	return substitute(sch.typ, fresh)
+}
+
+func substitute(t Type, vars map[*Variable]Type) Type {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if v, ok := vars[t]; ok {
+			return v
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, vars)}
+	case *Hash:
+		return &Hash{Key: substitute(t.Key, vars), Value: substitute(t.Value, vars)}
+	case *Function:
+		params := make([]Type, len(t.Parameters))
+		for i, p := range t.Parameters {
+			params[i] = substitute(p, vars)
+		}
+		return &Function{Parameters: params, Result: substitute(t.Result, vars), Variadic: t.Variadic}
+	}
+	return t
+}
+
+// builtins holds the types of the builtin functions.
+var builtins = func() map[string]*scheme {
+	a, b := &Variable{}, &Variable{}
+	fn := func(result Type, params ...Type) *scheme {
+		return &scheme{vars: []*Variable{a, b}, typ: &Function{Parameters: params, Result: result}}
+	}
+	variadic := func(result, param Type) *scheme {
+		return &scheme{typ: &Function{Parameters: []Type{param}, Result: result, Variadic: true}}
+	}
+
+	return map[string]*scheme{
+		"len":        fn(Int, Any),
+		"now":        fn(Int),
+		"read_file":  fn(String, String),
+		"write_file": fn(Null, String, String),
+		"getenv":     fn(Any, String),
+		"random":     fn(Int, Int),
+		"first":      fn(a, &Array{Element: a}),
+		"last":       fn(a, &Array{Element: a}),
+		"rest":       fn(&Array{Element: a}, &Array{Element: a}),
+		"push":       fn(&Array{Element: a}, &Array{Element: a}, a),
+		"puts":       variadic(Null, Any),
+		"type":       fn(String, Any),
+		"str":        fn(String, Any),
+		"int":        fn(Int, Any),
+		"keys":       fn(&Array{Element: a}, &Hash{Key: a, Value: b}),
+		"values":     fn(&Array{Element: b}, &Hash{Key: a, Value: b}),
+		"range":      variadic(&Array{Element: Int}, Int),
+		"map":        fn(&Array{Element: b}, &Array{Element: a}, &Function{Parameters: []Type{a}, Result: b}),
+		"filter":     fn(&Array{Element: a}, &Array{Element: a}, &Function{Parameters: []Type{a}, Result: Any}),
+		"reduce":     fn(b, &Array{Element: a}, &Function{Parameters: []Type{b, a}, Result: b}, b),
+		"freeze":     fn(a, a),
+		"frozen":     fn(Bool, Any),
+		"signature":  fn(&Hash{Key: String, Value: Any}, Any),
+		"decimal":    fn(Decimal, Any),
+		"round":      variadic(Decimal, Any),
+		"new":        fn(Any, Any, Any),
+		"prototype":  fn(Any, Any),
+	}
+}()
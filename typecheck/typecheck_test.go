@@ -0,0 +1,177 @@
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	require.Empty(t, p.Errors(), "input: %s", input)
+	return prog
+}
+
+// lastName returns the last name declared by the last let statement of
+// prog.
+func lastName(prog *ast.Program) *ast.Identifier {
+	var name *ast.Identifier
+	for _, stmt := range prog.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			names := ast.PatternNames(let.Name)
+			name = names[len(names)-1]
+		}
+	}
+	return name
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 5;`, "int"},
+		{`let x: any = 5;`, "any"},
+		{`let x = "a" + "b";`, "string"},
+		{`let x = 1 < 2;`, "bool"},
+		{`let x = [1, 2, 3];`, "[int]"},
+		{`let x = [1, "two"];`, "[any]"},
+		{`let x = [];`, "['a]"},
+		{`let x = {"a": 1};`, "{string: int}"},
+		{`let x = if (true) { 1 } else { 2 };`, "int"},
+		{`let x = if (true) { 1 };`, "any"},
+		{`let x = fn(a, b) { a - b };`, "fn(int, int): int"},
+		{`let x = fn(a: int, b: string): bool { true };`, "fn(int, string): bool"},
+		{`let x = fn(a) { a };`, "fn('a): 'a"},
+		{`let x = fn(f, a) { f(a) };`, "fn(fn('a): 'b, 'a): 'b"},
+		{`let x = fn(a) { if (a) { return 1; } 2 };`, "fn('a): int"},
+		{`let id = fn(a) { a }; let x = [id(1), id(2)];`, "[int]"},
+		{`let id = fn(a) { a }; let x = id("s");`, "string"},
+		{`let x = fn(n) { if (n < 2) { return n; } x(n - 1) + x(n - 2) };`, "fn(int): int"},
+		{`let x = map([1, 2], fn(n) { str(n) });`, "[string]"},
+		{`let x = first([[1]]);`, "[int]"},
+		{`let h = {"a": true}; let x = h["a"];`, "bool"},
+		{`let a = [1]; let x = a[0] += 1;`, "int"},
+		{`let x = fn() { let s = 0; for (n in [1, 2]) { s += n; } s };`, "fn(): int"},
+		{`let x = try { 1 } catch (e) { e };`, "any"},
+		{`let x = match (1) { 0 => "zero", n => str(n) };`, "string"},
+		{`let x = match ([[1]]) { [[a]] => a, _ => 0 };`, "int"},
+		{`let x = match ({"k": true}) { {"k": b} if b => 1, _ => "s" };`, "any"},
+		{`let x = fn(a) { match (a) { [_] => 1, _ => 0 } };`, "fn('a): int"},
+		{`let [a, x] = [1, 2];`, "int"},
+		{`let [a, ...x] = ["s"];`, "[string]"},
+		{`let {k, x} = {"k": true, "x": false};`, "bool"},
+		{`let x = fn([a, b]: [int]) { a + b };`, "fn([int]): int"},
+		{`let x = fn(a, b = 1) { a + b };`, "any"},
+		{"let x = `${1} ${true}`;", "string"},
+		{`let f = fn(a, b) { a }; let x = f(b: 1, a: 2);`, "any"},
+		{`let x = 99999999999999999999 + 1;`, "int"},
+		{`let x = 1.50;`, "decimal"},
+		{`let x = -1.5 * 2;`, "decimal"},
+		{`let x = 1 / 3.0 < 1;`, "bool"},
+		{`let x: decimal = round(10.005, 2, "half_up");`, "decimal"},
+		{`let x = fn(price: decimal, qty: int) { price * qty };`, "fn(decimal, int): decimal"},
+		{`let x: decimal = 1;`, "decimal"},
+		{`let x = 0; for (p in [1.50, 2.25]) { x += p }`, "decimal"},
+		{`let x = 1; x = 2.5;`, "decimal"},
+		{`let x = [1, 2]; x[0] = 0.5;`, "[decimal]"},
+		{`let f = fn(d: decimal): decimal { if (d < 0) { return 0; } d * 2 }; let x = f(3);`, "decimal"},
+	}
+
+	for _, tt := range tests {
+		prog := parse(t, tt.input)
+		info, errs := Check(prog)
+		require.Empty(t, errs, "input: %s", tt.input)
+		require.Equal(t, tt.expected, info.TypeOf(lastName(prog)).String(), "input: %s", tt.input)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + true`, "1:1: type mismatch: int + bool"},
+		{`"a" - "b"`, "1:1: unknown operator: string - string"},
+		{`-true`, "1:1: unknown operator: -bool"},
+		{`let x: int = "five";`, `1:14: cannot use string as int in declaration of x`},
+		{`let x: foo = 1;`, "1:8: unknown type foo"},
+		{`let f = fn(a: int) { a }; f("s")`, `1:29: cannot use string as int in argument 1 to f`},
+		{`let f = fn(a, b) { a }; f(1)`, "1:25: wrong number of arguments to f: want=2, got=1"},
+		{`let f = fn(): string { 1 };`, "1:24: cannot use int as string in return value of f"},
+		{`let f = fn(a): bool { if (a) { return 1; } true };`, "1:39: cannot use int as bool in return value of f"},
+		{`let x = 1; x = "s";`, `1:16: cannot assign string to x of type int`},
+		{`let a = [1]; a[0] = "s";`, `1:21: cannot assign string to element of type int`},
+		{`let a = [1]; a["s"]`, `1:16: array index must be int, got string`},
+		{`let h = {"a": 1}; h[1]`, "1:21: hash key must be string, got int"},
+		{`1[0]`, "1:1: index operator not supported: int"},
+		{`5()`, "1:1: calling non-function: int"},
+		{`for (x in 5) {}`, "1:11: cannot iterate over int"},
+		{`let f = fn(a) { a + 1 }; f(true)`, "1:28: cannot use bool as int in argument 1 to f"},
+		{`len(1, 2)`, "1:1: wrong number of arguments to len: want=1, got=2"},
+		{`map([1], fn(s: string) { s })`, "1:10: cannot use fn(string): string as fn(int): 'a in argument 2 to map"},
+		{`match ([1]) { [a] => a + "s" }`, "1:22: type mismatch: int + string"},
+		{`let [a]: [string] = [1];`, "1:21: cannot use [int] as [string] in declaration of [a]"},
+		{`fn(a: int = "s") { a }`, `1:13: cannot use string as int in default value of a`},
+		{`fn(a, b = a + 1) { b + "s" }`, "1:20: type mismatch: int + string"},
+		{`fn(...r) { r + 1 }`, "1:12: type mismatch: [any] + int"},
+		{"`${-true}`", "1:4: unknown operator: -bool"},
+		{`1.5 + "s"`, "1:1: type mismatch: decimal + string"},
+		{`let x: int = 2.5;`, "1:14: cannot use decimal as int in declaration of x"},
+		{`let x: int = 1; x = 2.5;`, "1:21: cannot assign decimal to x of type int"},
+		{`let f = fn(a: int) { a }; f(1.5)`, "1:29: cannot use decimal as int in argument 1 to f"},
+		{`let x = 1.5; x = "s";`, "1:18: cannot assign string to x of type decimal"},
+	}
+
+	for _, tt := range tests {
+		_, errs := Check(parse(t, tt.input))
+		require.Len(t, errs, 1, "input: %s", tt.input)
+		require.Equal(t, tt.expected, errs[0].Error(), "input: %s", tt.input)
+	}
+}
+
+func TestErrorSpan(t *testing.T) {
+	_, errs := Check(parse(t, "let x = 1;\nx + \"s\""))
+	require.Len(t, errs, 1)
+	require.Equal(t, 2, errs[0].Pos.Line)
+	require.Equal(t, 1, errs[0].Pos.Column)
+	require.Equal(t, 2, errs[0].End.Line)
+	require.Equal(t, 8, errs[0].End.Column)
+}
+
+// TestGradual checks programs mixing types in ways that work at run time.
+func TestGradual(t *testing.T) {
+	inputs := []string{
+		`let a = [1, "two", true]; puts(a[0]);`,
+		`let x = if (true) { 1 }; puts(x);`,
+		`let f = fn(x: any) { x }; f(1); f("s");`,
+		`import "math" as m; m["sqrt"](4) + 1;`,
+		`try { throw "e"; } catch (e) { e + 1 }`,
+		`let f = fn(n: int) { if (n == 0) { return "zero"; } n }; f(1) + 1;`,
+		`undefined_name + 1`,
+		`let x = 1; let x = "shadowed"; x + "s";`,
+		`let len = fn(s: string) { 0 }; len("s")`,
+		`match (1) { [a] => a + "s", n => n + 1 }`,
+		`let f = fn(a, b = 2, ...r) { a }; f(1); f("s", 2, 3);`,
+		`let f = fn(a: int, b: int) { a + b }; f(b: 1, a: 2) + "s";`,
+		`let V = {"+": fn(a, b) { a }}; let v = new(V, {"x": 1}); v + v;`,
+		`let f = fn(e: decimal = 1) { e * 2 }; f();`,
+	}
+
+	for _, input := range inputs {
+		_, errs := Check(parse(t, input))
+		require.Empty(t, errs, "input: %s", input)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, b := range object.Builtins {
+		require.Contains(t, builtins, b.Name)
+	}
+}
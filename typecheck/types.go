@@ -0,0 +1,141 @@
+package typecheck
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Type is the type of a Monkey value: a *Basic, *Array, *Hash or *Function
+// type, or a *Variable standing for a type that is not known yet.
+type Type interface {
+	String() string
+}
+
+// Basic is a type without parts, named like in annotations.
+type Basic struct {
+	Name string
+}
+
+// The basic types. Any is the type of values the checker knows nothing
+// about, like the values of exceptions and modules; it is accepted where
+// any other type is expected.
+var (
+	Int     = &Basic{Name: "int"}
+	Decimal = &Basic{Name: "decimal"}
+	Bool    = &Basic{Name: "bool"}
+	String  = &Basic{Name: "string"}
+	Null    = &Basic{Name: "null"}
+	Any     = &Basic{Name: "any"}
+)
+
+var basics = map[string]*Basic{
+	"int":     Int,
+	"decimal": Decimal,
+	"bool":    Bool,
+	"string":  String,
+	"null":    Null,
+	"any":     Any,
+}
+
+// Array is the type of arrays whose elements have type Element.
+type Array struct {
+	Element Type
+}
+
+// Hash is the type of hashes with keys of type Key and values of type
+// Value.
+type Hash struct {
+	Key, Value Type
+}
+
+// Function is the type of functions. The last parameter of a variadic
+// function takes any number of arguments, including none.
+type Function struct {
+	Parameters []Type
+	Result     Type
+	Variadic   bool
+}
+
+// Variable is a type variable, which stands for a type that is inferred
+// later, or for any type in the types of polymorphic functions.
+type Variable struct {
+	id       int
+	level    int  // the nesting of the let statement introducing it
+	instance Type // the type it was unified with, if any
+}
+
+func (b *Basic) String() string    { return b.Name }
+func (a *Array) String() string    { return typeString(a, map[*Variable]string{}) }
+func (h *Hash) String() string     { return typeString(h, map[*Variable]string{}) }
+func (f *Function) String() string { return typeString(f, map[*Variable]string{}) }
+func (v *Variable) String() string { return typeString(v, map[*Variable]string{}) }
+
+// typeString formats t like an annotation. Variables are named 'a, 'b and
+// so on, in the order they appear in.
+func typeString(t Type, names map[*Variable]string) string {
+	switch t := prune(t).(type) {
+	case *Basic:
+		return t.Name
+	case *Array:
+		return "[" + typeString(t.Element, names) + "]"
+	case *Hash:
+		return "{" + typeString(t.Key, names) + ": " + typeString(t.Value, names) + "}"
+	case *Function:
+		params := make([]string, len(t.Parameters))
+		for i, p := range t.Parameters {
+			params[i] = typeString(p, names)
+		}
+		if t.Variadic {
+			params[len(params)-1] += "..."
+		}
+		return "fn(" + strings.Join(params, ", ") + "): " + typeString(t.Result, names)
+	case *Variable:
+		name, ok := names[t]
+		if !ok {
+			name = "'" + varName(len(names))
+			names[t] = name
+		}
+		return name
+	}
+	return "?"
+}
+
+// varName returns the n-th variable name: a, ..., z, a1, ..., z1, a2, ...
+func varName(n int) string {
+	name := string(rune('a' + n%26))
+	if n >= 26 {
+		name += strconv.Itoa(n / 26)
+	}
+	return name
+}
+
+// prune returns the type t stands for, following the instances of
+// variables.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Variable)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+// resolve returns t with all the variables that were unified replaced by
+// their instances.
+func resolve(t Type) Type {
+	switch t := prune(t).(type) {
+	case *Array:
+		return &Array{Element: resolve(t.Element)}
+	case *Hash:
+		return &Hash{Key: resolve(t.Key), Value: resolve(t.Value)}
+	case *Function:
+		params := make([]Type, len(t.Parameters))
+		for i, p := range t.Parameters {
+			params[i] = resolve(p)
+		}
+		return &Function{Parameters: params, Result: resolve(t.Result), Variadic: t.Variadic}
+	default:
+		return t
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/vet"
+)
+
+func vetCommand(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	only := flags.String("only", "", "comma separated list of analyzers to run")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey vet [-only analyzers] file...")
+		fmt.Fprintln(flags.Output(), "\nanalyzers:")
+		for _, a := range vet.Analyzers {
+			fmt.Fprintf(flags.Output(), "  %-12s %s\n", a.Name(), strings.Join(a.Codes(), ", "))
+		}
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var analyzers []vet.Analyzer
+	if *only != "" {
+		for _, name := range strings.Split(*only, ",") {
+			a, ok := vet.Lookup(strings.TrimSpace(name))
+			if !ok {
+				fmt.Fprintf(os.Stderr, "monkey vet: unknown analyzer %q\n", name)
+				return 2
+			}
+			analyzers = append(analyzers, a)
+		}
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := readSource(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey vet: %v\n", err)
+			status = 1
+			continue
+		}
+
+		diagnostics, err := vet.Check(src, analyzers...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			status = 1
+			continue
+		}
+
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%s (%s)\n", filename, d, d.Analyzer)
+			status = 1
+		}
+	}
+
+	return status
+}
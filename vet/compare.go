@@ -0,0 +1,40 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/ast"
+
+// SelfCompare reports comparisons whose operands are the same expression,
+// such as `x == x`. Operands containing calls are skipped, since calling
+// twice may give different results.
+type SelfCompare struct{}
+
+const CodeSelfCompare = "V005"
+
+func (SelfCompare) Name() string    { return "selfcompare" }
+func (SelfCompare) Codes() []string { return []string{CodeSelfCompare} }
+
+var comparisons = map[string]bool{"==": true, "!=": true, "<": true, ">": true}
+
+func (SelfCompare) Run(pass *Pass) {
+	ast.Inspect(pass.Program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || !comparisons[infix.Operator] {
+			return true
+		}
+
+		if !hasCall(infix.Left) && infix.Left.String() == infix.Right.String() {
+			pass.Reportf(infix.Token.Pos, CodeSelfCompare, "comparison of %s with itself", infix.Left)
+		}
+		return true
+	})
+}
+
+func hasCall(expr ast.Expression) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if _, ok := n.(*ast.CallExpression); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
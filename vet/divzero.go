@@ -0,0 +1,33 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/ast"
+
+// DivideByZero reports divisions by the literal 0, or a decimal zero like
+// 0.00.
+type DivideByZero struct{}
+
+const CodeDivideByZero = "V006"
+
+func (DivideByZero) Name() string    { return "divzero" }
+func (DivideByZero) Codes() []string { return []string{CodeDivideByZero} }
+
+func (DivideByZero) Run(pass *Pass) {
+	ast.Inspect(pass.Program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || infix.Operator != "/" {
+			return true
+		}
+
+		switch lit := infix.Right.(type) {
+		case *ast.InetegerLiteral:
+			if lit.Value == 0 {
+				pass.Reportf(infix.Token.Pos, CodeDivideByZero, "division by zero")
+			}
+		case *ast.DecimalLiteral:
+			if lit.Unscaled.Sign() == 0 {
+				pass.Reportf(infix.Token.Pos, CodeDivideByZero, "division by zero")
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,43 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/ast"
+
+// UnreachableArm reports match arms that can never be chosen: arms after an
+// unguarded arm whose pattern matches anything, that is a wildcard or a bare
+// name, and arms repeating the literal pattern of an earlier unguarded arm.
+type UnreachableArm struct{}
+
+const CodeUnreachableArm = "V007"
+
+func (UnreachableArm) Name() string    { return "unreachable-arm" }
+func (UnreachableArm) Codes() []string { return []string{CodeUnreachableArm} }
+
+func (UnreachableArm) Run(pass *Pass) {
+	ast.Inspect(pass.Program, func(n ast.Node) bool {
+		if m, ok := n.(*ast.MatchExpression); ok {
+			checkArms(pass, m.Arms)
+		}
+		return true
+	})
+}
+
+func checkArms(pass *Pass, arms []*ast.MatchArm) {
+	seen := map[string]bool{}
+	for i, arm := range arms {
+		switch p := arm.Pattern.(type) {
+		case *ast.InetegerLiteral, *ast.BigIntegerLiteral, *ast.DecimalLiteral, *ast.Boolean, *ast.StringLiteral:
+			if seen[p.String()] {
+				pass.Reportf(ast.Pos(p), CodeUnreachableArm, "unreachable match arm: %s is matched above", p.String())
+				continue
+			}
+			if arm.Guard == nil {
+				seen[p.String()] = true
+			}
+		case *ast.WildcardPattern, *ast.Identifier:
+			if arm.Guard == nil && i < len(arms)-1 {
+				pass.Reportf(ast.Pos(arms[i+1].Pattern), CodeUnreachableArm, "unreachable match arm: %s matches everything", p.String())
+				return
+			}
+		}
+	}
+}
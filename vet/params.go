@@ -0,0 +1,35 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/ast"
+
+// DuplicateParam reports function literals that declare the same parameter
+// name more than once, counting the names of destructured parameters.
+type DuplicateParam struct{}
+
+const CodeDuplicateParam = "V003"
+
+func (DuplicateParam) Name() string    { return "dupparam" }
+func (DuplicateParam) Codes() []string { return []string{CodeDuplicateParam} }
+
+func (DuplicateParam) Run(pass *Pass) {
+	ast.Inspect(pass.Program, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+
+		seen := map[string]bool{}
+		for _, p := range fn.Parameters {
+			for _, name := range ast.PatternNames(p) {
+				if seen[name.Value] {
+					pass.Reportf(name.Token.Pos, CodeDuplicateParam, "duplicate parameter %q", name.Value)
+				}
+				seen[name.Value] = true
+			}
+		}
+		if fn.Rest != nil && seen[fn.Rest.Value] {
+			pass.Reportf(fn.Rest.Token.Pos, CodeDuplicateParam, "duplicate parameter %q", fn.Rest.Value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,29 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/resolver"
+
+// ConstRedeclare reports declarations of a name that a const or import
+// statement of the same scope declared before. Compiling the program would
+// fail with "cannot redeclare constant".
+type ConstRedeclare struct{}
+
+const CodeConstRedeclare = "V009"
+
+func (ConstRedeclare) Name() string    { return "redeclare" }
+func (ConstRedeclare) Codes() []string { return []string{CodeConstRedeclare} }
+
+func (ConstRedeclare) Run(pass *Pass) {
+	consts := map[*resolver.Scope]map[string]*resolver.Symbol{}
+	for _, sym := range pass.Info.Symbols() {
+		if c := consts[sym.Scope][sym.Name]; c != nil {
+			pass.Reportf(sym.Pos(), CodeConstRedeclare, "cannot redeclare constant %s declared at %s", sym.Name, c.Pos())
+			continue
+		}
+		if sym.Kind == resolver.Const || sym.Kind == resolver.Import {
+			if consts[sym.Scope] == nil {
+				consts[sym.Scope] = map[string]*resolver.Symbol{}
+			}
+			consts[sym.Scope][sym.Name] = sym
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/resolver"
+
+// Shadow reports let bindings and parameters that hide a binding of an
+// enclosing scope.
+type Shadow struct{}
+
+const CodeShadow = "V002"
+
+func (Shadow) Name() string    { return "shadow" }
+func (Shadow) Codes() []string { return []string{CodeShadow} }
+
+func (Shadow) Run(pass *Pass) {
+	for _, sym := range pass.Info.Symbols() {
+		if sym.Shadows == nil || sym.Shadows.Kind == resolver.Predeclared {
+			continue
+		}
+		pass.Reportf(sym.Pos(), CodeShadow, "declaration of %q shadows declaration at %s", sym.Name, sym.Shadows.Pos())
+	}
+}
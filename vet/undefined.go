@@ -0,0 +1,17 @@
+package vet
+
+// Undefined reports names that are not declared in any enclosing scope and
+// are not builtins. Running the program would fail at that point with
+// "identifier not found".
+type Undefined struct{}
+
+const CodeUndefined = "V008"
+
+func (Undefined) Name() string    { return "undefined" }
+func (Undefined) Codes() []string { return []string{CodeUndefined} }
+
+func (Undefined) Run(pass *Pass) {
+	for _, err := range pass.Info.Errors {
+		pass.Reportf(err.Pos, CodeUndefined, "undefined: %s", err.Name)
+	}
+}
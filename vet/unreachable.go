@@ -0,0 +1,35 @@
+package vet
+
+import "github.com/riadafridishibly/go-monkey/ast"
+
+// Unreachable reports statements that follow a return, throw, break or
+// continue statement in the same block. Only the first unreachable statement
+// of a block is reported.
+type Unreachable struct{}
+
+const CodeUnreachable = "V004"
+
+func (Unreachable) Name() string    { return "unreachable" }
+func (Unreachable) Codes() []string { return []string{CodeUnreachable} }
+
+func (Unreachable) Run(pass *Pass) {
+	ast.Inspect(pass.Program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Program:
+			checkUnreachable(pass, n.Statements)
+		case *ast.BlockStatement:
+			checkUnreachable(pass, n.Statements)
+		}
+		return true
+	})
+}
+
+func checkUnreachable(pass *Pass, list []ast.Statement) {
+	for i := 0; i < len(list)-1; i++ {
+		switch list[i].(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BranchStatement:
+			pass.Reportf(ast.Pos(list[i+1]), CodeUnreachable, "unreachable code")
+			return
+		}
+	}
+}
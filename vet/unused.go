@@ -0,0 +1,30 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/resolver"
+)
+
+// UnusedLet reports let and const bindings inside functions and blocks that are never
+// referenced. Top-level bindings are left alone, since the host program may
+// read them after the script ran. Names starting with an underscore are
+// exempt.
+type UnusedLet struct{}
+
+const CodeUnusedLet = "V001"
+
+func (UnusedLet) Name() string    { return "unused" }
+func (UnusedLet) Codes() []string { return []string{CodeUnusedLet} }
+
+func (UnusedLet) Run(pass *Pass) {
+	for _, sym := range pass.Info.Symbols() {
+		if (sym.Kind != resolver.Let && sym.Kind != resolver.Const) || len(sym.Uses) > 0 || strings.HasPrefix(sym.Name, "_") {
+			continue
+		}
+		if sym.Scope == pass.Info.Program {
+			continue
+		}
+		pass.Reportf(sym.Pos(), CodeUnusedLet, "%s declared and not used", sym.Name)
+	}
+}
@@ -0,0 +1,191 @@
+// Package vet reports suspicious constructs in Monkey programs.
+//
+// Every check is an Analyzer with its own diagnostic codes. A diagnostic can
+// be silenced with a comment on the same line or on the line above it:
+//
+//	let unused = 1; // vet:ignore V001
+//	// vet:ignore
+//	x == x;
+//
+// Without codes the comment silences every diagnostic on those lines.
+package vet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+	"github.com/riadafridishibly/go-monkey/resolver"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+// Analyzer is a single check.
+type Analyzer interface {
+	// Name is the analyzer name used on the command line.
+	Name() string
+	// Codes lists the diagnostic codes the analyzer may report.
+	Codes() []string
+	// Run inspects pass.Program and reports its findings through pass.
+	Run(pass *Pass)
+}
+
+// Diagnostic is a single finding.
+type Diagnostic struct {
+	Pos      token.Position
+	Code     string
+	Message  string
+	Analyzer string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s %s", d.Pos, d.Code, d.Message)
+}
+
+// Pass holds the program under analysis and collects the diagnostics of one
+// analyzer.
+type Pass struct {
+	Program *ast.Program
+	Info    *resolver.Info
+
+	analyzer    Analyzer
+	diagnostics []Diagnostic
+}
+
+// Reportf records a diagnostic at pos.
+func (pass *Pass) Reportf(pos token.Position, code, format string, args ...interface{}) {
+	pass.diagnostics = append(pass.diagnostics, Diagnostic{
+		Pos:      pos,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Analyzer: pass.analyzer.Name(),
+	})
+}
+
+// Analyzers is the default set of checks, run by `monkey vet`.
+var Analyzers = []Analyzer{
+	UnusedLet{},
+	Shadow{},
+	DuplicateParam{},
+	Unreachable{},
+	SelfCompare{},
+	DivideByZero{},
+	UnreachableArm{},
+	Undefined{},
+	ConstRedeclare{},
+}
+
+// Lookup returns the analyzer of Analyzers with the given name.
+func Lookup(name string) (Analyzer, bool) {
+	for _, a := range Analyzers {
+		if a.Name() == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// Check parses src and runs the analyzers over it, or all of Analyzers when
+// none are given. Suppressed diagnostics are dropped and the rest are sorted
+// by position. The error lists the parse errors, if any, or is the error
+// expanding the macros of src.
+func Check(src string, analyzers ...Analyzer) ([]Diagnostic, error) {
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	prog, err := evaluator.Expand(prog)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(analyzers) == 0 {
+		analyzers = Analyzers
+	}
+
+	info := resolver.Resolve(prog, object.BuiltinNames()...)
+
+	var diagnostics []Diagnostic
+	for _, a := range analyzers {
+		pass := &Pass{Program: prog, Info: info, analyzer: a}
+		a.Run(pass)
+		diagnostics = append(diagnostics, pass.diagnostics...)
+	}
+
+	suppressed := suppressions(src)
+	kept := diagnostics[:0]
+	for _, d := range diagnostics {
+		if !suppressed.covers(d) {
+			kept = append(kept, d)
+		}
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Pos.Offset < kept[j].Pos.Offset
+	})
+
+	return kept, nil
+}
+
+const ignoreDirective = "vet:ignore"
+
+// suppressionSet maps a line to the codes ignored on it. A nil code list
+// ignores everything.
+type suppressionSet map[int][]string
+
+func (s suppressionSet) covers(d Diagnostic) bool {
+	codes, ok := s[d.Pos.Line]
+	if !ok {
+		return false
+	}
+	if codes == nil {
+		return true
+	}
+	for _, code := range codes {
+		if code == d.Code {
+			return true
+		}
+	}
+	return false
+}
+
+func suppressions(src string) suppressionSet {
+	set := suppressionSet{}
+
+	lex := lexer.NewWithMode(src, lexer.ScanComments)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		if tok.Type != token.COMMENT {
+			continue
+		}
+
+		text := strings.TrimSpace(strings.TrimPrefix(tok.Literal, "//"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+
+		codes := strings.FieldsFunc(text[len(ignoreDirective):], isCodeSeparator)
+		if len(codes) == 0 {
+			codes = nil // ignore everything
+		}
+
+		for _, line := range []int{tok.Pos.Line, tok.Pos.Line + 1} {
+			if existing, ok := set[line]; ok && (existing == nil || codes == nil) {
+				set[line] = nil
+				continue
+			}
+			set[line] = append(set[line], codes...)
+		}
+	}
+
+	return set
+}
+
+func isCodeSeparator(r rune) bool {
+	return r == ' ' || r == ',' || r == '\t'
+}
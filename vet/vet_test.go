@@ -0,0 +1,187 @@
+package vet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzers(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		analyzer Analyzer
+		expected []string
+	}{
+		{
+			name: "unused let",
+			input: `let top = 1;
+let f = fn(a) {
+	let used = a;
+	let unused = 2;
+	let _ignored = 3;
+	used
+};`,
+			analyzer: UnusedLet{},
+			expected: []string{"4:6: V001 unused declared and not used"},
+		},
+		{
+			name: "unused let in block",
+			input: `if (true) { let x = 1; }
+let rec = fn() { let r = fn() { r() }; r };`,
+			analyzer: UnusedLet{},
+			expected: []string{"1:17: V001 x declared and not used"},
+		},
+		{
+			name:     "unused const",
+			input:    `const top = 1; let f = fn() { const c = 2; const d = 3; d };`,
+			analyzer: UnusedLet{},
+			expected: []string{"1:37: V001 c declared and not used"},
+		},
+		{
+			name: `shadow`,
+			input: `let x = 1;
+let f = fn(x) { let y = x; if (y) { let y = 2; y } };
+let x = 2;`,
+			analyzer: Shadow{},
+			expected: []string{
+				`2:12: V002 declaration of "x" shadows declaration at 1:5`,
+				`2:41: V002 declaration of "y" shadows declaration at 2:21`,
+			},
+		},
+		{
+			name:     "duplicate parameter",
+			input:    `fn(a, b, a) { a + b }`,
+			analyzer: DuplicateParam{},
+			expected: []string{`1:10: V003 duplicate parameter "a"`},
+		},
+		{
+			name: "unreachable",
+			input: `fn() {
+	return 1;
+	let x = 2;
+	x;
+};
+fn() { if (true) { return 1; } 2 };
+try { throw 1; 2 } catch (e) { e };
+while (true) { break; 1 }`,
+			analyzer: Unreachable{},
+			expected: []string{"3:2: V004 unreachable code", "7:16: V004 unreachable code", "8:23: V004 unreachable code"},
+		},
+		{
+			name:     "self compare",
+			input:    `a == a; a[1] < a[1]; f() == f(); a == b; a + a;`,
+			analyzer: SelfCompare{},
+			expected: []string{
+				"1:3: V005 comparison of a with itself",
+				"1:14: V005 comparison of (a[1]) with itself",
+			},
+		},
+		{
+			name:     "division by zero",
+			input:    `10 / 0; 10 / 1; 0 / 10; 1.5 / 0.00; 1.5 / 0.01;`,
+			analyzer: DivideByZero{},
+			expected: []string{"1:4: V006 division by zero", "1:29: V006 division by zero"},
+		},
+		{
+			name:     "duplicate destructured param",
+			input:    `fn([a, b], {a}) { a };`,
+			analyzer: DuplicateParam{},
+			expected: []string{`1:13: V003 duplicate parameter "a"`},
+		},
+		{
+			name:     "duplicate rest param",
+			input:    `fn(a, b = 1, ...a) { a + b };`,
+			analyzer: DuplicateParam{},
+			expected: []string{`1:17: V003 duplicate parameter "a"`},
+		},
+		{
+			name: "unreachable arm",
+			input: `match (x) { 1 => 1, "1" => 2, 1 => 3, _ => 4, 5 => 5 };
+match (x) { 1 if y => 1, 1 => 2, n => n, [] => 0 };
+match (x) { [a] => a, _ => 0 };`,
+			analyzer: UnreachableArm{},
+			expected: []string{
+				"1:31: V007 unreachable match arm: 1 is matched above",
+				"1:47: V007 unreachable match arm: _ matches everything",
+				"2:42: V007 unreachable match arm: n matches everything",
+			},
+		},
+		{
+			name: "undefined",
+			input: `let f = fn(a) { a + b };
+puts(alsonope, len(f), f(a: 1));`,
+			analyzer: Undefined{},
+			expected: []string{
+				"1:21: V008 undefined: b",
+				"2:6: V008 undefined: alsonope",
+			},
+		},
+		{
+			name: "redeclare",
+			input: `const k = 1; import "m.mk" as m;
+if (true) { let k = 2; k }
+let k = 3; const m = k;`,
+			analyzer: ConstRedeclare{},
+			expected: []string{
+				"3:5: V009 cannot redeclare constant k declared at 1:7",
+				"3:18: V009 cannot redeclare constant m declared at 1:31",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics, err := Check(tt.input, tt.analyzer)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, d := range diagnostics {
+				actual = append(actual, d.String())
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	input := `let a = 1; let b = 2; let c = 3; let d = 4; a == a; // vet:ignore V005
+// vet:ignore
+b == b;
+c / 0 == c / 0; // vet:ignore V006
+d == d; // vet:ignore V001`
+
+	diagnostics, err := Check(input)
+	require.NoError(t, err)
+
+	var actual []string
+	for _, d := range diagnostics {
+		actual = append(actual, d.String())
+	}
+	require.Equal(t, []string{
+		"4:7: V005 comparison of (c / 0) with itself",
+		"5:3: V005 comparison of d with itself",
+	}, actual)
+}
+
+func TestCheckParseError(t *testing.T) {
+	_, err := Check("let = 1;")
+	require.Error(t, err)
+}
+
+func TestCheckMacroCapabilities(t *testing.T) {
+	_, err := Check(`let m = macro() { write_file("x", "y"); quote(1) }; m()`)
+	require.EqualError(t, err, `1:53: macro m: permission denied: write_file requires capability "fs-write"`)
+}
+
+func TestLookup(t *testing.T) {
+	for _, a := range Analyzers {
+		found, ok := Lookup(a.Name())
+		require.True(t, ok)
+		require.Equal(t, a, found)
+		require.NotEmpty(t, a.Codes())
+	}
+
+	_, ok := Lookup("nope")
+	require.False(t, ok)
+}
@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/riadafridishibly/go-monkey/object"
+)
+
+// Limits bounds the resources a program may use. Zero values mean the
+// defaults: no step or allocation limit and a call depth of MaxFrames. The
+// size of a decimal counts a byte for each digit after the point on top of
+// the bytes of its digits.
+type Limits struct {
+	MaxSteps int64 // instructions executed
+	MaxDepth int   // nested function calls
+	MaxAlloc int   // length of strings and big numbers in bytes, of arrays and hashes in elements
+}
+
+// StepLimitError is returned when a program executes more than
+// Limits.MaxSteps instructions.
+type StepLimitError struct {
+	Limit int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+func (e *StepLimitError) Kind() object.ErrorKind { return object.KindLimit }
+
+// DepthLimitError is returned when calls nest deeper than Limits.MaxDepth.
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("maximum call depth of %d exceeded", e.Limit)
+}
+
+func (e *DepthLimitError) Kind() object.ErrorKind { return object.KindLimit }
+
+// AllocLimitError is returned when a program creates a string, a big
+// number, an array or a hash larger than Limits.MaxAlloc.
+type AllocLimitError struct {
+	Type  object.ObjectType
+	Size  int
+	Limit int
+}
+
+func (e *AllocLimitError) Error() string {
+	return fmt.Sprintf("allocation limit exceeded: %s of size %d, limit is %d", e.Type, e.Size, e.Limit)
+}
+
+func (e *AllocLimitError) Kind() object.ErrorKind { return object.KindLimit }
+
+// PermissionError is returned when a program calls a builtin whose
+// capability was not granted.
+type PermissionError struct {
+	Builtin    string
+	Capability object.Capability
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: %s requires capability %q", e.Builtin, e.Capability)
+}
+
+func (e *PermissionError) Kind() object.ErrorKind { return object.KindPermission }
+
+// SetCapabilities restricts the builtins programs may call to those with one
+// of caps. Builtins without a capability can always be called. By default
+// all capabilities are granted.
+func (vm *VM) SetCapabilities(caps ...object.Capability) {
+	vm.capabilities = map[object.Capability]bool{}
+	for _, c := range caps {
+		vm.capabilities[c] = true
+	}
+}
+
+// Capabilities returns the capabilities granted to programs.
+func (vm *VM) Capabilities() []object.Capability {
+	caps := []object.Capability{}
+	for _, c := range object.Capabilities {
+		if vm.granted(c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+func (vm *VM) granted(c object.Capability) bool {
+	return c == "" || vm.capabilities == nil || vm.capabilities[c]
+}
+
+func (vm *VM) maxDepth() int {
+	if vm.limits.MaxDepth > 0 {
+		return vm.limits.MaxDepth
+	}
+	return MaxFrames
+}
+
+// check enforces the step limit and stops the program when ctx is done. It
+// is called once every checkInterval instructions, or once the step limit is
+// reached.
+func (vm *VM) check(ctx context.Context) error {
+	if max := vm.limits.MaxSteps; max > 0 && vm.steps > max {
+		return &StepLimitError{Limit: max}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	vm.checkAt = vm.steps + checkInterval
+	if max := vm.limits.MaxSteps; max > 0 && vm.checkAt > max {
+		vm.checkAt = max
+	}
+	return nil
+}
+
+// Alloc implements object.Host: it enforces the allocation limit on a value
+// a builtin is about to create.
+func (vm *VM) Alloc(t object.ObjectType, size int) error {
+	if max := vm.limits.MaxAlloc; max > 0 && size > max {
+		return &AllocLimitError{Type: t, Size: size, Limit: max}
+	}
+	return nil
+}
+
+// checkAlloc enforces the allocation limit on a value created by the
+// program.
+func (vm *VM) checkAlloc(obj object.Object) error {
+	if vm.limits.MaxAlloc <= 0 {
+		return nil
+	}
+
+	var size int
+	switch obj := obj.(type) {
+	case *object.String:
+		size = len(obj.Value)
+	case *object.Array:
+		size = len(obj.Elements)
+	case *object.Hash:
+		size = len(obj.Keys)
+	case *object.BigInt:
+		size = (obj.Value.BitLen() + 7) / 8
+	case *object.Decimal:
+		size = (obj.Unscaled.BitLen()+7)/8 + obj.Scale
+	default:
+		return nil
+	}
+	return vm.Alloc(obj.Type(), size)
+}
+
+// grow makes room for n more values on the stack.
+func (vm *VM) grow(n int) {
+	if vm.sp+n <= len(vm.stack) {
+		return
+	}
+	size := 2 * len(vm.stack)
+	for size < vm.sp+n {
+		size *= 2
+	}
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+}
@@ -0,0 +1,952 @@
+// Package vm implements the stack based virtual machine executing the
+// bytecode produced by the compiler.
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/riadafridishibly/go-monkey/code"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/token"
+)
+
+const (
+	StackSize   = 2048 // initial size of the stack, which grows as needed
+	GlobalsSize = 65536
+	MaxFrames   = 1024 // default maximum call depth
+)
+
+// checkInterval is the number of instructions executed between checks of
+// the context.
+const checkInterval = 1024
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	globals []object.Object
+	consts  map[int]string // names of the globals that can not be assigned
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // installed exception handlers, innermost last
+
+	lastPopped object.Object
+
+	limits  Limits
+	steps   int64
+	checkAt int64
+
+	capabilities map[object.Capability]bool // nil grants all
+
+	ctx      context.Context // of the current run
+	out      io.Writer
+	importer object.Importer
+	parent   *VM // the importing VM, see Inherit
+}
+
+// handler is an exception handler installed by OpTry.
+type handler struct {
+	frame int // framesIndex of the frame installing it
+	sp    int // stack pointer to unwind to
+	ip    int // handler code in the instructions of frame
+}
+
+// Error is a runtime error, located at the source span of the instruction
+// that failed. Err is the underlying error, such as a *StepLimitError or the
+// error of a done context.
+type Error struct {
+	Kind    object.ErrorKind
+	Pos     token.Position
+	End     token.Position // unknown for some instructions
+	Message string
+	Trace   []TraceEntry // innermost call first
+	Err     error
+}
+
+// TraceEntry is a function call in progress when an error was raised.
+type TraceEntry struct {
+	Function string         // "<main>" for the program itself
+	Pos, End token.Position // span of the instruction being executed
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore returns a VM sharing the globals of an earlier run, as
+// the REPL does line by line.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	ns := &object.Namespace{Constants: bytecode.Constants, Globals: globals}
+	mainClosure := &object.Closure{Fn: mainFn, Namespace: ns}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, 64)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: globals,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// LastPoppedStackElem returns the value of the last expression statement,
+// or of a top-level return statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// SetOutput sets the writer builtins such as puts print to. The default is
+// the standard output.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// Output returns the writer builtins print to.
+func (vm *VM) Output() io.Writer {
+	if vm.out == nil {
+		return os.Stdout
+	}
+	return vm.out
+}
+
+// SetConst makes assigning to the global at index, called name, fail with
+// a TypeError, as well as assigning to the cell it holds. Hosts use it for
+// the globals that earlier programs declared const, which the compiler of a
+// later program only sees as externals.
+func (vm *VM) SetConst(index int, name string) {
+	if vm.consts == nil {
+		vm.consts = map[int]string{}
+	}
+	vm.consts[index] = name
+}
+
+// constCell returns the name of the constant global held in cell, if any.
+func (vm *VM) constCell(cell *object.Cell) (string, bool) {
+	for index, name := range vm.consts {
+		if vm.globals[index] == object.Object(cell) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// SetImporter makes the import statements of the program load modules with
+// imp. Without an importer they fail with an ImportError.
+func (vm *VM) SetImporter(imp object.Importer) {
+	vm.importer = imp
+}
+
+// Importer is an importer running modules in VMs of their own. The VM
+// imports modules with ImportFrom rather than Import, passing itself as
+// parent, so that the importer can make the module VMs inherit from it.
+type Importer interface {
+	object.Importer
+	ImportFrom(parent *VM, path string) (*object.Module, error)
+}
+
+// Inherit makes vm, the VM of a module imported by the program of parent,
+// run with the context, limits, capabilities and output of parent. The
+// steps vm executes count against the step limit of parent.
+func (vm *VM) Inherit(parent *VM) {
+	vm.parent = parent
+	vm.out = parent.out
+	vm.capabilities = parent.capabilities
+	vm.limits = parent.limits
+	vm.steps = parent.steps
+}
+
+// SetLimits sets the limits enforced by the following runs.
+func (vm *VM) SetLimits(l Limits) {
+	vm.limits = l
+}
+
+// Limits returns the limits enforced by the runs of vm.
+func (vm *VM) Limits() Limits {
+	return vm.limits
+}
+
+// Context returns the context of the current run, or the background
+// context when vm is not running.
+func (vm *VM) Context() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if max := vm.maxDepth(); vm.framesIndex > max {
+		return &DepthLimitError{Limit: max}
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+	vm.enterNamespace()
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	frame := vm.frames[vm.framesIndex]
+	vm.enterNamespace()
+	return frame
+}
+
+// enterNamespace makes the constants and globals of the closure of the
+// current frame the ones instructions refer to.
+func (vm *VM) enterNamespace() {
+	if ns := vm.currentFrame().cl.Namespace; ns != nil {
+		vm.constants, vm.globals = ns.Constants, ns.Globals
+	}
+}
+
+// Run runs the program without a context, or with the context of the VM it
+// inherits from.
+func (vm *VM) Run() error {
+	if vm.parent != nil && vm.parent.ctx != nil {
+		return vm.RunContext(vm.parent.ctx)
+	}
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it ends, fails, exceeds one of the
+// limits or ctx is done.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
+	vm.checkAt = vm.steps
+	vm.handlers = vm.handlers[:0]
+	err := vm.run(0)
+	if vm.parent != nil && vm.steps > vm.parent.steps {
+		vm.parent.steps = vm.steps
+	}
+	return err
+}
+
+// Call calls fn with args on top of the running program and returns its
+// result, as builtins such as map do.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	if vm.ctx == nil {
+		vm.ctx = context.Background()
+	}
+	base := vm.sp
+	depth := vm.framesIndex
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.executeCall(len(args)); err != nil {
+		vm.sp = base
+		return nil, err
+	}
+	if vm.framesIndex > depth {
+		if err := vm.run(depth); err != nil {
+			vm.unwind(depth)
+			vm.sp = base
+			return nil, err
+		}
+	}
+
+	result := vm.pop()
+	vm.sp = base
+	return result, nil
+}
+
+// run executes instructions until the program ends, or until the frames
+// above depth have returned.
+func (vm *VM) run(depth int) error {
+	var (
+		ip    int
+		ins   code.Instructions
+		op    code.Opcode
+		frame *Frame
+	)
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		frame = vm.currentFrame()
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+
+		vm.steps++
+		if vm.steps > vm.checkAt {
+			err = vm.check(vm.ctx)
+		}
+		if err != nil {
+			return vm.newError(err)
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE)
+		case code.OpFalse:
+			err = vm.push(object.FALSE)
+		case code.OpNull:
+			err = vm.push(object.NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			right := vm.pop()
+			left := vm.pop()
+
+			var result object.Object
+			result, err = object.InfixWith(vm, infixOperators[op], left, right)
+			if err == nil {
+				err = vm.checkAlloc(result)
+			}
+			if err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpBang, code.OpMinus:
+			operator := "!"
+			if op == code.OpMinus {
+				operator = "-"
+			}
+
+			var result object.Object
+			result, err = object.PrefixWith(vm, operator, vm.pop())
+			if err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !object.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if name, ok := vm.consts[int(globalIndex)]; ok {
+				err = object.Errorf(object.KindType, "cannot assign to constant %s", name)
+				break
+			}
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.globalOrNull(globalIndex))
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			currentClosure := vm.currentFrame().cl
+			err = vm.push(currentClosure.Free[freeIndex])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(object.Builtins[builtinIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+			if err = vm.checkAlloc(array); err == nil {
+				err = vm.push(array)
+			}
+
+		case code.OpTemplate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			parts := vm.stack[vm.sp-numParts : vm.sp]
+			str := object.Template(parts)
+			vm.sp = vm.sp - numParts
+			if err = vm.checkAlloc(str); err == nil {
+				err = vm.push(str)
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err == nil {
+				err = vm.checkAlloc(hash)
+			}
+			if err == nil {
+				vm.sp = vm.sp - numElements
+				err = vm.push(hash)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			var result object.Object
+			result, err = object.IndexWith(vm, left, index)
+			if err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			path := vm.constants[constIndex].(*object.String).Value
+			if vm.importer == nil {
+				err = object.Errorf(object.KindImport, "cannot import %q: no module loader", path)
+				break
+			}
+			var mod *object.Module
+			if imp, ok := vm.importer.(Importer); ok {
+				mod, err = imp.ImportFrom(vm, path)
+			} else {
+				mod, err = vm.importer.Import(path)
+			}
+			if err == nil {
+				err = vm.push(mod)
+			}
+
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err = vm.push(object.NativeBoolToBoolean(object.MatchArray(vm.pop(), numElements, rest)))
+
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp -= numKeys
+			err = vm.push(object.NativeBoolToBoolean(object.MatchHash(vm.pop(), keys)))
+
+		case code.OpNoMatch:
+			err = object.NoMatch(vm.pop())
+
+		case code.OpDestructureArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err = object.DestructureArray(vm.pop(), numElements, rest)
+
+		case code.OpDestructureHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp -= numKeys
+			err = object.DestructureHash(vm.pop(), keys)
+
+		case code.OpArrayRest:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err = vm.push(object.ArrayRest(vm.pop(), start))
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			// a new key grows the hash past the allocation limit
+			if err = object.SetIndex(left, index, value); err == nil {
+				err = vm.checkAlloc(left)
+			}
+			if err == nil {
+				err = vm.push(value)
+			}
+
+		case code.OpDup2:
+			err = vm.push(vm.stack[vm.sp-2])
+			if err == nil {
+				err = vm.push(vm.stack[vm.sp-2])
+			}
+
+		case code.OpMakeCell:
+			err = vm.push(&object.Cell{Value: vm.pop()})
+
+		case code.OpLoadCell:
+			var cell *object.Cell
+			if cell, err = vm.popCell(); err == nil {
+				err = vm.push(cell.Value)
+			}
+
+		case code.OpStoreCell:
+			var cell *object.Cell
+			if cell, err = vm.popCell(); err != nil {
+				break
+			}
+			if name, ok := vm.constCell(cell); ok {
+				err = object.Errorf(object.KindType, "cannot assign to constant %s", name)
+				break
+			}
+			cell.Value = vm.pop()
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpCallNamed:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			numNamed := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+			err = vm.executeNamedCall(numArgs, numNamed)
+
+		case code.OpJumpIfPassed:
+			index := code.ReadUint8(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+
+			if vm.stack[frame.basePointer+int(index)] != nil {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// return at the top level ends the program
+				vm.lastPopped = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(object.NULL)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{frame: vm.framesIndex, sp: vm.sp, ip: pos})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			pos, _ := frame.cl.Fn.Lines.Lookup(ip)
+			err = object.Throw(vm.pop(), pos)
+
+		case code.OpIter:
+			var iter *object.Iterator
+			iter, err = object.NewIterator(vm.pop())
+			if err == nil {
+				err = vm.push(iter)
+			}
+
+		case code.OpNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			obj := vm.pop()
+			iter, ok := obj.(*object.Iterator)
+			if !ok {
+				err = fmt.Errorf("%s is not an iterator", obj.Type())
+				break
+			}
+			if item, ok := iter.Next(); ok {
+				err = vm.push(item)
+			} else {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		default:
+			err = fmt.Errorf("unknown opcode %d", op)
+		}
+
+		if err == nil {
+			continue
+		}
+		if vm.catch(err, depth) {
+			continue
+		}
+		if e, ok := err.(*Error); ok {
+			// raised by a function called from a builtin
+			return e
+		}
+		return vm.newError(err)
+	}
+
+	return nil
+}
+
+// catch hands err to the innermost exception handler installed since the
+// run at depth started and reports whether there was one. The stack is
+// unwound to the handler, which finds the exception on top of it. Limit
+// errors can not be caught.
+func (vm *VM) catch(err error, depth int) bool {
+	n := len(vm.handlers)
+	if n == 0 || vm.handlers[n-1].frame <= depth || object.KindOf(err) == object.KindLimit {
+		return false
+	}
+
+	frame := vm.currentFrame()
+	pos, _ := frame.cl.Fn.Lines.Lookup(frame.ip)
+	exc := exception(err, pos)
+
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+	vm.framesIndex = h.frame
+	vm.enterNamespace()
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+	vm.push(exc)
+	return true
+}
+
+// unwind removes the frames above depth, and their handlers, after an
+// error ended the run at depth.
+func (vm *VM) unwind(depth int) {
+	n := len(vm.handlers)
+	for n > 0 && vm.handlers[n-1].frame > depth {
+		n--
+	}
+	vm.handlers = vm.handlers[:n]
+	vm.framesIndex = depth
+	vm.enterNamespace()
+}
+
+// exception returns the exception of err, raised at pos unless err says
+// otherwise.
+func exception(err error, pos token.Position) *object.Exception {
+	var exc *object.Exception
+	if errors.As(err, &exc) {
+		return exc
+	}
+	if e, ok := err.(*Error); ok {
+		// raised by a function called from a builtin
+		return &object.Exception{Kind: e.Kind, Message: e.Message, Pos: e.Pos}
+	}
+	return &object.Exception{Kind: object.KindOf(err), Message: err.Error(), Pos: pos}
+}
+
+// newError returns the runtime error of err raised by the current
+// instruction, with the trace of the calls in progress.
+func (vm *VM) newError(err error) *Error {
+	trace := make([]TraceEntry, vm.framesIndex)
+	for i := range trace {
+		frame := vm.frames[vm.framesIndex-1-i]
+		entry, _ := frame.cl.Fn.Lines.Entry(frame.ip)
+
+		name := frame.cl.Fn.Name
+		switch {
+		case frame == vm.frames[0]:
+			name = "<main>"
+		case name == "":
+			name = "<anonymous>"
+		}
+		trace[i] = TraceEntry{Function: name, Pos: entry.Pos, End: entry.End}
+	}
+
+	return &Error{
+		Kind:    object.KindOf(err),
+		Pos:     trace[0].Pos,
+		End:     trace[0].End,
+		Message: err.Error(),
+		Trace:   trace,
+		Err:     err,
+	}
+}
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// globalOrNull returns the global at index, or null while it is still
+// unset, as when a let value refers to its own name.
+func (vm *VM) globalOrNull(index uint16) object.Object {
+	if obj := vm.globals[index]; obj != nil {
+		return obj
+	}
+	return object.NULL
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		vm.grow(1)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// popCell pops the cell of a variable. Decoded programs are not checked
+// for what their slots hold, so it is checked here.
+func (vm *VM) popCell() (*object.Cell, error) {
+	obj := vm.pop()
+	cell, ok := obj.(*object.Cell)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a cell", obj.Type())
+	}
+	return cell, nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, object.Errorf(object.KindType, "unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs, nil, nil)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return object.Errorf(object.KindType, "calling non-function: %s", callee.Type())
+	}
+}
+
+// executeNamedCall calls the function below numArgs arguments and numNamed
+// pairs of a name and a value.
+func (vm *VM) executeNamedCall(numArgs, numNamed int) error {
+	names := make([]string, numNamed)
+	values := make([]object.Object, numNamed)
+	start := vm.sp - 2*numNamed
+	for i := range names {
+		name, ok := vm.stack[start+2*i].(*object.String)
+		if !ok {
+			return fmt.Errorf("argument name %s is not a string", vm.stack[start+2*i].Inspect())
+		}
+		names[i], values[i] = name.Value, vm.stack[start+2*i+1]
+	}
+	vm.sp = start
+
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs, names, values)
+	case *object.Builtin:
+		return object.Errorf(object.KindArgument, "%s: named arguments are not supported by builtins", callee.Name)
+	default:
+		return object.Errorf(object.KindType, "calling non-function: %s", callee.Type())
+	}
+}
+
+// callClosure calls cl with the numArgs arguments on the stack followed by
+// the arguments named names, whose values are named. The arguments become
+// the first locals of the frame: one per parameter, nil for parameters
+// taking their default value, then the array of the rest arguments.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, names []string, named []object.Object) error {
+	fn := cl.Fn
+	if len(names) == 0 && numArgs == fn.NumParameters && (fn.Signature == nil || fn.Signature.Rest == "") {
+		return vm.pushClosureFrame(cl, numArgs)
+	}
+	if fn.Signature == nil {
+		return object.Errorf(object.KindArgument, "wrong number of arguments: want=%d, got=%d",
+			fn.NumParameters, numArgs)
+	}
+
+	indexes, err := fn.Signature.Bind(fn.Name, numArgs, names)
+	if err != nil {
+		return err
+	}
+
+	base := vm.sp - numArgs
+	var rest *object.Array
+	if fn.Signature.Rest != "" {
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > fn.NumParameters {
+			rest.Elements = append(rest.Elements, vm.stack[base+fn.NumParameters:vm.sp]...)
+		}
+		if err := vm.checkAlloc(rest); err != nil {
+			return err
+		}
+	}
+
+	passed := numArgs
+	if passed > fn.NumParameters {
+		passed = fn.NumParameters
+	}
+	vm.sp = base + passed
+	vm.grow(fn.NumLocals - passed)
+	for i := passed; i < fn.NumParameters; i++ {
+		vm.stack[base+i] = nil
+	}
+	for i, index := range indexes {
+		vm.stack[base+index] = named[i]
+	}
+	vm.sp = base + fn.NumParameters
+	if rest != nil {
+		vm.stack[vm.sp] = rest
+		vm.sp++
+	}
+
+	return vm.pushClosureFrame(cl, vm.sp-base)
+}
+
+// pushClosureFrame pushes the frame of a call of cl whose first numArgs
+// locals are on the stack.
+func (vm *VM) pushClosureFrame(cl *object.Closure, numArgs int) error {
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.grow(cl.Fn.NumLocals - numArgs)
+
+	// clear the slots of the locals, which may hold values of earlier calls
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = object.NULL
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	if !vm.granted(builtin.Capability) {
+		return &PermissionError{Builtin: builtin.Name, Capability: builtin.Capability}
+	}
+
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result, err := builtin.Fn(vm, args...)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		result = object.NULL
+	}
+	if err := vm.checkAlloc(result); err != nil {
+		return err
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(result)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free, Namespace: vm.currentFrame().cl.Namespace}
+	return vm.push(closure)
+}
@@ -0,0 +1,1059 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riadafridishibly/go-monkey/ast"
+	"github.com/riadafridishibly/go-monkey/compiler"
+	"github.com/riadafridishibly/go-monkey/evaluator"
+	"github.com/riadafridishibly/go-monkey/lexer"
+	"github.com/riadafridishibly/go-monkey/object"
+	"github.com/riadafridishibly/go-monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected string
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", "1"},
+		{"1 + 2", "3"},
+		{"4 / 2 * 3 - 1", "5"},
+		{"-(5 + 5) * 2", "-20"},
+		{"5 * (2 + 10)", "60"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", "true"},
+		{"1 < 2", "true"},
+		{"1 > 2", "false"},
+		{"1 == 1", "true"},
+		{"(1 < 2) == true", "true"},
+		{"!5", "false"},
+		{"!!true", "true"},
+		{"!(if (false) { 5; })", "true"},
+		{`"a" == "a"`, "true"},
+		{`1 == true`, "false"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", "10"},
+		{"if (1 > 2) { 10 }", "null"},
+		{"if (1 > 2) { 10 } else { 20 }", "20"},
+		{"if (0) { 10 } else { 20 }", "10"},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", "20"},
+		{"if (true) { let a = 1; }", "null"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", "1"},
+		{"let one = 1; let two = one + one; one + two", "3"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCompositeValues(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, `"monkey"`},
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"[1, 2, 3][1]", "2"},
+		{"[1, 2, 3][3]", "null"},
+		{"[[1, 1, 1]][0][0]", "1"},
+		{"{1 + 1: 2 * 2, 3: 4}", "{2: 4, 3: 4}"},
+		{`{"a": 1}["a"]`, "1"},
+		{`{"a": 1}["b"]`, "null"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f();", "15"},
+		{"let f = fn() { return 99; 100; }; f();", "99"},
+		{"let f = fn() { }; f();", "null"},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", "10"},
+		{"let a = 50; let f = fn() { let a = 1; a }; f() + a;", "51"},
+		{"let f = fn(a) { if (a) { return 1; } 2 }; f(true) + f(false)", "3"},
+		{"return 1; 2", "1"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newAdder = fn(a) { fn(b) { a + b } };
+			let addTwo = newAdder(2);
+			addTwo(3);`,
+			"5",
+		},
+		{
+			`let newClosure = fn(a, b) {
+				let one = fn() { a; };
+				let two = fn() { b; };
+				fn() { one() + two(); };
+			};
+			newClosure(9, 90)();`,
+			"99",
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+				countDown(1);
+			};
+			wrapper();`,
+			"0",
+		},
+		{
+			`let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			"610",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; if (true) { let a = 2; a } + a", "3"},
+		{"let a = 1; if (true) { let a = 2; }; a", "1"},
+		{
+			`let f = fn(x) {
+				let fs = if (x) { let y = x * 2; fn() { y } };
+				fs() + x;
+			};
+			f(3);`,
+			"9",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"1 / 0", "1:3: division by zero"},
+		{"1()", "1:2: calling non-function: INTEGER"},
+		{"fn(a) { a }()", "1:12: wrong number of arguments to fn(a): want=1, got=0"},
+		{"{[]: 1}", "1:1: unusable as hash key: ARRAY"},
+		{"let f = fn() { f() }; f()", "1:17: maximum call depth of 1024 exceeded"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestErrorTrace(t *testing.T) {
+	input := `let inner = fn(x) { x + true };
+let outer = fn() { inner(1) };
+outer();`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var vmErr *Error
+	if err := New(comp.Bytecode()).Run(); !errors.As(err, &vmErr) {
+		t.Fatalf("expected an *Error, got=%v", err)
+	}
+
+	if vmErr.Kind != object.KindType {
+		t.Errorf("wrong kind. want=%s, got=%s", object.KindType, vmErr.Kind)
+	}
+	if vmErr.Pos.String() != "1:23" || vmErr.End.String() != "1:24" {
+		t.Errorf("wrong span. got=%s-%s", vmErr.Pos, vmErr.End)
+	}
+
+	expected := []string{"inner 1:23", "outer 2:25", "<main> 3:6"}
+	if len(vmErr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d", len(expected), len(vmErr.Trace))
+	}
+	for i, entry := range vmErr.Trace {
+		if got := fmt.Sprintf("%s %s", entry.Function, entry.Pos); got != expected[i] {
+			t.Errorf("trace[%d]: want=%q, got=%q", i, expected[i], got)
+		}
+	}
+
+	kinds := map[string]object.ErrorKind{
+		"1 / 0":                     object.KindArithmetic,
+		"fn(a) { a }()":             object.KindArgument,
+		"int(\"x\")":                object.KindValue,
+		"let f = fn() { f() }; f()": object.KindLimit,
+		"[1][\"a\"]":                object.KindType,
+	}
+	for input, kind := range kinds {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if !errors.As(err, &vmErr) || vmErr.Kind != kind {
+			t.Errorf("%s: want kind %s, got=%v", input, kind, err)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	double := &object.Builtin{Name: "double", Fn: func(_ object.Host, args ...object.Object) (object.Object, error) {
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("double: want INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: n.Value * 2}, nil
+	}}
+
+	run := func(input string) (object.Object, error) {
+		comp := compiler.New()
+		comp.EnableExternals()
+		if err := comp.Compile(parse(t, input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		globals := make([]object.Object, GlobalsSize)
+		for _, ext := range comp.Externals() {
+			globals[ext.Index] = double
+		}
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		err := machine.Run()
+		return machine.LastPoppedStackElem(), err
+	}
+
+	result, err := run("let f = fn(x) { double(x) + 1 }; f(20)")
+	if err != nil || result.Inspect() != "41" {
+		t.Errorf("wrong result. got=%v, err=%v", result, err)
+	}
+
+	_, err = run("\n  double(true)")
+	if err == nil || err.Error() != "2:9: double: want INTEGER, got BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestCoreBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("four") + len([1, 2])`, "6"},
+		{`let a = [1, 2, 3]; [first(a), last(a), rest(a), push(a, 4), a]`, "[1, 3, [2, 3], [1, 2, 3, 4], [1, 2, 3]]"},
+		{`[type(1), type(fn() {}), type(len), str(12) + str("!"), int("7") * 2]`, `["INTEGER", "FUNCTION", "FUNCTION", "12!", 14]`},
+		{`let h = {"a": 1, "b": 2}; [keys(h), values(h)]`, `[["a", "b"], [1, 2]]`},
+		{`map(range(4), fn(x) { x * x })`, "[0, 1, 4, 9]"},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, "[11, 12]"},
+		{`filter(range(10), fn(x) { x / 3 * 3 == x })`, "[0, 3, 6, 9]"},
+		{`reduce(range(1, 5), fn(acc, x) { acc * x }, 1)`, "24"},
+		{`map([[1, 2], [3]], fn(a) { reduce(map(a, fn(x) { x * 10 }), fn(s, x) { s + x }, 0) })`, "[30, 30]"},
+		{`let f = fn(n) { if (n == 0) { return 0; } reduce([n - 1], fn(_, x) { f(x) }, 0) + 1 }; f(200)`, "200"},
+		{`map(["a"], len)`, "[1]"},
+		{`1 + reduce([], fn(a, b) { a }, 1) + 1`, "3"},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, "1:4: len: argument 1 must be STRING, ARRAY or HASH, got INTEGER"},
+		{`map([1], 2)`, "1:4: map: argument 2 must be FUNCTION, got INTEGER"},
+		{"map([1], fn(x) {\n  x + true\n})", "2:5: type mismatch: INTEGER + BOOLEAN"},
+		{`map([1], fn(a, b) { a })`, "1:4: wrong number of arguments to fn(a, b): want=2, got=1"},
+		{`filter([1], fn(x) { first(x) })`, "1:26: first: argument 1 must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, `puts("a", 1); map([2, 3], fn(x) { puts(x) })`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetOutput(&out)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "a\n1\n2\n3\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+	if got := machine.LastPoppedStackElem().Inspect(); got != "[null, null]" {
+		t.Errorf("wrong result. got=%s", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop := "let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; "
+
+	run := func(ctx context.Context, input string, limits Limits) error {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		machine.SetLimits(limits)
+		return machine.RunContext(ctx)
+	}
+
+	bg := context.Background()
+
+	// deep recursion within the default depth needs a larger stack
+	if err := run(bg, loop+"f(1000)", Limits{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := run(bg, loop+"f(5000)", Limits{MaxDepth: 10000}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var depthErr *DepthLimitError
+	err := run(bg, loop+"f(100)", Limits{MaxDepth: 50})
+	if !errors.As(err, &depthErr) || depthErr.Limit != 50 {
+		t.Errorf("expected a DepthLimitError, got=%v", err)
+	}
+
+	var stepErr *StepLimitError
+	err = run(bg, loop+"f(100)", Limits{MaxSteps: 500})
+	if !errors.As(err, &stepErr) || err.Error() != "1:21: step limit of 500 exceeded" {
+		t.Errorf("expected a StepLimitError, got=%v", err)
+	}
+	if err := run(bg, "1; 2", Limits{MaxSteps: 4}); err != nil {
+		t.Errorf("program within the step limit failed: %s", err)
+	}
+	if err := run(bg, "1; 2", Limits{MaxSteps: 3}); !errors.As(err, &stepErr) {
+		t.Errorf("expected a StepLimitError, got=%v", err)
+	}
+
+	var allocErr *AllocLimitError
+	tests := []string{
+		`"abc" + "def"`,
+		`[1, 2, 3, 4, 5, 6]`,
+		`{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6}`,
+	}
+	for _, input := range tests {
+		err = run(bg, input, Limits{MaxAlloc: 5})
+		if !errors.As(err, &allocErr) || allocErr.Size != 6 {
+			t.Errorf("%s: expected an AllocLimitError, got=%v", input, err)
+		}
+		if err := run(bg, input, Limits{MaxAlloc: 6}); err != nil {
+			t.Errorf("%s: unexpected error: %s", input, err)
+		}
+	}
+	err = run(bg, "let h = {}; let i = 0; while (i < 10) { h[i] = i; i += 1 }", Limits{MaxAlloc: 5})
+	if !errors.As(err, &allocErr) || allocErr.Type != object.HASH_OBJ || allocErr.Size != 6 {
+		t.Errorf("expected an AllocLimitError for index assignment, got=%v", err)
+	}
+	err = run(bg, "let n = 4294967296; n * n * n", Limits{MaxAlloc: 9})
+	if !errors.As(err, &allocErr) || allocErr.Size != 13 {
+		t.Errorf("expected an AllocLimitError for a big integer, got=%v", err)
+	}
+
+	// decimals count the digits after the point, and products can not
+	// make more than object.MaxScale of them
+	err = run(bg, "0.00001 * 0.00001", Limits{MaxAlloc: 10})
+	if !errors.As(err, &allocErr) || allocErr.Size != 11 {
+		t.Errorf("expected an AllocLimitError for a decimal, got=%v", err)
+	}
+	err = run(bg, "let d = 0.1; let i = 0; while (i < 24) { d = d * d; i += 1 } d < 1", Limits{MaxSteps: 10000})
+	if err == nil || object.KindOf(err) != object.KindValue || !strings.Contains(err.Error(), "exceeds the precision of 1000") {
+		t.Errorf("expected a ValueError for a decimal too precise, got=%v", err)
+	}
+
+	// builtins check the limit before they build their result
+	err = run(bg, "range(100000000)", Limits{MaxAlloc: 1000})
+	if !errors.As(err, &allocErr) || allocErr.Size != 100000000 {
+		t.Errorf("expected an AllocLimitError for range, got=%v", err)
+	}
+	err = run(bg, "let a = [0]; let i = 0; while (i < 60) { a = [a, a]; i += 1 } str(a)", Limits{MaxAlloc: 1 << 20})
+	if !errors.As(err, &allocErr) || allocErr.Type != object.STRING_OBJ {
+		t.Errorf("expected an AllocLimitError for str, got=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(bg, 10*time.Millisecond)
+	defer cancel()
+	err = run(ctx, "let loop = fn() { loop() }; loop()", Limits{MaxDepth: 1 << 30})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the program, got=%v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, `len("abc"); let r = fn() { random(10) }; r()`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("all capabilities are granted by default: %s", err)
+	}
+
+	machine = New(comp.Bytecode())
+	machine.SetCapabilities(object.CapPure)
+	err := machine.Run()
+
+	var permErr *PermissionError
+	if !errors.As(err, &permErr) || permErr.Capability != object.CapRandom {
+		t.Fatalf("expected a PermissionError, got=%v", err)
+	}
+	if err.Error() != `1:34: permission denied: random requires capability "random"` {
+		t.Errorf("wrong error. got=%q", err)
+	}
+
+	machine = New(comp.Bytecode())
+	machine.SetCapabilities(object.CapPure, object.CapRandom)
+	if err := machine.Run(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { 1 / 0 } catch (e) { [e["kind"], e["message"], e["line"], e["column"]] }`, `["ArithmeticError", "division by zero", 1, 9]`},
+		{"try {\n  len(1)\n} catch (e) { e[\"line\"] }", "2"},
+		{`try { throw {"code": 7}; 1 } catch (e) { [e["kind"], e["value"]["code"], e["message"]] }`, `["Error", 7, "{\"code\": 7}"]`},
+		{`try { throw "x" } catch { 2 }`, "2"},
+		{`let a = 1; let b = try { let a = 2; throw a } catch (e) { e["value"] + a }; b`, "3"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e["message"] }`, `"deep"`},
+		{`try { try { throw 1 } catch (e) { throw e } } catch (e) { e["value"] }`, "1"},
+		{`try { try { throw 1 } finally { 2 } } catch (e) { e["value"] + 10 }`, "11"},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, "1"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, "2"},
+		{`let f = fn() { try { throw 1 } catch (e) { return e["value"] + 1; } }; [f(), f()]`, "[2, 2]"},
+		{`map([1, 0, 2], fn(x) { try { 6 / x } catch (e) { -1 } })`, "[6, -1, 3]"},
+		{`try { map([1, 0], fn(x) { 1 / x }) } catch (e) { e["message"] }`, `"division by zero"`},
+		{`let n = try { 1 } finally { 2 }; n`, "1"},
+		{`let f = fn(x) { if (x) { throw "stop" } x }; [f(false), try { f(true) } catch (e) { type(e) }]`, `[false, "EXCEPTION"]`},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	input := `try { puts("try"); throw "x" } catch (e) { puts("catch") } finally { puts("finally") };
+try { puts("try") } finally { puts("finally") }`
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetOutput(&out)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "try\ncatch\nfinally\ntry\nfinally\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	errorTests := []struct {
+		input    string
+		kind     object.ErrorKind
+		expected string
+	}{
+		{`throw "boom"`, object.KindError, "1:1: boom"},
+		{`try { 1 / 0 } finally { 1 }`, object.KindArithmetic, "1:1: division by zero"},
+		{`try { throw 1 } catch (e) { e + 1 }`, object.KindType, "1:31: type mismatch: EXCEPTION + INTEGER"},
+		{`let f = fn() { f() }; try { f() } catch (e) { 1 }`, object.KindLimit, "1:17: maximum call depth of 1024 exceeded"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var vmErr *Error
+		if err := New(comp.Bytecode()).Run(); !errors.As(err, &vmErr) {
+			t.Errorf("%s: expected an *Error, got=%v", tt.input, err)
+			continue
+		}
+		if vmErr.Kind != tt.kind || vmErr.Error() != tt.expected {
+			t.Errorf("%s: want=%s %q, got=%s %q", tt.input, tt.kind, tt.expected, vmErr.Kind, vmErr.Error())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()`, "20"},
+		{`let f = fn() { while (true) { return 5; } }; f()`, "5"},
+		{`let f = fn() { while (false) { return 5; } }; f()`, "null"},
+		{`let f = fn(h) { for (k in h) { return k; } }; [f({"b": 1, "a": 2}), f({})]`, `["b", null]`},
+		{`let f = fn(s) { for (c in s) { if (c != "h") { return c; } } }; f("hé")`, `"é"`},
+		{`let f = fn() { for (x in range(100000)) { if (x == 99999) { return x; } } }; f()`, "99999"},
+		{`let f = fn() { for (x in [1, 2]) { for (y in [3, 4]) { if (y == 4) { continue; } break; } return x; } }; f()`, "1"},
+		{`let f = fn() { for (x in [1, 2]) { if (x == 2) { return x; } try { continue; } finally { 3 } } }; f()`, "2"},
+		{`let f = fn() { let g = 0; for (x in [1, 2]) { let g = fn() { x }; if (x == 2) { return g(); } } }; f()`, "2"},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	input := `for (x in range(6)) {
+  if (x == 4) { break; }
+  try { if (x == 1) { continue; } puts(x) } finally { puts("-") }
+}
+while (true) { try { break; } finally { puts("done") } }`
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetOutput(&out)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "0\n-\n-\n2\n-\n3\n-\ndone\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	comp = compiler.New()
+	if err := comp.Compile(parse(t, `for (x in 5) { x }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "1:11: cannot iterate over INTEGER" || object.KindOf(err) != object.KindType {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	comp = compiler.New()
+	if err := comp.Compile(parse(t, `while (true) { }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine = New(comp.Bytecode())
+	machine.SetLimits(Limits{MaxSteps: 10000})
+	if err := machine.Run(); object.KindOf(err) != object.KindLimit {
+		t.Errorf("expected a limit error, got=%v", err)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{`let x = 1; x = 2; x`, "2"},
+		{`let x = 1; let y = x += 4; [x, y]`, "[5, 5]"},
+		{`let x = 10; x -= 3; x *= 2; x /= 7; x`, "2"},
+		{`let s = "a"; s += "b"; s`, `"ab"`},
+		{`let a = 1; let b = 2; a = b = 3; [a, b]`, "[3, 3]"},
+		{`let x = 1; if (true) { x = 2; let x = 3; x = 4; }; x`, "2"},
+		{`let i = 0; let sum = 0; while (i < 5) { sum += i; i += 1; } sum`, "10"},
+		{`let a = [1, 2, 3]; a[0] = 10; a[2] *= 5; a`, "[10, 2, 15]"},
+		{`let h = {"a": 1}; h["a"] += 1; h["b"] = [1]; h["b"][0] = 9; h`, `{"a": 2, "b": [9]}`},
+		{`let a = [0]; let b = a; b[0] = 1; a`, "[1]"},
+		{`let f = fn() { let n = 0; fn() { n += 1 } }; let c = f(); c(); c(); c()`, "3"},
+		{`let f = fn() { let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n }; f()`, "2"},
+		{`let f = fn(x) { let g = fn() { x }; x *= 3; g() }; f(2)`, "6"},
+		{`let f = fn() { let a = 1; let g = fn() { fn() { a = 5 } }; g()(); a }; f()`, "5"},
+		{`let f = fn() { let n = 0; for (x in [1, 2, 3]) { let add = fn() { n += x }; add(); } n }; f()`, "6"},
+		{`let f = fn() { let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) } [fs[0](), fs[1]()] }; f()`, "[1, 2]"},
+		{`let f = fn() { let g = fn() { g = 1; 2 }; [g(), g] }; f()`, "[2, 1]"},
+		{`let count = 0; let f = fn() { count += 1 }; f(); f(); count`, "2"},
+		{`let f = fn() { try { throw 1 } catch (e) { let g = fn() { e = 2 }; g(); e } }; f()`, "2"},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = [1]; a[1] = 2`, "1:19: array index out of range: 1 with length 1"},
+		{`let a = "x"; a[0] = "y"`, "1:19: index assignment not supported: STRING"},
+		{`let x = true; x += 1`, "1:17: type mismatch: BOOLEAN + INTEGER"},
+		{`let h = {}; h["a"] += 1`, "1:20: type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestConst(t *testing.T) {
+	tests := []vmTestCase{
+		{`const a = 2; const f = fn(x) { x * a }; f(3)`, "6"},
+		{`const a = 1; if (true) { let a = 2; a += 1; a } + a`, "4"},
+		{`let f = fn() { const n = 5; fn() { n } }; f()()`, "5"},
+		{`let h = freeze({"a": [1], "b": {}}); [frozen(h), frozen(h["a"]), frozen(h["b"]), frozen(1)]`, "[true, true, true, true]"},
+		{`let a = [1]; let b = freeze(a); [a == b, frozen(a), frozen(push(a, 2))]`, "[true, true, false]"},
+		{`let h = freeze({"a": 1}); try { h["b"] = 2 } catch (e) { [e["kind"], e["message"], h] }`, `["TypeError", "cannot modify frozen HASH", {"a": 1}]`},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	comp.EnableExternals()
+	if err := comp.Compile(parse(t, "let a = 1;\nlimit = a")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	ext := comp.Externals()[0]
+
+	globals := make([]object.Object, GlobalsSize)
+	globals[ext.Index] = &object.Integer{Value: 10}
+	vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+	vm.SetConst(ext.Index, ext.Name)
+	err := vm.Run()
+	if err == nil || err.Error() != "2:7: cannot assign to constant limit" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+	if kind := err.(*Error).Kind; kind != object.KindType {
+		t.Errorf("wrong kind. got=%s", kind)
+	}
+	if globals[ext.Index].Inspect() != "10" {
+		t.Errorf("constant changed. got=%s", globals[ext.Index].Inspect())
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, `"two"`},
+		{`match (-1) { -1 => true, _ => false }`, "true"},
+		{`match ("b") { "a" => 1, "b" => { let x = 2; x * 10 } }`, "20"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ([1, 2]) { [a] => a, [a, b] if a > b => a, [_, b] => b }`, "2"},
+		{`match ({"k": 5, "x": 1}) { {"k": 1} => 0, {"k": n} if n > 3 => n * 2 }`, "10"},
+		{`match ({"k": 1}) { {"j": _} => 1, _ => 2 }`, "2"},
+		{`let f = fn(x) { match (x) { [] => 0, [_] => 1, n => n } }; [f([]), f([7]), f(5), f([1, 2])]`, "[0, 1, 5, [1, 2]]"},
+		{`let f = fn(x) { match (x) { [a] => fn() { a += 1; a } } }; let g = f([1]); g(); g()`, "3"},
+		{`match (1) { 1 => {} }`, "null"},
+		{`let x = 1; match (2) { x => x }; x`, "1"},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 2; match (x) { 1 => 1 }`, "1:12: no match for 2"},
+		{`match ([1, 2]) { [a] => a, {"a": _} => 0 }`, "1:1: no match for [1, 2]"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := err.(*Error).Kind; kind != object.KindValue {
+			t.Errorf("%s: wrong kind. got=%s", tt.input, kind)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b] = [1, 2]; a + b`, "3"},
+		{`let [a, [b], ...r] = [1, [2], 3, 4]; [a + b, r]`, "[3, [3, 4]]"},
+		{`let [_, ...r] = [1]; r`, "[]"},
+		{`let {name, age} = {"name": "n", "age": 2, "x": 0}; [name, age]`, `["n", 2]`},
+		{`let {"a b": [c, ..._], 1: d} = {"a b": [1, 2], 1: true}; [c, d]`, "[1, true]"},
+		{`let f = fn([a, b], {k}, c) { a * b + k + c }; f([2, 3], {"k": 1}, 10)`, "17"},
+		{`let f = fn() { let [a, ...r] = [1, 2]; fn() { a += 1; [a, r] } }(); f(); f()`, "[3, [2]]"},
+		{`let f = fn([a]) { fn() { a += 1 } }; let g = f([1]); g(); g()`, "3"},
+		{`let [a] = [1]; if (true) { let [a] = [2]; a } + a`, "3"},
+		{`let r = [1]; let [...s] = r; s = push(s, 2); [r, s]`, "[[1], [1, 2]]"},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+		kind     object.ErrorKind
+	}{
+		{`let [a, b] = [1];`, "1:5: wrong number of elements to destructure: want=2, got=1", object.KindValue},
+		{`let [a, ...b] = [];`, "1:5: wrong number of elements to destructure: want>=1, got=0", object.KindValue},
+		{`let [a, {b}] = [1, 2];`, "1:9: cannot destructure INTEGER as a hash", object.KindType},
+		{`let {name} = {"age": 1};`, `1:5: missing key "name" to destructure`, object.KindValue},
+		{`let f = fn(x, [a]) { a }; f(1, "s")`, "1:15: cannot destructure STRING as an array", object.KindType},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := err.(*Error).Kind; kind != tt.kind {
+			t.Errorf("%s: wrong kind. want=%s, got=%s", tt.input, tt.kind, kind)
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"`plain`", `"plain"`},
+		{"``", `""`},
+		{"let n = 3; `${n} items`", `"3 items"`},
+		{"let h = {\"k\": [1]}; `${h} ${h[\"k\"]} ${true} ${fn() {}()}`", `"{\"k\": [1]} [1] true null"`},
+		{"let w = \"world\"; `hello, ${`dear ${w}`}!`", `"hello, dear world!"`},
+		{"`\\${x} \\``", "\"${x} `\""},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, "let s = `line ${\n1 / 0}`;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "2:3: division by zero" {
+		t.Errorf("wrong error. want=%q, got=%v", "2:3: division by zero", err)
+	}
+}
+
+func TestOverloading(t *testing.T) {
+	tests := []vmTestCase{
+		{`let Vec = {"+": fn(a, b) { new(Vec, {"x": a["x"] + b["x"]}) }, "<": fn(a, b) { a["x"] < b["x"] }, "neg": fn(v) { new(Vec, {"x": -v["x"]}) }}; let v = new(Vec, {"x": 1}); let w = new(Vec, {"x": 3}); [(v + w)["x"], (v + w + w)["x"], v < w, w < v, v > w, (-w)["x"]]`, "[4, 7, true, false, false, -3]"},
+		{`let Money = {"+": fn(a, b) { new(Money, {"c": a["c"] + b}) }}; let m = new(Money, {"c": 5}); m += 10; m["c"]`, "15"},
+		{`let Grid = {"[]": fn(g, p) { p[0] * g["w"] + p[1] }}; let g = new(Grid, {"w": 10}); [g[[2, 3]], g["w"]]`, "[23, 10]"},
+		{`let Base = {"kind": "base"}; let Mid = new(Base, {}); let o = new(Mid, {}); [o["kind"], o["none"], prototype(o) == Mid, prototype({})]`, `["base", null, true, null]`},
+		{`let p = new({}, {}); try { p - 1 } catch (e) { e["message"] }`, `"unknown operator: HASH - INTEGER: no \"-\" method in the prototype"`},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"let n = 1; let i = 0; while (i < 70) { n *= 2; i += 1 } [n, n / 1180591620717411303424]", "[1180591620717411303424, 1]"},
+		{"-9223372036854775808 - 1 + 1", "-9223372036854775808"},
+		{"[type(99999999999999999999), type(1.5), 1.5 + 1, 10.00 / 4]", `["INTEGER", "DECIMAL", 2.5, 2.50]`},
+		{"let amounts = [10.10, 20.20, 30.30]; reduce(amounts, fn(a, x) { a + x }, 0)", "60.60"},
+		{`[round(2.5), round(3.5), round(2.345, 2, "half_up"), round(5, 2)]`, "[2, 4, 2.35, 5.00]"},
+		{`let h = {2.0: "two"}; [h[2], 2 == 2.00, 0.5 < 1]`, `["two", true, true]`},
+		{`match (100000000000000000000) { 100000000000000000000 => "big", _ => "small" }`, `"big"`},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, "let x = 2.5 / 0.0;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "1:13: division by zero" {
+		t.Errorf("wrong error. want=%q, got=%v", "1:13: division by zero", err)
+	}
+}
+
+func TestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 2) { [a, b] }; [f(1), f(1, 3)]`, "[[1, 2], [1, 3]]"},
+		{`let f = fn(a, b = a * 2, c = a + b) { [a, b, c] }; [f(1), f(1, 5), f(1, c: 0)]`, "[[1, 2, 3], [1, 5, 6], [1, 2, 0]]"},
+		{`let f = fn(first, ...others) { [first, others] }; [f(1), f(1, 2, 3)]`, "[[1, []], [1, [2, 3]]]"},
+		{`let f = fn(...all) { len(all) }; [f(), f(1, 2)]`, "[0, 2]"},
+		{`let f = fn(a, b) { a - b }; [f(b: 1, a: 10), f(10, b: 3)]`, "[9, 7]"},
+		{`let f = fn([a, b] = [1, 2], {k} = {"k": 3}) { a + b + k }; [f(), f([0, 0])]`, "[6, 3]"},
+		{`let mk = fn(n) { fn(k = n) { k } }; [mk(1)(), mk(1)(2)]`, "[1, 2]"},
+		{`let f = fn(a = 1, ...r) { let g = fn() { a += 1; r = push(r, a) }; g(); [a, r] }; f(5, 0)`, "[6, [0, 6]]"},
+		{`let b = 10; let f = fn(a = b, b = 1) { a }; f()`, "10"},
+		{`map([1, 2], fn(x, y = 10) { x + y })`, "[11, 12]"},
+		{`let f = fn(a, b = 2, ...c) { 0 }; signature(f)`, `{"name": "f", "params": ["a", "b"], "defaults": [null, "2"], "required": 1, "rest": "c"}`},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+		kind     object.ErrorKind
+	}{
+		{`let f = fn(a, b = 2) { a }; f(1, 2, 3)`, "1:30: wrong number of arguments to f(a, b = 2): want=1 to 2, got=3", object.KindArgument},
+		{`let f = fn(a, ...r) { a }; f()`, "1:29: wrong number of arguments to f(a, ...r): want at least 1, got=0", object.KindArgument},
+		{`let f = fn(a, b) { a }; f(1, c: 2)`, "1:26: f(a, b) has no parameter c", object.KindArgument},
+		{`let f = fn(a, b) { a }; f(1, a: 2)`, "1:26: argument a to f(a, b) given twice", object.KindArgument},
+		{`let f = fn(a, b) { a }; f(b: 2)`, "1:26: missing argument a to f(a, b)", object.KindArgument},
+		{`len(s: "a")`, "1:4: len: named arguments are not supported by builtins", object.KindArgument},
+		{`fn([a] = 1) { a }()`, "1:4: cannot destructure INTEGER as an array", object.KindType},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := err.(*Error).Kind; kind != tt.kind {
+			t.Errorf("%s: wrong kind. want=%s, got=%s", tt.input, tt.kind, kind)
+		}
+	}
+}
+
+// testImporter runs the modules it imports, given by their source, in VMs
+// of their own and exports all their globals.
+type testImporter map[string]string
+
+func (imp testImporter) Import(path string) (*object.Module, error) {
+	src, ok := imp[path]
+	if !ok {
+		return nil, fmt.Errorf("no module %s", path)
+	}
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(src)).ParseProgram()); err != nil {
+		return nil, err
+	}
+
+	globals := make([]object.Object, GlobalsSize)
+	vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+	vm.SetImporter(imp)
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	exports := object.NewHash()
+	for _, sym := range comp.SymbolTable().Symbols() {
+		exports.Set(&object.String{Value: sym.Name}, globals[sym.Index])
+	}
+	return &object.Module{Path: path, Exports: exports}, nil
+}
+
+func TestImports(t *testing.T) {
+	imp := testImporter{
+		"m": `
+let base = 10;
+let add = fn(a, b) { a + b + base };
+let counter = fn() { let n = base; fn() { n += 1; n } };
+let apply = fn(f, x) { [f(x), "m"] };
+let fail = fn() { throw base + 1 };
+import "n" as n;`,
+		"n": `let twice = fn(x) { x * 2 };`,
+	}
+
+	tests := []vmTestCase{
+		{`import "m" as m; m["add"](1, 2)`, "13"},
+		{`import "m" as m; let c = m["counter"](); c(); [c(), "main"]`, `[12, "main"]`},
+		{`import "m" as m; m["apply"](fn(x) { [x, 100] }, 2)`, `[[2, 100], "m"]`},
+		{`import "m" as m; map([1, 2], fn(x) { m["add"](x, 0) })`, "[11, 12]"},
+		{`import "m" as m; let r = try { m["fail"]() } catch (e) { e["value"] }; [r, 7]`, "[11, 7]"},
+		{`import "m" as m; [m["n"]["twice"](4), m["base"], "x"]`, `[8, 10, "x"]`},
+		{`import "m" as m; m`, `<module "m">`},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		vm.SetImporter(imp)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		importer object.Importer
+		expected string
+		kind     object.ErrorKind
+	}{
+		{`import "m" as m;`, nil, `1:1: cannot import "m": no module loader`, object.KindImport},
+		{`let a = 1; import "x" as x;`, imp, "1:12: no module x", object.KindError},
+		{`import "m" as m; m["nope"]`, imp, `1:19: module "m" has no export "nope"`, object.KindValue},
+		{`import "m" as m; m["add"](1)`, imp, "1:26: wrong number of arguments to add(a, b): want=2, got=1", object.KindArgument},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		if tt.importer != nil {
+			vm.SetImporter(tt.importer)
+		}
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if kind := err.(*Error).Kind; kind != tt.kind {
+			t.Errorf("%s: wrong kind. want=%s, got=%s", tt.input, tt.kind, kind)
+		}
+	}
+}
+
+// TestEvaluatorAgreement runs the same programs through the evaluator, which
+// must agree with the VM on their results.
+func TestEvaluatorAgreement(t *testing.T) {
+	inputs := []string{
+		"let a = 1; if (true) { let a = 2; a } + a",
+		"let f = fn(a, b) { if (a > b) { return a; } b }; [f(1, 2), f(4, 3)]",
+		`let m = {"x": [1, 2]}; m["x"][1] * 10`,
+		`let newAdder = fn(a) { fn(b) { a + b } }; newAdder(1)(2)`,
+		fibonacciSource,
+		`map(range(5), fn(x) { [type(x), str(x)] })`,
+		`reduce(filter(range(20), fn(x) { x / 2 * 2 == x }), fn(a, x) { a + x }, 0)`,
+		`let h = {"x": 1}; [keys(h), values(h), first(push([], h)), int("12")]`,
+		`[try { 1 / 0 } catch (e) { [e["kind"], e["message"]] }, try { throw [1] } catch (e) { e["value"] }]`,
+		`let f = fn() { try { return 1; } finally { return 2; } }; f()`,
+		`map([1, 0], fn(x) { try { len(x) } catch (e) { e["kind"] } finally { 3 } })`,
+		`let f = fn(a) { for (x in a) { if (x > 2) { return x; } if (x == 1) { continue; } break; } -1 }; [f([3]), f([1, 4]), f([2, 4]), f({})]`,
+		`let f = fn() { while (true) { try { return 1; } finally { break; } } 2 }; f()`,
+		`let f = fn() { let n = 0; let inc = fn(d) { n += d; n }; [inc(1), inc(2), n] }; f()`,
+		`const c = [1, 2]; let f = fn() { const c = 3; c }; [f(), c, frozen(c), frozen(freeze(c))]`,
+		`let a = [1, {"k": 2}]; a[1]["k"] *= 10; a[0] -= 1; let i = 0; while (i < 3) { i += 1; if (i == 2) { continue; } a = push(a, i) } a`,
+		`let f = fn(x) { match (x) { [a, {"k": b}] if a < b => [a, b], [a, _] => a, {"k": k} => k, 0 => "zero", _ => false } }; map([[1, {"k": 2}], [3, {"k": 2}], {"k": "h"}, 0, 1], f)`,
+		`let swap = fn([a, b]) { [b, a] }; let [x, ...r] = swap([1, 2]); let {k} = {"k": r}; [x, k, match ([1, 2, 3]) { [_, ...t] => t }]`,
+		"let xs = [1, \"two\"]; `${xs[0]} and ${xs[1]}: ${map(xs, fn(x) { `<${x}>` })}`",
+		`let f = fn(a, b = a + 1, ...r) { [a, b, r] }; [f(1), f(1, 5, 6), f(b: 0, a: 2), signature(f), try { f(c: 1) } catch (e) { e["message"] }]`,
+		`let rate = 0.0825; let big = 9223372036854775807 * 3; [big, big / 3, round(1234.5 * rate, 2), int(7.99), -big + big, {1.0: "a"}[1]]`,
+		`let fs = []; for (i in [1, 2, 3]) { let j = i * 10; fs = push(fs, fn() { [i, j] }) }; map(fs, fn(f) { f() })`,
+		`let gs = []; let n = 0; while (n < 3) { n += 1; let m = n; gs = push(gs, fn() { m += 10; m }) }; [map(gs, fn(g) { g() }), map(gs, fn(g) { g() })]`,
+		`let r = if (true) { let h = {"f": fn() { h["v"] }, "v": 7}; const k = 1; fn() { [h["f"](), k] } }; [r(), match ([4]) { [z] => fn() { z }() }, try { throw 9 } catch (e) { fn() { e }() }]`,
+		`let P = {"==": fn(a, b) { a["n"] == b["n"] }, ">": fn(a, b) { a["n"] > b["n"] }, "[]": fn(h, k) { k }}; let a = new(P, {"n": 1}); let b = new(P, {"n": 2}); [a == b, a != b, a < b, b > a, a["n"], a["k"], try { -a } catch (e) { e["message"] }]`,
+	}
+
+	for _, input := range inputs {
+		evaluated := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		got := runVm(t, input)
+		if evaluated.Inspect() != got.Inspect() {
+			t.Errorf("%s: evaluator=%s, vm=%s", input, evaluated.Inspect(), got.Inspect())
+		}
+	}
+}
+
+const fibonacciSource = `
+let fibonacci = fn(x) {
+	if (x < 2) { return x; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(20);
+`
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(b, fibonacciSource)
+
+	for i := 0; i < b.N; i++ {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			b.Fatal(err)
+		}
+		if err := New(comp.Bytecode()).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibonacciEvaluator(b *testing.B) {
+	program := parse(b, fibonacciSource)
+
+	for i := 0; i < b.N; i++ {
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if result.Type() == object.ERROR_OBJ {
+			b.Fatal(result.Inspect())
+		}
+	}
+}
+
+func parse(tb testing.TB, input string) *ast.Program {
+	tb.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		tb.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func runVm(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("%s: compiler error: %s", input, err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("%s: vm error: %s", input, err)
+	}
+	return vm.LastPoppedStackElem()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		got := runVm(t, tt.input)
+		if got.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, got.Inspect())
+		}
+	}
+}